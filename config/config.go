@@ -2,23 +2,73 @@ package config
 
 import (
 	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/net/http/httpguts"
 )
 
 // Config holds all application configuration
 type Config struct {
 	Environment      string                             `mapstructure:"environment"`
 	Port             int                                `mapstructure:"port"`
+	TrustedProxies   []string                           `mapstructure:"trusted_proxies"` // Proxies whose X-Forwarded-For is honored
 	Server           ServerConfig                       `mapstructure:"server"`
 	JWT              JWTConfig                          `mapstructure:"jwt"`
+	Auth             AuthConfig                         `mapstructure:"auth"`
+	Login            LoginConfig                        `mapstructure:"login"`
 	RateLimit        RateLimitConfig                    `mapstructure:"rate_limit"`
 	Redis            RedisConfig                        `mapstructure:"redis"`
+	Replay           ReplayConfig                       `mapstructure:"replay"`
+	Idempotency      IdempotencyConfig                  `mapstructure:"idempotency"`
+	Audit            AuditConfig                        `mapstructure:"audit"`
+	Maintenance      MaintenanceConfig                  `mapstructure:"maintenance"`
+	Quota            QuotaConfig                        `mapstructure:"quota"`
+	TimeoutOverride  TimeoutOverrideConfig              `mapstructure:"timeout_override"`
+	GatewaySigning   GatewaySigningConfig               `mapstructure:"gateway_signing"`
 	CORS             CORSConfig                         `mapstructure:"cors"`
 	OPA              OPAConfig                          `mapstructure:"opa"`
+	IPFilter         IPFilterConfig                     `mapstructure:"ip_filter"`
+	CSP              CSPConfig                          `mapstructure:"csp"`
+	WebSocket        WebSocketConfig                    `mapstructure:"websocket"`
+	SecurityHeaders  SecurityHeadersConfig              `mapstructure:"security_headers"`
+	Logging          LoggingConfig                      `mapstructure:"logging"`
+	Tracing          TracingConfig                      `mapstructure:"tracing"`
+	RequestID        RequestIDConfig                    `mapstructure:"request_id"`
+	Readiness        ReadinessConfig                    `mapstructure:"readiness"`
+	Metrics          MetricsConfig                      `mapstructure:"metrics"`
+	OpenAPI          OpenAPIConfig                      `mapstructure:"openapi"`
+	APIVersion       APIVersionConfig                   `mapstructure:"api_version"`
 	Services         map[string]ServiceEndpoint         `mapstructure:"services"`
+	ServiceRegistry  ServiceRegistryConfig              `mapstructure:"service_registry"`
 	ExternalServices map[string]ExternalServiceEndpoint `mapstructure:"external_services"`
+	Composites       []CompositeRoute                   `mapstructure:"composites"`
+	Routes           []RouteConfig                      `mapstructure:"routes"`
+	DefaultRoute     DefaultRouteConfig                 `mapstructure:"default_route"`
+	Secrets          SecretsConfig                      `mapstructure:"secrets"`
+}
+
+// SecretsConfig holds where secret settings given by reference are looked up
+type SecretsConfig struct {
+	Vault VaultConfig `mapstructure:"vault"`
+}
+
+// VaultConfig reaches the Vault server resolving "vault:path#field" secret references
+type VaultConfig struct {
+	Address   string        `mapstructure:"address"`    // Defaults to VAULT_ADDR
+	Token     string        `mapstructure:"token"`      // Defaults to VAULT_TOKEN
+	TokenFile string        `mapstructure:"token_file"` // e.g. written by a Vault agent; wins over token
+	Timeout   time.Duration `mapstructure:"timeout"`    // Bounds resolving all secrets. Defaults to 10s
 }
 
 // ServerConfig holds server-specific configuration
@@ -26,22 +76,180 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
 	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+	// AllowedMethods lists the request methods accepted before routing; others get 405 or 501
+	AllowedMethods []string `mapstructure:"allowed_methods"`
+	// DisallowedMethods are rejected with 405 before routing even when allowed, e.g.
+	// TRACE and CONNECT
+	DisallowedMethods []string `mapstructure:"disallowed_methods"`
+	// RequestBudget bounds the total time spent on a request across all middleware and
+	// the backend call; 0 disables it
+	RequestBudget time.Duration `mapstructure:"request_budget"`
+	// H2C accepts cleartext HTTP/2 (prior knowledge or Upgrade), required for gRPC without TLS
+	H2C bool `mapstructure:"h2c"`
+	// ShutdownTimeout bounds how long shutdown waits for in-flight requests and upgraded
+	// connections before closing them; 0 uses DefaultShutdownTimeout
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// MaxHeaderBytes bounds the request line and headers; larger requests get a JSON 431.
+	// 0 uses Go's default of 1 MiB. The request body is not counted.
+	MaxHeaderBytes int `mapstructure:"max_header_bytes"`
+	// TLS terminates TLS on port, serving HTTP/2 to clients that offer it
+	TLS TLSConfig `mapstructure:"tls"`
+	// PathNormalization cleans up request paths before routing and proxying
+	PathNormalization PathNormalizationConfig `mapstructure:"path_normalization"`
+	// Connections caps the client connections held open at once
+	Connections ConnectionLimitConfig `mapstructure:"connections"`
+}
+
+// ConnectionLimitConfig caps the client connections the server holds open, so a flood
+// of connections can't exhaust file descriptors. Upgraded connections count until closed.
+type ConnectionLimitConfig struct {
+	Max int `mapstructure:"max"` // 0 = unlimited
+	// OnLimit is "wait" (default) to stop accepting until a connection closes, leaving
+	// new ones queued in the kernel backlog, or "reject" to close them once accepted
+	OnLimit string `mapstructure:"on_limit"`
+}
+
+// Validate checks the limit and the action taken when it is reached
+func (c ConnectionLimitConfig) Validate() error {
+	if c.Max < 0 {
+		return fmt.Errorf("max connections cannot be negative")
+	}
+	switch c.OnLimit {
+	case "", "wait", "reject":
+		return nil
+	}
+	return fmt.Errorf("invalid connection limit action %q: must be wait or reject", c.OnLimit)
+}
+
+// PathNormalizationConfig holds how request paths are normalized before routing.
+// Percent-encoded characters, such as %2F within a segment, are left untouched.
+type PathNormalizationConfig struct {
+	CollapseSlashes bool   `mapstructure:"collapse_slashes"` // Merge runs of slashes, e.g. /a//b to /a/b
+	TrailingSlash   string `mapstructure:"trailing_slash"`   // "keep" (default), "strip" or "add"
+	// Action is "rewrite" to route the normalized path transparently, or "redirect" to
+	// send the client to it with RedirectStatus
+	Action         string `mapstructure:"action"`
+	RedirectStatus int    `mapstructure:"redirect_status"` // 301 or 308; 308 keeps the method and body
+}
+
+// TLSConfig holds TLS termination for client connections
+type TLSConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	CertFile       string        `mapstructure:"cert_file"`
+	KeyFile        string        `mapstructure:"key_file"`
+	ReloadInterval time.Duration `mapstructure:"reload_interval"` // How often to check the files for a renewed certificate; 0 disables reloading
+	MinVersion     string        `mapstructure:"min_version"`     // "1.2" or "1.3"
+	CipherSuites   []string      `mapstructure:"cipher_suites"`   // TLS 1.2 cipher suites by name; empty uses Go's defaults
+	ALPN           []string      `mapstructure:"alpn"`            // Protocols offered to clients; HTTP/2 is only served when "h2" is listed
+	RedirectPort   int           `mapstructure:"redirect_port"`   // Plaintext port redirecting to HTTPS; 0 disables it
+	// ClientCAFile is a PEM bundle verifying client certificates, which clients may then
+	// present to authenticate on routes accepting the mtls scheme. Certificates are
+	// requested, never required, so other clients connect as before.
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+// Auth schemes a route may accept
+const (
+	AuthSchemeJWT    = "jwt"     // Bearer token, or the token cookie with jwt.cookie_auth
+	AuthSchemeAPIKey = "api_key" // X-Api-Key header listed under auth.api_keys
+	AuthSchemeMTLS   = "mtls"    // Verified client certificate listed under auth.client_certs
+)
+
+// AuthConfig holds the credentials of the auth schemes besides JWT. Each credential
+// stands for a principal with roles and scopes, checked by routes like a token's.
+type AuthConfig struct {
+	APIKeys     []APIKeyCredential  `mapstructure:"api_keys"`
+	ClientCerts []ClientCertMapping `mapstructure:"client_certs"`
+}
+
+// AuthPrincipal is who a credential authenticates
+type AuthPrincipal struct {
+	UserID string   `mapstructure:"user_id"`
+	Roles  []string `mapstructure:"roles"`
+	Scopes []string `mapstructure:"scopes"`
+	Tenant string   `mapstructure:"tenant"` // For tenant routing; "*" lets the caller choose with the tenant header
+}
+
+// APIKeyCredential is an API key sent in the X-Api-Key header
+type APIKeyCredential struct {
+	Key           string `mapstructure:"key"`
+	AuthPrincipal `mapstructure:",squash"`
+}
+
+// ClientCertMapping maps the common name of a verified client certificate's subject to
+// a principal; the user ID defaults to the common name
+type ClientCertMapping struct {
+	Subject       string `mapstructure:"subject"`
+	AuthPrincipal `mapstructure:",squash"`
 }
 
 // JWTConfig holds JWT authentication configuration
 type JWTConfig struct {
-	SecretKey       string        `mapstructure:"secret_key"`
+	SecretKey       string        `mapstructure:"secret_key"` // Signs new tokens; also accepted for validation
 	TokenDuration   time.Duration `mapstructure:"token_duration"`
 	RefreshDuration time.Duration `mapstructure:"refresh_duration"`
-	Issuer          string        `mapstructure:"issuer"`
+	Issuer          string        `mapstructure:"issuer"`   // Required iss of accepted tokens; empty skips the check
+	Audience        string        `mapstructure:"audience"` // Required in aud of accepted tokens; empty skips the check
+	// PreviousSecrets are still accepted when validating tokens, so tokens signed before
+	// a rotation of secret_key keep working until they expire. Remove them afterwards.
+	PreviousSecrets []string `mapstructure:"previous_secrets"`
+	// CookieAuth also accepts the token from the CookieName cookie when a request has
+	// no Authorization header, for browsers that can't set the header on navigations
+	CookieAuth bool   `mapstructure:"cookie_auth"`
+	CookieName string `mapstructure:"cookie_name"`
+	// Leeway tolerates clock skew with token issuers when checking exp, nbf and iat, up
+	// to MaxJWTLeeway
+	Leeway time.Duration `mapstructure:"leeway"`
+}
+
+// DefaultShutdownTimeout applies when server.shutdown_timeout is unset or 0
+const DefaultShutdownTimeout = 30 * time.Second
+
+// MaxJWTLeeway bounds jwt.leeway; more would keep expired tokens alive noticeably longer
+const MaxJWTLeeway = 5 * time.Minute
+
+// LoginConfig holds the password login endpoint at POST /api/v1/public/auth/login.
+// Credentials are checked against the static users or by a backend service.
+type LoginConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Verifier        string        `mapstructure:"verifier"`    // "static" or "service"
+	Service         string        `mapstructure:"service"`     // Service verifying credentials for the service verifier
+	VerifyPath      string        `mapstructure:"verify_path"` // Path on the service receiving the credentials
+	Users           []LoginUser   `mapstructure:"users"`       // Users for the static verifier
+	RequestsPerMin  int           `mapstructure:"requests_per_min"`
+	MaxFailures     int           `mapstructure:"max_failures"` // Failures per client IP or username before lockout
+	LockoutDuration time.Duration `mapstructure:"lockout_duration"`
+}
+
+// LoginUser is a user of the static login verifier
+type LoginUser struct {
+	Username     string   `mapstructure:"username"`
+	PasswordHash string   `mapstructure:"password_hash"` // bcrypt hash
+	UserID       string   `mapstructure:"user_id"`
+	Email        string   `mapstructure:"email"`
+	Roles        []string `mapstructure:"roles"`
+	Tenant       string   `mapstructure:"tenant"`
+	Tier         string   `mapstructure:"tier"` // Plan tier sizing the user's quota
+	Scopes       []string `mapstructure:"scopes"`
 }
 
 // RateLimitConfig holds rate limiting configuration
 type RateLimitConfig struct {
 	Enabled         bool          `mapstructure:"enabled"`
 	RequestsPerMin  int           `mapstructure:"requests_per_min"`
-	BurstSize       int           `mapstructure:"burst_size"`
+	BurstSize       int           `mapstructure:"burst_size"` // Requests allowed at once, refilled at RequestsPerMin
 	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+	AdminListLimit  int           `mapstructure:"admin_list_limit"` // Max buckets returned per admin listing page
+	// ExemptPaths are path prefixes never rate limited, e.g. health checks. A prefix
+	// matches whole segments unless it ends in *, e.g. /health* also covers /healthz.
+	ExemptPaths   []string `mapstructure:"exempt_paths"`
+	ExemptCIDRs   []string `mapstructure:"exempt_cidrs"`    // Client IPs or CIDR ranges never rate limited, e.g. internal monitoring
+	ExemptRoles   []string `mapstructure:"exempt_roles"`    // Token roles never rate limited
+	ExemptAPIKeys []string `mapstructure:"exempt_api_keys"` // X-Api-Key values never rate limited
+	// RetryAfterJitter is the most added at random to the Retry-After of a 429, so
+	// clients throttled in the same window don't all retry at the same instant.
+	// X-RateLimit-Reset stays exact. 0 disables it.
+	RetryAfterJitter time.Duration `mapstructure:"retry_after_jitter"`
 }
 
 // RedisConfig holds Redis configuration
@@ -50,6 +258,95 @@ type RedisConfig struct {
 	Port     int    `mapstructure:"port"`
 	Password string `mapstructure:"password"`
 	DB       int    `mapstructure:"db"`
+	// ReconnectInterval is how often the rate limiter retries an unreachable Redis,
+	// limiting in memory meanwhile
+	ReconnectInterval time.Duration `mapstructure:"reconnect_interval"`
+}
+
+// ReplayConfig holds the store shared by replay protection features (nonces,
+// idempotency keys, request deduplication)
+type ReplayConfig struct {
+	Window time.Duration `mapstructure:"window"` // How long a key is remembered
+	Store  string        `mapstructure:"store"`  // "memory" (single instance) or "redis" (clustered)
+}
+
+// IdempotencyConfig holds the deduplication of requests carrying an Idempotency-Key
+// header. The first response to a key is stored in the replay store and replayed to
+// later requests with the same key, route and user instead of proxying them again.
+type IdempotencyConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	TTL     time.Duration `mapstructure:"ttl"`     // How long a response is replayed; 0 uses replay.window
+	Methods []string      `mapstructure:"methods"` // Methods deduplicated; defaults to POST
+	// InFlight is what a request gets while the first with its key is still being
+	// processed: "reject" (409) or "wait" for its response, up to WaitTimeout
+	InFlight    string        `mapstructure:"in_flight"`
+	WaitTimeout time.Duration `mapstructure:"wait_timeout"`
+	// LockTimeout is how long an unfinished first request holds its key, so a key is
+	// freed if its gateway instance died mid-request
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+	MaxBodySize int64         `mapstructure:"max_body_size"` // Larger responses are not stored
+}
+
+// Validate checks the in-flight mode and limits
+func (c IdempotencyConfig) Validate() error {
+	switch c.InFlight {
+	case "", "reject", "wait":
+	default:
+		return fmt.Errorf("invalid idempotency in_flight %q (must be reject or wait)", c.InFlight)
+	}
+	if c.TTL < 0 || c.WaitTimeout < 0 || c.LockTimeout < 0 || c.MaxBodySize < 0 {
+		return fmt.Errorf("idempotency ttl, wait_timeout, lock_timeout and max_body_size cannot be negative")
+	}
+	return nil
+}
+
+// AuditConfig configures the audit trail of authentication outcomes and admin requests
+type AuditConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Sink    string `mapstructure:"sink"`    // "log" (zap, see file) or "redis" (a Redis stream)
+	File    string `mapstructure:"file"`    // Log sink output path; empty logs through the gateway logger
+	Stream  string `mapstructure:"stream"`  // Redis stream key
+	MaxLen  int64  `mapstructure:"max_len"` // Approximate cap on the Redis stream length
+}
+
+// MaintenanceConfig holds maintenance mode, answering 503 to all but the exempt paths.
+// It is reloadable and can also be switched through the admin API.
+type MaintenanceConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Message     string        `mapstructure:"message"`      // Returned in the error body
+	RetryAfter  time.Duration `mapstructure:"retry_after"`  // Sent as Retry-After
+	ExemptPaths []string      `mapstructure:"exempt_paths"` // Path prefixes still served, e.g. health checks
+}
+
+// QuotaConfig holds usage quotas per user over a calendar day or month, sized by the
+// tier claim of the user's token. Quotas are enforced independently of rate limits.
+type QuotaConfig struct {
+	Enabled     bool             `mapstructure:"enabled"`
+	Window      string           `mapstructure:"window"`       // "day" or "month" (calendar, UTC)
+	Tiers       map[string]int64 `mapstructure:"tiers"`        // Requests per window by tier; 0 is unlimited
+	DefaultTier string           `mapstructure:"default_tier"` // Tier of tokens without a known tier claim
+}
+
+// TimeoutOverrideConfig lets trusted callers replace the service timeout of a request
+// with the X-Gateway-Timeout header (seconds). A caller is trusted when its token has
+// one of the roles or it sends one of the API keys in X-Api-Key; other callers'
+// headers are ignored.
+type TimeoutOverrideConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Max     time.Duration `mapstructure:"max"`      // Longer overrides are clamped to this
+	Roles   []string      `mapstructure:"roles"`    // Token roles allowed to override
+	APIKeys []string      `mapstructure:"api_keys"` // X-Api-Key values allowed to override
+}
+
+// GatewaySigningConfig holds the HMAC signing of requests forwarded to backends, so
+// backends can verify that a request came through the gateway. Backends verify with
+// Secret and PreviousSecrets, so a new secret can be rolled out to backends first.
+type GatewaySigningConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Secret          string        `mapstructure:"secret"`           // Signs forwarded requests
+	PreviousSecrets []string      `mapstructure:"previous_secrets"` // Still accepted by verifiers during a rotation
+	Headers         []string      `mapstructure:"headers"`          // Request headers covered by the signature
+	MaxSkew         time.Duration `mapstructure:"max_skew"`         // Verifiers reject older or future timestamps
 }
 
 // CORSConfig holds CORS configuration
@@ -59,7 +356,70 @@ type CORSConfig struct {
 	AllowHeaders     []string `mapstructure:"allow_headers"`
 	ExposeHeaders    []string `mapstructure:"expose_headers"`
 	AllowCredentials bool     `mapstructure:"allow_credentials"`
-	MaxAge           int      `mapstructure:"max_age"`
+	MaxAge           int      `mapstructure:"max_age"` // Preflight cache seconds; 0 forces a preflight per request
+	// OriginMatch is how allow_origins are matched: "exact" (default), "wildcard"
+	// (e.g. https://*.preview.example.com) or "regex" (anchored regular expressions)
+	OriginMatch string `mapstructure:"origin_match"`
+	// Policies are named policies that route groups can be attached to; the fields
+	// above are the global policy used everywhere else
+	Policies map[string]CORSConfig `mapstructure:"policies"`
+}
+
+// Origin matching modes
+const (
+	OriginMatchExact    = "exact"
+	OriginMatchWildcard = "wildcard"
+	OriginMatchRegex    = "regex"
+)
+
+// wildcardLabels is what a "*" in a wildcard origin matches: one or more DNS labels,
+// never a scheme, port or path
+const wildcardLabels = `[a-z0-9-]+(?:\.[a-z0-9-]+)*`
+
+// OriginPatterns compiles allow_origins for the wildcard and regex matching modes,
+// skipping the "*" entry that allows every origin. Patterns match the whole origin.
+func (c CORSConfig) OriginPatterns() ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, origin := range c.AllowOrigins {
+		if origin == "*" {
+			continue
+		}
+		var expr string
+		switch c.OriginMatch {
+		case OriginMatchWildcard:
+			expr = "(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(origin), `\*`, wildcardLabels) + "$"
+		case OriginMatchRegex:
+			expr = "^(?:" + origin + ")$"
+		default:
+			return nil, fmt.Errorf("origin patterns require origin_match wildcard or regex")
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid origin pattern %q: %w", origin, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Policy returns the named policy. Its methods and headers default to the global
+// policy's; origins, credentials and max age are the policy's own.
+func (c CORSConfig) Policy(name string) (CORSConfig, bool) {
+	policy, ok := c.Policies[name]
+	if !ok {
+		return CORSConfig{}, false
+	}
+	if policy.AllowMethods == nil {
+		policy.AllowMethods = c.AllowMethods
+	}
+	if policy.AllowHeaders == nil {
+		policy.AllowHeaders = c.AllowHeaders
+	}
+	if policy.ExposeHeaders == nil {
+		policy.ExposeHeaders = c.ExposeHeaders
+	}
+	policy.Policies = nil
+	return policy, true
 }
 
 // OPAConfig holds Open Policy Agent configuration
@@ -69,10 +429,587 @@ type OPAConfig struct {
 	BundleURL  string `mapstructure:"bundle_url"`
 }
 
+// IPFilterConfig holds IP allowlist/denylist configuration
+type IPFilterConfig struct {
+	// TrustedProxies lists proxy CIDRs/IPs whose X-Forwarded-For header is honored;
+	// defaults to the top-level trusted_proxies
+	TrustedProxies []string      `mapstructure:"trusted_proxies"`
+	Global         IPFilterRules `mapstructure:"global"`
+	Admin          IPFilterRules `mapstructure:"admin"`
+}
+
+// IPFilterRules holds allow and deny lists of CIDRs or individual IPs.
+// Deny entries take precedence; an empty allow list allows everything not denied.
+type IPFilterRules struct {
+	Allow []string `mapstructure:"allow"`
+	Deny  []string `mapstructure:"deny"`
+}
+
+// Enabled reports whether any rule is configured
+func (r IPFilterRules) Enabled() bool {
+	return len(r.Allow) > 0 || len(r.Deny) > 0
+}
+
+// CSPConfig holds Content-Security-Policy nonce configuration for the web UI shell
+type CSPConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Policy      string `mapstructure:"policy"`       // "{nonce}" is replaced with the per-request nonce
+	NonceHeader string `mapstructure:"nonce_header"` // Request header forwarding the nonce to the backend
+	ReportOnly  bool   `mapstructure:"report_only"`
+}
+
+// WebSocketConfig caps concurrent WebSocket and other upgraded connections; 0 means unlimited
+type WebSocketConfig struct {
+	MaxConnections          int `mapstructure:"max_connections"`            // Across all clients
+	MaxConnectionsPerClient int `mapstructure:"max_connections_per_client"` // Per client IP
+}
+
+// MetricsConfig holds the built-in per-service request statistics reported by the
+// admin status endpoint, and the Prometheus metrics endpoint
+type MetricsConfig struct {
+	Enabled    bool     `mapstructure:"enabled"`
+	Prometheus bool     `mapstructure:"prometheus"` // Serve Prometheus metrics at Path
+	Path       string   `mapstructure:"path"`
+	Allow      []string `mapstructure:"allow"` // Client CIDRs/IPs allowed to scrape; empty allows everyone
+}
+
+// OpenAPIConfig holds the generated OpenAPI document served at /openapi.json and the
+// Swagger UI at /docs. Enabled defaults to true outside production.
+type OpenAPIConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Title   string `mapstructure:"title"`
+	Version string `mapstructure:"version"`
+}
+
+// APIVersionConfig controls forwarding the API version a client asked for to backends
+// as a normalized X-Api-Version header, whichever way the client specified it
+type APIVersionConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Header  string `mapstructure:"header"`  // Client request header carrying the version
+	Default string `mapstructure:"default"` // Forwarded when the client specified none; empty forwards nothing
+	// PathSegment is the position of the path segment that may carry the version, 1 (the
+	// default) for the leading one; segments elsewhere are never read as versions
+	PathSegment int `mapstructure:"path_segment"`
+}
+
+// apiVersionPattern matches an API version with an optional "v" prefix: "2", "v2", "V2.1"
+var apiVersionPattern = regexp.MustCompile(`^[vV]?(\d+(?:\.\d+)?)$`)
+
+// NormalizeAPIVersion returns the canonical "v<major>[.<minor>]" form of a version, or
+// false if the value isn't a version
+func NormalizeAPIVersion(raw string) (string, bool) {
+	match := apiVersionPattern.FindStringSubmatch(strings.TrimSpace(raw))
+	if match == nil {
+		return "", false
+	}
+	return "v" + match[1], true
+}
+
+// SecurityHeadersConfig holds the security headers added to every response. Each
+// header is only set when the backend didn't send its own; an empty value disables it.
+type SecurityHeadersConfig struct {
+	Enabled               bool       `mapstructure:"enabled"`
+	HSTS                  HSTSConfig `mapstructure:"hsts"`                 // Only sent on TLS requests
+	ContentTypeOptions    bool       `mapstructure:"content_type_options"` // X-Content-Type-Options: nosniff
+	FrameOptions          string     `mapstructure:"frame_options"`
+	ReferrerPolicy        string     `mapstructure:"referrer_policy"`
+	ContentSecurityPolicy string     `mapstructure:"content_security_policy"`
+	// StripHeaders lists backend response headers removed because they leak implementation details
+	StripHeaders []string `mapstructure:"strip_headers"`
+}
+
+// HSTSConfig holds the Strict-Transport-Security header settings
+type HSTSConfig struct {
+	Enabled           bool          `mapstructure:"enabled"`
+	MaxAge            time.Duration `mapstructure:"max_age"`
+	IncludeSubdomains bool          `mapstructure:"include_subdomains"`
+	Preload           bool          `mapstructure:"preload"`
+}
+
+// LoggingConfig holds access log configuration
+type LoggingConfig struct {
+	// Fields lists the optional access log fields to include: query, ip, user_agent,
+	// user_id, user_email, request_headers, response_headers (empty uses the defaults)
+	Fields []string `mapstructure:"fields"`
+	// RedactFields lists included fields whose values are replaced with a fixed mask
+	RedactFields []string `mapstructure:"redact_fields"`
+	// RedactHeaders lists headers masked when headers are logged, in addition to
+	// Authorization, Proxy-Authorization, Cookie and Set-Cookie which are always masked
+	RedactHeaders []string `mapstructure:"redact_headers"`
+	// SuccessSampleRate is the fraction (0-1] of successful requests that are logged;
+	// errors are always logged. 0 means unset and logs everything.
+	SuccessSampleRate float64 `mapstructure:"success_sample_rate"`
+	// UpstreamErrorBodyBytes is how much of a backend's 5xx response body is logged
+	// for diagnostics; 0 logs none
+	UpstreamErrorBodyBytes int `mapstructure:"upstream_error_body_bytes"`
+	// SlowRequestThreshold is the latency above which a request is logged as slow and
+	// counted, whatever its status; 0 disables. Services and routes may override it.
+	SlowRequestThreshold time.Duration `mapstructure:"slow_request_threshold"`
+}
+
+// RequestIDConfig selects the format of request IDs the gateway generates for requests
+// arriving without one: "uuidv4", "uuidv7" (time-ordered) or "ulid" (time-ordered,
+// 26 characters). Unset, IDs are derived from the trace ID when trace propagation is
+// enabled and are UUIDv4 otherwise.
+type RequestIDConfig struct {
+	Format string `mapstructure:"format"`
+}
+
+// TracingConfig holds distributed trace context configuration
+type TracingConfig struct {
+	// Propagation lists the trace context formats read and forwarded: "w3c" (traceparent)
+	// and/or "b3". Empty disables trace propagation.
+	Propagation []string `mapstructure:"propagation"`
+	// ResponseHeader, when set, returns the trace ID to clients in this header (e.g.
+	// X-Trace-ID) next to X-Request-ID. Ignored when propagation is disabled.
+	ResponseHeader string `mapstructure:"response_header"`
+	// Logs exports structured logs as OpenTelemetry log records over OTLP/HTTP
+	Logs OTLPLogsConfig `mapstructure:"logs"`
+}
+
+// ReadinessConfig selects the dependencies checked by /health/ready. Redis is reported
+// whenever it is configured; listed services are critical and probed. A required
+// dependency being down makes the gateway not ready (503); other services with upstreams
+// down only mark the report degraded.
+type ReadinessConfig struct {
+	Redis    bool          `mapstructure:"redis"`     // Require Redis; otherwise it is reported only, as rate limiting falls back to memory
+	Services []string      `mapstructure:"services"`  // Critical backend services, down when every upstream is
+	CacheTTL time.Duration `mapstructure:"cache_ttl"` // How long a result is reused across probes
+	Timeout  time.Duration `mapstructure:"timeout"`   // Per-check timeout
+	Startup  StartupConfig `mapstructure:"startup"`
+}
+
+// StartupConfig holds back traffic at startup, answering 503 to everything but the
+// liveness probes, until the listed dependencies are reachable. They are retried with
+// exponential backoff from Backoff to MaxBackoff; after MaxWait the gateway starts
+// serving regardless, logging the dependencies still down.
+type StartupConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Redis      bool          `mapstructure:"redis"`    // Wait for Redis
+	Services   []string      `mapstructure:"services"` // Wait for an upstream of each of these services
+	MaxWait    time.Duration `mapstructure:"max_wait"`
+	Backoff    time.Duration `mapstructure:"backoff"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+// OTLPLogsConfig holds OpenTelemetry log export configuration
+type OTLPLogsConfig struct {
+	Enabled       bool              `mapstructure:"enabled"`
+	Endpoint      string            `mapstructure:"endpoint"` // OTLP/HTTP logs endpoint, e.g. http://otel-collector:4318/v1/logs
+	Headers       map[string]string `mapstructure:"headers" secret:"true"`
+	ServiceName   string            `mapstructure:"service_name"`
+	Mode          string            `mapstructure:"mode"` // "tee" exports in addition to stdout, "otlp" instead of it
+	BatchSize     int               `mapstructure:"batch_size"`
+	FlushInterval time.Duration     `mapstructure:"flush_interval"`
+	Timeout       time.Duration     `mapstructure:"timeout"`
+}
+
+// ServiceRegistryConfig holds settings for services registered at runtime via the admin API
+type ServiceRegistryConfig struct {
+	File string `mapstructure:"file"` // JSON file persisting registered services; empty keeps them in memory only
+}
+
 // ServiceEndpoint represents a backend service endpoint
 type ServiceEndpoint struct {
-	BaseURL string        `mapstructure:"base_url"`
+	BaseURL   string             `mapstructure:"base_url"`
+	Upstreams []UpstreamEndpoint `mapstructure:"upstreams"` // Additional instances load-balanced with BaseURL
+	// Discovery resolves the service's instances at runtime instead of from BaseURL and
+	// Upstreams, which then only serve until the first lookup succeeds
+	Discovery DiscoveryConfig `mapstructure:"discovery"`
+	// StickySession keeps each client on the upstream it was first sent to
+	StickySession StickySessionConfig `mapstructure:"sticky_session"`
+	// Timeout bounds the whole backend round trip, including the response body. When
+	// ConnectTimeout or ResponseHeaderTimeout is set it is optional, so long streaming
+	// responses aren't cut off.
 	Timeout time.Duration `mapstructure:"timeout"`
+	// ConnectTimeout bounds dialing the backend and the TLS handshake (overrides
+	// transport.dial_timeout and transport.tls_handshake_timeout)
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+	// ResponseHeaderTimeout bounds the wait for the backend's response headers once the
+	// request is sent; the body may take longer
+	ResponseHeaderTimeout time.Duration `mapstructure:"response_header_timeout"`
+	// SlowRequestThreshold overrides logging.slow_request_threshold for the service
+	SlowRequestThreshold time.Duration `mapstructure:"slow_request_threshold"`
+	// MaxConcurrent caps the requests in flight to the service (0 = unlimited); excess
+	// requests wait up to QueueTimeout for a slot, then get 503. Upgraded connections
+	// are not counted.
+	MaxConcurrent int               `mapstructure:"max_concurrent"`
+	QueueTimeout  time.Duration     `mapstructure:"queue_timeout"`
+	HealthCheck   HealthCheckConfig `mapstructure:"health_check"`
+	EgressProxy   EgressProxyConfig `mapstructure:"egress_proxy"`
+	// KeepTrailingDot preserves a trailing dot in upstream hostnames (fully-qualified DNS names)
+	KeepTrailingDot bool          `mapstructure:"keep_trailing_dot"`
+	Rewrites        []RewriteRule `mapstructure:"rewrites"`
+	// MaxRedirects is the number of same-host redirects the gateway follows on behalf of
+	// the client; 0 (the default) passes redirects through untouched.
+	// Deprecated: use Redirect.Follow, which takes precedence when set.
+	MaxRedirects int `mapstructure:"max_redirects"`
+	// Redirect controls how the service's redirects reach the client
+	Redirect RedirectPolicy `mapstructure:"redirect"`
+	// HostHeader overrides the Host header sent to the backend, for virtual-hosted
+	// backends that expect a name other than the upstream address
+	HostHeader    string              `mapstructure:"host_header"`
+	TenantRouting TenantRoutingConfig `mapstructure:"tenant_routing"`
+	// Canary sends a share of the service's traffic to a canary deployment
+	Canary CanaryConfig `mapstructure:"canary"`
+	// PathTargets send requests under a path prefix to dedicated instances of the service
+	PathTargets []PathTarget `mapstructure:"path_targets"`
+	// Mirror copies a sample of the service's traffic to a secondary backend
+	Mirror MirrorConfig `mapstructure:"mirror"`
+	// RequestHeaders transforms the headers of requests forwarded to the service
+	RequestHeaders HeaderTransform `mapstructure:"request_headers"`
+	Retry          RetryConfig     `mapstructure:"retry"`
+	// Protocol is "http" (default) or "grpc"; gRPC backends are reached over HTTP/2,
+	// cleartext (h2c) for http:// URLs
+	Protocol string `mapstructure:"protocol"`
+	// GRPCServices lists the fully-qualified gRPC services (package.Service) routed to
+	// this backend
+	GRPCServices []string          `mapstructure:"grpc_services"`
+	TLS          UpstreamTLSConfig `mapstructure:"tls"`
+	Cookies      CookieConfig      `mapstructure:"cookies"`
+	Transport    TransportConfig   `mapstructure:"transport"`
+	Fallback     FallbackConfig    `mapstructure:"fallback"`
+	// ResponseFilter drops or masks fields of the service's JSON responses
+	ResponseFilter ResponseFilterConfig `mapstructure:"response_filter"`
+	// Cache keeps the service's cacheable GET responses in memory
+	Cache ResponseCacheConfig `mapstructure:"cache"`
+}
+
+// RedirectPolicy controls how backend redirects reach the client. Same-host redirects
+// are followed server-side first; a Location still pointing at the upstream is then
+// rewritten so the client isn't sent to an internal host.
+type RedirectPolicy struct {
+	// Follow is the number of same-host redirects the gateway follows on behalf of the
+	// client; 0 passes them through
+	Follow int `mapstructure:"follow"`
+	// RewriteLocation rewrites absolute Location headers addressing the upstream to the
+	// scheme and host the client used, restoring the path prefix the route stripped,
+	// e.g. http://users:8080/v2/1 becomes https://api.example.com/users/v2/1
+	RewriteLocation bool `mapstructure:"rewrite_location"`
+}
+
+// Hops returns the number of redirects to follow, falling back to the deprecated
+// max_redirects setting
+func (r RedirectPolicy) Hops(maxRedirects int) int {
+	if r.Follow > 0 {
+		return r.Follow
+	}
+	return maxRedirects
+}
+
+// ResponseCacheConfig caches successful GET and HEAD responses in memory, answering
+// repeated requests, and conditional ones with 304, without reaching the backend.
+// Responses marked no-store, private or no-cache, setting cookies or varying on every
+// header are never cached, nor are responses to authorized requests unless public.
+type ResponseCacheConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// TTL bounds how long a response is served from the cache; a shorter s-maxage or
+	// max-age from the backend wins. Defaults to 1m.
+	TTL         time.Duration `mapstructure:"ttl"`
+	MaxEntries  int           `mapstructure:"max_entries"`   // Least recently used entries are evicted beyond it. Defaults to 1000
+	MaxBodySize int64         `mapstructure:"max_body_size"` // Bytes; larger responses aren't cached. Defaults to 1 MiB
+	// StaleWhileRevalidate is how long past its TTL a response may still be served,
+	// marked X-Cache: STALE, while a request refreshes it. The backend's
+	// stale-while-revalidate directive takes precedence. 0 serves no stale responses.
+	StaleWhileRevalidate time.Duration `mapstructure:"stale_while_revalidate"`
+	// SoftBudget is how long a request with a stale response available waits for the
+	// backend before being served the stale one; the backend request then completes in
+	// the background. 0 serves the stale response at once.
+	SoftBudget time.Duration `mapstructure:"soft_budget"`
+}
+
+// Validate checks the cache limits
+func (c ResponseCacheConfig) Validate() error {
+	if c.TTL < 0 || c.MaxEntries < 0 || c.MaxBodySize < 0 {
+		return fmt.Errorf("cache ttl, max_entries and max_body_size cannot be negative")
+	}
+	if c.StaleWhileRevalidate < 0 || c.SoftBudget < 0 {
+		return fmt.Errorf("cache stale_while_revalidate and soft_budget cannot be negative")
+	}
+	return nil
+}
+
+// ResponseFilterConfig lists JSON fields removed from or masked in backend responses.
+// Paths are dot-separated keys, e.g. "owner.ssn"; arrays along a path apply it to each
+// element. Only application/json responses up to MaxBodySize are filtered.
+type ResponseFilterConfig struct {
+	Remove      []string `mapstructure:"remove"`
+	Mask        []string `mapstructure:"mask"`
+	MaskValue   string   `mapstructure:"mask_value"`    // Defaults to "***"
+	MaxBodySize int64    `mapstructure:"max_body_size"` // Bytes; larger bodies pass through unfiltered. Defaults to 1 MiB
+}
+
+// Enabled reports whether the filter removes or masks anything
+func (f ResponseFilterConfig) Enabled() bool {
+	return len(f.Remove) > 0 || len(f.Mask) > 0
+}
+
+// Validate checks the filter paths
+func (f ResponseFilterConfig) Validate() error {
+	for _, path := range append(append([]string{}, f.Remove...), f.Mask...) {
+		for _, key := range strings.Split(path, ".") {
+			if key == "" {
+				return fmt.Errorf("invalid response filter path %q", path)
+			}
+		}
+	}
+	if f.MaxBodySize < 0 {
+		return fmt.Errorf("response filter max_body_size cannot be negative")
+	}
+	return nil
+}
+
+// FallbackConfig is the response served instead of the generic error when the service
+// can't be reached. With several responses, the one matching the client's Accept header
+// is chosen, falling back to the first.
+type FallbackConfig struct {
+	Status    int                `mapstructure:"status"` // Defaults to 503
+	Responses []FallbackResponse `mapstructure:"responses"`
+}
+
+// FallbackResponse is one representation of a fallback response, given inline or as a file
+type FallbackResponse struct {
+	ContentType string `mapstructure:"content_type"`
+	Body        string `mapstructure:"body"`
+	File        string `mapstructure:"file"` // Read when the service proxy is built
+}
+
+// Validate checks that every response has a content type and exactly one of body or file
+func (f FallbackConfig) Validate() error {
+	if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+		return fmt.Errorf("fallback status must be an error status (4xx or 5xx)")
+	}
+	for _, response := range f.Responses {
+		if response.ContentType == "" {
+			return fmt.Errorf("fallback responses require a content_type")
+		}
+		if (response.Body == "") == (response.File == "") {
+			return fmt.Errorf("fallback response %s must set exactly one of body or file", response.ContentType)
+		}
+	}
+	return nil
+}
+
+// TransportConfig tunes the connection pool of a service's dedicated HTTP transport.
+// Zero values use the gateway defaults.
+type TransportConfig struct {
+	MaxIdleConns        int           `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int           `mapstructure:"max_conns_per_host"` // 0 means unlimited
+	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout"`
+	DialTimeout         time.Duration `mapstructure:"dial_timeout"`
+	TLSHandshakeTimeout time.Duration `mapstructure:"tls_handshake_timeout"`
+}
+
+// CookieConfig adjusts the attributes of cookies set by a backend, e.g. for a web UI
+// served from a different site, which needs SameSite=None; Secure
+type CookieConfig struct {
+	SameSite string `mapstructure:"same_site"` // strict, lax or none; empty keeps the backend's value
+	Secure   bool   `mapstructure:"secure"`    // Add Secure; implied by same_site none
+}
+
+// UpstreamTLSConfig holds the TLS settings used to reach an HTTPS backend
+type UpstreamTLSConfig struct {
+	CAFile     string `mapstructure:"ca_file"`     // PEM bundle trusted instead of the system roots
+	CertFile   string `mapstructure:"cert_file"`   // Client certificate for mutual TLS
+	KeyFile    string `mapstructure:"key_file"`    // Client private key for mutual TLS
+	ServerName string `mapstructure:"server_name"` // Overrides the name verified against the backend certificate
+	// InsecureSkipVerify disables backend certificate verification. Never use it in production.
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
+}
+
+// RetryConfig retries idempotent requests that fail with a connection error or a
+// 502/503/504 response, waiting an exponentially growing, jittered backoff between tries
+type RetryConfig struct {
+	Attempts   int           `mapstructure:"attempts"`    // Retries after the first try; 0 disables retries
+	Backoff    time.Duration `mapstructure:"backoff"`     // Base delay, doubled after every retry
+	MaxBackoff time.Duration `mapstructure:"max_backoff"` // Upper bound for the delay before jitter
+	Jitter     string        `mapstructure:"jitter"`      // none, full or equal
+	// MaxBodySize caps the request bodies buffered so they can be replayed; larger
+	// bodies are streamed and the request is not retried. Defaults to 1 MiB.
+	MaxBodySize int64 `mapstructure:"max_body_size"`
+}
+
+// HeaderTransform sets, adds and removes headers on a forwarded request. Removals
+// are applied first, then Set replaces any existing values and Add appends one.
+type HeaderTransform struct {
+	Set    map[string]string `mapstructure:"set" secret:"true"` // Values may carry backend credentials
+	Add    map[string]string `mapstructure:"add" secret:"true"`
+	Remove []string          `mapstructure:"remove"`
+}
+
+// TenantRoutingConfig scopes a service per tenant. The tenant comes from the JWT
+// tenant_id claim, or the tenant header for callers without a JWT.
+type TenantRoutingConfig struct {
+	Enabled bool              `mapstructure:"enabled"` // Requests without a resolvable tenant get 400
+	Header  string            `mapstructure:"header"`  // Defaults to X-Tenant-ID
+	Tenants map[string]string `mapstructure:"tenants"` // Tenant ID -> dedicated upstream URL
+}
+
+// PathTarget load-balances requests under a path prefix across its own upstreams instead
+// of the service's default pool. The prefix is matched on whole segments against the
+// path forwarded to the service, before rewrites; the longest matching prefix wins.
+type PathTarget struct {
+	Prefix    string             `mapstructure:"prefix"`
+	Upstreams []UpstreamEndpoint `mapstructure:"upstreams"`
+}
+
+// CanaryConfig routes part of a service's traffic to a canary upstream. A request goes
+// to the canary when the header says so, the user has one of the roles, or it falls in
+// the percentage; tenants with a dedicated upstream are never sent to the canary.
+type CanaryConfig struct {
+	URL     string   `mapstructure:"url"`
+	Percent int      `mapstructure:"percent"` // Share of requests, 0-100
+	Header  string   `mapstructure:"header"`  // Optional header forcing a track: "true" canary, "false" stable
+	Roles   []string `mapstructure:"roles"`   // Users with any of these roles always get the canary
+	Sticky  bool     `mapstructure:"sticky"`  // Keep each authenticated user on one track
+}
+
+// Validate checks the canary URL and percentage
+func (c CanaryConfig) Validate() error {
+	if c.URL == "" {
+		if c.Percent != 0 || c.Header != "" || len(c.Roles) > 0 {
+			return fmt.Errorf("canary settings require a canary url")
+		}
+		return nil
+	}
+	if u, err := url.Parse(c.URL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid canary url %q", c.URL)
+	}
+	if c.Percent < 0 || c.Percent > 100 {
+		return fmt.Errorf("canary percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// MirrorConfig copies a sample of a service's requests to a secondary backend, e.g. a
+// rewrite being tried against live traffic. Mirror responses are discarded, and mirror
+// failures or latency never affect the client. The mirror receives the same path and
+// headers as the primary backend.
+type MirrorConfig struct {
+	URL         string        `mapstructure:"url"`           // Scheme and host of the mirror backend
+	Percent     int           `mapstructure:"percent"`       // Share of requests mirrored, 1-100
+	AllMethods  bool          `mapstructure:"all_methods"`   // Also mirror non-idempotent methods such as POST
+	MaxBodySize int64         `mapstructure:"max_body_size"` // Bytes; requests with larger bodies aren't mirrored. Defaults to 1 MiB
+	Timeout     time.Duration `mapstructure:"timeout"`       // Defaults to 10s
+}
+
+// Validate checks the mirror URL and percentage
+func (m MirrorConfig) Validate() error {
+	if m.URL == "" {
+		if m.Percent != 0 || m.AllMethods {
+			return fmt.Errorf("mirror settings require a mirror url")
+		}
+		return nil
+	}
+	if u, err := url.Parse(m.URL); err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+		return fmt.Errorf("invalid mirror url %q (scheme and host only)", m.URL)
+	}
+	if m.Percent < 1 || m.Percent > 100 {
+		return fmt.Errorf("mirror percent must be between 1 and 100")
+	}
+	if m.MaxBodySize < 0 || m.Timeout < 0 {
+		return fmt.Errorf("mirror max_body_size and timeout cannot be negative")
+	}
+	return nil
+}
+
+// RewriteRule rewrites the request path before it is forwarded to a backend.
+// Rules are evaluated in order and the first match wins.
+type RewriteRule struct {
+	Match       string `mapstructure:"match"`       // Path prefix, or a regular expression when Regex is set
+	Replacement string `mapstructure:"replacement"` // Replaces the match; supports $1-style capture groups when Regex is set
+	Regex       bool   `mapstructure:"regex"`
+}
+
+// UpstreamEndpoint represents an additional instance of a backend service
+type UpstreamEndpoint struct {
+	URL    string `mapstructure:"url"`
+	Weight int    `mapstructure:"weight"`
+}
+
+// DiscoveryConfig selects how the instances of a service are found. "static" (the
+// default) uses base_url and upstreams; "dns_srv" looks up the SRV records of Name,
+// using the lowest priority and the record weights; "consul" asks the Consul agent at
+// Address for the instances of Name passing their health checks. Lookups repeat every
+// RefreshInterval, and the last instances found are kept while a lookup fails.
+type DiscoveryConfig struct {
+	Type            string        `mapstructure:"type"`
+	Name            string        `mapstructure:"name"`             // SRV record or Consul service name
+	Scheme          string        `mapstructure:"scheme"`           // Scheme of the instance URLs; defaults to http
+	Address         string        `mapstructure:"address"`          // Consul agent URL; defaults to http://127.0.0.1:8500
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"` // Defaults to 30s
+}
+
+// Enabled reports whether instances are discovered at runtime
+func (d DiscoveryConfig) Enabled() bool {
+	return d.Type != "" && d.Type != "static"
+}
+
+// Validate checks the discovery settings
+func (d DiscoveryConfig) Validate() error {
+	switch d.Type {
+	case "", "static":
+		return nil
+	case "dns_srv", "consul":
+	default:
+		return fmt.Errorf("invalid discovery type %q (must be static, dns_srv or consul)", d.Type)
+	}
+	if d.Name == "" {
+		return fmt.Errorf("discovery name is required for type %s", d.Type)
+	}
+	switch d.Scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("invalid discovery scheme %q (must be http or https)", d.Scheme)
+	}
+	if d.RefreshInterval < 0 {
+		return fmt.Errorf("discovery refresh_interval cannot be negative")
+	}
+	if d.Address != "" {
+		if u, err := url.Parse(d.Address); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid discovery address %q", d.Address)
+		}
+	}
+	return nil
+}
+
+// StickySessionConfig pins clients to one upstream of a service with an affinity
+// cookie set on the first response. A client whose upstream is down is moved to
+// another one.
+type StickySessionConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	CookieName string        `mapstructure:"cookie_name"` // Defaults to gw_affinity_<service>
+	TTL        time.Duration `mapstructure:"ttl"`         // Cookie lifetime; 0 keeps it for the browser session
+}
+
+// Validate checks the sticky session settings
+func (s StickySessionConfig) Validate() error {
+	if s.TTL < 0 {
+		return fmt.Errorf("sticky session ttl cannot be negative")
+	}
+	if s.CookieName != "" && !httpguts.ValidHeaderFieldName(s.CookieName) {
+		return fmt.Errorf("invalid sticky session cookie name %q", s.CookieName)
+	}
+	return nil
+}
+
+// HealthCheckConfig holds active health checking configuration for a backend service
+type HealthCheckConfig struct {
+	Enabled            bool          `mapstructure:"enabled"`
+	Path               string        `mapstructure:"path"`
+	Interval           time.Duration `mapstructure:"interval"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+	HealthyThreshold   int           `mapstructure:"healthy_threshold"`
+	UnhealthyThreshold int           `mapstructure:"unhealthy_threshold"`
+}
+
+// EgressProxyConfig holds the outbound HTTP proxy used to reach a backend service
+type EgressProxyConfig struct {
+	URL      string `mapstructure:"url"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	NoProxy  string `mapstructure:"no_proxy"` // Same syntax as NO_PROXY; defaults to the NO_PROXY environment variable
 }
 
 // ExternalServiceEndpoint represents an external service endpoint (e.g., host machine services)
@@ -80,6 +1017,98 @@ type ExternalServiceEndpoint struct {
 	BaseURL   string        `mapstructure:"base_url"`
 	Timeout   time.Duration `mapstructure:"timeout"`
 	WebSocket bool          `mapstructure:"websocket"` // Enable WebSocket upgrade support
+	// Fallback is served when the service can't be reached, e.g. a maintenance page for the web UI
+	Fallback FallbackConfig `mapstructure:"fallback"`
+	// Cache keeps cacheable GET responses, e.g. web UI assets, in memory
+	Cache ResponseCacheConfig `mapstructure:"cache"`
+}
+
+// RouteConfig declares a route proxied to a backend service, registered at startup
+type RouteConfig struct {
+	Method     string        `mapstructure:"method"`      // HTTP method, or ANY for every method
+	Path       string        `mapstructure:"path"`        // Gin pattern, e.g. /api/v1/users/:id or /api/v1/files/*path
+	Service    string        `mapstructure:"service"`     // Must be defined under services
+	TargetPath string        `mapstructure:"target_path"` // Backend path, may contain :params; defaults to *path or the request path
+	Rewrites   []RewriteRule `mapstructure:"rewrites"`    // Route-level rewrites; exclusive with target_path
+	Auth       string        `mapstructure:"auth"`        // required (default), optional or none
+	Roles      []string      `mapstructure:"roles"`       // Any one of these roles is required; needs auth required
+	// Scopes must be granted by the token's scope claim, all of them or, with ScopeMode
+	// "any", at least one; needs auth required
+	Scopes    []string `mapstructure:"scopes"`
+	ScopeMode string   `mapstructure:"scope_mode"` // all (default) or any
+	// ResponseFilter drops or masks JSON response fields on this route, after the service's filter
+	ResponseFilter ResponseFilterConfig `mapstructure:"response_filter"`
+	// Validation rejects malformed requests with 400, or 422 for schema violations,
+	// before they are proxied
+	Validation RequestValidationConfig `mapstructure:"validate"`
+	// SlowRequestThreshold overrides the service's and logging.slow_request_threshold
+	SlowRequestThreshold time.Duration `mapstructure:"slow_request_threshold"`
+	// AuthSchemes are tried in order when auth is required or optional, any one
+	// sufficing: jwt (the default), api_key and mtls
+	AuthSchemes []string `mapstructure:"auth_schemes"`
+}
+
+// DefaultRouteConfig sends API requests matching no route to a fallback service, e.g. a
+// legacy backend while routes are being migrated off it. Method and path are kept.
+type DefaultRouteConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	Service    string `mapstructure:"service"`     // Backend service name
+	PathPrefix string `mapstructure:"path_prefix"` // Unmatched paths under it fall through; must be under /api/
+	Auth       string `mapstructure:"auth"`        // required (default), optional or none
+}
+
+// RequestValidationConfig lists the checks a route applies to requests before proxying
+type RequestValidationConfig struct {
+	RequiredHeaders []string `mapstructure:"required_headers"` // Headers that must be present and non-empty
+	// ContentTypes are the media types accepted for POST, PUT and PATCH bodies, e.g.
+	// application/json or image/*; parameters such as charset are ignored
+	ContentTypes []string `mapstructure:"content_types"`
+	// Schema is the path of a JSON Schema file POST, PUT and PATCH bodies must match;
+	// failing bodies get 422 listing the offending fields
+	Schema      string `mapstructure:"schema"`
+	MaxBodySize int64  `mapstructure:"max_body_size"` // Bytes; larger bodies get 413 when a schema is set. Defaults to 1 MiB
+}
+
+// Enabled reports whether any check is configured
+func (v RequestValidationConfig) Enabled() bool {
+	return len(v.RequiredHeaders) > 0 || len(v.ContentTypes) > 0 || v.Schema != ""
+}
+
+// Validate checks the header names and media types
+func (v RequestValidationConfig) Validate() error {
+	for _, name := range v.RequiredHeaders {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid required header %q", name)
+		}
+	}
+	for _, contentType := range v.ContentTypes {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("invalid content type %q", contentType)
+		}
+	}
+	if v.MaxBodySize < 0 {
+		return fmt.Errorf("validate max_body_size cannot be negative")
+	}
+	if v.Schema != "" {
+		if _, err := jsonschema.Compile(v.Schema); err != nil {
+			return fmt.Errorf("invalid schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// CompositeRoute defines an endpoint whose response aggregates several backend calls
+type CompositeRoute struct {
+	Path     string             `mapstructure:"path"` // Relative to /api/v1, may contain :params
+	Timeout  time.Duration      `mapstructure:"timeout"`
+	Requests []CompositeRequest `mapstructure:"requests"`
+}
+
+// CompositeRequest defines a single backend call within a composite route
+type CompositeRequest struct {
+	Key     string `mapstructure:"key"`     // Key under which the response is merged
+	Service string `mapstructure:"service"` // Backend service name
+	Path    string `mapstructure:"path"`    // Backend path, may reference the route's :params
 }
 
 // LoadConfig loads configuration from environment variables and config files
@@ -90,6 +1119,17 @@ func LoadConfig() (*Config, error) {
 	viper.AddConfigPath("./config")
 	viper.AddConfigPath("/etc/api-gateway")
 
+	return readConfig()
+}
+
+// LoadConfigFile loads configuration from a specific file
+func LoadConfigFile(path string) (*Config, error) {
+	viper.SetConfigFile(path)
+	return readConfig()
+}
+
+// readConfig reads the config file, if any, on top of defaults and environment variables
+func readConfig() (*Config, error) {
 	// Set defaults
 	setDefaults()
 
@@ -104,6 +1144,11 @@ func LoadConfig() (*Config, error) {
 	// Override with environment variables
 	viper.AutomaticEnv()
 
+	return decodeConfig()
+}
+
+// decodeConfig builds and validates a Config from the current viper state
+func decodeConfig() (*Config, error) {
 	var cfg Config
 	if err := viper.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
@@ -117,6 +1162,26 @@ func LoadConfig() (*Config, error) {
 		cfg.ExternalServices = make(map[string]ExternalServiceEndpoint)
 	}
 
+	// The IP filter inherits the gateway-wide trusted proxies unless overridden
+	if len(cfg.IPFilter.TrustedProxies) == 0 {
+		cfg.IPFilter.TrustedProxies = cfg.TrustedProxies
+	}
+
+	// A zero shutdown timeout would close in-flight requests at once
+	if cfg.Server.ShutdownTimeout == 0 {
+		cfg.Server.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	// API docs are served by default everywhere but production
+	if !viper.IsSet("openapi.enabled") {
+		cfg.OpenAPI.Enabled = cfg.Environment != "production"
+	}
+
+	// Secrets kept out of the config file
+	if err := resolveSecrets(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
 	// Validate configuration
 	if err := validateConfig(&cfg); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -125,33 +1190,265 @@ func LoadConfig() (*Config, error) {
 	return &cfg, nil
 }
 
-func setDefaults() {
-	// General
-	viper.SetDefault("environment", "development")
-	viper.SetDefault("port", 8080)
+// WatchConfig watches the loaded config file and calls onChange with the reloaded
+// configuration, or an error if the new file is invalid, whenever it changes. Changes
+// are delivered one at a time, on the watcher goroutine.
+func WatchConfig(onChange func(*Config, error)) {
+	viper.OnConfigChange(func(fsnotify.Event) {
+		onChange(decodeConfig())
+	})
+	viper.WatchConfig()
+}
 
-	// Server
-	viper.SetDefault("server.read_timeout", 15*time.Second)
-	viper.SetDefault("server.write_timeout", 15*time.Second)
-	viper.SetDefault("server.idle_timeout", 60*time.Second)
+// RestartRequired lists the settings that differ between two configurations but
+// can't be applied at runtime. Rate limits, CORS, maintenance mode and service timeouts
+// are reloadable.
+func RestartRequired(current, updated *Config) []string {
+	var settings []string
 
-	// JWT
-	viper.SetDefault("jwt.secret_key", "change-me-in-production")
-	viper.SetDefault("jwt.token_duration", 15*time.Minute)
-	viper.SetDefault("jwt.refresh_duration", 7*24*time.Hour)
-	viper.SetDefault("jwt.issuer", "api-gateway")
+	currentValue, updatedValue := reflect.ValueOf(*current), reflect.ValueOf(*updated)
+	for i := 0; i < currentValue.NumField(); i++ {
+		field := currentValue.Type().Field(i)
+		switch field.Name {
+		case "RateLimit", "CORS", "Maintenance":
+			continue
+		case "Services", "ExternalServices":
+			if !reflect.DeepEqual(withoutTimeouts(currentValue.Field(i).Interface()), withoutTimeouts(updatedValue.Field(i).Interface())) {
+				settings = append(settings, field.Tag.Get("mapstructure"))
+			}
+			continue
+		}
 
-	// Rate Limiting
-	viper.SetDefault("rate_limit.enabled", true)
-	viper.SetDefault("rate_limit.requests_per_min", 100)
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), updatedValue.Field(i).Interface()) {
+			settings = append(settings, field.Tag.Get("mapstructure"))
+		}
+	}
+	return settings
+}
+
+// withoutTimeouts returns a copy of a service map with timeouts cleared for comparison
+func withoutTimeouts(services interface{}) interface{} {
+	switch s := services.(type) {
+	case map[string]ServiceEndpoint:
+		copied := make(map[string]ServiceEndpoint, len(s))
+		for name, endpoint := range s {
+			endpoint.Timeout = 0
+			copied[name] = endpoint
+		}
+		return copied
+	case map[string]ExternalServiceEndpoint:
+		copied := make(map[string]ExternalServiceEndpoint, len(s))
+		for name, endpoint := range s {
+			endpoint.Timeout = 0
+			copied[name] = endpoint
+		}
+		return copied
+	}
+	return services
+}
+
+// RedactedValue replaces secrets in the redacted configuration
+const RedactedValue = "[REDACTED]"
+
+// secretSettingPattern matches the names of settings holding secrets. Settings are
+// redacted when their name matches or their field is tagged secret:"true", so a new
+// secret setting is covered by its name alone.
+var secretSettingPattern = regexp.MustCompile(`(?i)secret|password|passwd|api_?keys?$|token$|credential|private`)
+
+// durationType is the type of duration settings, rendered as e.g. "15s"
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Redacted returns the configuration keyed by setting names as in the config file,
+// with secrets replaced by RedactedValue and passwords removed from URLs. Empty
+// secrets are kept so it shows whether a secret is set.
+func (c *Config) Redacted() map[string]interface{} {
+	return redactValue(reflect.ValueOf(*c), false).(map[string]interface{})
+}
+
+// redactValue converts v to plain maps, slices and values, redacting secret leaves
+func redactValue(v reflect.Value, secret bool) interface{} {
+	switch v.Kind() {
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, options, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+			fieldSecret := secret || field.Tag.Get("secret") == "true"
+			// Squashed fields are set at the level of their parent, as in the config file
+			if options == "squash" {
+				if squashed, ok := redactValue(v.Field(i), fieldSecret).(map[string]interface{}); ok {
+					for key, value := range squashed {
+						out[key] = value
+					}
+					continue
+				}
+			}
+			if name == "" {
+				name = field.Name
+			}
+			out[name] = redactValue(v.Field(i), fieldSecret || secretSettingPattern.MatchString(name))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = redactValue(iter.Value(), secret)
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i), secret)
+		}
+		return out
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), secret)
+	}
+
+	if secret && !v.IsZero() {
+		return RedactedValue
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.String {
+		return redactURL(v.String())
+	}
+	return v.Interface()
+}
+
+// redactURL masks the password of a URL with credentials (as "xxxxx"), e.g. an egress
+// proxy URL. Other strings are returned as they are.
+func redactURL(value string) string {
+	if !strings.Contains(value, "@") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	return u.Redacted()
+}
+
+func setDefaults() {
+	// General
+	viper.SetDefault("environment", "development")
+	viper.SetDefault("port", 8080)
+	viper.SetDefault("trusted_proxies", []string{})
+
+	// Server
+	viper.SetDefault("server.read_timeout", 15*time.Second)
+	viper.SetDefault("server.write_timeout", 15*time.Second)
+	viper.SetDefault("server.idle_timeout", 60*time.Second)
+	viper.SetDefault("server.allowed_methods", []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	viper.SetDefault("server.disallowed_methods", []string{"TRACE", "CONNECT"})
+	viper.SetDefault("server.h2c", false)
+	viper.SetDefault("server.request_budget", 0)
+	viper.SetDefault("server.shutdown_timeout", DefaultShutdownTimeout)
+	viper.SetDefault("server.max_header_bytes", 1<<20)
+	viper.SetDefault("server.tls.enabled", false)
+	viper.SetDefault("server.tls.reload_interval", time.Minute)
+	viper.SetDefault("server.tls.min_version", "1.2")
+	viper.SetDefault("server.tls.alpn", []string{"h2", "http/1.1"})
+	viper.SetDefault("server.tls.redirect_port", 0)
+	viper.SetDefault("server.path_normalization.collapse_slashes", true)
+	viper.SetDefault("server.path_normalization.trailing_slash", "keep")
+	viper.SetDefault("server.path_normalization.action", "rewrite")
+	viper.SetDefault("server.path_normalization.redirect_status", http.StatusPermanentRedirect)
+	viper.SetDefault("server.connections.max", 0)
+	viper.SetDefault("server.connections.on_limit", "wait")
+
+	// JWT
+	viper.SetDefault("jwt.secret_key", "change-me-in-production")
+	viper.SetDefault("jwt.token_duration", 15*time.Minute)
+	viper.SetDefault("jwt.refresh_duration", 7*24*time.Hour)
+	viper.SetDefault("jwt.issuer", "api-gateway")
+	viper.SetDefault("jwt.audience", "")
+	viper.SetDefault("jwt.previous_secrets", []string{})
+	viper.SetDefault("jwt.cookie_auth", false)
+	viper.SetDefault("jwt.cookie_name", "access_token")
+	viper.SetDefault("jwt.leeway", 30*time.Second)
+
+	// Login
+	viper.SetDefault("login.enabled", false)
+	viper.SetDefault("login.verifier", "static")
+	viper.SetDefault("login.verify_path", "/auth/verify")
+	viper.SetDefault("login.requests_per_min", 10)
+	viper.SetDefault("login.max_failures", 5)
+	viper.SetDefault("login.lockout_duration", 15*time.Minute)
+
+	// Rate Limiting
+	viper.SetDefault("rate_limit.enabled", true)
+	viper.SetDefault("rate_limit.requests_per_min", 100)
 	viper.SetDefault("rate_limit.burst_size", 20)
 	viper.SetDefault("rate_limit.cleanup_interval", 1*time.Minute)
+	viper.SetDefault("rate_limit.admin_list_limit", 500)
+	viper.SetDefault("rate_limit.exempt_paths", []string{"/health", "/metrics"})
+	viper.SetDefault("rate_limit.exempt_cidrs", []string{})
+	viper.SetDefault("rate_limit.exempt_roles", []string{})
+	viper.SetDefault("rate_limit.exempt_api_keys", []string{})
+	viper.SetDefault("rate_limit.retry_after_jitter", 5*time.Second)
 
 	// Redis
 	viper.SetDefault("redis.host", "localhost")
 	viper.SetDefault("redis.port", 6379)
 	viper.SetDefault("redis.password", "")
 	viper.SetDefault("redis.db", 0)
+	viper.SetDefault("redis.reconnect_interval", 5*time.Second)
+
+	// Replay protection
+	viper.SetDefault("replay.window", 24*time.Hour)
+	viper.SetDefault("replay.store", "memory")
+
+	// Idempotency keys
+	viper.SetDefault("idempotency.enabled", false)
+	viper.SetDefault("idempotency.ttl", 24*time.Hour)
+	viper.SetDefault("idempotency.methods", []string{"POST"})
+	viper.SetDefault("idempotency.in_flight", "reject")
+	viper.SetDefault("idempotency.wait_timeout", 10*time.Second)
+	viper.SetDefault("idempotency.lock_timeout", time.Minute)
+	viper.SetDefault("idempotency.max_body_size", 1<<20)
+
+	// Audit log
+	viper.SetDefault("audit.enabled", false)
+	viper.SetDefault("audit.sink", "log")
+	viper.SetDefault("audit.file", "")
+	viper.SetDefault("audit.stream", "audit:events")
+	viper.SetDefault("audit.max_len", 100000)
+
+	// Quotas
+	viper.SetDefault("quota.enabled", false)
+	viper.SetDefault("quota.window", "month")
+	viper.SetDefault("quota.default_tier", "free")
+
+	// Gateway request signing
+	viper.SetDefault("gateway_signing.enabled", false)
+	viper.SetDefault("gateway_signing.headers", []string{"X-Gateway", "X-Real-IP", "X-Request-ID"})
+	viper.SetDefault("gateway_signing.max_skew", 5*time.Minute)
+
+	// Timeout overrides
+	viper.SetDefault("timeout_override.enabled", false)
+	viper.SetDefault("timeout_override.max", 5*time.Minute)
+	viper.SetDefault("timeout_override.roles", []string{"admin"})
+
+	// Maintenance mode
+	viper.SetDefault("maintenance.enabled", false)
+	viper.SetDefault("maintenance.message", "The service is undergoing maintenance. Please try again later.")
+	viper.SetDefault("maintenance.retry_after", 5*time.Minute)
+	viper.SetDefault("maintenance.exempt_paths", []string{"/health", "/metrics", "/api/v1/public/auth", "/api/v1/admin"})
 
 	// CORS
 	viper.SetDefault("cors.allow_origins", []string{"*"})
@@ -165,6 +1462,89 @@ func setDefaults() {
 	viper.SetDefault("opa.enabled", true)
 	viper.SetDefault("opa.policy_path", "./policies")
 	viper.SetDefault("opa.bundle_url", "")
+
+	// Logging
+	viper.SetDefault("logging.fields", []string{"query", "ip", "user_agent", "user_id", "user_email"})
+	viper.SetDefault("logging.redact_fields", []string{})
+	viper.SetDefault("logging.redact_headers", []string{})
+	viper.SetDefault("logging.success_sample_rate", 1.0)
+	viper.SetDefault("logging.upstream_error_body_bytes", 0)
+	viper.SetDefault("logging.slow_request_threshold", 0)
+
+	// Service registry
+	viper.SetDefault("service_registry.file", "")
+
+	// Fallback service for unmatched API paths
+	viper.SetDefault("default_route.enabled", false)
+	viper.SetDefault("default_route.path_prefix", "/api/v1/")
+	viper.SetDefault("default_route.auth", "required")
+
+	// Where secret references are resolved
+	viper.SetDefault("secrets.vault.address", "")
+	viper.SetDefault("secrets.vault.token", "")
+	viper.SetDefault("secrets.vault.token_file", "")
+	viper.SetDefault("secrets.vault.timeout", 10*time.Second)
+
+	// WebSocket connection caps
+	viper.SetDefault("websocket.max_connections", 10000)
+	viper.SetDefault("websocket.max_connections_per_client", 50)
+
+	// Metrics; Prometheus is scraped from the gateway's host only unless allowed wider
+	viper.SetDefault("metrics.enabled", true)
+	viper.SetDefault("metrics.prometheus", true)
+	viper.SetDefault("metrics.path", "/metrics")
+	viper.SetDefault("metrics.allow", []string{"127.0.0.1", "::1"})
+
+	// API version forwarding
+	viper.SetDefault("api_version.enabled", false)
+	viper.SetDefault("api_version.header", "Api-Version")
+	viper.SetDefault("api_version.default", "")
+	viper.SetDefault("api_version.path_segment", 1)
+
+	// OpenAPI (openapi.enabled defaults by environment in decodeConfig)
+	viper.SetDefault("openapi.title", "API Gateway")
+	viper.SetDefault("openapi.version", "1.0.0")
+
+	// Readiness
+	viper.SetDefault("readiness.redis", false)
+	viper.SetDefault("readiness.services", []string{})
+	viper.SetDefault("readiness.cache_ttl", 2*time.Second)
+	viper.SetDefault("readiness.timeout", 2*time.Second)
+	viper.SetDefault("readiness.startup.enabled", false)
+	viper.SetDefault("readiness.startup.redis", false)
+	viper.SetDefault("readiness.startup.services", []string{})
+	viper.SetDefault("readiness.startup.max_wait", 60*time.Second)
+	viper.SetDefault("readiness.startup.backoff", 500*time.Millisecond)
+	viper.SetDefault("readiness.startup.max_backoff", 5*time.Second)
+
+	// Tracing
+	viper.SetDefault("tracing.propagation", []string{"w3c"})
+	viper.SetDefault("tracing.response_header", "")
+	viper.SetDefault("request_id.format", "")
+	viper.SetDefault("tracing.logs.enabled", false)
+	viper.SetDefault("tracing.logs.service_name", "api-gateway")
+	viper.SetDefault("tracing.logs.mode", "tee")
+	viper.SetDefault("tracing.logs.batch_size", 512)
+	viper.SetDefault("tracing.logs.flush_interval", 5*time.Second)
+	viper.SetDefault("tracing.logs.timeout", 10*time.Second)
+
+	// CSP
+	viper.SetDefault("csp.enabled", false)
+	viper.SetDefault("csp.policy", "default-src 'self'; script-src 'self' 'nonce-{nonce}'; object-src 'none'; base-uri 'self'")
+	viper.SetDefault("csp.nonce_header", "X-CSP-Nonce")
+	viper.SetDefault("csp.report_only", false)
+
+	// Security headers
+	viper.SetDefault("security_headers.enabled", true)
+	viper.SetDefault("security_headers.hsts.enabled", true)
+	viper.SetDefault("security_headers.hsts.max_age", 365*24*time.Hour)
+	viper.SetDefault("security_headers.hsts.include_subdomains", true)
+	viper.SetDefault("security_headers.hsts.preload", false)
+	viper.SetDefault("security_headers.content_type_options", true)
+	viper.SetDefault("security_headers.frame_options", "DENY")
+	viper.SetDefault("security_headers.referrer_policy", "strict-origin-when-cross-origin")
+	viper.SetDefault("security_headers.content_security_policy", "")
+	viper.SetDefault("security_headers.strip_headers", []string{"Server", "X-Powered-By"})
 }
 
 func validateConfig(cfg *Config) error {
@@ -179,6 +1559,17 @@ func validateConfig(cfg *Config) error {
 	if cfg.Environment == "production" && cfg.JWT.SecretKey == "change-me-in-production" {
 		return fmt.Errorf("JWT secret key must be changed in production")
 	}
+	for _, secret := range cfg.JWT.PreviousSecrets {
+		if secret == "" {
+			return fmt.Errorf("JWT previous secrets cannot be empty")
+		}
+	}
+	if cfg.JWT.Leeway < 0 || cfg.JWT.Leeway > MaxJWTLeeway {
+		return fmt.Errorf("JWT leeway must be between 0 and %s", MaxJWTLeeway)
+	}
+	if err := validateAuth(cfg.Auth); err != nil {
+		return err
+	}
 
 	if cfg.RateLimit.Enabled {
 		if cfg.RateLimit.RequestsPerMin <= 0 {
@@ -187,8 +1578,695 @@ func validateConfig(cfg *Config) error {
 		if cfg.RateLimit.BurstSize <= 0 {
 			return fmt.Errorf("burst size must be positive")
 		}
+		if cfg.RateLimit.RetryAfterJitter < 0 {
+			return fmt.Errorf("retry after jitter cannot be negative")
+		}
+	}
+	if err := validateIPList(cfg.RateLimit.ExemptCIDRs); err != nil {
+		return fmt.Errorf("rate limit exempt_cidrs: %w", err)
+	}
+
+	if cfg.Logging.SuccessSampleRate < 0 || cfg.Logging.SuccessSampleRate > 1 {
+		return fmt.Errorf("logging success sample rate must be between 0 and 1")
+	}
+	if cfg.Logging.UpstreamErrorBodyBytes < 0 {
+		return fmt.Errorf("logging upstream_error_body_bytes must not be negative")
+	}
+	if cfg.Logging.SlowRequestThreshold < 0 {
+		return fmt.Errorf("logging slow_request_threshold must not be negative")
+	}
+
+	for _, format := range cfg.Tracing.Propagation {
+		if format != "w3c" && format != "b3" {
+			return fmt.Errorf("unsupported trace propagation format: %s", format)
+		}
+	}
+
+	if cfg.Tracing.Logs.Enabled {
+		if cfg.Tracing.Logs.Endpoint == "" {
+			return fmt.Errorf("OTLP logs endpoint is required when log export is enabled")
+		}
+		if cfg.Tracing.Logs.Mode != "tee" && cfg.Tracing.Logs.Mode != "otlp" {
+			return fmt.Errorf("invalid OTLP logs mode: %s", cfg.Tracing.Logs.Mode)
+		}
+	}
+
+	if cfg.CSP.Enabled && !strings.Contains(cfg.CSP.Policy, "{nonce}") {
+		return fmt.Errorf("CSP policy must contain a {nonce} placeholder")
+	}
+
+	if cfg.Metrics.Prometheus && !strings.HasPrefix(cfg.Metrics.Path, "/") {
+		return fmt.Errorf("metrics path must start with /")
+	}
+
+	if cfg.Quota.Enabled {
+		if cfg.Quota.Window != "day" && cfg.Quota.Window != "month" {
+			return fmt.Errorf("quota window must be day or month")
+		}
+		if _, ok := cfg.Quota.Tiers[cfg.Quota.DefaultTier]; !ok {
+			return fmt.Errorf("quota default tier %q is not among the tiers", cfg.Quota.DefaultTier)
+		}
+		for tier, limit := range cfg.Quota.Tiers {
+			if limit < 0 {
+				return fmt.Errorf("quota of tier %s cannot be negative", tier)
+			}
+		}
+	}
+
+	if cfg.GatewaySigning.Enabled && cfg.GatewaySigning.Secret == "" {
+		return fmt.Errorf("gateway signing requires a secret")
+	}
+
+	if cfg.TimeoutOverride.Enabled {
+		if cfg.TimeoutOverride.Max <= 0 {
+			return fmt.Errorf("timeout override max must be positive")
+		}
+		if len(cfg.TimeoutOverride.Roles) == 0 && len(cfg.TimeoutOverride.APIKeys) == 0 {
+			return fmt.Errorf("timeout override requires roles or api_keys")
+		}
+	}
+
+	if cfg.Maintenance.RetryAfter < 0 {
+		return fmt.Errorf("maintenance retry_after cannot be negative")
+	}
+	for _, prefix := range cfg.Maintenance.ExemptPaths {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("maintenance exempt path %q must start with /", prefix)
+		}
+	}
+	for _, prefix := range cfg.RateLimit.ExemptPaths {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("rate limit exempt path %q must start with /", prefix)
+		}
+	}
+
+	if cfg.WebSocket.MaxConnections < 0 || cfg.WebSocket.MaxConnectionsPerClient < 0 {
+		return fmt.Errorf("websocket connection limits cannot be negative")
+	}
+
+	if err := validateLogin(cfg); err != nil {
+		return err
+	}
+
+	for _, name := range cfg.Readiness.Services {
+		if _, ok := cfg.Services[name]; !ok {
+			return fmt.Errorf("readiness: unknown service %s", name)
+		}
+	}
+	if cfg.Readiness.Redis && cfg.Redis.Host == "" {
+		return fmt.Errorf("readiness: redis requires redis.host")
+	}
+	if cfg.Readiness.CacheTTL < 0 || cfg.Readiness.Timeout < 0 {
+		return fmt.Errorf("readiness: cache_ttl and timeout cannot be negative")
+	}
+	switch cfg.RequestID.Format {
+	case "", "uuidv4", "uuidv7", "ulid":
+	default:
+		return fmt.Errorf("invalid request_id format %q (must be uuidv4, uuidv7 or ulid)", cfg.RequestID.Format)
+	}
+
+	startup := cfg.Readiness.Startup
+	for _, name := range startup.Services {
+		if _, ok := cfg.Services[name]; !ok {
+			return fmt.Errorf("readiness.startup: unknown service %s", name)
+		}
+	}
+	if startup.Redis && cfg.Redis.Host == "" {
+		return fmt.Errorf("readiness.startup: redis requires redis.host")
+	}
+	if startup.MaxWait < 0 || startup.Backoff < 0 || startup.MaxBackoff < 0 {
+		return fmt.Errorf("readiness.startup: max_wait, backoff and max_backoff cannot be negative")
+	}
+
+	switch cfg.Audit.Sink {
+	case "", "log":
+	case "redis":
+		if cfg.Audit.Enabled && cfg.Redis.Host == "" {
+			return fmt.Errorf("audit sink redis requires redis.host")
+		}
+	default:
+		return fmt.Errorf("unknown audit sink %q", cfg.Audit.Sink)
+	}
+
+	switch cfg.Replay.Store {
+	case "", "memory":
+	case "redis":
+		if cfg.Redis.Host == "" {
+			return fmt.Errorf("replay store redis requires redis.host")
+		}
+	default:
+		return fmt.Errorf("invalid replay store %q (must be memory or redis)", cfg.Replay.Store)
+	}
+	if cfg.Replay.Window < 0 {
+		return fmt.Errorf("replay window cannot be negative")
+	}
+	if err := cfg.Idempotency.Validate(); err != nil {
+		return err
+	}
+
+	if cfg.Server.RequestBudget < 0 {
+		return fmt.Errorf("request budget cannot be negative")
+	}
+	if cfg.Server.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown timeout cannot be negative")
+	}
+	if cfg.Server.MaxHeaderBytes < 0 {
+		return fmt.Errorf("max header bytes cannot be negative")
+	}
+	if err := validateTLS(cfg.Server.TLS, cfg.Port); err != nil {
+		return err
+	}
+	if err := cfg.Server.PathNormalization.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Server.Connections.Validate(); err != nil {
+		return err
+	}
+
+	if cfg.APIVersion.Default != "" {
+		if _, ok := NormalizeAPIVersion(cfg.APIVersion.Default); !ok {
+			return fmt.Errorf("invalid default API version: %s", cfg.APIVersion.Default)
+		}
+	}
+	if cfg.APIVersion.PathSegment < 0 {
+		return fmt.Errorf("API version path segment cannot be negative")
+	}
+
+	if cfg.CORS.MaxAge < 0 {
+		return fmt.Errorf("CORS max age cannot be negative")
+	}
+	if err := validateOriginMatch(cfg.CORS); err != nil {
+		return fmt.Errorf("CORS: %w", err)
+	}
+	for name, policy := range cfg.CORS.Policies {
+		if err := validateOriginMatch(policy); err != nil {
+			return fmt.Errorf("CORS policy %s: %w", name, err)
+		}
+		if len(policy.AllowOrigins) == 0 {
+			return fmt.Errorf("CORS policy %s: allow_origins is required", name)
+		}
+		if policy.MaxAge < 0 {
+			return fmt.Errorf("CORS policy %s: max age cannot be negative", name)
+		}
+		if len(policy.Policies) > 0 {
+			return fmt.Errorf("CORS policy %s: policies cannot be nested", name)
+		}
+	}
+
+	if cfg.SecurityHeaders.HSTS.MaxAge < 0 {
+		return fmt.Errorf("security headers: HSTS max age cannot be negative")
+	}
+
+	for _, list := range [][]string{
+		cfg.TrustedProxies,
+		cfg.IPFilter.TrustedProxies,
+		cfg.IPFilter.Global.Allow, cfg.IPFilter.Global.Deny,
+		cfg.IPFilter.Admin.Allow, cfg.IPFilter.Admin.Deny,
+		cfg.Metrics.Allow,
+	} {
+		if err := validateIPList(list); err != nil {
+			return fmt.Errorf("ip filter: %w", err)
+		}
+	}
+
+	for name, svc := range cfg.Services {
+		hc := svc.HealthCheck
+		if hc.Interval < 0 || hc.Timeout < 0 || hc.HealthyThreshold < 0 || hc.UnhealthyThreshold < 0 {
+			return fmt.Errorf("service %s: health check settings cannot be negative", name)
+		}
+		if svc.MaxRedirects < 0 || svc.Redirect.Follow < 0 {
+			return fmt.Errorf("service %s: max redirects cannot be negative", name)
+		}
+		if svc.EgressProxy.URL != "" {
+			if _, err := url.Parse(svc.EgressProxy.URL); err != nil {
+				return fmt.Errorf("service %s: invalid egress proxy url: %w", name, err)
+			}
+		}
+		for _, rule := range svc.Rewrites {
+			if err := rule.Validate(); err != nil {
+				return fmt.Errorf("service %s: %w", name, err)
+			}
+		}
+		if err := svc.RequestHeaders.Validate(); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		if err := svc.Fallback.Validate(); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		if err := svc.ResponseFilter.Validate(); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		if err := svc.Cache.Validate(); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		if err := svc.Canary.Validate(); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		if err := svc.Mirror.Validate(); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		if err := svc.StickySession.Validate(); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		if err := svc.Discovery.Validate(); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		if svc.Timeout < 0 || svc.ConnectTimeout < 0 || svc.ResponseHeaderTimeout < 0 || svc.SlowRequestThreshold < 0 {
+			return fmt.Errorf("service %s: timeouts cannot be negative", name)
+		}
+		if svc.MaxConcurrent < 0 || svc.QueueTimeout < 0 {
+			return fmt.Errorf("service %s: max_concurrent and queue_timeout cannot be negative", name)
+		}
+		if svc.QueueTimeout > 0 && svc.MaxConcurrent == 0 {
+			return fmt.Errorf("service %s: queue_timeout requires max_concurrent", name)
+		}
+		if svc.Retry.Attempts < 0 || svc.Retry.Backoff < 0 || svc.Retry.MaxBackoff < 0 || svc.Retry.MaxBodySize < 0 {
+			return fmt.Errorf("service %s: retry settings cannot be negative", name)
+		}
+		if (svc.TLS.CertFile == "") != (svc.TLS.KeyFile == "") {
+			return fmt.Errorf("service %s: tls cert_file and key_file must be set together", name)
+		}
+		if svc.Transport.MaxIdleConns < 0 || svc.Transport.MaxIdleConnsPerHost < 0 || svc.Transport.MaxConnsPerHost < 0 ||
+			svc.Transport.IdleConnTimeout < 0 || svc.Transport.DialTimeout < 0 || svc.Transport.TLSHandshakeTimeout < 0 {
+			return fmt.Errorf("service %s: transport settings cannot be negative", name)
+		}
+		switch strings.ToLower(svc.Cookies.SameSite) {
+		case "", "strict", "lax", "none":
+		default:
+			return fmt.Errorf("service %s: invalid cookie same_site %q (must be strict, lax or none)", name, svc.Cookies.SameSite)
+		}
+		switch svc.Protocol {
+		case "", "http":
+			if len(svc.GRPCServices) > 0 {
+				return fmt.Errorf("service %s: grpc_services requires protocol grpc", name)
+			}
+		case "grpc":
+			if svc.Mirror.URL != "" {
+				return fmt.Errorf("service %s: mirroring is not supported for gRPC services", name)
+			}
+			for _, grpcService := range svc.GRPCServices {
+				if grpcService == "" || strings.Contains(grpcService, "/") {
+					return fmt.Errorf("service %s: invalid gRPC service name %q", name, grpcService)
+				}
+			}
+		default:
+			return fmt.Errorf("service %s: invalid protocol %q (must be http or grpc)", name, svc.Protocol)
+		}
+		switch svc.Retry.Jitter {
+		case "", "none", "full", "equal":
+		default:
+			return fmt.Errorf("service %s: invalid retry jitter %q (must be none, full or equal)", name, svc.Retry.Jitter)
+		}
+		prefixes := make(map[string]bool, len(svc.PathTargets))
+		for _, target := range svc.PathTargets {
+			if !strings.HasPrefix(target.Prefix, "/") {
+				return fmt.Errorf("service %s: path target prefix %q must start with /", name, target.Prefix)
+			}
+			if prefixes[target.Prefix] {
+				return fmt.Errorf("service %s: duplicate path target prefix %s", name, target.Prefix)
+			}
+			prefixes[target.Prefix] = true
+			if len(target.Upstreams) == 0 {
+				return fmt.Errorf("service %s: path target %s needs at least one upstream", name, target.Prefix)
+			}
+			for _, upstream := range target.Upstreams {
+				if upstream.URL == "" {
+					return fmt.Errorf("service %s: upstream url cannot be empty", name)
+				}
+				if upstream.Weight < 0 {
+					return fmt.Errorf("service %s: upstream weight cannot be negative", name)
+				}
+			}
+		}
+		for tenant, upstreamURL := range svc.TenantRouting.Tenants {
+			if tenant == "" || upstreamURL == "" {
+				return fmt.Errorf("service %s: tenant routing entries need a tenant ID and an upstream url", name)
+			}
+			if u, err := url.Parse(upstreamURL); err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("service %s: invalid upstream url for tenant %s", name, tenant)
+			}
+		}
+		for _, upstream := range svc.Upstreams {
+			if upstream.URL == "" {
+				return fmt.Errorf("service %s: upstream url cannot be empty", name)
+			}
+			if upstream.Weight < 0 {
+				return fmt.Errorf("service %s: upstream weight cannot be negative", name)
+			}
+		}
+	}
+
+	for name, svc := range cfg.ExternalServices {
+		if err := svc.Fallback.Validate(); err != nil {
+			return fmt.Errorf("external service %s: %w", name, err)
+		}
+		if err := svc.Cache.Validate(); err != nil {
+			return fmt.Errorf("external service %s: %w", name, err)
+		}
+	}
+
+	if err := validateRoutes(cfg); err != nil {
+		return err
+	}
+	if err := validateDefaultRoute(cfg); err != nil {
+		return err
+	}
+
+	for _, composite := range cfg.Composites {
+		if composite.Path == "" {
+			return fmt.Errorf("composite route path cannot be empty")
+		}
+		if len(composite.Requests) == 0 {
+			return fmt.Errorf("composite route %s: at least one request is required", composite.Path)
+		}
+		keys := make(map[string]bool, len(composite.Requests))
+		for _, req := range composite.Requests {
+			if req.Key == "" || req.Service == "" {
+				return fmt.Errorf("composite route %s: request key and service are required", composite.Path)
+			}
+			if keys[req.Key] {
+				return fmt.Errorf("composite route %s: duplicate key %s", composite.Path, req.Key)
+			}
+			keys[req.Key] = true
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the trailing slash policy, action and redirect status
+func (p PathNormalizationConfig) Validate() error {
+	switch p.TrailingSlash {
+	case "", "keep", "strip", "add":
+	default:
+		return fmt.Errorf("invalid path_normalization trailing_slash %q (must be keep, strip or add)", p.TrailingSlash)
+	}
+	switch p.Action {
+	case "", "rewrite":
+	case "redirect":
+		if p.RedirectStatus != http.StatusMovedPermanently && p.RedirectStatus != http.StatusPermanentRedirect {
+			return fmt.Errorf("invalid path_normalization redirect_status %d (must be 301 or 308)", p.RedirectStatus)
+		}
+	default:
+		return fmt.Errorf("invalid path_normalization action %q (must be rewrite or redirect)", p.Action)
+	}
+	return nil
+}
+
+// validateTLS checks the TLS termination settings
+func validateTLS(cfg TLSConfig, port int) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return fmt.Errorf("tls requires cert_file and key_file")
+	}
+	if cfg.MinVersion != "" && cfg.MinVersion != "1.2" && cfg.MinVersion != "1.3" {
+		return fmt.Errorf("invalid tls min_version %q (must be 1.2 or 1.3)", cfg.MinVersion)
+	}
+	if cfg.ReloadInterval < 0 {
+		return fmt.Errorf("tls reload_interval cannot be negative")
+	}
+	if cfg.RedirectPort < 0 || cfg.RedirectPort > 65535 || cfg.RedirectPort == port {
+		return fmt.Errorf("invalid tls redirect_port: %d", cfg.RedirectPort)
+	}
+	return nil
+}
+
+// validateLogin checks the login endpoint settings when it is enabled
+func validateLogin(cfg *Config) error {
+	login := cfg.Login
+	if !login.Enabled {
+		return nil
+	}
+
+	switch login.Verifier {
+	case "static":
+		for _, user := range login.Users {
+			if user.Username == "" || user.UserID == "" {
+				return fmt.Errorf("login: static users require a username and user_id")
+			}
+			if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+				return fmt.Errorf("login: user %s: password_hash must be a bcrypt hash", user.Username)
+			}
+		}
+	case "service":
+		if _, ok := cfg.Services[login.Service]; !ok {
+			return fmt.Errorf("login: unknown verifier service %q", login.Service)
+		}
+		if !strings.HasPrefix(login.VerifyPath, "/") {
+			return fmt.Errorf("login: verify_path must start with /")
+		}
+	default:
+		return fmt.Errorf("login: invalid verifier %q (must be static or service)", login.Verifier)
 	}
 
+	if login.RequestsPerMin <= 0 || login.MaxFailures <= 0 || login.LockoutDuration <= 0 {
+		return fmt.Errorf("login: requests_per_min, max_failures and lockout_duration must be positive")
+	}
+	return nil
+}
+
+// routeMethods are the methods a declared route may use
+var routeMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true, "ANY": true,
+}
+
+// builtInRoutePrefixes are the paths the gateway serves itself, with everything below
+// them; builtInRoutePaths are the single paths it serves
+var (
+	builtInRoutePrefixes = []string{"/health", "/v2", "/api/v1/public", "/api/v1/admin", "/api/v1/services"}
+	builtInRoutePaths    = []string{"/openapi.json", "/docs", "/api/generate", "/api/chat", "/api/embeddings"}
+)
+
+// builtInRouteConflict returns the built-in route a declared route's path would clash
+// with when registered, or "" when there is none. A catch-all clashes with every
+// built-in route below it.
+func builtInRouteConflict(cfg *Config, path string) string {
+	paths := append([]string(nil), builtInRoutePaths...)
+	if cfg.Metrics.Prometheus && cfg.Metrics.Path != "" {
+		paths = append(paths, cfg.Metrics.Path)
+	}
+	for _, composite := range cfg.Composites {
+		paths = append(paths, "/api/v1"+composite.Path)
+	}
+	catchAll := ""
+	if i := strings.Index(path, "/*"); i >= 0 {
+		catchAll = path[:i+1]
+	}
+
+	for _, prefix := range builtInRoutePrefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return prefix
+		}
+		if catchAll != "" && strings.HasPrefix(prefix+"/", catchAll) {
+			return prefix
+		}
+	}
+	for _, builtIn := range paths {
+		if path == builtIn || (catchAll != "" && strings.HasPrefix(builtIn, catchAll)) {
+			return builtIn
+		}
+	}
+	return ""
+}
+
+// validateOriginMatch checks the origin matching mode and its patterns
+func validateOriginMatch(c CORSConfig) error {
+	switch c.OriginMatch {
+	case "", OriginMatchExact:
+		return nil
+	case OriginMatchWildcard, OriginMatchRegex:
+		_, err := c.OriginPatterns()
+		return err
+	default:
+		return fmt.Errorf("unknown origin_match %q (exact, wildcard or regex)", c.OriginMatch)
+	}
+}
+
+// validateDefaultRoute checks the fallback service for unmatched API paths
+func validateDefaultRoute(cfg *Config) error {
+	route := cfg.DefaultRoute
+	if !route.Enabled {
+		return nil
+	}
+	if _, ok := cfg.Services[route.Service]; !ok {
+		return fmt.Errorf("default_route: unknown service %q", route.Service)
+	}
+	if !strings.HasPrefix(route.PathPrefix, "/api/") {
+		return fmt.Errorf("default_route: path_prefix must be under /api/")
+	}
+	switch route.Auth {
+	case "", "required", "optional", "none":
+	default:
+		return fmt.Errorf("default_route: invalid auth mode %q (must be required, optional or none)", route.Auth)
+	}
+	return nil
+}
+
+// validateRoutes checks the declarative route table, rejecting malformed and duplicate routes
+func validateRoutes(cfg *Config) error {
+	seen := make(map[string]map[string]bool, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		method := strings.ToUpper(route.Method)
+		if !routeMethods[method] {
+			return fmt.Errorf("route %s %s: invalid method", route.Method, route.Path)
+		}
+		if !strings.HasPrefix(route.Path, "/") {
+			return fmt.Errorf("route %s %s: path must start with /", route.Method, route.Path)
+		}
+		if _, ok := cfg.Services[route.Service]; !ok {
+			return fmt.Errorf("route %s %s: unknown service %q", route.Method, route.Path, route.Service)
+		}
+		if route.TargetPath != "" && len(route.Rewrites) > 0 {
+			return fmt.Errorf("route %s %s: target_path and rewrites are mutually exclusive", route.Method, route.Path)
+		}
+		for _, rule := range route.Rewrites {
+			if err := rule.Validate(); err != nil {
+				return fmt.Errorf("route %s %s: %w", route.Method, route.Path, err)
+			}
+		}
+		if err := route.ResponseFilter.Validate(); err != nil {
+			return fmt.Errorf("route %s %s: %w", route.Method, route.Path, err)
+		}
+		if err := route.Validation.Validate(); err != nil {
+			return fmt.Errorf("route %s %s: %w", route.Method, route.Path, err)
+		}
+		if route.ScopeMode != "" && route.ScopeMode != "all" && route.ScopeMode != "any" {
+			return fmt.Errorf("route %s %s: invalid scope_mode %q (must be all or any)", route.Method, route.Path, route.ScopeMode)
+		}
+		if route.SlowRequestThreshold < 0 {
+			return fmt.Errorf("route %s %s: slow_request_threshold cannot be negative", route.Method, route.Path)
+		}
+		switch route.Auth {
+		case "", "required":
+		case "optional", "none":
+			if len(route.Roles) > 0 || len(route.Scopes) > 0 {
+				return fmt.Errorf("route %s %s: roles and scopes require auth to be required", route.Method, route.Path)
+			}
+		default:
+			return fmt.Errorf("route %s %s: invalid auth mode %q (must be required, optional or none)", route.Method, route.Path, route.Auth)
+		}
+		if err := validateAuthSchemes(cfg, route); err != nil {
+			return fmt.Errorf("route %s %s: %w", route.Method, route.Path, err)
+		}
+
+		if builtIn := builtInRouteConflict(cfg, route.Path); builtIn != "" {
+			return fmt.Errorf("route %s %s: conflicts with the built-in route %s", route.Method, route.Path, builtIn)
+		}
+
+		// ANY registers every method, so it conflicts with any other route on the path
+		methods := seen[route.Path]
+		if methods == nil {
+			methods = make(map[string]bool)
+			seen[route.Path] = methods
+		}
+		if methods[method] || methods["ANY"] || (method == "ANY" && len(methods) > 0) {
+			return fmt.Errorf("route %s %s: duplicate route", route.Method, route.Path)
+		}
+		methods[method] = true
+	}
+	return nil
+}
+
+// validateAuthSchemes checks that a route's auth schemes are known and have credentials
+// to check against
+func validateAuthSchemes(cfg *Config, route RouteConfig) error {
+	if len(route.AuthSchemes) > 0 && route.Auth == "none" {
+		return fmt.Errorf("auth_schemes require auth to be required or optional")
+	}
+	for _, scheme := range route.AuthSchemes {
+		switch scheme {
+		case AuthSchemeJWT:
+		case AuthSchemeAPIKey:
+			if len(cfg.Auth.APIKeys) == 0 {
+				return fmt.Errorf("auth scheme api_key requires auth.api_keys")
+			}
+		case AuthSchemeMTLS:
+			if !cfg.Server.TLS.Enabled || cfg.Server.TLS.ClientCAFile == "" {
+				return fmt.Errorf("auth scheme mtls requires server.tls with client_ca_file")
+			}
+		default:
+			return fmt.Errorf("invalid auth scheme %q (must be jwt, api_key or mtls)", scheme)
+		}
+	}
+	return nil
+}
+
+// validateAuth checks the credentials of the API key and client certificate schemes
+func validateAuth(cfg AuthConfig) error {
+	keys := make(map[string]bool, len(cfg.APIKeys))
+	for _, credential := range cfg.APIKeys {
+		if credential.Key == "" || credential.UserID == "" {
+			return fmt.Errorf("auth api_keys need a key and a user_id")
+		}
+		if keys[credential.Key] {
+			return fmt.Errorf("auth api_keys: duplicate key for user %s", credential.UserID)
+		}
+		keys[credential.Key] = true
+	}
+	for _, mapping := range cfg.ClientCerts {
+		if mapping.Subject == "" {
+			return fmt.Errorf("auth client_certs need a subject")
+		}
+	}
+	return nil
+}
+
+// validateIPList checks that every entry is a valid IP address or CIDR range
+func validateIPList(entries []string) error {
+	for _, entry := range entries {
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf("invalid IP or CIDR %q", entry)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the rewrite rule is well-formed
+func (r RewriteRule) Validate() error {
+	if r.Match == "" {
+		return fmt.Errorf("rewrite rule match cannot be empty")
+	}
+	if r.Regex {
+		if _, err := regexp.Compile(r.Match); err != nil {
+			return fmt.Errorf("invalid rewrite pattern %q: %w", r.Match, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the header transform only names valid, modifiable headers
+func (t HeaderTransform) Validate() error {
+	names := append([]string{}, t.Remove...)
+	for name := range t.Set {
+		names = append(names, name)
+	}
+	for name := range t.Add {
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.EqualFold(name, "Host") {
+			return fmt.Errorf("the Host header cannot be transformed; use host_header instead")
+		}
+	}
+	for name, value := range t.Set {
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("invalid value for header %q", name)
+		}
+	}
+	for name, value := range t.Add {
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("invalid value for header %q", name)
+		}
+	}
 	return nil
 }
 
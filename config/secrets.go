@@ -0,0 +1,254 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultVaultTimeout bounds a Vault secret lookup when secrets.vault.timeout is unset
+const defaultVaultTimeout = 10 * time.Second
+
+// secretFileSuffix names the setting, or environment variable, holding the path of a
+// file to read a secret setting from, e.g. jwt.secret_key_file or JWT_SECRET_KEY_FILE
+const secretFileSuffix = "_file"
+
+// SecretProvider looks up secrets kept outside the config file. Secret settings refer to
+// one with a value of the form "<scheme>:<ref>", e.g. "vault:secret/data/gateway#jwt_key".
+type SecretProvider interface {
+	Secret(ctx context.Context, ref string) (string, error)
+}
+
+// EnvSecrets reads secrets from environment variables; the ref is the variable name
+type EnvSecrets struct{}
+
+// Secret implements SecretProvider
+func (EnvSecrets) Secret(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// FileSecrets reads secrets from files, such as mounted Kubernetes or Docker secrets;
+// the ref is the path. A trailing newline is dropped.
+type FileSecrets struct{}
+
+// Secret implements SecretProvider
+func (FileSecrets) Secret(_ context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// VaultSecrets reads secrets from a Vault KV secrets engine, version 1 or 2; the ref is
+// the API path and the field, e.g. "secret/data/gateway#jwt_key"
+type VaultSecrets struct {
+	Address string
+	Token   string
+	Client  *http.Client
+}
+
+// Secret implements SecretProvider
+func (v VaultSecrets) Secret(ctx context.Context, ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("vault reference %q must be path#field", ref)
+	}
+	if v.Address == "" {
+		return "", fmt.Errorf("vault address is not configured")
+	}
+	endpoint, err := url.JoinPath(v.Address, "v1", path)
+	if err != nil {
+		return "", fmt.Errorf("invalid vault address: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault answered %s for %s", resp.Status, path)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+	// KV version 2 nests the secret's fields under data.data
+	fields := body.Data
+	if nested, ok := fields["data"].(map[string]interface{}); ok {
+		if _, direct := fields[field]; !direct {
+			fields = nested
+		}
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no string field %s", path, field)
+	}
+	return value, nil
+}
+
+var (
+	secretProvidersMu sync.RWMutex
+	// secretProviders resolve secret references by scheme. The vault scheme is served
+	// from secrets.vault unless a provider is registered for it.
+	secretProviders = map[string]SecretProvider{
+		"env":  EnvSecrets{},
+		"file": FileSecrets{},
+	}
+)
+
+// RegisterSecretProvider makes secret references with the scheme resolve through
+// provider, replacing any provider registered for it. Call it before loading the
+// configuration.
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[scheme] = provider
+}
+
+// secretSetting is a setting that may hold a secret reference
+type secretSetting struct {
+	name  string
+	value *string
+	file  bool // May also be read from the file named by its _file setting
+}
+
+// secretSettings returns the settings that may hold a secret reference, named as in the
+// config file. List entries are named by index, e.g. jwt.previous_secrets[1], and only
+// take references. Services are map values, so their settings point into services,
+// copies of cfg.Services that the caller stores back.
+func secretSettings(cfg *Config, services map[string]*ServiceEndpoint) []secretSetting {
+	settings := []secretSetting{
+		{name: "jwt.secret_key", value: &cfg.JWT.SecretKey, file: true},
+		{name: "redis.password", value: &cfg.Redis.Password, file: true},
+		{name: "gateway_signing.secret", value: &cfg.GatewaySigning.Secret, file: true},
+	}
+	list := func(name string, values []string) {
+		for i := range values {
+			settings = append(settings, secretSetting{name: fmt.Sprintf("%s[%d]", name, i), value: &values[i]})
+		}
+	}
+	list("jwt.previous_secrets", cfg.JWT.PreviousSecrets)
+	list("gateway_signing.previous_secrets", cfg.GatewaySigning.PreviousSecrets)
+	list("rate_limit.exempt_api_keys", cfg.RateLimit.ExemptAPIKeys)
+	list("timeout_override.api_keys", cfg.TimeoutOverride.APIKeys)
+	for i := range cfg.Auth.APIKeys {
+		settings = append(settings, secretSetting{name: fmt.Sprintf("auth.api_keys[%d].key", i), value: &cfg.Auth.APIKeys[i].Key})
+	}
+	for name, endpoint := range services {
+		settings = append(settings, secretSetting{name: "services." + name + ".egress_proxy.password", value: &endpoint.EgressProxy.Password, file: true})
+	}
+	return settings
+}
+
+// resolveSecrets replaces the secret settings given by reference with the secrets
+// themselves. A setting is read from the file named by its _file setting or _FILE
+// environment variable when present; otherwise a value of the form "<scheme>:<ref>"
+// with a known scheme is looked up through that provider. Other values are literals.
+func resolveSecrets(cfg *Config) error {
+	providers := make(map[string]SecretProvider)
+	secretProvidersMu.RLock()
+	for scheme, provider := range secretProviders {
+		providers[scheme] = provider
+	}
+	secretProvidersMu.RUnlock()
+	if _, ok := providers["vault"]; !ok {
+		vault, err := newVaultSecrets(cfg.Secrets.Vault)
+		if err != nil {
+			return fmt.Errorf("secrets: %w", err)
+		}
+		providers["vault"] = vault
+	}
+
+	timeout := cfg.Secrets.Vault.Timeout
+	if timeout <= 0 {
+		timeout = defaultVaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	services := make(map[string]*ServiceEndpoint, len(cfg.Services))
+	for name, endpoint := range cfg.Services {
+		endpoint := endpoint
+		services[name] = &endpoint
+	}
+	for _, setting := range secretSettings(cfg, services) {
+		if path := secretFile(setting.name); setting.file && path != "" {
+			secret, err := FileSecrets{}.Secret(ctx, path)
+			if err != nil {
+				return fmt.Errorf("%s: reading secret file: %w", setting.name, err)
+			}
+			*setting.value = secret
+			continue
+		}
+
+		scheme, ref, ok := strings.Cut(*setting.value, ":")
+		provider, known := providers[scheme]
+		if !ok || !known {
+			continue
+		}
+		secret, err := provider.Secret(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("%s: resolving %s secret: %w", setting.name, scheme, err)
+		}
+		*setting.value = secret
+	}
+	for name, endpoint := range services {
+		cfg.Services[name] = *endpoint
+	}
+	return nil
+}
+
+// secretFile returns the path of the file a secret setting is read from, if any: the
+// <setting>_file setting, or the <SETTING>_FILE environment variable
+func secretFile(name string) string {
+	if path := viper.GetString(name + secretFileSuffix); path != "" {
+		return path
+	}
+	return os.Getenv(strings.ToUpper(strings.ReplaceAll(name, ".", "_") + secretFileSuffix))
+}
+
+// newVaultSecrets builds the Vault provider from the configuration, falling back to the
+// VAULT_ADDR and VAULT_TOKEN environment variables
+func newVaultSecrets(cfg VaultConfig) (VaultSecrets, error) {
+	vault := VaultSecrets{Address: cfg.Address, Token: cfg.Token}
+	if vault.Address == "" {
+		vault.Address = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.TokenFile != "" {
+		token, err := FileSecrets{}.Secret(context.Background(), cfg.TokenFile)
+		if err != nil {
+			return VaultSecrets{}, fmt.Errorf("reading vault token file: %w", err)
+		}
+		vault.Token = token
+	}
+	if vault.Token == "" {
+		vault.Token = os.Getenv("VAULT_TOKEN")
+	}
+	return vault, nil
+}
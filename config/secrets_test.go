@@ -0,0 +1,141 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadTestConfig loads a config file with the given contents
+func loadTestConfig(t *testing.T, contents string) (*Config, error) {
+	t.Cleanup(viper.Reset)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfigFile(path)
+}
+
+// writeSecret writes a secret file and returns its path
+func writeSecret(t *testing.T, secret string) string {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(secret), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSecretFromFile(t *testing.T) {
+	path := writeSecret(t, "from-file\n")
+
+	cfg, err := loadTestConfig(t, "jwt:\n  secret_key: in-config\n  secret_key_file: "+path+"\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-file", cfg.JWT.SecretKey)
+
+	t.Setenv("REDIS_PASSWORD_FILE", path)
+	cfg, err = loadTestConfig(t, "redis:\n  password: in-config\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-file", cfg.Redis.Password)
+}
+
+func TestSecretReferences(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" || r.URL.Path != "/v1/secret/data/gateway" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"jwt_key":"from-vault"},"metadata":{"version":3}}}`))
+	}))
+	defer vault.Close()
+	t.Setenv("GATEWAY_REDIS_PASSWORD", "from-env")
+	path := writeSecret(t, "from-file")
+
+	cfg, err := loadTestConfig(t, `
+secrets:
+  vault:
+    address: "`+vault.URL+`"
+    token: vault-token
+jwt:
+  secret_key: "vault:secret/data/gateway#jwt_key"
+redis:
+  password: "env:GATEWAY_REDIS_PASSWORD"
+gateway_signing:
+  secret: "file:`+path+`"
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, "from-vault", cfg.JWT.SecretKey)
+	assert.Equal(t, "from-env", cfg.Redis.Password)
+	assert.Equal(t, "from-file", cfg.GatewaySigning.Secret)
+
+	// Values that aren't references are literals
+	cfg, err = loadTestConfig(t, "redis:\n  password: \"pass:word\"\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "pass:word", cfg.Redis.Password)
+
+	_, err = loadTestConfig(t, "jwt:\n  secret_key: \"vault:secret/data/gateway#other_key\"\nsecrets:\n  vault:\n    address: \""+vault.URL+"\"\n    token: vault-token\n")
+	assert.ErrorContains(t, err, "jwt.secret_key")
+}
+
+func TestSecretReferencesInListsAndServices(t *testing.T) {
+	t.Setenv("GATEWAY_OLD_JWT_KEY", "old-jwt-key")
+	t.Setenv("GATEWAY_OLD_SIGNING_KEY", "old-signing-key")
+	t.Setenv("GATEWAY_MONITORING_KEY", "monitoring-key")
+	t.Setenv("GATEWAY_REPORTS_KEY", "reports-key")
+	t.Setenv("GATEWAY_BILLING_KEY", "billing-key")
+	t.Setenv("GATEWAY_PROXY_PASSWORD", "proxy-password")
+	passwordFile := writeSecret(t, "proxy-password-from-file\n")
+
+	cfg, err := loadTestConfig(t, `
+jwt:
+  previous_secrets: ["env:GATEWAY_OLD_JWT_KEY", "literal-old-key"]
+gateway_signing:
+  previous_secrets: ["env:GATEWAY_OLD_SIGNING_KEY"]
+rate_limit:
+  exempt_api_keys: ["env:GATEWAY_MONITORING_KEY"]
+timeout_override:
+  api_keys: ["env:GATEWAY_REPORTS_KEY"]
+auth:
+  api_keys:
+    - key: "env:GATEWAY_BILLING_KEY"
+      user_id: billing-batch
+services:
+  users:
+    base_url: "http://users:8080"
+    egress_proxy:
+      url: "http://proxy:3128"
+      password: "env:GATEWAY_PROXY_PASSWORD"
+  orders:
+    base_url: "http://orders:8080"
+    egress_proxy:
+      url: "http://proxy:3128"
+      password_file: "`+passwordFile+`"
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old-jwt-key", "literal-old-key"}, cfg.JWT.PreviousSecrets)
+	assert.Equal(t, []string{"old-signing-key"}, cfg.GatewaySigning.PreviousSecrets)
+	assert.Equal(t, []string{"monitoring-key"}, cfg.RateLimit.ExemptAPIKeys)
+	assert.Equal(t, []string{"reports-key"}, cfg.TimeoutOverride.APIKeys)
+	assert.Equal(t, "billing-key", cfg.Auth.APIKeys[0].Key)
+	assert.Equal(t, "proxy-password", cfg.Services["users"].EgressProxy.Password)
+	assert.Equal(t, "proxy-password-from-file", cfg.Services["orders"].EgressProxy.Password)
+
+	_, err = loadTestConfig(t, "auth:\n  api_keys:\n    - key: \"env:GATEWAY_UNSET_SECRET\"\n      user_id: batch\n")
+	assert.ErrorContains(t, err, "auth.api_keys[0].key")
+}
+
+func TestMissingSecret(t *testing.T) {
+	_, err := loadTestConfig(t, "jwt:\n  secret_key_file: "+filepath.Join(t.TempDir(), "missing")+"\n")
+	assert.ErrorContains(t, err, "jwt.secret_key: reading secret file")
+
+	_, err = loadTestConfig(t, "jwt:\n  secret_key: \"env:GATEWAY_UNSET_SECRET\"\n")
+	assert.ErrorContains(t, err, "GATEWAY_UNSET_SECRET is not set")
+
+	// A required secret resolving to nothing fails validation
+	_, err = loadTestConfig(t, "jwt:\n  secret_key_file: "+writeSecret(t, "\n")+"\n")
+	assert.ErrorContains(t, err, "JWT secret key cannot be empty")
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxAggregateResponseBytes caps the size of each sub-response read by the aggregator
+const maxAggregateResponseBytes = 10 << 20
+
+// forwardedAggregateHeaders are the client headers copied onto each sub-request
+var forwardedAggregateHeaders = []string{"Authorization", "Accept-Language", "X-Request-ID", "X-Tenant-ID"}
+
+// subRequestError describes a failed sub-request within a composite response
+type subRequestError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// Aggregate returns a handler that fans out to several backend services concurrently
+// and merges their JSON responses under the configured keys. Failed sub-requests are
+// reported per key under "errors"; the request only fails when every sub-request fails.
+func (p *ProxyHandler) Aggregate(route config.CompositeRoute) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if route.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, route.Timeout)
+			defer cancel()
+		}
+
+		var (
+			mu   sync.Mutex
+			wg   sync.WaitGroup
+			data = make(map[string]json.RawMessage, len(route.Requests))
+			errs = make(map[string]subRequestError)
+		)
+
+		for _, sub := range route.Requests {
+			wg.Add(1)
+			go func(sub config.CompositeRequest) {
+				defer wg.Done()
+
+				body, subErr := p.fetchSubRequest(ctx, c, sub)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if subErr != nil {
+					errs[sub.Key] = *subErr
+					return
+				}
+				data[sub.Key] = body
+			}(sub)
+		}
+		wg.Wait()
+
+		if len(errs) > 0 {
+			p.logger.Warn("Composite request partially failed",
+				zap.String("path", route.Path),
+				zap.Int("failed", len(errs)),
+				zap.Int("total", len(route.Requests)),
+			)
+		}
+
+		status := http.StatusOK
+		if len(data) == 0 {
+			status = http.StatusBadGateway
+		}
+
+		response := gin.H{"data": data}
+		if len(errs) > 0 {
+			response["errors"] = errs
+		}
+		c.JSON(status, response)
+	}
+}
+
+// fetchSubRequest performs a single backend call for a composite route
+func (p *ProxyHandler) fetchSubRequest(ctx context.Context, c *gin.Context, sub config.CompositeRequest) (json.RawMessage, *subRequestError) {
+	svc, exists := p.service(sub.Service)
+	if !exists {
+		return nil, &subRequestError{Status: http.StatusInternalServerError, Message: "Service configuration not found"}
+	}
+
+	target := svc.pool.next()
+	if target == nil {
+		return nil, &subRequestError{Status: http.StatusServiceUnavailable, Message: "No healthy backend instance available"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, svc.timeout())
+	defer cancel()
+
+	reqURL := &url.URL{
+		Path:     p.replacePathParams(sub.Path, c),
+		RawQuery: c.Request.URL.RawQuery,
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, &subRequestError{Status: http.StatusInternalServerError, Message: err.Error()}
+	}
+	// Sub-requests are prepared like proxied requests: header transforms, the client IP,
+	// the principal and the signature all apply
+	req.RemoteAddr = c.Request.RemoteAddr
+	req.Host = c.Request.Host
+	for _, header := range forwardedAggregateHeaders {
+		if value := c.GetHeader(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+	rewriteRequestURL(req, target.url)
+	p.modifyRequest(req, target.url, svc.endpoint.HostHeader, svc.endpoint.RequestHeaders)
+
+	resp, err := svc.transport.RoundTrip(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, &subRequestError{Status: http.StatusGatewayTimeout, Message: "Backend service did not respond in time"}
+		}
+		return nil, &subRequestError{Status: http.StatusBadGateway, Message: fmt.Sprintf("Failed to reach backend service: %s", err.Error())}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAggregateResponseBytes))
+	if err != nil {
+		return nil, &subRequestError{Status: http.StatusBadGateway, Message: "Failed to read backend response"}
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, &subRequestError{Status: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+	// A response without a body has nothing to decode; merge it as null
+	if !hasResponseBody(resp) || len(body) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	if !json.Valid(body) {
+		return nil, &subRequestError{Status: http.StatusBadGateway, Message: "Backend returned invalid JSON"}
+	}
+
+	return body, nil
+}
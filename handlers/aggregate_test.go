@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestAggregateMergesResponsesWithPartialFailure(t *testing.T) {
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/users/42", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"42","name":"Ada"}`))
+	}))
+	defer users.Close()
+
+	tasks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer tasks.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"users": {BaseURL: users.URL},
+			"tasks": {BaseURL: tasks.URL},
+		},
+	}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.GET("/dashboard/:id", proxy.Aggregate(config.CompositeRoute{
+		Path: "/dashboard/:id",
+		Requests: []config.CompositeRequest{
+			{Key: "user", Service: "users", Path: "/users/:id"},
+			{Key: "tasks", Service: "tasks", Path: "/tasks"},
+		},
+	}))
+
+	req, _ := http.NewRequest("GET", "/dashboard/42", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Data   map[string]map[string]interface{} `json:"data"`
+		Errors map[string]subRequestError        `json:"errors"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Ada", response.Data["user"]["name"])
+	assert.NotContains(t, response.Data, "tasks")
+	assert.Equal(t, http.StatusInternalServerError, response.Errors["tasks"].Status)
+}
+
+func TestAggregateAllFailed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{}, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.GET("/dashboard", proxy.Aggregate(config.CompositeRoute{
+		Path:     "/dashboard",
+		Requests: []config.CompositeRequest{{Key: "user", Service: "missing", Path: "/users"}},
+	}))
+
+	req, _ := http.NewRequest("GET", "/dashboard", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), `"user"`)
+}
+
+func TestAggregateEmptyResponses(t *testing.T) {
+	noContent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer noContent.Close()
+
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+	}))
+	defer empty.Close()
+
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"audit":    {BaseURL: noContent.URL},
+			"settings": {BaseURL: empty.URL},
+		},
+	}, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.GET("/dashboard", proxy.Aggregate(config.CompositeRoute{
+		Path: "/dashboard",
+		Requests: []config.CompositeRequest{
+			{Key: "audit", Service: "audit", Path: "/audit"},
+			{Key: "settings", Service: "settings", Path: "/settings"},
+		},
+	}))
+
+	req, _ := http.NewRequest("GET", "/dashboard", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":{"audit":null,"settings":null}}`, w.Body.String())
+}
+
+func TestAggregateSubRequestsPreparedLikeProxiedRequests(t *testing.T) {
+	signing := config.GatewaySigningConfig{
+		Enabled: true,
+		Secret:  "signing-secret",
+		Headers: []string{"X-Gateway", "X-Real-IP"},
+	}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"env":       r.Header.Get("X-Env"),
+			"real_ip":   r.Header.Get("X-Real-IP"),
+			"user":      r.Header.Get(UserIDHeader),
+			"signature": VerifyGatewaySignature(r, signing, time.Now()) == nil,
+		})
+	}))
+	defer backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"users": {BaseURL: backend.URL, RequestHeaders: config.HeaderTransform{Set: map[string]string{"X-Env": "prod"}}},
+		},
+		GatewaySigning: signing,
+	}, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.GET("/dashboard", proxy.Aggregate(config.CompositeRoute{
+		Path:     "/dashboard",
+		Requests: []config.CompositeRequest{{Key: "user", Service: "users", Path: "/users"}},
+	}))
+
+	req, _ := http.NewRequest("GET", "/dashboard", nil)
+	req.RemoteAddr = "203.0.113.9:5000"
+	req.Header.Set("X-Real-IP", "1.2.3.4")
+	req.Header.Set(UserIDHeader, "admin")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":{"user":{"env":"prod","real_ip":"203.0.113.9","user":"","signature":true}}}`, w.Body.String())
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned by a CredentialVerifier when the username or
+// password is wrong
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// VerifiedUser is the identity a CredentialVerifier vouches for. Its tenant, tier and
+// scope are carried by the access token like its roles.
+type VerifiedUser struct {
+	UserID   string   `json:"user_id"`
+	Email    string   `json:"email"`
+	Roles    []string `json:"roles"`
+	TenantID string   `json:"tenant_id,omitempty"`
+	Tier     string   `json:"tier,omitempty"`
+	Scope    string   `json:"scope,omitempty"` // Space-delimited, as in the token
+}
+
+// CredentialVerifier checks a username and password. It returns ErrInvalidCredentials
+// for wrong credentials and other errors when verification itself failed.
+type CredentialVerifier interface {
+	Verify(ctx context.Context, username, password string) (*VerifiedUser, error)
+}
+
+// StaticCredentialVerifier checks credentials against a fixed set of users with
+// bcrypt password hashes, for development and small deployments
+type StaticCredentialVerifier struct {
+	users map[string]config.LoginUser
+}
+
+// dummyPasswordHash is compared against for unknown users so that response times
+// don't reveal which usernames exist. It is generated on first use.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// NewStaticCredentialVerifier creates a verifier for the given users
+func NewStaticCredentialVerifier(users []config.LoginUser) *StaticCredentialVerifier {
+	v := &StaticCredentialVerifier{users: make(map[string]config.LoginUser, len(users))}
+	for _, user := range users {
+		v.users[user.Username] = user
+	}
+	return v
+}
+
+// Verify implements CredentialVerifier
+func (v *StaticCredentialVerifier) Verify(_ context.Context, username, password string) (*VerifiedUser, error) {
+	user, ok := v.users[username]
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &VerifiedUser{
+		UserID:   user.UserID,
+		Email:    user.Email,
+		Roles:    user.Roles,
+		TenantID: user.Tenant,
+		Tier:     user.Tier,
+		Scope:    strings.Join(user.Scopes, " "),
+	}, nil
+}
+
+// ServiceCredentialVerifier delegates verification to a backend service: credentials
+// are POSTed as JSON {"username","password"} and the service replies 200 with the
+// user as JSON, or 401/403 for wrong credentials
+type ServiceCredentialVerifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewServiceCredentialVerifier creates a verifier calling path on the service
+func NewServiceCredentialVerifier(endpoint config.ServiceEndpoint, path string) (*ServiceCredentialVerifier, error) {
+	transport, err := newHTTPTransport(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := endpoint.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &ServiceCredentialVerifier{
+		url:    strings.TrimSuffix(endpoint.BaseURL, "/") + path,
+		client: &http.Client{Transport: transport, Timeout: timeout},
+	}, nil
+}
+
+// Verify implements CredentialVerifier
+func (v *ServiceCredentialVerifier) Verify(ctx context.Context, username, password string) (*VerifiedUser, error) {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, ErrInvalidCredentials
+	default:
+		return nil, fmt.Errorf("credential service returned status %d", resp.StatusCode)
+	}
+
+	var user VerifiedUser
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("invalid credential service response: %w", err)
+	}
+	if user.UserID == "" {
+		return nil, fmt.Errorf("credential service response has no user_id")
+	}
+	return &user, nil
+}
+
+// NewCredentialVerifier creates the verifier selected by the login configuration
+func NewCredentialVerifier(cfg *config.Config) (CredentialVerifier, error) {
+	if cfg.Login.Verifier == "service" {
+		return NewServiceCredentialVerifier(cfg.Services[cfg.Login.Service], cfg.Login.VerifyPath)
+	}
+	return NewStaticCredentialVerifier(cfg.Login.Users), nil
+}
+
+// AuthHandler handles password login
+type AuthHandler struct {
+	config   *config.Config
+	verifier CredentialVerifier
+	guard    *middleware.LoginGuard
+	logger   *zap.Logger
+}
+
+// NewAuthHandler creates a new auth handler
+func NewAuthHandler(cfg *config.Config, verifier CredentialVerifier, guard *middleware.LoginGuard, logger *zap.Logger) *AuthHandler {
+	return &AuthHandler{
+		config:   cfg,
+		verifier: verifier,
+		guard:    guard,
+		logger:   logger,
+	}
+}
+
+// loginRequest is the body of a login request
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Login verifies the credentials and returns access and refresh tokens
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, middleware.CodeBadRequest, "username and password are required")
+		return
+	}
+
+	if retryAfter, locked := h.guard.ReserveAttempt(c, req.Username); locked {
+		middleware.RecordAudit(c, middleware.AuditEvent{
+			Type:     middleware.AuditLoginLocked,
+			Outcome:  middleware.AuditOutcomeDenied,
+			Username: req.Username,
+			Status:   middleware.CodeLoginLockedOut.Status(),
+		})
+		c.Header("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds())))))
+		middleware.AbortWithError(c, middleware.CodeLoginLockedOut, "Too many failed login attempts. Please try again later.")
+		return
+	}
+
+	user, err := h.verifier.Verify(c.Request.Context(), req.Username, req.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		// The reserved attempt stays counted as a failure
+		middleware.RecordAudit(c, middleware.AuditEvent{
+			Type:     middleware.AuditLoginFailure,
+			Outcome:  middleware.AuditOutcomeFailure,
+			Username: req.Username,
+			Status:   middleware.CodeInvalidCredentials.Status(),
+			Reason:   "invalid credentials",
+		})
+		h.logger.Warn("Failed login attempt",
+			zap.String("username", req.Username),
+			zap.String("ip", middleware.ClientIP(c)),
+		)
+		middleware.AbortWithError(c, middleware.CodeInvalidCredentials, "Invalid username or password")
+		return
+	}
+	if err != nil {
+		h.guard.ReleaseAttempt(c, req.Username)
+		h.logger.Error("Credential verification failed", zap.Error(err))
+		middleware.AbortWithError(c, middleware.CodeAuthUnavailable, "Credentials could not be verified")
+		return
+	}
+	h.guard.RecordSuccess(c, req.Username)
+
+	accessToken, err := middleware.GenerateTokenForClaims(&middleware.Claims{
+		UserID:   user.UserID,
+		Email:    user.Email,
+		Roles:    user.Roles,
+		TenantID: user.TenantID,
+		Tier:     user.Tier,
+		Scope:    user.Scope,
+	}, h.config)
+	if err != nil {
+		h.logger.Error("Failed to generate access token", zap.Error(err))
+		middleware.AbortWithError(c, middleware.CodeInternal, "Failed to generate token")
+		return
+	}
+	refreshToken, err := middleware.GenerateRefreshToken(user.UserID, h.config)
+	if err != nil {
+		h.logger.Error("Failed to generate refresh token", zap.Error(err))
+		middleware.AbortWithError(c, middleware.CodeInternal, "Failed to generate token")
+		return
+	}
+
+	middleware.RecordAudit(c, middleware.AuditEvent{
+		Type:     middleware.AuditLoginSuccess,
+		Outcome:  middleware.AuditOutcomeSuccess,
+		UserID:   user.UserID,
+		Username: req.Username,
+		Status:   http.StatusOK,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(h.config.JWT.TokenDuration.Seconds()),
+	})
+}
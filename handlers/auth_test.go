@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setupLoginRouter serves the login endpoint for a static user "alice" with password "correct-horse"
+func setupLoginRouter(t *testing.T, login config.LoginConfig, globals ...gin.HandlerFunc) (*gin.Engine, *config.Config) {
+	gin.SetMode(gin.TestMode)
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login.Users = []config.LoginUser{
+		{
+			Username: "alice", PasswordHash: string(hash), UserID: "42", Email: "alice@example.com", Roles: []string{"user"},
+			Tenant: "acme", Tier: "pro", Scopes: []string{"tasks:read", "tasks:write"},
+		},
+	}
+	cfg := &config.Config{
+		JWT:   config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour, RefreshDuration: 24 * time.Hour},
+		Login: login,
+	}
+
+	verifier, err := NewCredentialVerifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard := middleware.NewLoginGuard(cfg, nil)
+
+	router := gin.New()
+	router.Use(globals...)
+	router.POST("/login", guard.Middleware(), NewAuthHandler(cfg, verifier, guard, zap.NewNop()).Login)
+	return router, cfg
+}
+
+// postLogin sends a login request from the given client address
+func postLogin(router *gin.Engine, remoteAddr, username, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	req := httptest.NewRequest("POST", "/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+var defaultLoginConfig = config.LoginConfig{
+	Enabled:         true,
+	Verifier:        "static",
+	RequestsPerMin:  100,
+	MaxFailures:     3,
+	LockoutDuration: time.Minute,
+}
+
+func TestLoginSuccess(t *testing.T) {
+	router, _ := setupLoginRouter(t, defaultLoginConfig)
+
+	w := postLogin(router, "10.0.0.1:1234", "alice", "correct-horse")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.AccessToken)
+	assert.NotEmpty(t, response.RefreshToken)
+	assert.Equal(t, "Bearer", response.TokenType)
+	assert.Equal(t, 3600, response.ExpiresIn)
+}
+
+func TestLoginAccessTokenAuthenticates(t *testing.T) {
+	router, cfg := setupLoginRouter(t, defaultLoginConfig)
+	router.GET("/me", middleware.AuthMiddleware(cfg), func(c *gin.Context) {
+		claims, _ := middleware.GetUserFromContext(c)
+		c.JSON(http.StatusOK, gin.H{
+			"user_id": claims.UserID, "roles": claims.Roles,
+			"tenant_id": claims.TenantID, "tier": claims.Tier, "scope": claims.Scope,
+		})
+	})
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	json.Unmarshal(postLogin(router, "10.0.0.1:1234", "alice", "correct-horse").Body.Bytes(), &tokens)
+
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"user_id":"42","roles":["user"],"tenant_id":"acme","tier":"pro","scope":"tasks:read tasks:write"}`, w.Body.String())
+}
+
+func TestLoginRefreshTokenDoesNotAuthenticate(t *testing.T) {
+	router, cfg := setupLoginRouter(t, defaultLoginConfig)
+	router.GET("/me", middleware.AuthMiddleware(cfg), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	var tokens struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.Unmarshal(postLogin(router, "10.0.0.1:1234", "alice", "correct-horse").Body.Bytes(), &tokens)
+
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.RefreshToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), middleware.ErrNotAccessToken.Error())
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	router, _ := setupLoginRouter(t, defaultLoginConfig)
+
+	for _, username := range []string{"alice", "mallory"} {
+		w := postLogin(router, "10.0.0.1:1234", username, "wrong")
+		assert.Equal(t, http.StatusUnauthorized, w.Code, username)
+		assert.NotContains(t, w.Body.String(), "token")
+	}
+}
+
+func TestLoginMissingFields(t *testing.T) {
+	router, _ := setupLoginRouter(t, defaultLoginConfig)
+
+	w := postLogin(router, "10.0.0.1:1234", "alice", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLoginLockout(t *testing.T) {
+	router, _ := setupLoginRouter(t, defaultLoginConfig)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, postLogin(router, "10.0.0.1:1234", "alice", "wrong").Code)
+	}
+
+	// Locked out even with the right password, from the same IP or another one
+	for _, addr := range []string{"10.0.0.1:1234", "10.0.0.2:1234"} {
+		w := postLogin(router, addr, "alice", "correct-horse")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, addr)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	}
+
+	// The locked-out IP can't try other accounts either
+	assert.Equal(t, http.StatusTooManyRequests, postLogin(router, "10.0.0.1:1234", "bob", "whatever").Code)
+}
+
+// slowVerifier verifies credentials after a delay
+type slowVerifier struct {
+	CredentialVerifier
+	delay time.Duration
+}
+
+func (v slowVerifier) Verify(ctx context.Context, username, password string) (*VerifiedUser, error) {
+	time.Sleep(v.delay)
+	return v.CredentialVerifier.Verify(ctx, username, password)
+}
+
+func TestLoginLockoutConcurrentAttempts(t *testing.T) {
+	router, cfg := setupLoginRouter(t, defaultLoginConfig)
+	verifier, _ := NewCredentialVerifier(cfg)
+	guard := middleware.NewLoginGuard(cfg, nil)
+	router.POST("/slow-login", NewAuthHandler(cfg, slowVerifier{verifier, 50 * time.Millisecond}, guard, zap.NewNop()).Login)
+
+	// A burst of guesses, each from its own address, arrives before any is verified
+	codes := make([]int, 20)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body, _ := json.Marshal(map[string]string{"username": "alice", "password": "wrong"})
+			req := httptest.NewRequest("POST", "/slow-login", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.RemoteAddr = fmt.Sprintf("10.0.1.%d:1234", i)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	verified := 0
+	for _, code := range codes {
+		if code == http.StatusUnauthorized {
+			verified++
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, code)
+		}
+	}
+	assert.Equal(t, defaultLoginConfig.MaxFailures, verified, "only MaxFailures guesses are checked")
+}
+
+func TestLoginSuccessResetsUserFailures(t *testing.T) {
+	router, _ := setupLoginRouter(t, defaultLoginConfig)
+
+	postLogin(router, "10.0.0.1:1234", "alice", "wrong")
+	postLogin(router, "10.0.0.2:1234", "alice", "wrong")
+	assert.Equal(t, http.StatusOK, postLogin(router, "10.0.0.3:1234", "alice", "correct-horse").Code)
+
+	postLogin(router, "10.0.0.4:1234", "alice", "wrong")
+	assert.Equal(t, http.StatusOK, postLogin(router, "10.0.0.5:1234", "alice", "correct-horse").Code)
+}
+
+func TestLoginStrictRateLimit(t *testing.T) {
+	login := defaultLoginConfig
+	login.RequestsPerMin = 2
+	router, _ := setupLoginRouter(t, login)
+
+	assert.Equal(t, http.StatusOK, postLogin(router, "10.0.0.1:1234", "alice", "correct-horse").Code)
+	assert.Equal(t, http.StatusOK, postLogin(router, "10.0.0.1:1234", "alice", "correct-horse").Code)
+	w := postLogin(router, "10.0.0.1:1234", "alice", "correct-horse")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.True(t, retryAfter >= 1 && retryAfter <= 60, "Retry-After rounds up: %d", retryAfter)
+	assert.Equal(t, http.StatusOK, postLogin(router, "10.0.0.2:1234", "alice", "correct-horse").Code)
+}
+
+// auditEvents collects audit events
+type auditEvents struct {
+	mu     sync.Mutex
+	events []middleware.AuditEvent
+}
+
+func (s *auditEvents) Write(ctx context.Context, event middleware.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestLoginAudit(t *testing.T) {
+	sink := &auditEvents{}
+	auditor := middleware.NewAuditorWithSink(sink, zap.NewNop())
+	login := defaultLoginConfig
+	login.MaxFailures = 1
+	router, _ := setupLoginRouter(t, login, auditor.Middleware())
+
+	postLogin(router, "10.0.0.1:1234", "alice", "correct-horse")
+	postLogin(router, "10.0.0.2:1234", "alice", "wrong")
+	postLogin(router, "10.0.0.2:1234", "alice", "correct-horse")
+	auditor.Close()
+
+	if assert.Len(t, sink.events, 3) {
+		assert.Equal(t, middleware.AuditLoginSuccess, sink.events[0].Type)
+		assert.Equal(t, "42", sink.events[0].UserID)
+		assert.Equal(t, middleware.AuditLoginFailure, sink.events[1].Type)
+		assert.Equal(t, "alice", sink.events[1].Username)
+		assert.Equal(t, "10.0.0.2", sink.events[1].IP)
+		assert.Equal(t, middleware.AuditLoginLocked, sink.events[2].Type)
+		assert.Equal(t, middleware.AuditOutcomeDenied, sink.events[2].Outcome)
+	}
+}
+
+func TestServiceCredentialVerifier(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var creds map[string]string
+		json.NewDecoder(r.Body).Decode(&creds)
+		if r.URL.Path != "/auth/verify" || creds["password"] != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(VerifiedUser{
+			UserID: "7", Email: creds["username"] + "@example.com", Roles: []string{"hr"},
+			TenantID: "acme", Tier: "enterprise", Scope: "employees:read",
+		})
+	}))
+	defer backend.Close()
+
+	verifier, err := NewServiceCredentialVerifier(config.ServiceEndpoint{BaseURL: backend.URL}, "/auth/verify")
+	assert.NoError(t, err)
+
+	user, err := verifier.Verify(context.Background(), "bob", "secret")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &VerifiedUser{
+			UserID: "7", Email: "bob@example.com", Roles: []string{"hr"},
+			TenantID: "acme", Tier: "enterprise", Scope: "employees:read",
+		}, user)
+	}
+
+	_, err = verifier.Verify(context.Background(), "bob", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"time"
+)
+
+// bulkhead caps the requests in flight to a service so a slow backend can't tie up
+// the gateway's resources at the expense of other services
+type bulkhead struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+// newBulkhead returns a bulkhead admitting maxConcurrent requests, or nil when unlimited
+func newBulkhead(maxConcurrent int, queueTimeout time.Duration) *bulkhead {
+	if maxConcurrent <= 0 {
+		return nil
+	}
+	return &bulkhead{slots: make(chan struct{}, maxConcurrent), queueTimeout: queueTimeout}
+}
+
+// acquire takes a slot, waiting up to the queue timeout for one to free up. It returns
+// the function releasing the slot, or false when the request must be shed.
+func (b *bulkhead) acquire(ctx context.Context) (func(), bool) {
+	select {
+	case b.slots <- struct{}{}:
+		return b.release, true
+	default:
+	}
+	if b.queueTimeout <= 0 {
+		return nil, false
+	}
+
+	timer := time.NewTimer(b.queueTimeout)
+	defer timer.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		return b.release, true
+	case <-timer.C:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+func (b *bulkhead) release() {
+	<-b.slots
+}
+
+// inFlight returns the number of requests holding a slot
+func (b *bulkhead) inFlight() int {
+	return len(b.slots)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newBlockingBackend holds every request until release is closed
+func newBlockingBackend(t *testing.T) (*httptest.Server, chan struct{}) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend, release
+}
+
+// waitInFlight waits until n requests hold a slot of the backend service's bulkhead
+func waitInFlight(t *testing.T, proxy *ProxyHandler, n int) {
+	svc, _ := proxy.service("backend")
+	assert.Eventually(t, func() bool { return svc.bulkhead.inFlight() == n }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestBulkheadShedsExcessRequests(t *testing.T) {
+	backend, release := newBlockingBackend(t)
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL, MaxConcurrent: 2}},
+	}, "backend")
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = sendRequest(t, "GET", gateway.URL+"/svc/slow", "").Code
+		}(i)
+	}
+	waitInFlight(t, proxy, 2)
+
+	start := time.Now()
+	assert.Equal(t, http.StatusServiceUnavailable, sendRequest(t, "GET", gateway.URL+"/svc/slow", "").Code)
+	assert.Less(t, time.Since(start), time.Second, "excess requests are rejected without waiting")
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK}, codes)
+	waitInFlight(t, proxy, 0)
+	assert.Equal(t, http.StatusOK, sendRequest(t, "GET", gateway.URL+"/svc/slow", "").Code)
+}
+
+func TestBulkheadQueuesUntilSlotFrees(t *testing.T) {
+	backend, release := newBlockingBackend(t)
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL, MaxConcurrent: 1, QueueTimeout: 5 * time.Second}},
+	}, "backend")
+
+	first := make(chan int, 1)
+	go func() { first <- sendRequest(t, "GET", gateway.URL+"/svc/slow", "").Code }()
+	waitInFlight(t, proxy, 1)
+
+	queued := make(chan int, 1)
+	go func() { queued <- sendRequest(t, "GET", gateway.URL+"/svc/slow", "").Code }()
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, http.StatusOK, <-first)
+	assert.Equal(t, http.StatusOK, <-queued)
+}
+
+func TestBulkheadQueueTimeout(t *testing.T) {
+	backend, release := newBlockingBackend(t)
+	defer close(release)
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL, MaxConcurrent: 1, QueueTimeout: 100 * time.Millisecond}},
+	}, "backend")
+
+	go sendRequest(t, "GET", gateway.URL+"/svc/slow", "")
+	waitInFlight(t, proxy, 1)
+
+	start := time.Now()
+	assert.Equal(t, http.StatusServiceUnavailable, sendRequest(t, "GET", gateway.URL+"/svc/slow", "").Code)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestBulkheadReleasesOnTimeout(t *testing.T) {
+	backend, release := newBlockingBackend(t)
+	defer close(release)
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL, MaxConcurrent: 1, Timeout: 100 * time.Millisecond}},
+	}, "backend")
+
+	assert.Equal(t, http.StatusGatewayTimeout, sendRequest(t, "GET", gateway.URL+"/svc/slow", "").Code)
+	waitInFlight(t, proxy, 0)
+}
+
+func TestBulkheadReleasesOnPanic(t *testing.T) {
+	// The response breaks off mid-body, which aborts the handler with a panic
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "partial")
+		w.(http.Flusher).Flush()
+		conn, _, _ := http.NewResponseController(w).Hijack()
+		conn.Close()
+	}))
+	defer backend.Close()
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL, MaxConcurrent: 1}},
+	}, "backend")
+
+	resp, err := http.Get(gateway.URL + "/svc/broken")
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	waitInFlight(t, proxy, 0)
+}
@@ -0,0 +1,608 @@
+package handlers
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Response cache defaults
+const (
+	defaultCacheTTL            = time.Minute
+	defaultCacheMaxEntries     = 1000
+	defaultCacheMaxBodySize    = 1 << 20
+	defaultCacheRefreshTimeout = 30 * time.Second
+)
+
+// cacheStatusHeader tells clients whether the gateway answered from its cache
+const cacheStatusHeader = "X-Cache"
+
+// notModifiedHeaders are the cached headers repeated on a 304
+var notModifiedHeaders = []string{"Cache-Control", "Content-Location", "ETag", "Expires", "Last-Modified", "Vary"}
+
+// responseCache is an in-memory cache of backend responses, evicting the least
+// recently used entries beyond its size. Expired entries may still be served stale
+// while a request refreshes them.
+type responseCache struct {
+	ttl            time.Duration
+	maxEntries     int
+	maxBodySize    int64
+	staleWindow    time.Duration
+	softBudget     time.Duration
+	refreshTimeout time.Duration    // Bounds a refresh that outlives the client's request
+	now            func() time.Time // replaced in tests
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // Of *cachedResponse, most recently used first
+	refreshing map[string]bool
+}
+
+// cachedResponse is a backend response held in the cache
+type cachedResponse struct {
+	key        string
+	status     int
+	header     http.Header
+	body       []byte
+	vary       map[string]string // Request headers the response varies on, as first requested
+	storedAt   time.Time
+	expires    time.Time
+	staleUntil time.Time // Until when it may be served stale; expires when it may not
+}
+
+// newResponseCache creates the cache of a service, or nil when caching is disabled.
+// Refreshes of stale entries are bounded by the service's timeout.
+func newResponseCache(cfg config.ResponseCacheConfig, timeout time.Duration) *responseCache {
+	if !cfg.Enabled {
+		return nil
+	}
+	c := &responseCache{
+		ttl:            cfg.TTL,
+		maxEntries:     cfg.MaxEntries,
+		maxBodySize:    cfg.MaxBodySize,
+		staleWindow:    cfg.StaleWhileRevalidate,
+		softBudget:     cfg.SoftBudget,
+		refreshTimeout: durationOr(timeout, defaultCacheRefreshTimeout),
+		now:            time.Now,
+		entries:        make(map[string]*list.Element),
+		lru:            list.New(),
+		refreshing:     make(map[string]bool),
+	}
+	if c.ttl <= 0 {
+		c.ttl = defaultCacheTTL
+	}
+	if c.maxEntries <= 0 {
+		c.maxEntries = defaultCacheMaxEntries
+	}
+	if c.maxBodySize <= 0 {
+		c.maxBodySize = defaultCacheMaxBodySize
+	}
+	return c
+}
+
+// cacheKey identifies a request to a service in its cache. GET and HEAD share entries.
+// The tenant of tenant-routed requests follows a "#", which a request URI never holds.
+func cacheKey(service string, req *http.Request, tenant string) string {
+	key := service + ":" + req.URL.RequestURI()
+	if tenant != "" {
+		key += "#" + tenant
+	}
+	return key
+}
+
+// lookup returns the response cached for the request, if it is fresh or may still be
+// served stale, and whether it is fresh
+func (c *responseCache) lookup(key string, req *http.Request) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cachedResponse)
+	now := c.now()
+	if !now.Before(entry.staleUntil) || !entry.matchesVary(req) {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry, now.Before(entry.expires)
+}
+
+// purge removes the entries whose key matches, returning how many it removed
+func (c *responseCache) purge(match func(key string) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := 0
+	for key, element := range c.entries {
+		if match(key) {
+			c.lru.Remove(element)
+			delete(c.entries, key)
+			purged++
+		}
+	}
+	return purged
+}
+
+// beginRefresh claims the refresh of a stale entry, reporting false when another
+// request is already refreshing it
+func (c *responseCache) beginRefresh(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing[key] {
+		return false
+	}
+	c.refreshing[key] = true
+	return true
+}
+
+// endRefresh releases the refresh of an entry
+func (c *responseCache) endRefresh(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.refreshing, key)
+}
+
+// store adds a response, replacing any for the same key
+func (c *responseCache) store(entry *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[entry.key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// freshness returns how long a response may be served from the cache and for how long
+// after that it may be served stale, reporting false when it must not be cached.
+// Responses to requests with credentials are only shared when the backend allows it
+// explicitly. The backend's stale-while-revalidate and must-revalidate directives take
+// precedence over the configured stale window.
+func (c *responseCache) freshness(resp *http.Response, credentialed bool) (time.Duration, time.Duration, bool) {
+	if resp.StatusCode != http.StatusOK || resp.Request == nil || resp.Request.Method != http.MethodGet {
+		return 0, 0, false
+	}
+	if len(resp.Header.Values("Set-Cookie")) > 0 {
+		return 0, 0, false
+	}
+
+	directives := cacheControl(resp.Header)
+	for _, name := range []string{"no-store", "private", "no-cache"} {
+		if _, ok := directives[name]; ok {
+			return 0, 0, false
+		}
+	}
+	_, public := directives["public"]
+	sharedMaxAge, shared := directives["s-maxage"]
+	if credentialed && !public && !shared {
+		return 0, 0, false
+	}
+
+	stale := c.staleWindow
+	if value, ok := directives["stale-while-revalidate"]; ok {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			stale = time.Duration(seconds) * time.Second
+		}
+	}
+	for _, name := range []string{"must-revalidate", "proxy-revalidate"} {
+		if _, ok := directives[name]; ok {
+			stale = 0
+		}
+	}
+
+	ttl := c.ttl
+	maxAge, ok := sharedMaxAge, shared
+	if !ok {
+		maxAge, ok = directives["max-age"]
+	}
+	if ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return 0, 0, false
+		}
+		ttl = min(ttl, time.Duration(seconds)*time.Second)
+	}
+	return ttl, max(stale, 0), ttl > 0
+}
+
+// cacheControl parses the Cache-Control directives of a header, by lowercase name
+func cacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// matchesVary reports whether req carries the request headers the response was
+// selected by
+func (e *cachedResponse) matchesVary(req *http.Request) bool {
+	for name, value := range e.vary {
+		if strings.Join(req.Header.Values(name), ",") != value {
+			return false
+		}
+	}
+	return true
+}
+
+// prepare returns the status and headers answering req from the cached response, with
+// 304 when its validators match, and whether the body is sent. cacheStatus is reported
+// in X-Cache.
+func (e *cachedResponse) prepare(req *http.Request, now time.Time, cacheStatus string) (int, http.Header, bool) {
+	header := make(http.Header)
+	status, withBody := e.status, req.Method != http.MethodHead
+	if notModified(req, e.header) {
+		for _, name := range notModifiedHeaders {
+			if values := e.header.Values(name); len(values) > 0 {
+				header[name] = append([]string(nil), values...)
+			}
+		}
+		status, withBody = http.StatusNotModified, false
+	} else {
+		for name, values := range e.header {
+			header[name] = append([]string(nil), values...)
+		}
+	}
+	header.Set("Age", strconv.Itoa(int(now.Sub(e.storedAt)/time.Second)))
+	header.Set(cacheStatusHeader, cacheStatus)
+	return status, header, withBody
+}
+
+// write answers req from the cached response
+func (e *cachedResponse) write(w http.ResponseWriter, req *http.Request, now time.Time) {
+	status, header, withBody := e.prepare(req, now, "HIT")
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(status)
+	if withBody {
+		w.Write(e.body)
+	}
+}
+
+// response returns the cached response as served stale in place of the backend's
+func (e *cachedResponse) response(req *http.Request, now time.Time) *http.Response {
+	status, header, withBody := e.prepare(req, now, "STALE")
+	resp := &http.Response{
+		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       http.NoBody,
+		Request:    req,
+	}
+	if withBody {
+		resp.Body = io.NopCloser(bytes.NewReader(e.body))
+		resp.ContentLength = int64(len(e.body))
+	}
+	return resp
+}
+
+// notModified reports whether the conditional headers of req match a response with
+// the given headers. If-None-Match takes precedence over If-Modified-Since.
+func notModified(req *http.Request, header http.Header) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, header.Get("ETag"))
+	}
+	if ifModifiedSince := req.Header.Get("If-Modified-Since"); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+		modified, err := http.ParseTime(header.Get("Last-Modified"))
+		return err == nil && !modified.After(since)
+	}
+	return false
+}
+
+// etagMatches reports whether an If-None-Match list matches etag, using the weak
+// comparison
+func etagMatches(list, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// serveCached answers a GET or HEAD request from the cache when it holds a fresh
+// response, reporting whether it did. Otherwise the request is marked so that the
+// backend's response is stored, along with a stale response the proxy may serve in its
+// place. Conditional headers still reach the backend on a miss.
+func serveCached(c *gin.Context, cache *responseCache, key string) bool {
+	if cache == nil || middleware.IsUpgradeRequest(c.Request) {
+		return false
+	}
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+
+	// Clients asking for a fresh copy bypass the cache, which still stores the response
+	var stale *cachedResponse
+	if _, ok := cacheControl(c.Request.Header)["no-cache"]; !ok && c.Request.Header.Get("Pragma") != "no-cache" {
+		if entry, fresh := cache.lookup(key, c.Request); fresh {
+			entry.write(c.Writer, c.Request, cache.now())
+			return true
+		} else if entry != nil {
+			stale = entry
+		}
+	}
+
+	target := &cacheTarget{
+		cache:        cache,
+		key:          key,
+		header:       c.Request.Header.Clone(),
+		credentialed: credentialed(c),
+		stale:        stale,
+	}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), cacheTargetKey{}, target))
+	return false
+}
+
+// credentialed reports whether the request carries credentials or was authenticated,
+// by any auth scheme, so that its response may be specific to the caller
+func credentialed(c *gin.Context) bool {
+	if _, ok := middleware.GetUserFromContext(c); ok {
+		return true
+	}
+	for _, name := range []string{"Authorization", "Cookie", middleware.APIKeyHeader} {
+		if c.Request.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return c.Request.TLS != nil && len(c.Request.TLS.PeerCertificates) > 0
+}
+
+// cacheTarget is where the response to a request missing the cache is stored
+type cacheTarget struct {
+	cache        *responseCache
+	key          string
+	header       http.Header // The client's request headers, for Vary
+	credentialed bool
+	stale        *cachedResponse // Expired entry that may be served while refreshing it
+	served       *http.Response  // The stale response served in place of the backend's
+}
+
+// cacheTargetKey is the context key of a request's cacheTarget
+type cacheTargetKey struct{}
+
+// captureForCache stores the backend's response to a request that missed the cache
+// once its body has been read in full, if it may be cached
+func captureForCache(resp *http.Response) {
+	if resp.Request == nil {
+		return
+	}
+	target, ok := resp.Request.Context().Value(cacheTargetKey{}).(*cacheTarget)
+	if !ok || resp == target.served {
+		return
+	}
+	resp.Header.Set(cacheStatusHeader, "MISS")
+
+	ttl, stale, ok := target.cache.freshness(resp, target.credentialed)
+	if !ok || resp.ContentLength > target.cache.maxBodySize {
+		return
+	}
+	vary := make(map[string]string)
+	for _, value := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return
+			}
+			if name != "" {
+				vary[name] = strings.Join(target.header.Values(name), ",")
+			}
+		}
+	}
+
+	header := resp.Header.Clone()
+	status := resp.StatusCode
+	resp.Body = &cachingBody{ReadCloser: resp.Body, limit: target.cache.maxBodySize, done: func(body []byte) {
+		now := target.cache.now()
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		target.cache.store(&cachedResponse{
+			key:        target.key,
+			status:     status,
+			header:     header,
+			body:       body,
+			vary:       vary,
+			storedAt:   now,
+			expires:    now.Add(ttl),
+			staleUntil: now.Add(ttl + stale),
+		})
+	}}
+}
+
+// staleTransport lets the proxy serve a stale cached response when the backend does
+// not respond within the cache's soft budget or cannot be reached. The backend request
+// then continues in the background, bounded by the refresh timeout, and refreshes the
+// entry when it completes. Requests without a stale entry pass through.
+type staleTransport struct {
+	next http.RoundTripper
+	// modifyResponse is the proxy's, applied to responses arriving after the stale one
+	// was served so they are stored as if proxied
+	modifyResponse func(*http.Response) error
+}
+
+// roundTripResult is the outcome of a backend round trip
+type roundTripResult struct {
+	resp *http.Response
+	err  error
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *staleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, ok := req.Context().Value(cacheTargetKey{}).(*cacheTarget)
+	if !ok || target.stale == nil {
+		return t.next.RoundTrip(req)
+	}
+	cache := target.cache
+	if !cache.beginRefresh(target.key) {
+		// Another request is already refreshing the entry
+		return t.serveStale(req, target), nil
+	}
+
+	// The backend request is cancelled with the client's, unless the stale response
+	// was served
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), cache.refreshTimeout)
+	detach := context.AfterFunc(req.Context(), cancel)
+	results := make(chan roundTripResult, 1)
+	go func() {
+		resp, err := t.next.RoundTrip(req.WithContext(ctx))
+		results <- roundTripResult{resp: resp, err: err}
+	}()
+
+	budget := time.NewTimer(cache.softBudget)
+	defer budget.Stop()
+	select {
+	case result := <-results:
+		cache.endRefresh(target.key)
+		if result.err != nil {
+			cancel()
+			return t.serveStale(req, target), nil
+		}
+		result.resp.Body = &cancelingBody{ReadCloser: result.resp.Body, cancel: cancel}
+		return result.resp, nil
+	case <-budget.C:
+	}
+
+	detach()
+	go func() {
+		defer cancel()
+		defer cache.endRefresh(target.key)
+		result := <-results
+		if result.err != nil {
+			return
+		}
+		defer result.resp.Body.Close()
+		if t.modifyResponse == nil || t.modifyResponse(result.resp) == nil {
+			io.Copy(io.Discard, result.resp.Body)
+		}
+	}()
+	return t.serveStale(req, target), nil
+}
+
+// serveStale returns the stale response of target, marked so it is not stored again
+func (t *staleTransport) serveStale(req *http.Request, target *cacheTarget) *http.Response {
+	resp := target.stale.response(req, target.cache.now())
+	target.served = resp
+	return resp
+}
+
+// cancelingBody cancels the context of its request once closed
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// cachingBody keeps a copy of a body up to limit bytes, calling done with it once the
+// body was read to the end. Bodies over the limit or closed early are not kept.
+type cachingBody struct {
+	io.ReadCloser
+	buf   bytes.Buffer
+	limit int64
+	done  func(body []byte)
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.done == nil {
+		return n, err
+	}
+	if int64(b.buf.Len()+n) > b.limit {
+		b.done = nil
+		b.buf = bytes.Buffer{}
+		return n, err
+	}
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.done(b.buf.Bytes())
+		b.done = nil
+	}
+	return n, err
+}
+
+// FlushCache removes responses from the caches of every service: the entry with the
+// key query parameter, the entries whose key starts with prefix, or all entries when
+// neither is given. Keys are the service name and the backend request URI, e.g.
+// "assets:/app.js?v=2", followed by the tenant for tenant-routed services, e.g.
+// "users:/plans#acme".
+func (p *ProxyHandler) FlushCache(c *gin.Context) {
+	key, prefix := c.Query("key"), c.Query("prefix")
+	if key != "" && prefix != "" {
+		middleware.AbortWithError(c, middleware.CodeBadRequest, "key and prefix are mutually exclusive")
+		return
+	}
+	match := func(string) bool { return true }
+	target := "*"
+	switch {
+	case key != "":
+		match = func(k string) bool { return k == key }
+		target = key
+	case prefix != "":
+		match = func(k string) bool { return strings.HasPrefix(k, prefix) }
+		target = prefix + "*"
+	}
+
+	p.mu.RLock()
+	caches := make([]*responseCache, 0, len(p.services)+len(p.externalCaches))
+	for _, svc := range p.services {
+		if svc.cache != nil {
+			caches = append(caches, svc.cache)
+		}
+	}
+	for _, cache := range p.externalCaches {
+		caches = append(caches, cache)
+	}
+	p.mu.RUnlock()
+
+	purged := 0
+	for _, cache := range caches {
+		purged += cache.purge(match)
+	}
+
+	middleware.RecordAudit(c, middleware.AuditEvent{Type: middleware.AuditCacheFlush, Outcome: middleware.AuditOutcomeSuccess, Target: target})
+	p.logger.Warn("Response cache flushed", zap.String("target", target), zap.Int("purged", purged))
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestResponseCacheConditionalRequests(t *testing.T) {
+	var calls atomic.Int32
+	var forwardedIfNoneMatch atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		forwardedIfNoneMatch.Store(r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Write([]byte("console.log('app')"))
+	}))
+	defer backend.Close()
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"assets": {
+			BaseURL: backend.URL,
+			Cache:   config.ResponseCacheConfig{Enabled: true, TTL: time.Minute},
+		}},
+	}, "assets")
+	get := func(path string, headers ...string) gatewayResponse {
+		return sendRequest(t, "GET", gateway.URL+path, "", headers...)
+	}
+
+	// A miss forwards conditional headers, and the backend's 304 passes through
+	resp := get("/svc/other.js", "If-None-Match", `"v1"`)
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+	assert.Equal(t, `"v1"`, forwardedIfNoneMatch.Load())
+
+	resp = get("/svc/app.js")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "MISS", resp.Header.Get("X-Cache"))
+	assert.Equal(t, int32(2), calls.Load())
+
+	// A matching validator gets 304 from the cache, keeping ETag and Last-Modified
+	resp = get("/svc/app.js", "If-None-Match", `W/"v0", "v1"`)
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+	assert.Equal(t, "HIT", resp.Header.Get("X-Cache"))
+	assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", resp.Header.Get("Last-Modified"))
+	assert.Empty(t, resp.Body)
+
+	resp = get("/svc/app.js", "If-Modified-Since", "Mon, 02 Jan 2006 15:04:05 GMT")
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+
+	// A mismatch gets the full cached response
+	resp = get("/svc/app.js", "If-None-Match", `"v0"`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "HIT", resp.Header.Get("X-Cache"))
+	assert.Equal(t, "console.log('app')", resp.Body)
+	assert.Equal(t, "application/javascript", resp.Header.Get("Content-Type"))
+
+	resp = get("/svc/app.js", "If-Modified-Since", "Sun, 01 Jan 2006 15:04:05 GMT")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "console.log('app')", resp.Body)
+
+	assert.Equal(t, int32(2), calls.Load(), "hits must not reach the backend")
+}
+
+func TestResponseCacheExpiry(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=10")
+		w.Write([]byte("body"))
+	}))
+	defer backend.Close()
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"assets": {
+			BaseURL: backend.URL,
+			Cache:   config.ResponseCacheConfig{Enabled: true, TTL: time.Minute},
+		}},
+	}, "assets")
+	svc, _ := proxy.service("assets")
+	cache := svc.cache
+
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	get := func() { sendRequest(t, "GET", gateway.URL+"/svc/data", "") }
+
+	get()
+	get()
+	assert.Equal(t, int32(1), calls.Load())
+
+	// The backend's max-age is shorter than the configured TTL
+	now = now.Add(11 * time.Second)
+	get()
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestResponseCacheSkipsUncacheable(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/cookie":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		case "/public":
+			w.Header().Set("Cache-Control", "public")
+		case "/vary-all":
+			w.Header().Set("Vary", "*")
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte("body"))
+	}))
+	defer backend.Close()
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"assets": {
+			BaseURL: backend.URL,
+			Cache:   config.ResponseCacheConfig{Enabled: true, TTL: time.Minute},
+		}},
+	}, "assets")
+
+	twice := func(path string, headers ...string) int32 {
+		calls.Store(0)
+		sendRequest(t, "GET", gateway.URL+path, "", headers...)
+		sendRequest(t, "GET", gateway.URL+path, "", headers...)
+		return calls.Load()
+	}
+
+	for _, path := range []string{"/svc/no-store", "/svc/cookie", "/svc/vary-all", "/svc/error"} {
+		assert.Equal(t, int32(2), twice(path), path)
+	}
+	assert.Equal(t, int32(2), twice("/svc/private-data", "Authorization", "Bearer token"))
+	assert.Equal(t, int32(1), twice("/svc/public", "Authorization", "Bearer token"))
+
+	// Non-GET requests are never answered from the cache
+	calls.Store(0)
+	sendRequest(t, "POST", gateway.URL+"/svc/public", "")
+	sendRequest(t, "POST", gateway.URL+"/svc/public", "")
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestResponseCacheServesStaleWithinSoftBudget(t *testing.T) {
+	var calls atomic.Int32
+	var delay atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		time.Sleep(time.Duration(delay.Load()))
+		fmt.Fprintf(w, "v%d", n)
+	}))
+	defer backend.Close()
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"assets": {BaseURL: backend.URL, Cache: config.ResponseCacheConfig{
+			Enabled: true, TTL: 10 * time.Second, StaleWhileRevalidate: time.Minute, SoftBudget: 50 * time.Millisecond,
+		}}},
+	}, "assets")
+	svc, _ := proxy.service("assets")
+	cache := svc.cache
+
+	var now atomic.Int64
+	now.Store(time.Now().UnixNano())
+	cache.now = func() time.Time { return time.Unix(0, now.Load()) }
+	advance := func(d time.Duration) { now.Add(int64(d)) }
+
+	resp := sendRequest(t, "GET", gateway.URL+"/svc/report", "")
+	assert.Equal(t, "v1", resp.Body)
+	assert.Equal(t, "MISS", resp.Header.Get("X-Cache"))
+
+	// Past its TTL, a slow backend gets the stale response served within the budget
+	advance(11 * time.Second)
+	delay.Store(int64(300 * time.Millisecond))
+	start := time.Now()
+	resp = sendRequest(t, "GET", gateway.URL+"/svc/report", "")
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "v1", resp.Body)
+	assert.Equal(t, "STALE", resp.Header.Get("X-Cache"))
+	assert.Equal(t, "11", resp.Header.Get("Age"))
+
+	// The backend's late response refreshes the entry in the background
+	assert.Eventually(t, func() bool {
+		entry, fresh := cache.lookup("assets:/report", httptest.NewRequest("GET", "/report", nil))
+		return fresh && string(entry.body) == "v2"
+	}, 2*time.Second, 10*time.Millisecond)
+	resp = sendRequest(t, "GET", gateway.URL+"/svc/report", "")
+	assert.Equal(t, "v2", resp.Body)
+	assert.Equal(t, "HIT", resp.Header.Get("X-Cache"))
+
+	// A backend responding within the budget is served directly
+	advance(11 * time.Second)
+	delay.Store(0)
+	resp = sendRequest(t, "GET", gateway.URL+"/svc/report", "")
+	assert.Equal(t, "v3", resp.Body)
+	assert.Equal(t, "MISS", resp.Header.Get("X-Cache"))
+
+	// Beyond the stale window the backend is waited for
+	advance(2 * time.Minute)
+	delay.Store(int64(100 * time.Millisecond))
+	resp = sendRequest(t, "GET", gateway.URL+"/svc/report", "")
+	assert.Equal(t, "v4", resp.Body)
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestFlushResponseCache(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte("body"))
+	}))
+	defer backend.Close()
+	router, proxy := newServiceRouter(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"assets": {
+			BaseURL: backend.URL,
+			Cache:   config.ResponseCacheConfig{Enabled: true, TTL: time.Minute},
+		}},
+	}, "assets")
+	router.DELETE("/admin/cache", proxy.FlushCache)
+	gateway := httptest.NewServer(router)
+	t.Cleanup(gateway.Close)
+
+	cached := func(path string) bool {
+		before := calls.Load()
+		sendRequest(t, "GET", gateway.URL+path, "")
+		return calls.Load() == before
+	}
+	for _, path := range []string{"/svc/app.js", "/svc/img/a.png", "/svc/img/b.png"} {
+		assert.False(t, cached(path), path)
+		assert.True(t, cached(path), path)
+	}
+
+	// A single entry
+	resp := sendRequest(t, "DELETE", gateway.URL+"/admin/cache?key=assets:/app.js", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"purged":1}`, resp.Body)
+	assert.False(t, cached("/svc/app.js"))
+	assert.True(t, cached("/svc/img/a.png"))
+
+	// Entries under a prefix
+	resp = sendRequest(t, "DELETE", gateway.URL+"/admin/cache?prefix=assets:/img/", "")
+	assert.JSONEq(t, `{"purged":2}`, resp.Body)
+	assert.False(t, cached("/svc/img/a.png"))
+	assert.True(t, cached("/svc/app.js"))
+
+	// Everything
+	resp = sendRequest(t, "DELETE", gateway.URL+"/admin/cache", "")
+	assert.JSONEq(t, `{"purged":2}`, resp.Body)
+	assert.False(t, cached("/svc/app.js"))
+
+	assert.Equal(t, http.StatusBadRequest, sendRequest(t, "DELETE", gateway.URL+"/admin/cache?key=a&prefix=b", "").Code)
+}
+
+func TestResponseCacheKeepsCallersApart(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/shared" {
+			w.Header().Set("Cache-Control", "public")
+		}
+		w.Write([]byte(r.Header.Get("X-Tenant-ID")))
+	}))
+	defer backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	cache := config.ResponseCacheConfig{Enabled: true, TTL: time.Minute}
+	proxy := NewProxyHandler(&config.Config{
+		Metrics: config.MetricsConfig{Enabled: true},
+		Services: map[string]config.ServiceEndpoint{
+			"tenants": {BaseURL: backend.URL, Cache: cache, TenantRouting: config.TenantRoutingConfig{Enabled: true}},
+			"assets":  {BaseURL: backend.URL, Cache: cache},
+		},
+	}, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// Stands in for a principal authenticated without an Authorization header, e.g.
+		// by API key
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			c.Set(string(middleware.UserContextKey), &middleware.Claims{UserID: user, TenantID: c.GetHeader("X-Test-Tenant")})
+		}
+		c.Next()
+	})
+	router.GET("/tenants/*path", proxy.ProxyToService("tenants"))
+	router.GET("/assets/*path", proxy.ProxyToService("assets"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	get := func(path, user, tenant string) string {
+		req, _ := http.NewRequest("GET", gateway.URL+path, nil)
+		req.Header.Set("X-Test-User", user)
+		req.Header.Set("X-Test-Tenant", tenant)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// Public responses are cached per tenant
+	assert.Equal(t, "acme", get("/tenants/shared", "user-1", "acme"))
+	assert.Equal(t, "acme", get("/tenants/shared", "user-2", "acme"))
+	assert.Equal(t, "globex", get("/tenants/shared", "user-3", "globex"))
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Responses to authenticated principals are private unless marked otherwise
+	calls.Store(0)
+	get("/assets/private", "user-1", "")
+	get("/assets/private", "user-2", "")
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Cache hits are counted as requests to the service
+	assert.EqualValues(t, 3, proxy.ServiceMetrics()["tenants"].Requests)
+}
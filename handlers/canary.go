@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// releaseTrackHeader tells clients whether the canary or the stable deployment served them
+const releaseTrackHeader = "X-Release-Track"
+
+const (
+	trackStable = "stable"
+	trackCanary = "canary"
+)
+
+// canaryRouter splits a service's traffic between its stable pool and a canary pool
+type canaryRouter struct {
+	cfg  config.CanaryConfig
+	pool *upstreamPool
+	// random returns a number in [0, 100); replaced in tests
+	random func() int
+}
+
+// newCanaryRouter builds the canary pool. Returns nil when no canary is configured.
+func newCanaryRouter(endpoint config.ServiceEndpoint) (*canaryRouter, error) {
+	if endpoint.Canary.URL == "" {
+		return nil, nil
+	}
+	pool, err := newUpstreamPool(config.ServiceEndpoint{
+		BaseURL:         endpoint.Canary.URL,
+		KeepTrailingDot: endpoint.KeepTrailingDot,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &canaryRouter{
+		cfg:    endpoint.Canary,
+		pool:   pool,
+		random: func() int { return rand.Intn(100) },
+	}, nil
+}
+
+// selects reports whether the request should go to the canary
+func (r *canaryRouter) selects(c *gin.Context, serviceName string) bool {
+	if r.cfg.Header != "" {
+		if forced, err := strconv.ParseBool(c.GetHeader(r.cfg.Header)); err == nil {
+			return forced
+		}
+	}
+
+	claims, authenticated := middleware.GetUserFromContext(c)
+	if authenticated && len(r.cfg.Roles) > 0 && hasAnyRole(claims.Roles, r.cfg.Roles) {
+		return true
+	}
+
+	if r.cfg.Sticky && authenticated && claims.UserID != "" {
+		// Hash the user into a stable bucket, salted with the service so one user isn't
+		// on the canary of every service at once
+		h := fnv.New32a()
+		h.Write([]byte(serviceName + "\x00" + claims.UserID))
+		return int(h.Sum32()%100) < r.cfg.Percent
+	}
+	return r.random() < r.cfg.Percent
+}
+
+// hasAnyRole reports whether roles and wanted share a role
+func hasAnyRole(roles, wanted []string) bool {
+	for _, role := range roles {
+		for _, w := range wanted {
+			if role == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// canaryContext returns a Gin context for a request from userID (anonymous when empty)
+func canaryContext(userID string, roles ...string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	if userID != "" {
+		c.Set(string(middleware.UserContextKey), &middleware.Claims{UserID: userID, Roles: roles})
+	}
+	return c
+}
+
+func TestCanarySplitRatio(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, err := newCanaryRouter(config.ServiceEndpoint{Canary: config.CanaryConfig{URL: "http://canary:8080", Percent: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 10000
+	canary := 0
+	for i := 0; i < requests; i++ {
+		if router.selects(canaryContext(""), "users") {
+			canary++
+		}
+	}
+	assert.InDelta(t, 0.20, float64(canary)/requests, 0.03)
+}
+
+func TestCanaryStickyByUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, err := newCanaryRouter(config.ServiceEndpoint{Canary: config.CanaryConfig{URL: "http://canary:8080", Percent: 30, Sticky: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.random = func() int { t.Fatal("sticky selection of a known user must not be random"); return 0 }
+
+	const users = 2000
+	canary := 0
+	for i := 0; i < users; i++ {
+		userID := fmt.Sprintf("user-%d", i)
+		first := router.selects(canaryContext(userID), "users")
+		for j := 0; j < 3; j++ {
+			assert.Equal(t, first, router.selects(canaryContext(userID), "users"))
+		}
+		if first {
+			canary++
+		}
+	}
+	assert.InDelta(t, 0.30, float64(canary)/users, 0.05)
+}
+
+func TestCanaryRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, err := newCanaryRouter(config.ServiceEndpoint{Canary: config.CanaryConfig{URL: "http://canary:8080", Roles: []string{"beta"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, router.selects(canaryContext("1", "user", "beta"), "users"))
+	assert.False(t, router.selects(canaryContext("2", "user"), "users"))
+	assert.False(t, router.selects(canaryContext(""), "users"))
+}
+
+func TestCanaryForcedByHeader(t *testing.T) {
+	stable := newHeaderEchoBackend()
+	defer stable.Close()
+	canary := newHeaderEchoBackend()
+	defer canary.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"users": {
+			BaseURL: stable.URL,
+			Canary:  config.CanaryConfig{URL: canary.URL, Percent: 0, Header: "X-Canary"},
+		}},
+	}, "users")
+
+	tests := []struct {
+		header  string
+		backend *httptest.Server
+		track   string
+	}{
+		{"true", canary, "canary"},
+		{"false", stable, "stable"},
+		{"", stable, "stable"},
+	}
+
+	for _, tt := range tests {
+		t.Run("X-Canary="+tt.header, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", gateway.URL+"/svc/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Canary", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.track, resp.Header.Get("X-Release-Track"))
+			echoed := gatewayHeaders(t, gateway, "/svc/", map[string]string{"X-Canary": tt.header})
+			assert.Equal(t, tt.backend.Listener.Addr().String(), echoed["Host"])
+		})
+	}
+}
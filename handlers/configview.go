@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigHandler reports the configuration the gateway loaded, with secrets redacted
+type ConfigHandler struct {
+	startup *config.Config
+	current atomic.Pointer[config.Config]
+}
+
+// NewConfigHandler creates a new configuration admin handler for the configuration
+// loaded at startup
+func NewConfigHandler(cfg *config.Config) *ConfigHandler {
+	h := &ConfigHandler{startup: cfg}
+	h.current.Store(cfg)
+	return h
+}
+
+// Update records a reloaded configuration
+func (h *ConfigHandler) Update(cfg *config.Config) {
+	h.current.Store(cfg)
+}
+
+// Get returns the latest loaded configuration (defaults, file and environment merged)
+// and the settings that changed since startup but only take effect after a restart
+func (h *ConfigHandler) Get(c *gin.Context) {
+	current := h.current.Load()
+	restartRequired := config.RestartRequired(h.startup, current)
+	if restartRequired == nil {
+		restartRequired = []string{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"config":           current.Redacted(),
+		"restart_required": restartRequired,
+	})
+}
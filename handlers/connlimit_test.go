@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// startLimitedServer serves through a listener limited per cfg
+func startLimitedServer(t *testing.T, cfg config.ConnectionLimitConfig) (*httptest.Server, *ConnectionLimiter) {
+	limiter := NewConnectionLimiter(cfg)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.Listener = limiter.Listener(server.Listener)
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, limiter
+}
+
+// keepAliveConn opens a connection to server and sends a request on it, returning the
+// connection and a channel receiving the response status, or 0 if the connection was
+// closed without one
+func keepAliveConn(t *testing.T, server *httptest.Server) (net.Conn, <-chan int) {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	statuses := make(chan int, 1)
+	go func() {
+		io.WriteString(conn, "GET / HTTP/1.1\r\nHost: gateway\r\n\r\n")
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			statuses <- 0
+			return
+		}
+		resp.Body.Close()
+		statuses <- resp.StatusCode
+	}()
+	return conn, statuses
+}
+
+func TestConnectionLimitWait(t *testing.T) {
+	server, limiter := startLimitedServer(t, config.ConnectionLimitConfig{Max: 2, OnLimit: "wait"})
+
+	first, firstStatus := keepAliveConn(t, server)
+	_, secondStatus := keepAliveConn(t, server)
+	assert.Equal(t, http.StatusOK, <-firstStatus)
+	assert.Equal(t, http.StatusOK, <-secondStatus)
+	assert.Equal(t, 2, limiter.Open())
+
+	// The third connection is held in the backlog while both are open
+	_, thirdStatus := keepAliveConn(t, server)
+	select {
+	case status := <-thirdStatus:
+		t.Fatalf("connection beyond the limit was served with %d", status)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// and served once one closes
+	first.Close()
+	select {
+	case status := <-thirdStatus:
+		assert.Equal(t, http.StatusOK, status)
+	case <-time.After(2 * time.Second):
+		t.Fatal("held connection was not served after a slot freed up")
+	}
+	assert.Equal(t, 2, limiter.Open())
+	assert.Equal(t, 2.0, testutil.ToFloat64(limiter.open))
+}
+
+func TestConnectionLimitReject(t *testing.T) {
+	server, limiter := startLimitedServer(t, config.ConnectionLimitConfig{Max: 1, OnLimit: "reject"})
+
+	first, firstStatus := keepAliveConn(t, server)
+	assert.Equal(t, http.StatusOK, <-firstStatus)
+
+	// Excess connections are closed without a response
+	for i := 0; i < 3; i++ {
+		_, status := keepAliveConn(t, server)
+		assert.Equal(t, 0, <-status)
+	}
+	assert.Equal(t, 3.0, testutil.ToFloat64(limiter.rejected))
+	assert.Equal(t, 1, limiter.Open())
+
+	first.Close()
+	assert.Eventually(t, func() bool { return limiter.Open() == 0 }, 2*time.Second, 10*time.Millisecond)
+	_, status := keepAliveConn(t, server)
+	assert.Equal(t, http.StatusOK, <-status)
+}
+
+func TestConnectionLimitUnlimited(t *testing.T) {
+	server, limiter := startLimitedServer(t, config.ConnectionLimitConfig{})
+
+	for i := 0; i < 5; i++ {
+		_, status := keepAliveConn(t, server)
+		assert.Equal(t, http.StatusOK, <-status)
+	}
+	assert.Equal(t, 5, limiter.Open())
+}
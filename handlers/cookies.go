@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/api-gateway/config"
+)
+
+// cookieSameSiteValues maps configured SameSite modes to their attribute values
+var cookieSameSiteValues = map[string]string{
+	"strict": "Strict",
+	"lax":    "Lax",
+	"none":   "None",
+}
+
+// rewriteCookies adjusts the SameSite and Secure attributes of backend Set-Cookie
+// headers. SameSite=None always gets Secure, since browsers reject it otherwise.
+// Other attributes are passed through untouched.
+func rewriteCookies(resp *http.Response, cfg config.CookieConfig) {
+	sameSite := cookieSameSiteValues[strings.ToLower(cfg.SameSite)]
+	secure := cfg.Secure || sameSite == "None"
+	if sameSite == "" && !secure {
+		return
+	}
+
+	cookies := resp.Header.Values("Set-Cookie")
+	if len(cookies) == 0 {
+		return
+	}
+
+	resp.Header.Del("Set-Cookie")
+	for _, cookie := range cookies {
+		resp.Header.Add("Set-Cookie", rewriteCookie(cookie, sameSite, secure))
+	}
+}
+
+// rewriteCookie replaces the SameSite attribute of a single Set-Cookie value and adds
+// Secure if requested
+func rewriteCookie(cookie, sameSite string, secure bool) string {
+	parts := strings.Split(cookie, ";")
+	attributes := make([]string, 0, len(parts)+2)
+	attributes = append(attributes, strings.TrimSpace(parts[0]))
+
+	hasSecure := false
+	for _, part := range parts[1:] {
+		attribute := strings.TrimSpace(part)
+		name, _, _ := strings.Cut(attribute, "=")
+		switch {
+		case attribute == "":
+			continue
+		case strings.EqualFold(strings.TrimSpace(name), "SameSite") && sameSite != "":
+			continue
+		case strings.EqualFold(attribute, "Secure"):
+			hasSecure = true
+		}
+		attributes = append(attributes, attribute)
+	}
+
+	if secure && !hasSecure {
+		attributes = append(attributes, "Secure")
+	}
+	if sameSite != "" {
+		attributes = append(attributes, "SameSite="+sameSite)
+	}
+	return strings.Join(attributes, "; ")
+}
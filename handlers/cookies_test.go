@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteCookie(t *testing.T) {
+	tests := []struct {
+		name     string
+		cookie   string
+		sameSite string
+		secure   bool
+		want     string
+	}{
+		{"strict to none", "session=abc; Path=/; HttpOnly; SameSite=Strict", "None", true, "session=abc; Path=/; HttpOnly; Secure; SameSite=None"},
+		{"lax to none keeps secure", "id=1; Secure; samesite=lax", "None", true, "id=1; Secure; SameSite=None"},
+		{"adds missing samesite", "id=1; Path=/", "Lax", false, "id=1; Path=/; SameSite=Lax"},
+		{"secure only", "id=1; SameSite=Strict", "", true, "id=1; SameSite=Strict; Secure"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rewriteCookie(tt.cookie, tt.sameSite, tt.secure))
+		})
+	}
+}
+
+func TestServiceCookieRewrite(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", "session=abc; Path=/; HttpOnly; SameSite=Strict")
+		w.Header().Add("Set-Cookie", "theme=dark; SameSite=Lax")
+	}))
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"backend": {BaseURL: backend.URL, Cookies: config.CookieConfig{SameSite: "none"}},
+		},
+	}, "backend")
+
+	resp, err := http.Get(gateway.URL + "/svc/")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, []string{
+		"session=abc; Path=/; HttpOnly; Secure; SameSite=None",
+		"theme=dark; Secure; SameSite=None",
+	}, resp.Header.Values("Set-Cookie"))
+}
+
+func TestServiceCookiesUntouchedByDefault(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", "session=abc; SameSite=Strict")
+	}))
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL}},
+	}, "backend")
+
+	resp, err := http.Get(gateway.URL + "/svc/")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "session=abc; SameSite=Strict", resp.Header.Get("Set-Cookie"))
+}
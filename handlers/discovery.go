@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/api-gateway/config"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDiscoveryRefreshInterval = 30 * time.Second
+	defaultConsulAddress            = "http://127.0.0.1:8500"
+	discoveryTimeout                = 5 * time.Second
+)
+
+// ServiceDiscovery finds the instances of a backend service
+type ServiceDiscovery interface {
+	// Resolve returns the current instances of the service
+	Resolve(ctx context.Context) ([]config.UpstreamEndpoint, error)
+}
+
+// newServiceDiscovery returns the discovery configured for a service
+func newServiceDiscovery(endpoint config.ServiceEndpoint) ServiceDiscovery {
+	cfg := endpoint.Discovery
+	scheme := cfg.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	switch cfg.Type {
+	case "dns_srv":
+		return &dnsSRVDiscovery{name: cfg.Name, scheme: scheme, resolver: net.DefaultResolver}
+	case "consul":
+		address := cfg.Address
+		if address == "" {
+			address = defaultConsulAddress
+		}
+		return &consulDiscovery{address: address, service: cfg.Name, scheme: scheme, client: &http.Client{}}
+	}
+	return staticDiscovery(staticUpstreams(endpoint))
+}
+
+// staticUpstreams returns the base URL and additional upstreams of a service
+func staticUpstreams(endpoint config.ServiceEndpoint) []config.UpstreamEndpoint {
+	upstreams := make([]config.UpstreamEndpoint, 0, len(endpoint.Upstreams)+1)
+	if endpoint.BaseURL != "" {
+		upstreams = append(upstreams, config.UpstreamEndpoint{URL: endpoint.BaseURL, Weight: 1})
+	}
+	return append(upstreams, endpoint.Upstreams...)
+}
+
+// staticDiscovery always returns the configured instances
+type staticDiscovery []config.UpstreamEndpoint
+
+// Resolve implements ServiceDiscovery
+func (s staticDiscovery) Resolve(context.Context) ([]config.UpstreamEndpoint, error) {
+	return s, nil
+}
+
+// srvResolver looks up DNS SRV records; implemented by *net.Resolver
+type srvResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// dnsSRVDiscovery finds instances through the SRV records of a DNS name. Only the
+// records of the lowest priority are used, weighted by their record weight.
+type dnsSRVDiscovery struct {
+	name     string
+	scheme   string
+	resolver srvResolver // replaced in tests
+}
+
+// Resolve implements ServiceDiscovery
+func (d *dnsSRVDiscovery) Resolve(ctx context.Context) ([]config.UpstreamEndpoint, error) {
+	_, records, err := d.resolver.LookupSRV(ctx, "", "", d.name)
+	if err != nil {
+		return nil, err
+	}
+
+	var upstreams []config.UpstreamEndpoint
+	for _, record := range records {
+		// Records are sorted by priority, lowest first
+		if record.Priority != records[0].Priority {
+			break
+		}
+		host := net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port)))
+		upstreams = append(upstreams, config.UpstreamEndpoint{
+			URL:    d.scheme + "://" + host,
+			Weight: int(record.Weight),
+		})
+	}
+	return upstreams, nil
+}
+
+// consulDiscovery finds the instances of a service that pass their Consul health
+// checks, through the health endpoint of the Consul agent
+type consulDiscovery struct {
+	address string
+	service string
+	scheme  string
+	client  *http.Client
+}
+
+// consulServiceEntry is the part of a Consul health API entry naming an instance
+type consulServiceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+		Weights struct {
+			Passing int
+		}
+	}
+}
+
+// Resolve implements ServiceDiscovery
+func (d *consulDiscovery) Resolve(ctx context.Context) ([]config.UpstreamEndpoint, error) {
+	endpoint := strings.TrimRight(d.address, "/") + "/v1/health/service/" + url.PathEscape(d.service) + "?passing=true"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul returned status %d", resp.StatusCode)
+	}
+
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("invalid consul response: %w", err)
+	}
+
+	upstreams := make([]config.UpstreamEndpoint, 0, len(entries))
+	for _, entry := range entries {
+		// Instances without their own address listen on the node's
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+		upstreams = append(upstreams, config.UpstreamEndpoint{
+			URL:    d.scheme + "://" + net.JoinHostPort(address, strconv.Itoa(entry.Service.Port)),
+			Weight: entry.Service.Weights.Passing,
+		})
+	}
+	return upstreams, nil
+}
+
+// watchDiscovery looks up the instances of a service now, then keeps its pool in sync
+// with them every refresh interval until the returned function is called
+func (p *ProxyHandler) watchDiscovery(serviceName string, cfg config.DiscoveryConfig, pool *upstreamPool, discovery ServiceDiscovery) func() {
+	interval := cfg.RefreshInterval
+	if interval <= 0 {
+		interval = defaultDiscoveryRefreshInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.refreshUpstreams(ctx, serviceName, pool, discovery)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.refreshUpstreams(ctx, serviceName, pool, discovery)
+			}
+		}
+	}()
+	return cancel
+}
+
+// refreshUpstreams replaces the instances of pool with the discovered ones. The known
+// instances are kept when the lookup fails or finds none, so a discovery outage
+// doesn't take the service down.
+func (p *ProxyHandler) refreshUpstreams(ctx context.Context, serviceName string, pool *upstreamPool, discovery ServiceDiscovery) error {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	endpoints, err := discovery.Resolve(ctx)
+	if err == nil && len(endpoints) == 0 {
+		err = errors.New("no instances found")
+	}
+	var added, removed int
+	if err == nil {
+		added, removed, err = pool.update(endpoints)
+	}
+	if err != nil {
+		// Lookups cut short by the service being stopped aren't failures
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			p.logger.Warn("Service discovery failed, keeping known upstreams",
+				zap.String("service", serviceName),
+				zap.Error(err),
+			)
+		}
+		return err
+	}
+
+	if added > 0 || removed > 0 {
+		p.logger.Info("Service upstreams updated",
+			zap.String("service", serviceName),
+			zap.Int("added", added),
+			zap.Int("removed", removed),
+			zap.Int("upstreams", len(pool.members())),
+		)
+	}
+	return nil
+}
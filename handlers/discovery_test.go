@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSRVResolver serves SRV records that tests change between lookups
+type fakeSRVResolver struct {
+	mu      sync.Mutex
+	records []*net.SRV
+	err     error
+}
+
+func (r *fakeSRVResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return name, r.records, r.err
+}
+
+func (r *fakeSRVResolver) set(err error, servers ...*httptest.Server) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+	r.records = nil
+	for _, server := range servers {
+		addr := server.Listener.Addr().(*net.TCPAddr)
+		r.records = append(r.records, &net.SRV{Target: "127.0.0.1.", Port: uint16(addr.Port), Weight: 1})
+	}
+}
+
+func poolURLs(pool *upstreamPool) []string {
+	var urls []string
+	for _, u := range pool.members() {
+		urls = append(urls, u.url.String())
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func serverURLs(servers ...*httptest.Server) []string {
+	var urls []string
+	for _, server := range servers {
+		urls = append(urls, server.URL)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func TestServiceDiscoveryUpdatesUpstreams(t *testing.T) {
+	first, _ := newFlappingBackend("first")
+	second, _ := newFlappingBackend("second")
+	third, thirdHealthy := newFlappingBackend("third")
+	defer first.Close()
+	defer second.Close()
+	defer third.Close()
+
+	gateway, proxy := setupHealthCheckedProxy(t, config.ServiceEndpoint{
+		BaseURL:     first.URL,
+		HealthCheck: fastHealthCheck(),
+	})
+	pool := proxy.services["backend"].pool
+	resolver := &fakeSRVResolver{}
+	discovery := &dnsSRVDiscovery{name: "_http._tcp.backend", scheme: "http", resolver: resolver}
+	served := func() map[string]bool {
+		names := make(map[string]bool)
+		for i := 0; i < 6; i++ {
+			_, body := gatewayGet(t, gateway, "/backend/")
+			names[body] = true
+		}
+		return names
+	}
+
+	// Discovered instances replace the configured ones
+	firstUpstream := pool.primary()
+	resolver.set(nil, second, third)
+	assert.NoError(t, proxy.refreshUpstreams(context.Background(), "backend", pool, discovery))
+	assert.Equal(t, serverURLs(second, third), poolURLs(pool))
+	assert.Equal(t, map[string]bool{"second": true, "third": true}, served())
+	select {
+	case <-firstUpstream.removed:
+	default:
+		t.Error("removed upstream was not signalled")
+	}
+
+	// Instances added later are health checked
+	thirdHealthy.Store(false)
+	assert.Eventually(t, func() bool {
+		return served()["third"] == false
+	}, time.Second, 20*time.Millisecond)
+	thirdHealthy.Store(true)
+
+	// Instances that stay keep their state; removed ones stop receiving traffic
+	var kept *upstream
+	for _, u := range pool.members() {
+		if u.url.String() == second.URL {
+			kept = u
+		}
+	}
+	resolver.set(nil, first, second)
+	assert.NoError(t, proxy.refreshUpstreams(context.Background(), "backend", pool, discovery))
+	assert.Equal(t, serverURLs(first, second), poolURLs(pool))
+	for _, u := range pool.members() {
+		if u.url.String() == second.URL {
+			assert.Same(t, kept, u)
+		}
+	}
+	assert.Equal(t, map[string]bool{"first": true, "second": true}, served())
+
+	// Failed and empty lookups keep the known instances
+	resolver.set(errors.New("no such host"))
+	assert.Error(t, proxy.refreshUpstreams(context.Background(), "backend", pool, discovery))
+	resolver.set(nil)
+	assert.Error(t, proxy.refreshUpstreams(context.Background(), "backend", pool, discovery))
+	assert.Equal(t, serverURLs(first, second), poolURLs(pool))
+}
+
+func TestDNSSRVDiscoveryUsesLowestPriority(t *testing.T) {
+	resolver := &fakeSRVResolver{records: []*net.SRV{
+		{Target: "a.example.", Port: 8080, Priority: 10, Weight: 3},
+		{Target: "b.example.", Port: 8081, Priority: 10, Weight: 0},
+		{Target: "backup.example.", Port: 8080, Priority: 20, Weight: 1},
+	}}
+	discovery := &dnsSRVDiscovery{name: "_http._tcp.users", scheme: "https", resolver: resolver}
+
+	upstreams, err := discovery.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []config.UpstreamEndpoint{
+		{URL: "https://a.example:8080", Weight: 3},
+		{URL: "https://b.example:8081", Weight: 0},
+	}, upstreams)
+}
+
+func TestConsulDiscovery(t *testing.T) {
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/health/service/users", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("passing"))
+		w.Write([]byte(`[
+			{"Node": {"Address": "10.0.0.1"}, "Service": {"Address": "", "Port": 8080, "Weights": {"Passing": 2}}},
+			{"Node": {"Address": "10.0.0.2"}, "Service": {"Address": "10.1.0.2", "Port": 9090, "Weights": {"Passing": 1}}}
+		]`))
+	}))
+	defer consul.Close()
+
+	discovery := newServiceDiscovery(config.ServiceEndpoint{Discovery: config.DiscoveryConfig{
+		Type: "consul", Name: "users", Address: consul.URL,
+	}})
+	upstreams, err := discovery.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []config.UpstreamEndpoint{
+		{URL: "http://10.0.0.1:8080", Weight: 2},
+		{URL: "http://10.1.0.2:9090", Weight: 1},
+	}, upstreams)
+}
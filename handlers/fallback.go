@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/api-gateway/config"
+)
+
+// fallback is the response served when a service can't be reached
+type fallback struct {
+	status    int
+	responses []fallbackBody
+}
+
+// fallbackBody is one representation of a fallback response
+type fallbackBody struct {
+	contentType string
+	mediaType   string // contentType without parameters, lowercased
+	body        []byte
+}
+
+// newFallback loads the configured fallback responses, reading files once. Returns
+// nil when none are configured.
+func newFallback(cfg config.FallbackConfig) (*fallback, error) {
+	if len(cfg.Responses) == 0 {
+		return nil, nil
+	}
+
+	f := &fallback{status: cfg.Status, responses: make([]fallbackBody, 0, len(cfg.Responses))}
+	if f.status == 0 {
+		f.status = http.StatusServiceUnavailable
+	}
+
+	for _, response := range cfg.Responses {
+		body := []byte(response.Body)
+		if response.File != "" {
+			data, err := os.ReadFile(response.File)
+			if err != nil {
+				return nil, fmt.Errorf("reading fallback file: %w", err)
+			}
+			body = data
+		}
+
+		mediaType, _, err := mime.ParseMediaType(response.ContentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallback content type %q: %w", response.ContentType, err)
+		}
+		f.responses = append(f.responses, fallbackBody{
+			contentType: response.ContentType,
+			mediaType:   mediaType,
+			body:        body,
+		})
+	}
+	return f, nil
+}
+
+// write serves the representation best matching the request's Accept header
+func (f *fallback) write(w http.ResponseWriter, r *http.Request) {
+	response := f.responses[f.negotiate(r.Header.Get("Accept"))]
+
+	w.Header().Set("Content-Type", response.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(response.body)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(f.status)
+	if r.Method != http.MethodHead {
+		w.Write(response.body)
+	}
+}
+
+// acceptRange is a media range from an Accept header with its quality
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+// negotiate returns the index of the response preferred by the Accept header: the
+// highest quality range wins, and the first response when nothing matches
+func (f *fallback) negotiate(accept string) int {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		if quality > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mediaType, quality: quality})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+
+	for _, accepted := range ranges {
+		for i, response := range f.responses {
+			if mediaTypeMatches(accepted.mediaType, response.mediaType) {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// mediaTypeMatches reports whether a media range such as "text/*" covers a media type
+func mediaTypeMatches(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(mediaRange, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
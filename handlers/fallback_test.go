@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// maintenanceFallback serves an HTML page from a file and a JSON error inline
+func maintenanceFallback(t *testing.T) config.FallbackConfig {
+	page := filepath.Join(t.TempDir(), "maintenance.html")
+	if err := os.WriteFile(page, []byte("<h1>Back soon</h1>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return config.FallbackConfig{
+		Status: http.StatusServiceUnavailable,
+		Responses: []config.FallbackResponse{
+			{ContentType: "application/json", Body: `{"error":"Service Unavailable","message":"Down for maintenance"}`},
+			{ContentType: "text/html; charset=utf-8", File: page},
+		},
+	}
+}
+
+func TestServiceFallbackOnUpstreamFailure(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	backendURL := backend.URL
+	backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"web_ui": {BaseURL: backendURL, Fallback: maintenanceFallback(t)}},
+	}, "web_ui")
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"text/html,application/xhtml+xml,*/*;q=0.8", "text/html; charset=utf-8", "<h1>Back soon</h1>"},
+		{"application/json", "application/json", `{"error":"Service Unavailable","message":"Down for maintenance"}`},
+		{"text/*", "text/html; charset=utf-8", "<h1>Back soon</h1>"},
+		{"application/json;q=0.5, text/html", "text/html; charset=utf-8", "<h1>Back soon</h1>"},
+		{"", "application/json", `{"error":"Service Unavailable","message":"Down for maintenance"}`},
+		{"image/png", "application/json", `{"error":"Service Unavailable","message":"Down for maintenance"}`},
+	}
+
+	for _, tt := range tests {
+		resp := sendRequest(t, "GET", gateway.URL+"/svc/", "", "Accept", tt.accept)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code, tt.accept)
+		assert.Equal(t, tt.contentType, resp.Header.Get("Content-Type"), tt.accept)
+		assert.Equal(t, tt.body, resp.Body, tt.accept)
+	}
+}
+
+func TestServiceWithoutFallbackReturnsBadGateway(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	backendURL := backend.URL
+	backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"api": {BaseURL: backendURL}},
+	}, "api")
+
+	resp := sendRequest(t, "GET", gateway.URL+"/svc/", "", "Accept", "text/html")
+	assert.Equal(t, http.StatusBadGateway, resp.Code)
+	assert.Contains(t, resp.Body, "Bad Gateway")
+}
+
+func TestExternalServiceFallback(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	backendURL := backend.URL
+	backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{
+		ExternalServices: map[string]config.ExternalServiceEndpoint{
+			"frontend": {BaseURL: backendURL, Fallback: maintenanceFallback(t)},
+		},
+	}, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.NoRoute(proxy.ProxyWithWebSocket("frontend"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	resp := sendRequest(t, "GET", gateway.URL+"/dashboard", "", "Accept", "text/html")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, "<h1>Back soon</h1>", resp.Body)
+}
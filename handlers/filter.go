@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultFilterMaxBodySize caps the responses the JSON field filter buffers
+const defaultFilterMaxBodySize = 1 << 20
+
+// responseFilterContextKey is the request context key for route-level response filters
+type responseFilterContextKey struct{}
+
+// ResponseFilter returns a handler that applies a route-level JSON response filter to
+// the proxy handler that follows it, after the service's own filter
+func ResponseFilter(filter config.ResponseFilterConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), responseFilterContextKey{}, filter))
+		c.Next()
+	}
+}
+
+// filterResponse applies the service filter, then any route filter, to a JSON response
+func filterResponse(resp *http.Response, serviceFilter config.ResponseFilterConfig) error {
+	filters := make([]config.ResponseFilterConfig, 0, 2)
+	if serviceFilter.Enabled() {
+		filters = append(filters, serviceFilter)
+	}
+	if resp.Request != nil {
+		if routeFilter, ok := resp.Request.Context().Value(responseFilterContextKey{}).(config.ResponseFilterConfig); ok && routeFilter.Enabled() {
+			filters = append(filters, routeFilter)
+		}
+	}
+	if len(filters) == 0 || !hasResponseBody(resp) || !isJSONResponse(resp) {
+		return nil
+	}
+
+	// Filtering needs the whole document; larger or unknown-length bodies past the cap
+	// are streamed through untouched
+	maxSize := int64(defaultFilterMaxBodySize)
+	for _, filter := range filters {
+		if filter.MaxBodySize > 0 && filter.MaxBodySize < maxSize {
+			maxSize = filter.MaxBodySize
+		}
+	}
+	if resp.ContentLength > maxSize {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > maxSize {
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		// Not valid JSON after all; pass it through as received
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+
+	for _, filter := range filters {
+		maskValue := filter.MaskValue
+		if maskValue == "" {
+			maskValue = "***"
+		}
+		for _, path := range filter.Remove {
+			filterJSONPath(document, strings.Split(path, "."), nil)
+		}
+		for _, path := range filter.Mask {
+			filterJSONPath(document, strings.Split(path, "."), maskValue)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	filtered := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	resp.Body = io.NopCloser(bytes.NewReader(filtered))
+	resp.ContentLength = int64(len(filtered))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(filtered)))
+	// The backend's validator described the unfiltered body
+	resp.Header.Del("ETag")
+	return nil
+}
+
+// filterJSONPath removes the value at path, or replaces it with mask when mask is
+// non-nil. Arrays met along the path apply the rest of it to every element.
+func filterJSONPath(node interface{}, path []string, mask interface{}) {
+	switch value := node.(type) {
+	case []interface{}:
+		for _, element := range value {
+			filterJSONPath(element, path, mask)
+		}
+	case map[string]interface{}:
+		child, ok := value[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) > 1 {
+			filterJSONPath(child, path[1:], mask)
+		} else if mask != nil {
+			value[path[0]] = mask
+		} else {
+			delete(value, path[0])
+		}
+	}
+}
+
+// isJSONResponse reports whether the response carries an unencoded JSON document
+func isJSONResponse(resp *http.Response) bool {
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// readCloser reads from a reader and closes the underlying body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
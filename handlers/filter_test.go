@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// taskDocument is a nested backend response with fields that shouldn't reach clients
+const taskDocument = `{"tasks":[{"id":1,"title":"a & b","internal_notes":"x","owner":{"name":"Ann","ssn":"123-45-6789"}},` +
+	`{"id":2,"title":"c","internal_notes":"y","owner":{"name":"Bob","ssn":"987-65-4321"}}],"total":2}`
+
+func TestResponseFilterNestedJSON(t *testing.T) {
+	backend := newStaticBackend(t, "application/json; charset=utf-8", taskDocument)
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"tasks": {
+			BaseURL: backend.URL,
+			ResponseFilter: config.ResponseFilterConfig{
+				Remove: []string{"tasks.internal_notes", "missing.field"},
+				Mask:   []string{"tasks.owner.ssn"},
+			},
+		}},
+	}, "tasks")
+
+	resp := sendRequest(t, "GET", gateway.URL+"/svc/tasks", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"tasks":[{"id":1,"title":"a & b","owner":{"name":"Ann","ssn":"***"}},`+
+		`{"id":2,"title":"c","owner":{"name":"Bob","ssn":"***"}}],"total":2}`, resp.Body)
+	assert.Contains(t, resp.Body, "a & b", "HTML characters are not escaped")
+	assert.Equal(t, strconv.Itoa(len(resp.Body)), resp.Header.Get("Content-Length"))
+	assert.Empty(t, resp.Header.Get("ETag"))
+}
+
+func TestResponseFilterSkipsNonJSON(t *testing.T) {
+	filter := config.ResponseFilterConfig{Remove: []string{"internal_notes"}}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		filter      config.ResponseFilterConfig
+	}{
+		{"plain text", "text/plain", `{"internal_notes":"x"}`, filter},
+		{"invalid JSON", "application/json", `{"internal_notes":`, filter},
+		{"over the size cap", "application/json", `{"internal_notes":"` + strings.Repeat("x", 64) + `"}`,
+			config.ResponseFilterConfig{Remove: []string{"internal_notes"}, MaxBodySize: 32}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newStaticBackend(t, tt.contentType, tt.body)
+			gateway, _ := setupServiceGateway(t, &config.Config{
+				Services: map[string]config.ServiceEndpoint{"tasks": {BaseURL: backend.URL, ResponseFilter: tt.filter}},
+			}, "tasks")
+
+			resp := sendRequest(t, "GET", gateway.URL+"/svc/tasks", "")
+			assert.Equal(t, tt.body, resp.Body)
+			assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+		})
+	}
+}
+
+func TestRouteResponseFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	backend := newStaticBackend(t, "application/vnd.api+json", `{"data":{"id":"1","debug":{"sql":"SELECT"}},"meta":{"token":"t"}}`)
+	cfg := &config.Config{
+		Services: map[string]config.ServiceEndpoint{"tasks": {
+			BaseURL:        backend.URL,
+			ResponseFilter: config.ResponseFilterConfig{Mask: []string{"meta.token"}, MaskValue: "[redacted]"},
+		}},
+	}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	t.Cleanup(proxy.Close)
+
+	router := gin.New()
+	router.GET("/svc/*path", ResponseFilter(config.ResponseFilterConfig{Remove: []string{"data.debug"}}), proxy.ProxyToService("tasks"))
+	gateway := httptest.NewServer(router)
+	t.Cleanup(gateway.Close)
+
+	_, body := gatewayGet(t, gateway, "/svc/tasks/1")
+	assert.JSONEq(t, `{"data":{"id":"1"},"meta":{"token":"[redacted]"}}`, body)
+}
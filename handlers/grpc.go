@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+)
+
+// gRPC status codes used by the gateway itself
+const (
+	grpcStatusInternal    = 13
+	grpcStatusUnavailable = 14
+)
+
+// grpcTransport reaches gRPC backends over HTTP/2: cleartext h2c for http:// targets
+// and TLS with ALPN h2 for https:// targets. HTTP/2 preserves the grpc-status and
+// grpc-message trailers, which the reverse proxy copies back to the client.
+type grpcTransport struct {
+	h2c *http2.Transport
+	h2  *http2.Transport
+}
+
+func newGRPCTransport(tlsConfig *tls.Config) *grpcTransport {
+	return &grpcTransport{
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+		h2: &http2.Transport{TLSClientConfig: tlsConfig},
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *grpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		return t.h2.RoundTrip(req)
+	}
+	return t.h2c.RoundTrip(req)
+}
+
+// isGRPCRequest reports whether the request carries a gRPC payload
+func isGRPCRequest(req *http.Request) bool {
+	contentType := req.Header.Get("Content-Type")
+	return contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+") ||
+		strings.HasPrefix(contentType, "application/grpc;")
+}
+
+// ProxyGRPC returns a handler that passes gRPC calls through to a backend service
+// configured with protocol grpc. Messages are forwarded as-is: the gateway does not
+// decode protobuf, so authorization cannot be applied per method.
+func (p *ProxyHandler) ProxyGRPC(serviceName string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ProtoMajor != 2 {
+			c.JSON(http.StatusHTTPVersionNotSupported, gin.H{
+				"error":   "HTTP Version Not Supported",
+				"message": "gRPC requires HTTP/2",
+			})
+			return
+		}
+		if !isGRPCRequest(c.Request) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"error":   "Unsupported Media Type",
+				"message": "Expected content-type application/grpc",
+			})
+			return
+		}
+
+		svc, exists := p.service(serviceName)
+		if !exists || svc.endpoint.Protocol != "grpc" {
+			p.logger.Error("gRPC proxy not found for service", zap.String("service", serviceName))
+			writeGRPCError(c.Writer, grpcStatusInternal, "Service configuration not found")
+			return
+		}
+
+		target := svc.pool.next()
+		if target == nil {
+			writeGRPCError(c.Writer, grpcStatusUnavailable, "No healthy backend instance available")
+			return
+		}
+
+		p.logger.Info("Proxying gRPC call",
+			zap.String("service", serviceName),
+			zap.String("method", c.Request.URL.Path),
+		)
+
+		// Streams may be long-lived, so the service timeout is not applied; the client's
+		// grpc-timeout header is forwarded and enforced by the backend
+		start := time.Now()
+		svc.proxy.ServeHTTP(c.Writer, withUpstream(c.Request, target))
+		p.metrics.record(svc.name, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// grpcErrorHandler reports proxy errors to gRPC clients as an UNAVAILABLE status
+func (p *ProxyHandler) grpcErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	p.logger.Error("gRPC proxy error",
+		zap.String("url", r.URL.String()),
+		zap.Error(err),
+	)
+	writeGRPCError(w, grpcStatusUnavailable, "Failed to reach backend service")
+}
+
+// writeGRPCError writes a trailers-only gRPC response carrying the status and message
+func writeGRPCError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", url.PathEscape(message))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// newGRPCEchoServer starts a minimal cleartext gRPC server. /echo.Echo/Say echoes the
+// request message and /echo.Echo/Fail returns INVALID_ARGUMENT, both via trailers.
+func newGRPCEchoServer() *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message, _ := io.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+
+		if r.URL.Path == "/echo.Echo/Fail" {
+			w.Header().Set("Grpc-Status", "3")
+			w.Header().Set("Grpc-Message", "name is required")
+			return
+		}
+		w.Write(message)
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "")
+	})
+	return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+}
+
+// grpcFrame encodes a message using the gRPC length-prefixed framing
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(message)))
+	copy(frame[5:], message)
+	return frame
+}
+
+// setupGRPCGateway serves the echo gRPC service through the gateway over h2c
+func setupGRPCGateway(t *testing.T, backendURL string) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"echo": {BaseURL: backendURL, Protocol: "grpc", GRPCServices: []string{"echo.Echo"}},
+		},
+	}, zap.NewNop())
+	t.Cleanup(proxy.Close)
+
+	router := gin.New()
+	router.POST("/echo.Echo/:method", proxy.ProxyGRPC("echo"))
+	gateway := httptest.NewServer(h2c.NewHandler(router, &http2.Server{}))
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+// grpcCall performs a unary call over cleartext HTTP/2 and returns the response with its body read
+func grpcCall(t *testing.T, gatewayURL, method string, message []byte) (*http.Response, []byte) {
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}}
+
+	req, _ := http.NewRequest(http.MethodPost, gatewayURL+method, bytes.NewReader(grpcFrame(message)))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("gRPC call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp, body
+}
+
+func TestProxyGRPCEcho(t *testing.T) {
+	backend := newGRPCEchoServer()
+	defer backend.Close()
+	gateway := setupGRPCGateway(t, backend.URL)
+
+	resp, body := grpcCall(t, gateway.URL, "/echo.Echo/Say", []byte("hello"))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, "application/grpc", resp.Header.Get("Content-Type"))
+	assert.Equal(t, grpcFrame([]byte("hello")), body)
+	assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+}
+
+func TestProxyGRPCErrorTrailers(t *testing.T) {
+	backend := newGRPCEchoServer()
+	defer backend.Close()
+	gateway := setupGRPCGateway(t, backend.URL)
+
+	resp, _ := grpcCall(t, gateway.URL, "/echo.Echo/Fail", []byte("hello"))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "3", resp.Trailer.Get("Grpc-Status"))
+	assert.Equal(t, "name is required", resp.Trailer.Get("Grpc-Message"))
+}
+
+func TestProxyGRPCBackendUnavailable(t *testing.T) {
+	backend := newGRPCEchoServer()
+	backendURL := backend.URL
+	backend.Close()
+	gateway := setupGRPCGateway(t, backendURL)
+
+	resp, _ := grpcCall(t, gateway.URL, "/echo.Echo/Say", []byte("hello"))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "14", resp.Header.Get("Grpc-Status"))
+}
+
+func TestProxyGRPCRejectsNonGRPC(t *testing.T) {
+	backend := newGRPCEchoServer()
+	defer backend.Close()
+	gateway := setupGRPCGateway(t, backend.URL)
+
+	resp, err := http.Post(gateway.URL+"/echo.Echo/Say", "application/json", bytes.NewReader([]byte("{}")))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusHTTPVersionNotSupported, resp.StatusCode)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestApplyHeaderTransform(t *testing.T) {
+	header := http.Header{}
+	header.Set("Cookie", "session=abc")
+	header.Set("X-Env", "client")
+	header.Set("X-Feature", "a")
+
+	applyHeaderTransform(header, config.HeaderTransform{
+		Set:    map[string]string{"x-env": "production"},
+		Add:    map[string]string{"x-feature": "b"},
+		Remove: []string{"cookie"},
+	})
+
+	assert.Empty(t, header.Get("Cookie"))
+	assert.Equal(t, []string{"production"}, header.Values("X-Env"))
+	assert.Equal(t, []string{"a", "b"}, header.Values("X-Feature"))
+}
+
+func TestServiceRequestHeaders(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"backend": {
+				BaseURL: backend.URL,
+				RequestHeaders: config.HeaderTransform{
+					Set:    map[string]string{"X-Service-Name": "backend"},
+					Add:    map[string]string{"X-Feature": "beta"},
+					Remove: []string{"Cookie"},
+				},
+			},
+		},
+	}, "backend")
+
+	echoed := gatewayHeaders(t, gateway, "/svc/", map[string]string{
+		"Cookie":         "session=abc",
+		"X-Service-Name": "spoofed",
+	})
+	assert.Equal(t, "backend", echoed["X-Service-Name"])
+	assert.Equal(t, "beta", echoed["X-Feature"])
+	assert.NotContains(t, echoed, "Cookie")
+}
+
+func TestGatewayManagedHeadersCannotBeSpoofed(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL}},
+	}, "backend")
+
+	echoed := gatewayHeaders(t, gateway, "/svc/", map[string]string{
+		"X-Gateway":  "evil-gateway",
+		"X-Real-IP":  "10.9.9.9",
+		UserIDHeader: "admin",
+	})
+	assert.Equal(t, "api-gateway", echoed["X-Gateway"])
+	assert.Equal(t, "127.0.0.1", echoed["X-Real-Ip"])
+	assert.NotContains(t, echoed, http.CanonicalHeaderKey(UserIDHeader))
+}
+
+func TestRouteRequestHeadersOverrideService(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"backend": {
+				BaseURL:        backend.URL,
+				RequestHeaders: config.HeaderTransform{Set: map[string]string{"X-Route": "service"}},
+			},
+		},
+	}, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.GET("/admin/*path", proxy.ProxyToServiceWithHeaders("backend", config.HeaderTransform{
+		Set:    map[string]string{"X-Route": "admin"},
+		Remove: []string{"Authorization"},
+	}))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	echoed := gatewayHeaders(t, gateway, "/admin/users", map[string]string{"Authorization": "Bearer token"})
+	assert.Equal(t, "admin", echoed["X-Route"])
+	assert.NotContains(t, echoed, "Authorization")
+}
+
+func TestHeaderTransformValidate(t *testing.T) {
+	assert.NoError(t, config.HeaderTransform{Set: map[string]string{"X-Env": "prod"}}.Validate())
+	assert.Error(t, config.HeaderTransform{Set: map[string]string{"Bad Header": "x"}}.Validate())
+	assert.Error(t, config.HeaderTransform{Set: map[string]string{"X-Env": "a\nb"}}.Validate())
+	assert.Error(t, config.HeaderTransform{Remove: []string{"Host"}}.Validate())
+}
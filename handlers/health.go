@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"net/http"
+	"runtime"
+	"runtime/debug"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,6 +14,20 @@ import (
 type HealthHandler struct {
 	logger    *zap.Logger
 	startTime time.Time
+	upstreams UpstreamReporter
+	metrics   ServiceMetricsReporter
+	rateLimit RateLimitReporter
+	readiness readiness
+}
+
+// UpstreamReporter reports the health of backend upstreams, keyed by service name
+type UpstreamReporter interface {
+	UpstreamStatus() map[string][]UpstreamStatus
+}
+
+// RateLimitReporter reports the store backing the rate limiter
+type RateLimitReporter interface {
+	Store() string
 }
 
 // NewHealthHandler creates a new health handler
@@ -22,6 +38,21 @@ func NewHealthHandler(logger *zap.Logger) *HealthHandler {
 	}
 }
 
+// SetUpstreamReporter sets the source of backend upstream health for status reports
+func (h *HealthHandler) SetUpstreamReporter(reporter UpstreamReporter) {
+	h.upstreams = reporter
+}
+
+// SetMetricsReporter sets the source of per-service request statistics for status reports
+func (h *HealthHandler) SetMetricsReporter(reporter ServiceMetricsReporter) {
+	h.metrics = reporter
+}
+
+// SetRateLimitReporter sets the rate limiter whose mode is shown in detailed health
+func (h *HealthHandler) SetRateLimitReporter(reporter RateLimitReporter) {
+	h.rateLimit = reporter
+}
+
 // Health returns basic health status
 func (h *HealthHandler) Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -30,13 +61,35 @@ func (h *HealthHandler) Health(c *gin.Context) {
 	})
 }
 
-// Ready returns readiness status (for Kubernetes readiness probe)
+// Ready returns readiness status (for Kubernetes readiness probe), 503 while a
+// required dependency is down. The health field is degraded while any dependency or
+// upstream is down without making the gateway unready, e.g. one instance of a critical
+// service or every instance of a non-critical one. The endpoint is public, so which
+// dependencies are down and why is only reported by Detailed.
 func (h *HealthHandler) Ready(c *gin.Context) {
-	// Check if the service is ready to accept traffic
-	// Add any additional checks here (database, external services, etc.)
+	report := h.readiness.report()
 
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "ready",
+	status, code := "ready", http.StatusOK
+	if !report.ready {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+	health := "healthy"
+	for _, check := range report.checks {
+		if check.Status != "up" {
+			health = "degraded"
+		}
+	}
+	if h.upstreams != nil {
+		for _, service := range h.serviceStates() {
+			if service.Status != "up" {
+				health = "degraded"
+			}
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status":    status,
+		"health":    health,
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
 	})
 }
@@ -67,12 +120,121 @@ func (h *HealthHandler) Status(c *gin.Context) {
 func (h *HealthHandler) SystemStatus(c *gin.Context) {
 	uptime := time.Since(h.startTime)
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"service":     "api-gateway",
 		"status":      "healthy",
 		"version":     "1.0.0",
 		"uptime":      uptime.String(),
 		"timestamp":   time.Now().UTC().Format(time.RFC3339),
 		"environment": gin.Mode(),
-	})
+	}
+
+	// Include backend upstream health when available
+	if h.upstreams != nil {
+		upstreams := h.upstreams.UpstreamStatus()
+		for _, statuses := range upstreams {
+			for _, status := range statuses {
+				if !status.Healthy {
+					response["status"] = "degraded"
+				}
+			}
+		}
+		response["upstreams"] = upstreams
+	}
+
+	// Include per-service request statistics when metrics are enabled
+	if h.metrics != nil {
+		if metrics := h.metrics.ServiceMetrics(); metrics != nil {
+			response["services"] = metrics
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Detailed aggregates liveness, readiness dependencies and service states, backend
+// health, per-service statistics, the rate limiter mode and build information into one document for
+// dashboards (admin only). Sections for features that are off are omitted. It always
+// responds 200; the status field is healthy, degraded (an upstream or optional
+// dependency is down) or unhealthy (not ready).
+func (h *HealthHandler) Detailed(c *gin.Context) {
+	status := "healthy"
+	degrade := func() {
+		if status == "healthy" {
+			status = "degraded"
+		}
+	}
+
+	report := h.readiness.report()
+	readiness := gin.H{"status": "ready"}
+	if !report.ready {
+		readiness["status"] = "not ready"
+		status = "unhealthy"
+	}
+	if len(report.checks) > 0 {
+		readiness["checks"] = report.checks
+		for _, check := range report.checks {
+			if check.Status != "up" {
+				degrade()
+			}
+		}
+	}
+
+	response := gin.H{
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"liveness": gin.H{
+			"status": "alive",
+			"uptime": time.Since(h.startTime).String(),
+		},
+		"readiness": readiness,
+		"build":     buildInfo(),
+	}
+
+	if h.upstreams != nil {
+		upstreams := h.upstreams.UpstreamStatus()
+		for _, statuses := range upstreams {
+			for _, upstream := range statuses {
+				if !upstream.Healthy {
+					degrade()
+				}
+			}
+		}
+		response["upstreams"] = upstreams
+		readiness["services"] = h.serviceStates()
+	}
+	if h.metrics != nil {
+		if metrics := h.metrics.ServiceMetrics(); metrics != nil {
+			response["services"] = metrics
+		}
+	}
+	if h.rateLimit != nil {
+		response["rate_limiter"] = gin.H{"store": h.rateLimit.Store()}
+	}
+
+	response["status"] = status
+	c.JSON(http.StatusOK, response)
+}
+
+// buildInfo describes the running binary, with the VCS revision when it was built from
+// a repository checkout
+func buildInfo() gin.H {
+	build := gin.H{
+		"version":    "1.0.0",
+		"go_version": runtime.Version(),
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build["revision"] = setting.Value
+		case "vcs.time":
+			build["revision_time"] = setting.Value
+		case "vcs.modified":
+			build["modified"] = setting.Value == "true"
+		}
+	}
+	return build
 }
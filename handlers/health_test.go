@@ -108,3 +108,72 @@ func TestSystemStatus(t *testing.T) {
 	assert.Equal(t, "api-gateway", response["service"])
 	assert.NotEmpty(t, response["environment"])
 }
+
+// fakeHealthSources reports fixed upstream health, metrics and rate limiter mode
+type fakeHealthSources struct{}
+
+func (fakeHealthSources) UpstreamStatus() map[string][]UpstreamStatus {
+	return map[string][]UpstreamStatus{"users": {{URL: "http://users:8080", Healthy: false}}}
+}
+
+func (fakeHealthSources) ServiceMetrics() map[string]ServiceStats {
+	return map[string]ServiceStats{"users": {Requests: 3}}
+}
+
+func (fakeHealthSources) Store() string { return "local" }
+
+// detailedResponse requests /health/detailed and decodes the body
+func detailedResponse(t *testing.T, handler *HealthHandler) map[string]interface{} {
+	router, _ := setupTestRouter()
+	router.GET("/health/detailed", handler.Detailed)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health/detailed", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestDetailedHealth(t *testing.T) {
+	_, handler := setupTestRouter()
+	handler.SetUpstreamReporter(fakeHealthSources{})
+	handler.SetMetricsReporter(fakeHealthSources{})
+	handler.SetRateLimitReporter(fakeHealthSources{})
+	handler.AddReadinessCheck("redis", false, checkDown)
+
+	response := detailedResponse(t, handler)
+	assert.Equal(t, "degraded", response["status"])
+	assert.Equal(t, "alive", response["liveness"].(map[string]interface{})["status"])
+	readiness := response["readiness"].(map[string]interface{})
+	assert.Equal(t, "ready", readiness["status"])
+	assert.Contains(t, readiness["checks"], "redis")
+	assert.Contains(t, response["upstreams"], "users")
+	assert.Contains(t, response["services"], "users")
+	assert.Equal(t, map[string]interface{}{"store": "local"}, response["rate_limiter"])
+	build := response["build"].(map[string]interface{})
+	assert.Equal(t, "1.0.0", build["version"])
+	assert.NotEmpty(t, build["go_version"])
+}
+
+func TestDetailedHealthNotReady(t *testing.T) {
+	_, handler := setupTestRouter()
+	handler.AddReadinessCheck("redis", true, checkDown)
+
+	response := detailedResponse(t, handler)
+	assert.Equal(t, "unhealthy", response["status"])
+	assert.Equal(t, "not ready", response["readiness"].(map[string]interface{})["status"])
+}
+
+func TestDetailedHealthWithoutOptionalFeatures(t *testing.T) {
+	_, handler := setupTestRouter()
+
+	response := detailedResponse(t, handler)
+	assert.Equal(t, "healthy", response["status"])
+	assert.Equal(t, map[string]interface{}{"status": "ready"}, response["readiness"])
+	for _, section := range []string{"upstreams", "services", "rate_limiter"} {
+		assert.NotContains(t, response, section)
+	}
+	assert.Contains(t, response, "build")
+}
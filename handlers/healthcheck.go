@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/api-gateway/config"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHealthCheckPath               = "/health"
+	defaultHealthCheckInterval           = 10 * time.Second
+	defaultHealthCheckTimeout            = 2 * time.Second
+	defaultHealthCheckHealthyThreshold   = 2
+	defaultHealthCheckUnhealthyThreshold = 3
+)
+
+// HealthChecker periodically probes backend upstreams and marks them up or down
+type HealthChecker struct {
+	logger *zap.Logger
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// NewHealthChecker creates a new health checker
+func NewHealthChecker(logger *zap.Logger) *HealthChecker {
+	return &HealthChecker{
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Watch starts probing every upstream of a service in the background, using the
+// service's transport so probes take the same network path as proxied traffic.
+// Upstreams discovery adds later are probed as they join the pool. The returned
+// function stops probing the service.
+func (h *HealthChecker) Watch(serviceName string, hc config.HealthCheckConfig, pool *upstreamPool, transport http.RoundTripper) func() {
+	hc = healthCheckWithDefaults(hc)
+	client := newProbeClient(transport)
+	stop := make(chan struct{})
+	start := func(u *upstream) {
+		select {
+		case <-h.stop:
+			return
+		case <-stop:
+			return
+		default:
+		}
+		h.wg.Add(1)
+		go h.probeLoop(client, serviceName, hc, u, stop)
+	}
+	for _, u := range pool.watch(start) {
+		start(u)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// newProbeClient returns a client sending health probes over transport
+func newProbeClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		// Probes must not follow redirects to other hosts
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Stop stops all probes and waits for them to exit
+func (h *HealthChecker) Stop() {
+	h.once.Do(func() {
+		close(h.stop)
+	})
+	h.wg.Wait()
+}
+
+// probeLoop probes a single upstream on every interval until the checker or the service
+// watch is stopped, or the upstream leaves its pool
+func (h *HealthChecker) probeLoop(client *http.Client, serviceName string, hc config.HealthCheckConfig, u *upstream, stop <-chan struct{}) {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
+
+	for {
+		h.check(client, serviceName, hc, u)
+
+		select {
+		case <-h.stop:
+			return
+		case <-stop:
+			return
+		case <-u.removed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs a single probe and applies the healthy/unhealthy thresholds
+func (h *HealthChecker) check(client *http.Client, serviceName string, hc config.HealthCheckConfig, u *upstream) {
+	err := h.probe(client, hc, u)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.lastChecked = time.Now()
+	wasHealthy := u.healthy.Load()
+
+	if err == nil {
+		u.successes++
+		u.failures = 0
+		u.lastError = ""
+		if !wasHealthy && u.successes >= hc.HealthyThreshold {
+			u.healthy.Store(true)
+			h.logger.Info("Upstream marked healthy",
+				zap.String("service", serviceName),
+				zap.String("upstream", u.url.String()),
+			)
+		}
+		return
+	}
+
+	u.failures++
+	u.successes = 0
+	u.lastError = err.Error()
+	if wasHealthy && u.failures >= hc.UnhealthyThreshold {
+		u.healthy.Store(false)
+		h.logger.Warn("Upstream marked unhealthy",
+			zap.String("service", serviceName),
+			zap.String("upstream", u.url.String()),
+			zap.Error(err),
+		)
+	}
+}
+
+// probe sends a health check request to the upstream
+func (h *HealthChecker) probe(client *http.Client, hc config.HealthCheckConfig, u *upstream) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hc.Timeout)
+	defer cancel()
+	return probeUpstream(ctx, client, hc.Path, u)
+}
+
+// probeUpstream requests path on the upstream, expecting a 2xx or 3xx status
+func probeUpstream(ctx context.Context, client *http.Client, path string, u *upstream) error {
+	target := *u.url
+	target.Path = singleJoiningSlash(u.url.Path, path)
+	target.RawPath = ""
+	target.RawQuery = ""
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "api-gateway-health-checker")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// healthCheckWithDefaults fills in unset health check settings
+func healthCheckWithDefaults(hc config.HealthCheckConfig) config.HealthCheckConfig {
+	if hc.Path == "" {
+		hc.Path = defaultHealthCheckPath
+	}
+	if hc.Interval <= 0 {
+		hc.Interval = defaultHealthCheckInterval
+	}
+	if hc.Timeout <= 0 {
+		hc.Timeout = defaultHealthCheckTimeout
+	}
+	if hc.HealthyThreshold <= 0 {
+		hc.HealthyThreshold = defaultHealthCheckHealthyThreshold
+	}
+	if hc.UnhealthyThreshold <= 0 {
+		hc.UnhealthyThreshold = defaultHealthCheckUnhealthyThreshold
+	}
+	return hc
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// newFlappingBackend returns a backend whose health endpoint can be toggled
+func newFlappingBackend(name string) (*httptest.Server, *atomic.Bool) {
+	healthy := &atomic.Bool{}
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(name))
+	}))
+	return server, healthy
+}
+
+func setupHealthCheckedProxy(t *testing.T, endpoint config.ServiceEndpoint) (*httptest.Server, *ProxyHandler) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": endpoint},
+	}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	t.Cleanup(proxy.Close)
+
+	router := gin.New()
+	router.GET("/backend/*path", proxy.ProxyToService("backend"))
+
+	// The reverse proxy requires a real connection (CloseNotifier), so serve over HTTP
+	gateway := httptest.NewServer(router)
+	t.Cleanup(gateway.Close)
+	return gateway, proxy
+}
+
+func fastHealthCheck() config.HealthCheckConfig {
+	return config.HealthCheckConfig{
+		Enabled:            true,
+		Path:               "/health",
+		Interval:           10 * time.Millisecond,
+		Timeout:            time.Second,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	}
+}
+
+func TestHealthCheckFlappingBackend(t *testing.T) {
+	backend, healthy := newFlappingBackend("primary")
+	defer backend.Close()
+
+	gateway, proxy := setupHealthCheckedProxy(t, config.ServiceEndpoint{
+		BaseURL:     backend.URL,
+		HealthCheck: fastHealthCheck(),
+	})
+
+	status, _ := gatewayGet(t, gateway, "/backend/items")
+	assert.Equal(t, http.StatusOK, status)
+
+	// Backend goes down: it is removed and requests are rejected
+	healthy.Store(false)
+	assert.Eventually(t, func() bool {
+		status, _ := gatewayGet(t, gateway, "/backend/items")
+		return status == http.StatusServiceUnavailable
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.False(t, proxy.UpstreamStatus()["backend"][0].Healthy)
+
+	// Backend recovers: it is re-added once probes succeed again
+	healthy.Store(true)
+	assert.Eventually(t, func() bool {
+		status, _ := gatewayGet(t, gateway, "/backend/items")
+		return status == http.StatusOK
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.True(t, proxy.UpstreamStatus()["backend"][0].Healthy)
+}
+
+func TestHealthCheckSkipsDownUpstream(t *testing.T) {
+	stable, _ := newFlappingBackend("stable")
+	defer stable.Close()
+	flapping, healthy := newFlappingBackend("flapping")
+	defer flapping.Close()
+
+	gateway, _ := setupHealthCheckedProxy(t, config.ServiceEndpoint{
+		BaseURL:     stable.URL,
+		Upstreams:   []config.UpstreamEndpoint{{URL: flapping.URL}},
+		HealthCheck: fastHealthCheck(),
+	})
+
+	healthy.Store(false)
+	assert.Eventually(t, func() bool {
+		for i := 0; i < 4; i++ {
+			if _, body := gatewayGet(t, gateway, "/backend/items"); body != "stable" {
+				return false
+			}
+		}
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+
+	healthy.Store(true)
+	assert.Eventually(t, func() bool {
+		for i := 0; i < 4; i++ {
+			if _, body := gatewayGet(t, gateway, "/backend/items"); body == "flapping" {
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestSystemStatusIncludesUpstreams(t *testing.T) {
+	backend, healthy := newFlappingBackend("primary")
+	defer backend.Close()
+	healthy.Store(false)
+
+	_, proxy := setupHealthCheckedProxy(t, config.ServiceEndpoint{
+		BaseURL:     backend.URL,
+		HealthCheck: fastHealthCheck(),
+	})
+	assert.Eventually(t, func() bool {
+		return !proxy.UpstreamStatus()["backend"][0].Healthy
+	}, 2*time.Second, 10*time.Millisecond)
+
+	router, handler := setupTestRouter()
+	handler.SetUpstreamReporter(proxy)
+	router.GET("/api/v1/admin/system/status", handler.SystemStatus)
+
+	req, _ := http.NewRequest("GET", "/api/v1/admin/system/status", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"degraded"`)
+	assert.Contains(t, w.Body.String(), backend.URL)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MaintenanceHandler lets administrators switch maintenance mode during deploys
+type MaintenanceHandler struct {
+	maintenance *middleware.Maintenance
+	logger      *zap.Logger
+}
+
+// NewMaintenanceHandler creates a new maintenance mode admin handler
+func NewMaintenanceHandler(maintenance *middleware.Maintenance, logger *zap.Logger) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		maintenance: maintenance,
+		logger:      logger,
+	}
+}
+
+// maintenanceRequest is the body of a maintenance mode switch
+type maintenanceRequest struct {
+	Enabled    *bool  `json:"enabled" binding:"required"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after"` // Seconds; 0 uses the default
+}
+
+// Get returns the current maintenance mode
+func (h *MaintenanceHandler) Get(c *gin.Context) {
+	c.JSON(http.StatusOK, maintenanceResponse(h.maintenance.State()))
+}
+
+// Set switches maintenance mode on or off. It stays as set until the next change
+// through this endpoint or to the maintenance configuration.
+func (h *MaintenanceHandler) Set(c *gin.Context) {
+	var req maintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RetryAfter < 0 {
+		middleware.AbortWithError(c, middleware.CodeBadRequest, "enabled is required and retry_after must not be negative")
+		return
+	}
+
+	h.maintenance.Set(*req.Enabled, req.Message, time.Duration(req.RetryAfter)*time.Second)
+	state := h.maintenance.State()
+	fields := []zap.Field{zap.Bool("enabled", state.Enabled)}
+	if claims, ok := middleware.GetUserFromContext(c); ok {
+		fields = append(fields, zap.String("user_id", claims.UserID))
+	}
+	h.logger.Warn("Maintenance mode switched", fields...)
+	c.JSON(http.StatusOK, maintenanceResponse(state))
+}
+
+// maintenanceResponse renders the maintenance state
+func maintenanceResponse(state middleware.MaintenanceState) gin.H {
+	response := gin.H{
+		"enabled":     state.Enabled,
+		"message":     state.Message,
+		"retry_after": int(state.RetryAfter.Seconds()),
+	}
+	if state.Enabled {
+		response["since"] = state.Since
+	}
+	return response
+}
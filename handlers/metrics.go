@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ServiceStats summarizes the requests proxied to a backend service
+type ServiceStats struct {
+	Requests     int64   `json:"requests"`
+	Errors       int64   `json:"errors"` // Responses with a 5xx status, including gateway timeouts
+	ErrorRate    float64 `json:"error_rate"`
+	LatencyP50Ms float64 `json:"latency_p50_ms"`
+	LatencyP95Ms float64 `json:"latency_p95_ms"`
+}
+
+// ServiceMetricsReporter reports per-service request statistics, keyed by service name
+type ServiceMetricsReporter interface {
+	ServiceMetrics() map[string]ServiceStats
+}
+
+// serviceMetrics records request statistics for every backend service. Latency
+// quantiles are estimated with the P² algorithm, so memory per service is constant
+// regardless of traffic.
+type serviceMetrics struct {
+	mu       sync.Mutex
+	services map[string]*serviceCounters
+}
+
+// serviceCounters holds the running statistics for one service
+type serviceCounters struct {
+	requests int64
+	errors   int64
+	p50      *p2Quantile
+	p95      *p2Quantile
+}
+
+func newServiceMetrics() *serviceMetrics {
+	return &serviceMetrics{services: make(map[string]*serviceCounters)}
+}
+
+// record adds a completed request to the service's statistics
+func (m *serviceMetrics) record(service string, status int, latency time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counters, ok := m.services[service]
+	if !ok {
+		counters = &serviceCounters{p50: newP2Quantile(0.5), p95: newP2Quantile(0.95)}
+		m.services[service] = counters
+	}
+
+	counters.requests++
+	if status >= 500 {
+		counters.errors++
+	}
+	ms := float64(latency) / float64(time.Millisecond)
+	counters.p50.add(ms)
+	counters.p95.add(ms)
+}
+
+// remove drops the statistics of a service that no longer exists
+func (m *serviceMetrics) remove(service string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.services, service)
+}
+
+// snapshot returns the current statistics of every service
+func (m *serviceMetrics) snapshot() map[string]ServiceStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make(map[string]ServiceStats, len(m.services))
+	for name, counters := range m.services {
+		stats[name] = ServiceStats{
+			Requests:     counters.requests,
+			Errors:       counters.errors,
+			ErrorRate:    float64(counters.errors) / float64(counters.requests),
+			LatencyP50Ms: counters.p50.value(),
+			LatencyP95Ms: counters.p95.value(),
+		}
+	}
+	return stats
+}
+
+// p2Quantile estimates a single quantile of a stream using the P² algorithm
+// (Jain & Chlamtac, 1985), which tracks five markers instead of storing samples
+type p2Quantile struct {
+	p       float64
+	count   int
+	heights [5]float64
+	pos     [5]float64 // Actual marker positions
+	desired [5]float64 // Desired marker positions
+	step    [5]float64 // Desired position increments
+}
+
+func newP2Quantile(p float64) *p2Quantile {
+	return &p2Quantile{p: p, step: [5]float64{0, p / 2, p, (1 + p) / 2, 1}}
+}
+
+// add feeds an observation into the estimator
+func (q *p2Quantile) add(x float64) {
+	// The first five observations initialize the markers
+	if q.count < 5 {
+		q.heights[q.count] = x
+		q.count++
+		if q.count == 5 {
+			sort.Float64s(q.heights[:])
+			q.pos = [5]float64{1, 2, 3, 4, 5}
+			q.desired = [5]float64{1, 1 + 2*q.p, 1 + 4*q.p, 3 + 2*q.p, 5}
+		}
+		return
+	}
+	q.count++
+
+	// Find the cell containing x, extending the extremes if needed
+	var k int
+	switch {
+	case x < q.heights[0]:
+		q.heights[0] = x
+		k = 0
+	case x >= q.heights[4]:
+		q.heights[4] = x
+		k = 3
+	default:
+		for k = 0; k < 3 && x >= q.heights[k+1]; k++ {
+		}
+	}
+
+	for i := k + 1; i < 5; i++ {
+		q.pos[i]++
+	}
+	for i := range q.desired {
+		q.desired[i] += q.step[i]
+	}
+
+	// Move the middle markers towards their desired positions
+	for i := 1; i <= 3; i++ {
+		d := q.desired[i] - q.pos[i]
+		if (d >= 1 && q.pos[i+1]-q.pos[i] > 1) || (d <= -1 && q.pos[i-1]-q.pos[i] < -1) {
+			sign := math.Copysign(1, d)
+			height := q.parabolic(i, sign)
+			if height <= q.heights[i-1] || height >= q.heights[i+1] {
+				height = q.linear(i, sign)
+			}
+			q.heights[i] = height
+			q.pos[i] += sign
+		}
+	}
+}
+
+func (q *p2Quantile) parabolic(i int, d float64) float64 {
+	return q.heights[i] + d/(q.pos[i+1]-q.pos[i-1])*
+		((q.pos[i]-q.pos[i-1]+d)*(q.heights[i+1]-q.heights[i])/(q.pos[i+1]-q.pos[i])+
+			(q.pos[i+1]-q.pos[i]-d)*(q.heights[i]-q.heights[i-1])/(q.pos[i]-q.pos[i-1]))
+}
+
+func (q *p2Quantile) linear(i int, d float64) float64 {
+	j := i + int(d)
+	return q.heights[i] + d*(q.heights[j]-q.heights[i])/(q.pos[j]-q.pos[i])
+}
+
+// value returns the current estimate; with fewer than five observations it is exact
+func (q *p2Quantile) value() float64 {
+	if q.count == 0 {
+		return 0
+	}
+	if q.count < 5 {
+		samples := append([]float64{}, q.heights[:q.count]...)
+		sort.Float64s(samples)
+		return samples[int(math.Round(q.p*float64(q.count-1)))]
+	}
+	return q.heights[2]
+}
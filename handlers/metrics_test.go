@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestP2QuantileEstimate(t *testing.T) {
+	p50 := newP2Quantile(0.5)
+	p95 := newP2Quantile(0.95)
+
+	random := rand.New(rand.NewSource(1))
+	for _, i := range random.Perm(10000) {
+		p50.add(float64(i))
+		p95.add(float64(i))
+	}
+
+	assert.InDelta(t, 5000, p50.value(), 150)
+	assert.InDelta(t, 9500, p95.value(), 150)
+}
+
+func TestP2QuantileFewSamples(t *testing.T) {
+	q := newP2Quantile(0.5)
+	assert.Equal(t, 0.0, q.value())
+
+	q.add(30)
+	q.add(10)
+	q.add(20)
+	assert.Equal(t, 20.0, q.value())
+}
+
+func TestServiceMetricsInSystemStatus(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{
+		Metrics:  config.MetricsConfig{Enabled: true},
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL}},
+	}, zap.NewNop())
+	defer proxy.Close()
+
+	health := NewHealthHandler(zap.NewNop())
+	health.SetMetricsReporter(proxy)
+
+	router := gin.New()
+	router.Any("/svc/*path", proxy.ProxyToService("backend"))
+	router.GET("/status", health.SystemStatus)
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	for _, path := range []string{"/svc/ok", "/svc/ok", "/svc/ok", "/svc/fail"} {
+		status, _ := gatewayGet(t, gateway, path)
+		assert.NotZero(t, status)
+	}
+
+	_, body := gatewayGet(t, gateway, "/status")
+	var response struct {
+		Services map[string]ServiceStats `json:"services"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(body), &response))
+
+	stats := response.Services["backend"]
+	assert.Equal(t, int64(4), stats.Requests)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.Equal(t, 0.25, stats.ErrorRate)
+	assert.Greater(t, stats.LatencyP50Ms, 0.0)
+	assert.GreaterOrEqual(t, stats.LatencyP95Ms, stats.LatencyP50Ms)
+}
+
+func TestServiceMetricsDisabled(t *testing.T) {
+	proxy := NewProxyHandler(&config.Config{}, zap.NewNop())
+	defer proxy.Close()
+
+	assert.Nil(t, proxy.ServiceMetrics())
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"go.uber.org/zap"
+)
+
+// Mirror defaults
+const (
+	defaultMirrorMaxBodySize = 1 << 20
+	defaultMirrorTimeout     = 10 * time.Second
+	// maxInFlightMirrors bounds the mirror requests outstanding per service; requests
+	// arriving while the mirror is this far behind are not mirrored
+	maxInFlightMirrors = 256
+)
+
+// mirrorTransport sends requests to the primary backend and, for a sample of them, a
+// copy to the mirror backend in the background. The primary response is returned as
+// soon as it arrives whatever happens to the copy.
+type mirrorTransport struct {
+	next        http.RoundTripper
+	mirror      http.RoundTripper
+	target      *url.URL
+	cfg         config.MirrorConfig
+	maxBodySize int64
+	timeout     time.Duration
+	slots       chan struct{}
+	logger      *zap.Logger
+	// random returns a number in [0, 100); replaced in tests
+	random func() int
+}
+
+// newMirrorTransport wraps next to mirror requests as configured, or returns next
+// when the service has no mirror
+func newMirrorTransport(next http.RoundTripper, cfg config.MirrorConfig, logger *zap.Logger) (http.RoundTripper, error) {
+	if cfg.URL == "" {
+		return next, nil
+	}
+	target, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	mirror, err := newHTTPTransport(config.ServiceEndpoint{})
+	if err != nil {
+		return nil, err
+	}
+
+	maxBodySize := cfg.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMirrorMaxBodySize
+	}
+	return &mirrorTransport{
+		next:        next,
+		mirror:      mirror,
+		target:      target,
+		cfg:         cfg,
+		maxBodySize: maxBodySize,
+		timeout:     durationOr(cfg.Timeout, defaultMirrorTimeout),
+		slots:       make(chan struct{}, maxInFlightMirrors),
+		logger:      logger,
+		random:      func() int { return rand.Intn(100) },
+	}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.selects(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	body, ok := t.bufferBody(req)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	select {
+	case t.slots <- struct{}{}:
+		// Copy before the primary round trip so the two never share mutable state
+		copied, cancel := t.mirrorRequest(req, body)
+		go t.send(copied, cancel)
+	default:
+		// The mirror is falling behind; skip this copy rather than queue it
+	}
+	return t.next.RoundTrip(req)
+}
+
+// selects reports whether the request is sampled and its method may be mirrored.
+// Upgraded connections are never mirrored.
+func (t *mirrorTransport) selects(req *http.Request) bool {
+	if middleware.IsUpgradeRequest(req) {
+		return false
+	}
+	if !t.cfg.AllMethods {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			return false
+		}
+	}
+	return t.random() < t.cfg.Percent
+}
+
+// bufferBody reads the request body so that both backends can receive it, restoring it
+// on req. It reports false, leaving the body readable, when it is too large to mirror.
+func (t *mirrorTransport) bufferBody(req *http.Request) ([]byte, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true
+	}
+	if req.ContentLength > t.maxBodySize {
+		return nil, false
+	}
+
+	original := req.Body
+	body, err := io.ReadAll(io.LimitReader(original, t.maxBodySize+1))
+	if err != nil || int64(len(body)) > t.maxBodySize {
+		// Hand the primary the bytes already read followed by the rest
+		req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), original), Closer: original}
+		return nil, false
+	}
+	original.Close()
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, true
+}
+
+// mirrorRequest returns a copy of req addressed to the mirror. The copy must outlive
+// the client request, so it gets its own deadline; cancel releases it.
+func (t *mirrorTransport) mirrorRequest(req *http.Request, body []byte) (*http.Request, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	copied := req.Clone(ctx)
+	copied.URL.Scheme = t.target.Scheme
+	copied.URL.Host = t.target.Host
+	copied.Host = t.target.Host
+	copied.Body = http.NoBody
+	copied.GetBody = nil
+	if body != nil {
+		copied.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return copied, cancel
+}
+
+// send delivers the mirrored request and discards the response
+func (t *mirrorTransport) send(req *http.Request, cancel context.CancelFunc) {
+	defer func() { <-t.slots }()
+	defer cancel()
+
+	resp, err := t.mirror.RoundTrip(req)
+	if err != nil {
+		t.logger.Debug("Mirror request failed",
+			zap.String("mirror", t.target.Host),
+			zap.String("path", req.URL.Path),
+			zap.Error(err),
+		)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
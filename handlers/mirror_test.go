@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// mirroredRequest is what the mirror backend received
+type mirroredRequest struct {
+	method string
+	path   string
+	body   string
+	header http.Header
+}
+
+// newMirrorBackend records the requests it receives after waiting delay
+func newMirrorBackend(t *testing.T, delay time.Duration) (*httptest.Server, chan mirroredRequest) {
+	received := make(chan mirroredRequest, 10)
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- mirroredRequest{method: r.Method, path: r.URL.Path, body: string(body), header: r.Header.Clone()}
+		time.Sleep(delay)
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "mirror response")
+	}))
+	t.Cleanup(mirror.Close)
+	return mirror, received
+}
+
+// expectMirrored waits for the mirror to receive a request
+func expectMirrored(t *testing.T, received chan mirroredRequest) mirroredRequest {
+	select {
+	case req := <-received:
+		return req
+	case <-time.After(2 * time.Second):
+		t.Fatal("mirror received no request")
+		return mirroredRequest{}
+	}
+}
+
+// expectNotMirrored checks that the mirror receives nothing
+func expectNotMirrored(t *testing.T, received chan mirroredRequest) {
+	select {
+	case req := <-received:
+		t.Fatalf("unexpected mirrored request %s %s", req.method, req.path)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMirrorReceivesCopy(t *testing.T) {
+	mirror, received := newMirrorBackend(t, 0)
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {
+			BaseURL: newEchoBackend(t, "primary").URL,
+			Mirror:  config.MirrorConfig{URL: mirror.URL, Percent: 100, AllMethods: true},
+		}},
+	}, "backend")
+
+	resp := sendRequest(t, "POST", gateway.URL+"/svc/events?x=1", `{"n":1}`, "X-Custom", "kept")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, `primary:{"n":1}`, resp.Body, "the primary gets the full body")
+
+	copied := expectMirrored(t, received)
+	assert.Equal(t, "POST", copied.method)
+	assert.Equal(t, "/events", copied.path)
+	assert.Equal(t, `{"n":1}`, copied.body)
+	assert.Equal(t, "kept", copied.header.Get("X-Custom"))
+	assert.Equal(t, "api-gateway", copied.header.Get("X-Gateway"))
+}
+
+func TestMirrorSkipsNonIdempotentMethodsByDefault(t *testing.T) {
+	mirror, received := newMirrorBackend(t, 0)
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {
+			BaseURL: newEchoBackend(t, "primary").URL,
+			Mirror:  config.MirrorConfig{URL: mirror.URL, Percent: 100},
+		}},
+	}, "backend")
+
+	assert.Equal(t, http.StatusOK, sendRequest(t, "POST", gateway.URL+"/svc/orders", "order").Code)
+	expectNotMirrored(t, received)
+
+	sendRequest(t, "GET", gateway.URL+"/svc/orders", "")
+	assert.Equal(t, "GET", expectMirrored(t, received).method)
+}
+
+func TestMirrorSampling(t *testing.T) {
+	mirror, received := newMirrorBackend(t, 0)
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {
+			BaseURL: newEchoBackend(t, "primary").URL,
+			Mirror:  config.MirrorConfig{URL: mirror.URL, Percent: 25},
+		}},
+	}, "backend")
+	svc, _ := proxy.service("backend")
+	transport := svc.proxy.Transport.(*mirrorTransport)
+
+	transport.random = func() int { return 25 }
+	sendRequest(t, "GET", gateway.URL+"/svc/a", "")
+	expectNotMirrored(t, received)
+
+	transport.random = func() int { return 24 }
+	sendRequest(t, "GET", gateway.URL+"/svc/b", "")
+	assert.Equal(t, "/b", expectMirrored(t, received).path)
+}
+
+func TestMirrorFailuresDoNotAffectClient(t *testing.T) {
+	primary := newEchoBackend(t, "primary")
+
+	t.Run("slow mirror", func(t *testing.T) {
+		mirror, received := newMirrorBackend(t, 2*time.Second)
+		gateway, _ := setupServiceGateway(t, &config.Config{
+			Services: map[string]config.ServiceEndpoint{"backend": {
+				BaseURL: primary.URL,
+				Mirror:  config.MirrorConfig{URL: mirror.URL, Percent: 100, AllMethods: true},
+			}},
+		}, "backend")
+
+		start := time.Now()
+		resp := sendRequest(t, "PUT", gateway.URL+"/svc/item", "data")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "primary:data", resp.Body)
+		expectMirrored(t, received)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("unreachable mirror", func(t *testing.T) {
+		mirror := httptest.NewServer(http.NotFoundHandler())
+		mirror.Close()
+		gateway, _ := setupServiceGateway(t, &config.Config{
+			Services: map[string]config.ServiceEndpoint{"backend": {
+				BaseURL: primary.URL,
+				Mirror:  config.MirrorConfig{URL: mirror.URL, Percent: 100},
+			}},
+		}, "backend")
+
+		resp := sendRequest(t, "GET", gateway.URL+"/svc/item", "")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "primary:", resp.Body)
+	})
+}
+
+func TestMirrorSkipsLargeBodies(t *testing.T) {
+	mirror, received := newMirrorBackend(t, 0)
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {
+			BaseURL: newEchoBackend(t, "primary").URL,
+			Mirror:  config.MirrorConfig{URL: mirror.URL, Percent: 100, AllMethods: true, MaxBodySize: 4},
+		}},
+	}, "backend")
+
+	resp := sendRequest(t, "POST", gateway.URL+"/svc/upload", "0123456789")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "primary:0123456789", resp.Body)
+	expectNotMirrored(t, received)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/api-gateway/config"
+)
+
+// pathTarget is an upstream pool serving the requests under a path prefix
+type pathTarget struct {
+	prefix string
+	pool   *upstreamPool
+}
+
+// newPathTargets builds the pools of a service's path targets, longest prefix first
+func newPathTargets(endpoint config.ServiceEndpoint) ([]pathTarget, error) {
+	targets := make([]pathTarget, 0, len(endpoint.PathTargets))
+	for _, target := range endpoint.PathTargets {
+		pool, err := newUpstreamPool(config.ServiceEndpoint{
+			Upstreams:       target.Upstreams,
+			KeepTrailingDot: endpoint.KeepTrailingDot,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("path target %s: %w", target.Prefix, err)
+		}
+		targets = append(targets, pathTarget{prefix: target.Prefix, pool: pool})
+	}
+
+	sort.SliceStable(targets, func(i, j int) bool { return len(targets[i].prefix) > len(targets[j].prefix) })
+	return targets, nil
+}
+
+// matchPathTarget returns the pool for the longest prefix matching path, or nil
+func matchPathTarget(targets []pathTarget, path string) *upstreamPool {
+	for _, target := range targets {
+		if hasPathPrefix(path, target.prefix) {
+			return target.pool
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathTargetRouting(t *testing.T) {
+	shared := newHeaderEchoBackend()
+	defer shared.Close()
+	reportsA := newHeaderEchoBackend()
+	defer reportsA.Close()
+	reportsB := newHeaderEchoBackend()
+	defer reportsB.Close()
+	exports := newHeaderEchoBackend()
+	defer exports.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"analytics": {
+			BaseURL: shared.URL,
+			PathTargets: []config.PathTarget{
+				{Prefix: "/reports", Upstreams: []config.UpstreamEndpoint{{URL: reportsA.URL}, {URL: reportsB.URL}}},
+				{Prefix: "/reports/exports", Upstreams: []config.UpstreamEndpoint{{URL: exports.URL}}},
+			},
+		}},
+	}, "analytics")
+
+	host := func(path string) string {
+		return gatewayHeaders(t, gateway, path, nil)["Host"]
+	}
+
+	// Requests under /reports are balanced across the reports replicas
+	reportHosts := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		reportHosts[host("/svc/reports/daily")] = true
+	}
+	assert.Equal(t, map[string]bool{
+		reportsA.Listener.Addr().String(): true,
+		reportsB.Listener.Addr().String(): true,
+	}, reportHosts)
+	assert.Contains(t, []string{reportsA.Listener.Addr().String(), reportsB.Listener.Addr().String()}, host("/svc/reports"))
+
+	// The longest prefix wins
+	assert.Equal(t, exports.Listener.Addr().String(), host("/svc/reports/exports/42"))
+
+	// Other paths, including ones merely sharing the prefix text, use the default pool
+	assert.Equal(t, shared.Listener.Addr().String(), host("/svc/users"))
+	assert.Equal(t, shared.Listener.Addr().String(), host("/svc/reportsarchive"))
+}
@@ -2,25 +2,60 @@ package handlers
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
 	"go.uber.org/zap"
+	"golang.org/x/net/http/httpguts"
 )
 
 // ProxyHandler handles reverse proxy operations
 type ProxyHandler struct {
 	config          *config.Config
 	logger          *zap.Logger
-	proxies         map[string]*httputil.ReverseProxy
+	mu              sync.RWMutex
+	services        map[string]*serviceProxy
+	registered      map[string]ServiceDefinition
+	registry        *serviceRegistry
 	externalProxies map[string]*httputil.ReverseProxy
+	externalTimeout map[string]time.Duration
+	externalCaches  map[string]*responseCache
+	healthChecker   *HealthChecker
+	trustedProxies  middleware.IPRanges
+	metrics         *serviceMetrics // nil when metrics are disabled
+	backendMetrics  *backendMetrics
+	tunnels         *tunnelTracker // upgraded connections, closed on shutdown
+}
+
+// serviceProxy holds the reverse proxy and upstream pool for a backend service
+type serviceProxy struct {
+	name            string
+	endpoint        config.ServiceEndpoint
+	pool            *upstreamPool
+	proxy           *httputil.ReverseProxy
+	transport       http.RoundTripper
+	stop            func() // Stops health checking and discovery
+	timeoutNanos    atomic.Int64
+	tenantUpstreams map[string]*upstream
+	pathTargets     []pathTarget
+	canary          *canaryRouter   // nil when no canary is configured
+	fallback        *fallback       // nil when no fallback response is configured
+	bulkhead        *bulkhead       // nil when concurrency is unlimited
+	sticky          *stickySessions // nil without session affinity
+	cache           *responseCache  // nil when responses aren't cached
 }
 
 // NewProxyHandler creates a new proxy handler
@@ -28,13 +63,35 @@ func NewProxyHandler(cfg *config.Config, logger *zap.Logger) *ProxyHandler {
 	handler := &ProxyHandler{
 		config:          cfg,
 		logger:          logger,
-		proxies:         make(map[string]*httputil.ReverseProxy),
+		services:        make(map[string]*serviceProxy),
+		registered:      make(map[string]ServiceDefinition),
 		externalProxies: make(map[string]*httputil.ReverseProxy),
+		externalTimeout: make(map[string]time.Duration),
+		externalCaches:  make(map[string]*responseCache),
+		healthChecker:   NewHealthChecker(logger),
+		backendMetrics:  newBackendMetrics(),
+		tunnels:         newTunnelTracker(),
+	}
+
+	trustedProxies, err := middleware.ParseIPRanges(cfg.TrustedProxies)
+	if err != nil {
+		logger.Error("Invalid trusted proxies, forwarding headers will not be trusted", zap.Error(err))
+	}
+	handler.trustedProxies = trustedProxies
+
+	if cfg.Metrics.Enabled {
+		handler.metrics = newServiceMetrics()
 	}
 
 	// Initialize proxies for each backend service
 	handler.initProxies()
 
+	// Restore services registered at runtime through the admin API
+	if cfg.ServiceRegistry.File != "" {
+		handler.registry = &serviceRegistry{path: cfg.ServiceRegistry.File}
+		handler.loadRegisteredServices()
+	}
+
 	// Initialize proxies for external services
 	handler.initExternalProxies()
 
@@ -44,41 +101,259 @@ func NewProxyHandler(cfg *config.Config, logger *zap.Logger) *ProxyHandler {
 // initProxies initializes reverse proxies for all backend services
 func (p *ProxyHandler) initProxies() {
 	for serviceName, endpoint := range p.config.Services {
-		if endpoint.BaseURL == "" {
+		if endpoint.BaseURL == "" && len(endpoint.Upstreams) == 0 && !endpoint.Discovery.Enabled() {
 			continue
 		}
 
-		target, err := url.Parse(endpoint.BaseURL)
+		svc, err := p.buildServiceProxy(serviceName, endpoint)
 		if err != nil {
-			p.logger.Error("Failed to parse service URL",
+			p.logger.Error("Failed to initialize proxy for service",
 				zap.String("service", serviceName),
 				zap.String("url", endpoint.BaseURL),
 				zap.Error(err),
 			)
 			continue
 		}
+		p.services[serviceName] = svc
 
-		proxy := httputil.NewSingleHostReverseProxy(target)
+		p.logger.Debug("Initialized proxy for service",
+			zap.String("service", serviceName),
+			zap.String("discovery", endpoint.Discovery.Type),
+			zap.Int("upstreams", len(svc.pool.members())),
+			zap.Bool("health_check", endpoint.HealthCheck.Enabled),
+		)
+	}
 
-		// Customize the director to modify the request
-		originalDirector := proxy.Director
-		proxy.Director = func(req *http.Request) {
-			originalDirector(req)
-			p.modifyRequest(req, target)
-		}
+	// Summarize instead of logging every service at info level, which floods
+	// startup logs when many services are configured
+	p.logger.Info("Initialized service proxies",
+		zap.Int("services", len(p.services)),
+		zap.Int("skipped", len(p.config.Services)-len(p.services)),
+	)
+}
 
-		// Custom error handler
-		proxy.ErrorHandler = p.errorHandler
+// buildServiceProxy creates the upstream pool, transport and reverse proxy for a
+// service and starts health checking it if enabled
+func (p *ProxyHandler) buildServiceProxy(serviceName string, endpoint config.ServiceEndpoint) (*serviceProxy, error) {
+	pool, err := newUpstreamPool(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service url: %w", err)
+	}
 
-		// Custom response modifier
-		proxy.ModifyResponse = p.modifyResponse
+	rewriter, err := newPathRewriter(endpoint.Rewrites)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rewrite rules: %w", err)
+	}
 
-		p.proxies[serviceName] = proxy
-		p.logger.Info("Initialized proxy for service",
+	if endpoint.TLS.InsecureSkipVerify {
+		p.logger.Warn("TLS certificate verification is DISABLED for backend service; traffic can be intercepted",
 			zap.String("service", serviceName),
-			zap.String("url", endpoint.BaseURL),
 		)
 	}
+
+	fb, err := newFallback(endpoint.Fallback)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fallback: %w", err)
+	}
+
+	var transport http.RoundTripper
+	if endpoint.Protocol == "grpc" {
+		tlsConfig, err := upstreamTLSConfig(endpoint.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transport settings: %w", err)
+		}
+		transport = newGRPCTransport(tlsConfig)
+	} else {
+		transport, err = newServiceTransport(endpoint, p.config.GatewaySigning)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transport settings: %w", err)
+		}
+	}
+
+	tenantUpstreams := make(map[string]*upstream, len(endpoint.TenantRouting.Tenants))
+	for tenant, rawURL := range endpoint.TenantRouting.Tenants {
+		target, err := parseBackendURL(rawURL, endpoint.KeepTrailingDot)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream for tenant %s: %w", tenant, err)
+		}
+		u := &upstream{url: target, weight: 1}
+		u.healthy.Store(true)
+		tenantUpstreams[tenant] = u
+	}
+
+	pathTargets, err := newPathTargets(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path targets: %w", err)
+	}
+
+	canary, err := newCanaryRouter(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid canary: %w", err)
+	}
+
+	// Only proxied requests are mirrored and timed, not health probes
+	proxyTransport, err := newMirrorTransport(&timingTransport{next: transport}, endpoint.Mirror, p.logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror: %w", err)
+	}
+	// Stale cached responses stand in for slow or unreachable backends
+	cache := newResponseCache(endpoint.Cache, endpoint.Timeout)
+	var stale *staleTransport
+	if cache != nil {
+		stale = &staleTransport{next: proxyTransport}
+		proxyTransport = stale
+	}
+
+	proxy := &httputil.ReverseProxy{
+		// Route each request to the upstream selected for it
+		Director: func(req *http.Request) {
+			target, ok := upstreamFromContext(req.Context())
+			if !ok {
+				target = pool.primary()
+			}
+			applyRewrites(req, rewriter)
+			rewriteRequestURL(req, target.url)
+			p.modifyRequest(req, target.url, endpoint.HostHeader, endpoint.RequestHeaders)
+		},
+		// Custom error handler, serving the fallback response when one is configured
+		ErrorHandler: p.fallbackErrorHandler(fb),
+		// Custom response modifier
+		ModifyResponse: func(resp *http.Response) error {
+			if endpoint.Redirect.RewriteLocation {
+				rewriteLocation(resp)
+			}
+			rewriteCookies(resp, endpoint.Cookies)
+			if err := filterResponse(resp, endpoint.ResponseFilter); err != nil {
+				return err
+			}
+			return p.modifyResponse(resp)
+		},
+		Transport: proxyTransport,
+	}
+	if stale != nil {
+		stale.modifyResponse = proxy.ModifyResponse
+	}
+	if endpoint.Protocol == "grpc" {
+		// Stream messages as they arrive and report failures as gRPC statuses
+		proxy.FlushInterval = -1
+		proxy.ErrorHandler = p.grpcErrorHandler
+	}
+
+	svc := &serviceProxy{
+		name:            serviceName,
+		endpoint:        endpoint,
+		pool:            pool,
+		proxy:           proxy,
+		transport:       transport,
+		stop:            func() {},
+		tenantUpstreams: tenantUpstreams,
+		pathTargets:     pathTargets,
+		canary:          canary,
+		fallback:        fb,
+		bulkhead:        newBulkhead(endpoint.MaxConcurrent, endpoint.QueueTimeout),
+		sticky:          newStickySessions(serviceName, endpoint.StickySession),
+		cache:           cache,
+	}
+	svc.timeoutNanos.Store(int64(endpoint.Timeout))
+
+	if endpoint.HealthCheck.Enabled {
+		pools := []*upstreamPool{pool}
+		for _, target := range pathTargets {
+			pools = append(pools, target.pool)
+		}
+		if canary != nil {
+			pools = append(pools, canary.pool)
+		}
+
+		stops := make([]func(), 0, len(pools))
+		for _, watched := range pools {
+			stops = append(stops, p.healthChecker.Watch(serviceName, endpoint.HealthCheck, watched, transport))
+		}
+		svc.stop = func() {
+			for _, stop := range stops {
+				stop()
+			}
+		}
+	}
+
+	if endpoint.Discovery.Enabled() {
+		stopHealthCheck := svc.stop
+		stopDiscovery := p.watchDiscovery(serviceName, endpoint.Discovery, pool, newServiceDiscovery(endpoint))
+		svc.stop = func() {
+			stopDiscovery()
+			stopHealthCheck()
+		}
+	}
+
+	return svc, nil
+}
+
+// service returns the proxy for a backend service
+func (p *ProxyHandler) service(serviceName string) (*serviceProxy, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	svc, ok := p.services[serviceName]
+	return svc, ok
+}
+
+// Close stops background health checking and service discovery
+func (p *ProxyHandler) Close() {
+	p.mu.RLock()
+	for _, svc := range p.services {
+		svc.stop()
+	}
+	p.mu.RUnlock()
+	p.healthChecker.Stop()
+}
+
+// UpstreamStatus returns the health of every upstream, keyed by service name
+func (p *ProxyHandler) UpstreamStatus() map[string][]UpstreamStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	status := make(map[string][]UpstreamStatus, len(p.services))
+	for name, svc := range p.services {
+		status[name] = svc.pool.status()
+	}
+	return status
+}
+
+// CheckService reports whether a backend service is reachable. Services with active
+// health checks are judged by their tracked upstream health; others are probed at the
+// health check path, succeeding when any upstream answers.
+func (p *ProxyHandler) CheckService(ctx context.Context, serviceName string) error {
+	svc, ok := p.service(serviceName)
+	if !ok {
+		return fmt.Errorf("unknown service %s", serviceName)
+	}
+
+	if svc.endpoint.HealthCheck.Enabled {
+		for _, u := range svc.pool.members() {
+			if u.healthy.Load() {
+				return nil
+			}
+		}
+		return errors.New("no healthy upstream")
+	}
+
+	client := newProbeClient(svc.transport)
+	path := healthCheckWithDefaults(svc.endpoint.HealthCheck).Path
+	var err error
+	for _, u := range svc.pool.members() {
+		if err = probeUpstream(ctx, client, path, u); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// ServiceMetrics returns request statistics for every service that has served
+// traffic, or nil when metrics are disabled
+func (p *ProxyHandler) ServiceMetrics() map[string]ServiceStats {
+	if p.metrics == nil {
+		return nil
+	}
+	return p.metrics.snapshot()
 }
 
 // initExternalProxies initializes reverse proxies for external services
@@ -88,7 +363,7 @@ func (p *ProxyHandler) initExternalProxies() {
 			continue
 		}
 
-		target, err := url.Parse(endpoint.BaseURL)
+		target, err := parseBackendURL(endpoint.BaseURL, false)
 		if err != nil {
 			p.logger.Error("Failed to parse external service URL",
 				zap.String("service", serviceName),
@@ -104,76 +379,214 @@ func (p *ProxyHandler) initExternalProxies() {
 		originalDirector := proxy.Director
 		proxy.Director = func(req *http.Request) {
 			originalDirector(req)
-			p.modifyRequest(req, target)
+			p.modifyRequest(req, target, "", config.HeaderTransform{})
 		}
 
-		// Custom error handler
-		proxy.ErrorHandler = p.errorHandler
+		// Custom error handler, serving the fallback response when one is configured
+		fb, err := newFallback(endpoint.Fallback)
+		if err != nil {
+			p.logger.Error("Invalid fallback for external service, using the default error",
+				zap.String("service", serviceName),
+				zap.Error(err),
+			)
+		}
+		proxy.ErrorHandler = p.fallbackErrorHandler(fb)
 
 		// Custom response modifier
 		proxy.ModifyResponse = p.modifyResponse
 
 		p.externalProxies[serviceName] = proxy
-		p.logger.Info("Initialized external proxy for service",
+		p.externalTimeout[serviceName] = endpoint.Timeout
+		if cache := newResponseCache(endpoint.Cache, endpoint.Timeout); cache != nil {
+			p.externalCaches[serviceName] = cache
+			proxy.Transport = &staleTransport{next: http.DefaultTransport, modifyResponse: proxy.ModifyResponse}
+		}
+		p.logger.Debug("Initialized external proxy for service",
 			zap.String("service", serviceName),
 			zap.String("url", endpoint.BaseURL),
 			zap.Bool("websocket", endpoint.WebSocket),
 		)
 	}
+
+	p.logger.Info("Initialized external service proxies",
+		zap.Int("services", len(p.externalProxies)),
+		zap.Int("skipped", len(p.config.ExternalServices)-len(p.externalProxies)),
+	)
 }
 
-// modifyRequest modifies the request before sending to backend service
-func (p *ProxyHandler) modifyRequest(req *http.Request, target *url.URL) {
+// modifyRequest modifies the request before sending to backend service. The Host
+// header is the target host unless hostHeader overrides it. Header transforms run
+// before the gateway sets its own headers, so they cannot override them.
+func (p *ProxyHandler) modifyRequest(req *http.Request, target *url.URL, hostHeader string, headers config.HeaderTransform) {
+	// Preserve the host the client addressed before it is replaced
+	originalHost := req.Host
+
+	// Never forward client-supplied copies of headers the gateway manages
+	for _, name := range gatewayManagedHeaders {
+		req.Header.Del(name)
+	}
+	applyHeaderTransforms(req, headers)
+	forwardAPIVersion(req, p.config.APIVersion)
+	forwardPrincipal(req)
+
 	req.Host = target.Host
+	if hostHeader != "" {
+		req.Host = hostHeader
+	}
 	req.URL.Host = target.Host
 	req.URL.Scheme = target.Scheme
 
 	// Add/forward headers
-	req.Header.Set("X-Forwarded-Host", req.Host)
+	req.Header.Set("X-Forwarded-Host", originalHost)
 	req.Header.Set("X-Origin-Host", target.Host)
 
-	// Forward original client IP
-	if clientIP := req.Header.Get("X-Real-IP"); clientIP == "" {
-		req.Header.Set("X-Real-IP", req.RemoteAddr)
+	// Forward the real client IP. A client-supplied X-Forwarded-For chain is only kept
+	// when the peer is a trusted proxy; the reverse proxy then appends the peer address
+	// to the chain. Client copies of X-Real-IP were stripped above so it can't be forged.
+	peer := middleware.ParseRemoteIP(req.RemoteAddr)
+	if !p.trustedProxies.Contains(peer) {
+		req.Header.Del("X-Forwarded-For")
+	}
+	if clientIP := middleware.ResolveClientIP(req.RemoteAddr, middleware.ForwardedFor(req.Header), p.trustedProxies); clientIP != nil {
+		req.Header.Set("X-Real-IP", clientIP.String())
 	}
 
 	// Add gateway identifier
 	req.Header.Set("X-Gateway", "api-gateway")
+
+	// Sign the request last so the signature covers the final headers
+	if p.config.GatewaySigning.Enabled {
+		signRequest(req, p.config.GatewaySigning, time.Now())
+	}
 }
 
 // modifyResponse modifies the response from backend service
 func (p *ProxyHandler) modifyResponse(resp *http.Response) error {
 	// Add custom headers to response
 	resp.Header.Set("X-Gateway", "api-gateway")
+	captureForCache(resp)
+
+	// Tell backend errors apart from the gateway's own in logs and metrics; the
+	// response itself is forwarded unchanged
+	if resp.StatusCode >= 500 && resp.Request != nil {
+		if timing, ok := backendTimingFrom(resp.Request.Context()); ok {
+			timing.upstreamError.Store(true)
+			if limit := p.config.Logging.UpstreamErrorBodyBytes; limit > 0 && hasResponseBody(resp) {
+				resp.Body = &errorBodyCapture{ReadCloser: resp.Body, timing: timing, limit: limit}
+			}
+		}
+	}
 
 	return nil
 }
 
-// errorHandler handles errors from the reverse proxy
+// errorBodyCapture keeps up to limit bytes from the start of a response body as it is
+// copied to the client, so the response isn't held back. They are recorded in the
+// backend timing once the limit or the end of the body is reached, or it is closed.
+type errorBodyCapture struct {
+	io.ReadCloser
+	timing *backendTiming
+	head   []byte
+	limit  int
+	stored bool
+}
+
+func (b *errorBodyCapture) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if keep := min(n, b.limit-len(b.head)); keep > 0 {
+		b.head = append(b.head, p[:keep]...)
+	}
+	if len(b.head) >= b.limit || err != nil {
+		b.store()
+	}
+	return n, err
+}
+
+func (b *errorBodyCapture) Close() error {
+	b.store()
+	return b.ReadCloser.Close()
+}
+
+// store records the captured bytes once
+func (b *errorBodyCapture) store() {
+	if b.stored {
+		return
+	}
+	b.stored = true
+	body := string(b.head)
+	b.timing.errorBody.Store(&body)
+}
+
+// hasResponseBody reports whether a backend response may carry a body. Transforms that
+// decode or rewrite the body must pass responses without one through untouched.
+func hasResponseBody(resp *http.Response) bool {
+	switch {
+	case resp.StatusCode < 200, resp.StatusCode == http.StatusNoContent, resp.StatusCode == http.StatusNotModified:
+		return false
+	case resp.Request != nil && resp.Request.Method == http.MethodHead:
+		return false
+	}
+	return resp.ContentLength != 0
+}
+
+// errBackendTimeout cancels a backend request that outlived its timeout
+var errBackendTimeout = errors.New("backend request timed out")
+
+// errorHandler handles errors from the reverse proxy. Requests cancelled on timeout are
+// answered by proxyWithTimeout instead.
 func (p *ProxyHandler) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if backendTimedOut(r) {
+		return
+	}
 	p.logger.Error("Proxy error",
 		zap.String("method", r.Method),
 		zap.String("url", r.URL.String()),
 		zap.Error(err),
 	)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusBadGateway)
+	if middleware.BudgetExceeded(r.Context()) {
+		middleware.WriteError(w, r, middleware.CodeRequestBudgetExceeded, "Request time budget exceeded")
+		return
+	}
+	// Connect and response header timeouts
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		middleware.WriteError(w, r, middleware.CodeUpstreamTimeout, "Backend service did not respond in time")
+		return
+	}
+	middleware.WriteError(w, r, middleware.CodeUpstreamUnreachable, "Failed to reach backend service: "+err.Error())
+}
 
-	response := fmt.Sprintf(`{"error":"Bad Gateway","message":"Failed to reach backend service: %s"}`, err.Error())
-	w.Write([]byte(response))
+// fallbackErrorHandler returns a proxy error handler serving fb when the backend can't
+// be reached. Without a fallback, or when the request's time budget ran out, the
+// default error handler responds.
+func (p *ProxyHandler) fallbackErrorHandler(fb *fallback) func(http.ResponseWriter, *http.Request, error) {
+	if fb == nil {
+		return p.errorHandler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if middleware.BudgetExceeded(r.Context()) || backendTimedOut(r) {
+			p.errorHandler(w, r, err)
+			return
+		}
+
+		p.logger.Error("Proxy error, serving fallback response",
+			zap.String("method", r.Method),
+			zap.String("url", r.URL.String()),
+			zap.Error(err),
+		)
+		fb.write(w, r)
+	}
 }
 
 // ProxyToService returns a handler that proxies requests to a specific backend service
 func (p *ProxyHandler) ProxyToService(serviceName string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		proxy, exists := p.proxies[serviceName]
+		svc, exists := p.service(serviceName)
 		if !exists {
 			p.logger.Error("Proxy not found for service", zap.String("service", serviceName))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Internal Server Error",
-				"message": "Service configuration not found",
-			})
+			middleware.AbortWithError(c, middleware.CodeServiceNotFound, "Service configuration not found")
 			return
 		}
 
@@ -189,45 +602,17 @@ func (p *ProxyHandler) ProxyToService(serviceName string) gin.HandlerFunc {
 			c.Request.URL.Path = path
 		}
 
-		// Set timeout for backend request
-		timeout := p.getServiceTimeout(serviceName)
-
-		// Add timeout handling
-		done := make(chan bool, 1)
-		go func() {
-			proxy.ServeHTTP(c.Writer, c.Request)
-			done <- true
-		}()
-
-		select {
-		case <-done:
-			// Request completed successfully
-		case <-time.After(timeout):
-			p.logger.Error("Backend request timeout",
-				zap.String("service", serviceName),
-				zap.String("path", c.Request.URL.Path),
-				zap.Duration("timeout", timeout),
-			)
-			if !c.Writer.Written() {
-				c.JSON(http.StatusGatewayTimeout, gin.H{
-					"error":   "Gateway Timeout",
-					"message": "Backend service did not respond in time",
-				})
-			}
-		}
+		p.serveService(c, svc)
 	}
 }
 
 // ProxyToServiceWithPath returns a handler that proxies requests with path rewriting
 func (p *ProxyHandler) ProxyToServiceWithPath(serviceName, targetPath string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		proxy, exists := p.proxies[serviceName]
+		svc, exists := p.service(serviceName)
 		if !exists {
 			p.logger.Error("Proxy not found for service", zap.String("service", serviceName))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Internal Server Error",
-				"message": "Service configuration not found",
-			})
+			middleware.AbortWithError(c, middleware.CodeServiceNotFound, "Service configuration not found")
 			return
 		}
 
@@ -245,33 +630,198 @@ func (p *ProxyHandler) ProxyToServiceWithPath(serviceName, targetPath string) gi
 		// Set new path for backend
 		c.Request.URL.Path = finalPath
 
-		// Set timeout for backend request
-		timeout := p.getServiceTimeout(serviceName)
-
-		// Add timeout handling
-		done := make(chan bool, 1)
-		go func() {
-			proxy.ServeHTTP(c.Writer, c.Request)
-			done <- true
-		}()
-
-		select {
-		case <-done:
-			// Request completed successfully
-		case <-time.After(timeout):
-			p.logger.Error("Backend request timeout",
-				zap.String("service", serviceName),
-				zap.String("path", finalPath),
-				zap.Duration("timeout", timeout),
-			)
-			if !c.Writer.Written() {
-				c.JSON(http.StatusGatewayTimeout, gin.H{
-					"error":   "Gateway Timeout",
-					"message": "Backend service did not respond in time",
-				})
+		p.serveService(c, svc)
+	}
+}
+
+// serveService selects a healthy upstream and proxies the request to it with the service timeout
+func (p *ProxyHandler) serveService(c *gin.Context, svc *serviceProxy) {
+	start := time.Now()
+	var timing *backendTiming
+	c.Set(middleware.ServiceContextKey, svc.name)
+	if threshold := svc.endpoint.SlowRequestThreshold; threshold > 0 {
+		// A route's own threshold takes precedence
+		if _, ok := c.Get(middleware.SlowRequestThresholdContextKey); !ok {
+			c.Set(middleware.SlowRequestThresholdContextKey, threshold)
+		}
+	}
+	// Responses served from the cache count as requests to the service too
+	defer func() {
+		p.metrics.record(svc.name, c.Writer.Status(), time.Since(start))
+		p.backendMetrics.recordServerError(svc.name, c.Writer.Status(), timing)
+		if timing != nil {
+			timing.report(c, svc.name, p.backendMetrics)
+		}
+	}()
+
+	var target *upstream
+	var tenant string
+	if svc.endpoint.TenantRouting.Enabled {
+		tenant = middleware.ResolveTenant(c, svc.endpoint.TenantRouting.Header)
+		if tenant == "" {
+			middleware.AbortWithError(c, middleware.CodeTenantUnresolved, "Tenant could not be resolved for this request")
+			return
+		}
+
+		// Forward the resolved tenant, replacing any client-supplied value
+		header := svc.endpoint.TenantRouting.Header
+		if header == "" {
+			header = middleware.TenantHeader
+		}
+		c.Set(middleware.TenantContextKey, tenant)
+		c.Request.Header.Set(header, tenant)
+
+		target = svc.tenantUpstreams[tenant]
+	}
+	// Tenants are served by their own upstreams, so they don't share cached responses
+	if serveCached(c, svc.cache, cacheKey(svc.name, c.Request, tenant)) {
+		return
+	}
+
+	if target == nil {
+		// Path targets without a healthy instance fall back to the default pool
+		if targetPool := matchPathTarget(svc.pathTargets, c.Request.URL.Path); targetPool != nil {
+			target = targetPool.next()
+		}
+	}
+	if target == nil && svc.canary != nil {
+		// An unhealthy canary sends its share back to the stable pool
+		track := trackStable
+		if svc.canary.selects(c, svc.name) {
+			if target = svc.canary.pool.next(); target != nil {
+				track = trackCanary
 			}
 		}
+		c.Header(releaseTrackHeader, track)
+	}
+	if target == nil && svc.sticky != nil {
+		target = svc.sticky.pinned(c.Request, svc.pool)
+	}
+	if target == nil {
+		// Pin the client to the selected upstream, or move it off one that is down
+		if target = svc.pool.next(); target != nil && svc.sticky != nil {
+			svc.sticky.pin(c.Writer, c.Request, target)
+		}
+	}
+	if svc.sticky != nil {
+		svc.sticky.strip(c.Request)
+	}
+	if target == nil {
+		p.logger.Warn("No healthy upstream available",
+			zap.String("service", svc.name),
+			zap.String("path", c.Request.URL.Path),
+		)
+		if svc.fallback != nil {
+			svc.fallback.write(c.Writer, c.Request)
+			return
+		}
+		middleware.AbortWithError(c, middleware.CodeNoHealthyUpstream, "No healthy backend instance available")
+		return
+	}
+	c.Request = withUpstream(c.Request, target)
+
+	// Upgraded connections are tunneled by the reverse proxy until either side closes;
+	// the backend response timeout does not apply to them
+	if middleware.IsUpgradeRequest(c.Request) {
+		svc.proxy.ServeHTTP(p.tunnels.track(c.Writer), c.Request)
+		return
+	}
+	c.Request, timing = withBackendTiming(c.Request)
+	if svc.endpoint.Redirect.RewriteLocation {
+		c.Request = p.withRedirectOrigin(c.Request)
+	}
+
+	// Cap the requests in flight to the service. The slot is released when the handler
+	// returns, including after a timeout or a panic.
+	if svc.bulkhead != nil {
+		release, ok := svc.bulkhead.acquire(c.Request.Context())
+		if !ok {
+			p.logger.Warn("Service concurrency limit reached",
+				zap.String("service", svc.name),
+				zap.String("path", c.Request.URL.Path),
+			)
+			middleware.AbortWithError(c, middleware.CodeConcurrencyLimited, "Too many concurrent requests to this service")
+			return
+		}
+		defer release()
+	}
+
+	// Set timeout for backend request, or the override of a trusted caller, bounded by
+	// what is left of the request budget. Zero means the response may take as long as it needs.
+	timeout := svc.overallTimeout()
+	if override, ok := timeoutOverride(c, p.config.TimeoutOverride); ok {
+		timeout = override
+		c.Request = withTimeoutOverride(c.Request, override)
+		if writeTimeout := p.config.Server.WriteTimeout; writeTimeout > 0 && override+writeDeadlineSlack > writeTimeout {
+			extendWriteDeadline(c.Writer, override)
+		}
 	}
+	budgetBound := false
+	if deadline, ok := c.Request.Context().Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			middleware.AbortBudgetExceeded(c)
+			return
+		}
+		if timeout == 0 || remaining < timeout {
+			timeout = remaining
+			budgetBound = true
+		}
+	}
+	proxyWithTimeout(c, svc.proxy, timeout, func() {
+		p.logger.Error("Backend request timeout",
+			zap.String("service", svc.name),
+			zap.String("path", c.Request.URL.Path),
+			zap.Duration("timeout", timeout),
+		)
+		if budgetBound && !c.Writer.Written() {
+			middleware.AbortBudgetExceeded(c)
+		} else if !c.Writer.Written() {
+			middleware.AbortWithError(c, middleware.CodeUpstreamTimeout, "Backend service did not respond in time")
+		}
+	})
+}
+
+// proxyWithTimeout serves the request through proxy in its own goroutine, so that the
+// timeout (zero for none) can fire while it waits on the backend. On expiry the backend
+// request is cancelled and the proxy waited for before onTimeout runs, so the response
+// is only ever written by one goroutine at a time. Panics, such as http.ErrAbortHandler
+// when a response breaks off mid-stream, are re-raised in the handler goroutine where
+// the server recovers them; left in the proxy goroutine they would crash the process.
+func proxyWithTimeout(c *gin.Context, proxy http.Handler, timeout time.Duration, onTimeout func()) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	ctx, cancel := context.WithCancelCause(c.Request.Context())
+	defer cancel(nil)
+	req := c.Request.WithContext(ctx)
+
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() { done <- recover() }()
+		proxy.ServeHTTP(c.Writer, req)
+	}()
+
+	var recovered interface{}
+	select {
+	case recovered = <-done:
+	case <-expired:
+		cancel(errBackendTimeout)
+		recovered = <-done
+		onTimeout()
+	}
+	if recovered != nil {
+		panic(recovered)
+	}
+}
+
+// backendTimedOut reports whether the request was cancelled by proxyWithTimeout, which
+// then answers the client itself
+func backendTimedOut(r *http.Request) bool {
+	return errors.Is(context.Cause(r.Context()), errBackendTimeout)
 }
 
 // replacePathParams replaces path parameters (e.g., :id) with actual values from context
@@ -283,32 +833,62 @@ func (p *ProxyHandler) replacePathParams(path string, c *gin.Context) string {
 	return path
 }
 
-// getServiceTimeout returns the configured timeout for a service
-func (p *ProxyHandler) getServiceTimeout(serviceName string) time.Duration {
-	if svc, ok := p.config.Services[serviceName]; ok && svc.Timeout > 0 {
-		return svc.Timeout
+// timeout returns the configured timeout for the service
+func (s *serviceProxy) timeout() time.Duration {
+	if timeout := time.Duration(s.timeoutNanos.Load()); timeout > 0 {
+		return timeout
 	}
 	return 30 * time.Second
 }
 
+// overallTimeout returns the timeout for a proxied request as a whole. Services with a
+// connect or response header timeout have no overall limit unless timeout is set, so
+// that long streaming responses run to completion.
+func (s *serviceProxy) overallTimeout() time.Duration {
+	if s.timeoutNanos.Load() == 0 && (s.endpoint.ConnectTimeout > 0 || s.endpoint.ResponseHeaderTimeout > 0) {
+		return 0
+	}
+	return s.timeout()
+}
+
 // getExternalServiceTimeout returns the configured timeout for an external service
 func (p *ProxyHandler) getExternalServiceTimeout(serviceName string) time.Duration {
-	if svc, ok := p.config.ExternalServices[serviceName]; ok && svc.Timeout > 0 {
-		return svc.Timeout
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if timeout := p.externalTimeout[serviceName]; timeout > 0 {
+		return timeout
 	}
 	return 30 * time.Second
 }
 
+// UpdateTimeouts applies reloaded timeouts to configured backend and external services.
+// Requests already in flight keep the timeout they started with.
+func (p *ProxyHandler) UpdateTimeouts(cfg *config.Config) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for name, endpoint := range cfg.Services {
+		if _, static := p.config.Services[name]; !static {
+			continue
+		}
+		if svc, ok := p.services[name]; ok {
+			svc.timeoutNanos.Store(int64(endpoint.Timeout))
+		}
+	}
+	for name, endpoint := range cfg.ExternalServices {
+		if _, ok := p.externalProxies[name]; ok {
+			p.externalTimeout[name] = endpoint.Timeout
+		}
+	}
+}
+
 // ProxyToExternalService returns a handler that proxies requests to an external service
 func (p *ProxyHandler) ProxyToExternalService(serviceName string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		proxy, exists := p.externalProxies[serviceName]
 		if !exists {
 			p.logger.Error("External proxy not found for service", zap.String("service", serviceName))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Internal Server Error",
-				"message": "External service configuration not found",
-			})
+			middleware.AbortWithError(c, middleware.CodeServiceNotFound, "External service configuration not found")
 			return
 		}
 
@@ -324,31 +904,29 @@ func (p *ProxyHandler) ProxyToExternalService(serviceName string) gin.HandlerFun
 			c.Request.URL.Path = path
 		}
 
+		if serveCached(c, p.externalCaches[serviceName], cacheKey(serviceName, c.Request, "")) {
+			return
+		}
+
+		// Upgraded connections are tunneled until either side closes
+		if middleware.IsUpgradeRequest(c.Request) {
+			proxy.ServeHTTP(p.tunnels.track(c.Writer), c.Request)
+			return
+		}
+
 		// Set timeout for external request
 		timeout := p.getExternalServiceTimeout(serviceName)
 
-		// Add timeout handling
-		done := make(chan bool, 1)
-		go func() {
-			proxy.ServeHTTP(c.Writer, c.Request)
-			done <- true
-		}()
-
-		select {
-		case <-done:
-			// Request completed successfully
-		case <-time.After(timeout):
+		// Add timeout handling, re-raising proxy panics in the handler goroutine
+		proxyWithTimeout(c, proxy, timeout, func() {
 			p.logger.Error("External service request timeout",
 				zap.String("service", serviceName),
 				zap.Duration("timeout", timeout),
 			)
 			if !c.Writer.Written() {
-				c.JSON(http.StatusGatewayTimeout, gin.H{
-					"error":   "Gateway Timeout",
-					"message": "External service did not respond in time",
-				})
+				middleware.AbortWithError(c, middleware.CodeUpstreamTimeout, "External service did not respond in time")
 			}
-		}
+		})
 	}
 }
 
@@ -358,10 +936,7 @@ func (p *ProxyHandler) ProxyToExternalServiceWithPath(serviceName, targetPath st
 		proxy, exists := p.externalProxies[serviceName]
 		if !exists {
 			p.logger.Error("External proxy not found for service", zap.String("service", serviceName))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Internal Server Error",
-				"message": "External service configuration not found",
-			})
+			middleware.AbortWithError(c, middleware.CodeServiceNotFound, "External service configuration not found")
 			return
 		}
 
@@ -379,32 +954,30 @@ func (p *ProxyHandler) ProxyToExternalServiceWithPath(serviceName, targetPath st
 		// Set new path for backend
 		c.Request.URL.Path = finalPath
 
+		if serveCached(c, p.externalCaches[serviceName], cacheKey(serviceName, c.Request, "")) {
+			return
+		}
+
+		// Upgraded connections are tunneled until either side closes
+		if middleware.IsUpgradeRequest(c.Request) {
+			proxy.ServeHTTP(p.tunnels.track(c.Writer), c.Request)
+			return
+		}
+
 		// Set timeout for external request
 		timeout := p.getExternalServiceTimeout(serviceName)
 
-		// Add timeout handling
-		done := make(chan bool, 1)
-		go func() {
-			proxy.ServeHTTP(c.Writer, c.Request)
-			done <- true
-		}()
-
-		select {
-		case <-done:
-			// Request completed successfully
-		case <-time.After(timeout):
+		// Add timeout handling, re-raising proxy panics in the handler goroutine
+		proxyWithTimeout(c, proxy, timeout, func() {
 			p.logger.Error("External service request timeout",
 				zap.String("service", serviceName),
 				zap.String("path", finalPath),
 				zap.Duration("timeout", timeout),
 			)
 			if !c.Writer.Written() {
-				c.JSON(http.StatusGatewayTimeout, gin.H{
-					"error":   "Gateway Timeout",
-					"message": "External service did not respond in time",
-				})
+				middleware.AbortWithError(c, middleware.CodeUpstreamTimeout, "External service did not respond in time")
 			}
-		}
+		})
 	}
 }
 
@@ -415,19 +988,22 @@ func (p *ProxyHandler) ProxyWithWebSocket(serviceName string) gin.HandlerFunc {
 		proxy, exists := p.externalProxies[serviceName]
 		if !exists {
 			p.logger.Error("External proxy not found for service", zap.String("service", serviceName))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Internal Server Error",
-				"message": "External service configuration not found",
-			})
+			middleware.AbortWithError(c, middleware.CodeServiceNotFound, "External service configuration not found")
 			return
 		}
 
-		// Check if this is a WebSocket upgrade request
+		// Log protocol upgrades; the reverse proxy tunnels any Upgrade protocol
 		if isWebSocketUpgrade(c.Request) {
 			p.logger.Info("WebSocket upgrade request",
 				zap.String("service", serviceName),
 				zap.String("path", c.Request.URL.Path),
 			)
+		} else if middleware.IsUpgradeRequest(c.Request) {
+			p.logger.Info("Protocol upgrade request",
+				zap.String("service", serviceName),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("upgrade", c.Request.Header.Get("Upgrade")),
+			)
 		}
 
 		// Preserve the original path for frontend routing
@@ -437,33 +1013,30 @@ func (p *ProxyHandler) ProxyWithWebSocket(serviceName string) gin.HandlerFunc {
 			zap.String("path", c.Request.URL.Path),
 		)
 
+		if middleware.IsUpgradeRequest(c.Request) {
+			proxy.ServeHTTP(p.tunnels.track(c.Writer), c.Request)
+			return
+		}
+		if serveCached(c, p.externalCaches[serviceName], cacheKey(serviceName, c.Request, "")) {
+			return
+		}
 		proxy.ServeHTTP(c.Writer, c.Request)
 	}
 }
 
 // isWebSocketUpgrade checks if the request is a WebSocket upgrade
 func isWebSocketUpgrade(req *http.Request) bool {
-	connection := req.Header.Get("Connection")
-	upgrade := req.Header.Get("Upgrade")
-	return strings.ToLower(connection) == "upgrade" && strings.ToLower(upgrade) == "websocket"
+	return middleware.IsUpgradeRequest(req) && httpguts.HeaderValuesContainsToken(req.Header["Upgrade"], "websocket")
 }
 
 // NotFound handles 404 errors
 func NotFound(c *gin.Context) {
-	c.JSON(http.StatusNotFound, gin.H{
-		"error":   "Not Found",
-		"message": "The requested endpoint does not exist",
-		"path":    c.Request.URL.Path,
-	})
+	middleware.AbortWithError(c, middleware.CodeNotFound, "The requested endpoint does not exist")
 }
 
 // MethodNotAllowed handles 405 errors
 func MethodNotAllowed(c *gin.Context) {
-	c.JSON(http.StatusMethodNotAllowed, gin.H{
-		"error":   "Method Not Allowed",
-		"message": fmt.Sprintf("Method %s is not allowed for this endpoint", c.Request.Method),
-		"path":    c.Request.URL.Path,
-	})
+	middleware.AbortWithError(c, middleware.CodeMethodNotAllowed, fmt.Sprintf("Method %s is not allowed for this endpoint", c.Request.Method))
 }
 
 // logRequestBody logs the request body for debugging (use carefully in production)
@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// newHeaderEchoBackend returns a backend that responds with the request headers it received
+func newHeaderEchoBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers := make(map[string]string, len(r.Header)+1)
+		for name := range r.Header {
+			headers[name] = r.Header.Get(name)
+		}
+		headers["Host"] = r.Host
+		json.NewEncoder(w).Encode(headers)
+	}))
+}
+
+// newStaticBackend returns a backend that responds with body, its content type and ETag "v1"
+func newStaticBackend(t *testing.T, contentType, body string) *httptest.Server {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// newEchoBackend returns a backend that responds with its name and the request body,
+// as "name:body"
+func newEchoBackend(t *testing.T, name string) *httptest.Server {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, name+":"+string(body))
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// newServiceRouter routes /svc/*path to a single backend service behind the proxy
+func newServiceRouter(t *testing.T, cfg *config.Config, serviceName string) (*gin.Engine, *ProxyHandler) {
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	t.Cleanup(proxy.Close)
+
+	router := gin.New()
+	router.Any("/svc/*path", proxy.ProxyToService(serviceName))
+	return router, proxy
+}
+
+// setupServiceGateway serves a single backend service behind the proxy at /svc/*path
+func setupServiceGateway(t *testing.T, cfg *config.Config, serviceName string) (*httptest.Server, *ProxyHandler) {
+	router, proxy := newServiceRouter(t, cfg, serviceName)
+	gateway := httptest.NewServer(router)
+	t.Cleanup(gateway.Close)
+	return gateway, proxy
+}
+
+// gatewayResponse is a response received through the gateway
+type gatewayResponse struct {
+	Code   int
+	Header http.Header
+	Body   string
+}
+
+// sendRequest sends a request with the given header name and value pairs, skipping empty
+// values, and reads the response. A failed request is reported with t.Errorf, so it may be
+// sent from another goroutine, and returns a zero response.
+func sendRequest(t *testing.T, method, url, body string, headers ...string) gatewayResponse {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		if headers[i+1] != "" {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("request failed: %v", err)
+		return gatewayResponse{}
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return gatewayResponse{Code: resp.StatusCode, Header: resp.Header, Body: string(respBody)}
+}
+
+// gatewayGet sends a GET for path through the gateway and returns the status and body
+func gatewayGet(t *testing.T, gateway *httptest.Server, path string) (int, string) {
+	resp := sendRequest(t, "GET", gateway.URL+path, "")
+	return resp.Code, resp.Body
+}
+
+// gatewayHeaders sends a request through the gateway and decodes the echoed backend headers
+func gatewayHeaders(t *testing.T, gateway *httptest.Server, path string, headers map[string]string) map[string]string {
+	req, _ := http.NewRequest("GET", gateway.URL+path, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var echoed map[string]string
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&echoed))
+	return echoed
+}
+
+func TestForwardedForFromUntrustedPeer(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL}},
+	}, "backend")
+
+	echoed := gatewayHeaders(t, gateway, "/svc/", map[string]string{
+		"X-Forwarded-For": "1.2.3.4",
+		"X-Real-IP":       "1.2.3.4",
+	})
+	assert.Equal(t, "127.0.0.1", echoed["X-Forwarded-For"])
+	assert.Equal(t, "127.0.0.1", echoed["X-Real-Ip"])
+}
+
+func TestForwardedForChainFromTrustedPeer(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		TrustedProxies: []string{"127.0.0.1"},
+		Services:       map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL}},
+	}, "backend")
+
+	echoed := gatewayHeaders(t, gateway, "/svc/", map[string]string{
+		"X-Forwarded-For": "198.51.100.7",
+		"X-Real-IP":       "1.2.3.4",
+	})
+	assert.Equal(t, "198.51.100.7, 127.0.0.1", echoed["X-Forwarded-For"])
+	assert.Equal(t, "198.51.100.7", echoed["X-Real-Ip"])
+
+	// X-Real-IP is the leftmost untrusted hop of a longer chain
+	echoed = gatewayHeaders(t, gateway, "/svc/", map[string]string{
+		"X-Forwarded-For": "203.0.113.9, 198.51.100.7, 127.0.0.1",
+	})
+	assert.Equal(t, "203.0.113.9, 198.51.100.7, 127.0.0.1, 127.0.0.1", echoed["X-Forwarded-For"])
+	assert.Equal(t, "203.0.113.9", echoed["X-Real-Ip"])
+}
+
+func TestHostHeaderOverride(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"backend": {BaseURL: backend.URL, HostHeader: "tenant-a.internal.example"},
+		},
+	}, "backend")
+
+	req, _ := http.NewRequest("GET", gateway.URL+"/svc/", nil)
+	req.Host = "api.example.com"
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	var echoed map[string]string
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&echoed))
+	assert.Equal(t, "tenant-a.internal.example", echoed["Host"])
+	assert.Equal(t, "api.example.com", echoed["X-Forwarded-Host"])
+	assert.Equal(t, strings.TrimPrefix(backend.URL, "http://"), echoed["X-Origin-Host"])
+}
+
+func TestHostHeaderDefaultsToTarget(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL}},
+	}, "backend")
+
+	echoed := gatewayHeaders(t, gateway, "/svc/", nil)
+	assert.Equal(t, strings.TrimPrefix(backend.URL, "http://"), echoed["Host"])
+	assert.Equal(t, strings.TrimPrefix(gateway.URL, "http://"), echoed["X-Forwarded-Host"])
+}
+
+func TestHasResponseBody(t *testing.T) {
+	get, _ := http.NewRequest(http.MethodGet, "/", nil)
+	head, _ := http.NewRequest(http.MethodHead, "/", nil)
+
+	tests := []struct {
+		name string
+		resp *http.Response
+		want bool
+	}{
+		{"no content", &http.Response{StatusCode: http.StatusNoContent, ContentLength: -1, Request: get}, false},
+		{"not modified", &http.Response{StatusCode: http.StatusNotModified, ContentLength: -1, Request: get}, false},
+		{"empty", &http.Response{StatusCode: http.StatusOK, ContentLength: 0, Request: get}, false},
+		{"head", &http.Response{StatusCode: http.StatusOK, ContentLength: 42, Request: head}, false},
+		{"chunked", &http.Response{StatusCode: http.StatusOK, ContentLength: -1, Request: get}, true},
+		{"sized", &http.Response{StatusCode: http.StatusOK, ContentLength: 42, Request: get}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hasResponseBody(tt.resp))
+		})
+	}
+}
+
+func TestRequestBudgetBoundsBackendCall(t *testing.T) {
+	cancelled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+			close(cancelled)
+		}
+	}))
+	defer backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{
+		Services: map[string]config.ServiceEndpoint{"slow": {BaseURL: backend.URL, Timeout: 5 * time.Second}},
+	}, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.Use(middleware.RequestDeadline(150 * time.Millisecond))
+	router.Use(func(c *gin.Context) {
+		// Earlier middleware spends part of the budget
+		time.Sleep(50 * time.Millisecond)
+		c.Next()
+	})
+	router.Any("/svc/*path", proxy.ProxyToService("slow"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	start := time.Now()
+	status, body := gatewayGet(t, gateway, "/svc/")
+
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Contains(t, body, "Request time budget exceeded")
+	assert.Less(t, time.Since(start), time.Second)
+
+	// The backend call is abandoned rather than left writing to the finished response,
+	// so the client gets a single error body
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("backend request was not cancelled")
+	}
+	var envelope map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &envelope))
+}
+
+// newUpgradeEchoBackend switches any request asking for the "echo-tcp" protocol to a
+// raw byte echo over the hijacked connection
+func newUpgradeEchoBackend(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo-tcp" {
+			w.WriteHeader(http.StatusUpgradeRequired)
+			return
+		}
+
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo-tcp\r\n\r\n")
+		buf.Flush()
+		io.Copy(conn, buf)
+	}))
+}
+
+func TestGenericUpgradeTunnel(t *testing.T) {
+	backend := newUpgradeEchoBackend(t)
+	defer backend.Close()
+
+	// A service timeout shorter than the session must not cut the tunnel
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"echo": {BaseURL: backend.URL, Timeout: 50 * time.Millisecond}},
+	}, "echo")
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(gateway.URL, "http://"))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET /svc/tunnel HTTP/1.1\r\nHost: gateway\r\nConnection: keep-alive, Upgrade\r\nUpgrade: echo-tcp\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("reading upgrade response failed: %v", err)
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "echo-tcp", resp.Header.Get("Upgrade"))
+
+	time.Sleep(100 * time.Millisecond)
+	for _, message := range []string{"ping", "raw bytes \x00\x01"} {
+		_, err = conn.Write([]byte(message))
+		assert.NoError(t, err)
+
+		echoed := make([]byte, len(message))
+		_, err = io.ReadFull(reader, echoed)
+		assert.NoError(t, err)
+		assert.Equal(t, message, string(echoed))
+	}
+}
+
+func TestIsUpgradeRequest(t *testing.T) {
+	tests := []struct {
+		connection, upgrade string
+		upgradeReq, ws      bool
+	}{
+		{"Upgrade", "websocket", true, true},
+		{"keep-alive, Upgrade", "WebSocket", true, true},
+		{"upgrade", "h2c", true, false},
+		{"keep-alive", "websocket", false, false},
+		{"Upgrade", "", false, false},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Connection", tt.connection)
+		req.Header.Set("Upgrade", tt.upgrade)
+		assert.Equal(t, tt.upgradeReq, middleware.IsUpgradeRequest(req), "%s / %s", tt.connection, tt.upgrade)
+		assert.Equal(t, tt.ws, isWebSocketUpgrade(req), "%s / %s", tt.connection, tt.upgrade)
+	}
+}
+
+func TestErrorHandlerEscapesErrorText(t *testing.T) {
+	proxy := NewProxyHandler(&config.Config{}, zap.NewNop())
+	defer proxy.Close()
+
+	adversarial := errors.New("dial \"backend\": refused\n{\"injected\":true}\\ \x00 </script>")
+	w := httptest.NewRecorder()
+	proxy.errorHandler(w, httptest.NewRequest("GET", "/", nil), adversarial)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.True(t, json.Valid(w.Body.Bytes()), w.Body.String())
+
+	var body middleware.APIError
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "Bad Gateway", body.Error)
+	assert.Equal(t, "Failed to reach backend service: "+adversarial.Error(), body.Message)
+}
+
+func TestProxyErrorCodes(t *testing.T) {
+	backend, release := newBlockingBackend(t)
+	defer close(release)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"slow":  {BaseURL: backend.URL, Timeout: 50 * time.Millisecond},
+			"down":  {BaseURL: unreachable.URL},
+			"unset": {BaseURL: backend.URL, TenantRouting: config.TenantRoutingConfig{Enabled: true}},
+		},
+	}, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.Use(middleware.RequestID(&config.Config{}))
+	for _, name := range []string{"slow", "down", "unset", "missing"} {
+		router.Any("/"+name+"/*path", proxy.ProxyToService(name))
+	}
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantCode   middleware.ErrorCode
+	}{
+		{"/slow/", http.StatusGatewayTimeout, middleware.CodeUpstreamTimeout},
+		{"/down/", http.StatusBadGateway, middleware.CodeUpstreamUnreachable},
+		{"/unset/", http.StatusBadRequest, middleware.CodeTenantUnresolved},
+		{"/missing/", http.StatusInternalServerError, middleware.CodeServiceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", gateway.URL+tt.path, nil)
+			req.Header.Set(middleware.RequestIDHeader, "req-42")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			var body middleware.APIError
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, tt.wantCode, body.Code)
+			assert.Equal(t, "req-42", body.RequestID)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const defaultAdminListLimit = 500
+
+// BucketLister lists active rate limit buckets and resets them
+type BucketLister interface {
+	Store() string
+	Buckets(ctx context.Context, cursor string, limit int) ([]middleware.BucketInfo, string, error)
+	Reset(ctx context.Context, clientID string) (bool, error)
+}
+
+// RateLimitHandler exposes rate limiter state to administrators
+type RateLimitHandler struct {
+	limiter  BucketLister
+	maxLimit int
+	logger   *zap.Logger
+}
+
+// NewRateLimitHandler creates a new rate limit admin handler
+func NewRateLimitHandler(limiter BucketLister, cfg *config.Config, logger *zap.Logger) *RateLimitHandler {
+	maxLimit := cfg.RateLimit.AdminListLimit
+	if maxLimit <= 0 {
+		maxLimit = defaultAdminListLimit
+	}
+	return &RateLimitHandler{
+		limiter:  limiter,
+		maxLimit: maxLimit,
+		logger:   logger,
+	}
+}
+
+// ListBuckets returns a page of active rate limit buckets. Query parameters:
+// limit (capped at the configured maximum) and cursor (from a previous page's next_cursor).
+func (h *RateLimitHandler) ListBuckets(c *gin.Context) {
+	limit := h.maxLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "limit must be a positive integer",
+			})
+			return
+		}
+		if parsed < limit {
+			limit = parsed
+		}
+	}
+
+	buckets, next, err := h.limiter.Buckets(c.Request.Context(), c.Query("cursor"), limit)
+	if err != nil {
+		h.logger.Error("Failed to list rate limit buckets", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal Server Error",
+			"message": "Failed to list rate limit buckets",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"store":       h.limiter.Store(),
+		"buckets":     buckets,
+		"count":       len(buckets),
+		"next_cursor": next,
+	})
+}
+
+// ResetClient flushes the rate limit state of a client, e.g. user:42 or ip:10.0.0.1, as
+// listed by ListBuckets, so a throttled client is allowed again at once
+func (h *RateLimitHandler) ResetClient(c *gin.Context) {
+	clientID := c.Param("clientID")
+	found, err := h.limiter.Reset(c.Request.Context(), clientID)
+	if err != nil {
+		h.logger.Error("Failed to reset rate limit bucket", zap.String("client", clientID), zap.Error(err))
+		middleware.RecordAudit(c, middleware.AuditEvent{Type: middleware.AuditRateLimitFlush, Outcome: middleware.AuditOutcomeFailure, Target: clientID})
+		middleware.AbortWithError(c, middleware.CodeInternal, "Failed to reset the rate limit bucket")
+		return
+	}
+
+	middleware.RecordAudit(c, middleware.AuditEvent{Type: middleware.AuditRateLimitFlush, Outcome: middleware.AuditOutcomeSuccess, Target: clientID})
+	fields := []zap.Field{zap.String("client", clientID), zap.Bool("found", found)}
+	if claims, ok := middleware.GetUserFromContext(c); ok {
+		fields = append(fields, zap.String("user_id", claims.UserID))
+	}
+	h.logger.Warn("Rate limit bucket reset", fields...)
+	c.JSON(http.StatusOK, gin.H{
+		"client": clientID,
+		"found":  found,
+		"store":  h.limiter.Store(),
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type bucketListing struct {
+	Store      string                  `json:"store"`
+	Buckets    []middleware.BucketInfo `json:"buckets"`
+	Count      int                     `json:"count"`
+	NextCursor string                  `json:"next_cursor"`
+}
+
+func TestListRateLimitBuckets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{RateLimit: config.RateLimitConfig{
+		Enabled:         true,
+		RequestsPerMin:  10,
+		BurstSize:       10,
+		CleanupInterval: time.Minute,
+		AdminListLimit:  2,
+	}}
+	limiter, err := middleware.NewRateLimiter(cfg)
+	assert.NoError(t, err)
+	defer limiter.Close()
+
+	router := gin.New()
+	router.Use(limiter.Middleware())
+	router.GET("/work", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/admin/ratelimit", NewRateLimitHandler(limiter, cfg, zap.NewNop()).ListBuckets)
+
+	// Three clients with different usage
+	for client, requests := range map[string]int{"10.0.0.1": 3, "10.0.0.2": 1, "10.0.0.3": 5} {
+		for i := 0; i < requests; i++ {
+			req, _ := http.NewRequest("GET", "/work", nil)
+			req.RemoteAddr = client + ":1234"
+			router.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+
+	list := func(query string) bucketListing {
+		req, _ := http.NewRequest("GET", "/admin/ratelimit"+query, nil)
+		req.RemoteAddr = "10.0.0.9:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var listing bucketListing
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &listing))
+		return listing
+	}
+
+	// Results are capped at the configured limit and paginated
+	first := list("?limit=100")
+	assert.Equal(t, "local", first.Store)
+	assert.Equal(t, 2, first.Count)
+	assert.NotEmpty(t, first.NextCursor)
+
+	second := list("?cursor=" + first.NextCursor)
+	assert.Empty(t, second.NextCursor)
+
+	remaining := make(map[string]int)
+	for _, bucket := range append(first.Buckets, second.Buckets...) {
+		remaining[bucket.Client] = bucket.Remaining
+		assert.True(t, bucket.Reset.After(time.Now()))
+	}
+	assert.Equal(t, 7, remaining["ip:10.0.0.1"])
+	assert.Equal(t, 9, remaining["ip:10.0.0.2"])
+	assert.Equal(t, 5, remaining["ip:10.0.0.3"])
+
+	req, _ := http.NewRequest("GET", "/admin/ratelimit?limit=abc", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestResetRateLimitClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{RateLimit: config.RateLimitConfig{
+		Enabled:         true,
+		RequestsPerMin:  2,
+		BurstSize:       2,
+		CleanupInterval: time.Minute,
+	}}
+	limiter, err := middleware.NewRateLimiter(cfg)
+	assert.NoError(t, err)
+	defer limiter.Close()
+
+	router := gin.New()
+	router.DELETE("/admin/ratelimit/:clientID", NewRateLimitHandler(limiter, cfg, zap.NewNop()).ResetClient)
+	work := router.Group("/", limiter.Middleware())
+	work.GET("/work", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("GET", "/work").Code)
+	assert.Equal(t, http.StatusOK, request("GET", "/work").Code)
+	assert.Equal(t, http.StatusTooManyRequests, request("GET", "/work").Code)
+
+	// The flushed client is allowed again at once
+	w := request("DELETE", "/admin/ratelimit/ip:10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"client":"ip:10.0.0.1","found":true,"store":"local"}`, w.Body.String())
+	assert.Equal(t, http.StatusOK, request("GET", "/work").Code)
+
+	w = request("DELETE", "/admin/ratelimit/ip:10.0.0.2")
+	assert.JSONEq(t, `{"client":"ip:10.0.0.2","found":false,"store":"local"}`, w.Body.String())
+}
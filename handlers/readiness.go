@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/api-gateway/config"
+)
+
+const (
+	defaultReadinessCacheTTL = 2 * time.Second
+	defaultReadinessTimeout  = 2 * time.Second
+)
+
+// ReadinessCheck reports whether a dependency is reachable
+type ReadinessCheck func(ctx context.Context) error
+
+// DependencyStatus is a dependency's entry in the readiness report
+type DependencyStatus struct {
+	Status   string `json:"status"` // "up" or "down"
+	Required bool   `json:"required"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ServiceState is a backend service's entry in the readiness report, derived from the
+// tracked health of its upstreams
+type ServiceState struct {
+	Status           string `json:"status"` // "up", "degraded" (some upstreams down) or "down"
+	Critical         bool   `json:"critical"`
+	HealthyUpstreams int    `json:"healthy_upstreams"`
+	Upstreams        int    `json:"upstreams"`
+}
+
+// readinessCheck is a registered dependency check
+type readinessCheck struct {
+	name     string
+	required bool
+	check    ReadinessCheck
+}
+
+// readinessReport is the outcome of running every check
+type readinessReport struct {
+	ready     bool
+	checks    map[string]DependencyStatus
+	checkedAt time.Time
+}
+
+// readiness runs dependency checks for the readiness probe, caching the outcome briefly
+// so frequent probes don't hammer the dependencies
+type readiness struct {
+	cacheTTL time.Duration
+	timeout  time.Duration
+	checks   []readinessCheck
+	critical map[string]bool
+	mu       sync.Mutex
+	last     *readinessReport
+}
+
+// ConfigureReadiness applies the readiness cache and timeout settings
+func (h *HealthHandler) ConfigureReadiness(cfg config.ReadinessConfig) {
+	h.readiness.mu.Lock()
+	defer h.readiness.mu.Unlock()
+	h.readiness.cacheTTL = cfg.CacheTTL
+	h.readiness.timeout = cfg.Timeout
+	h.readiness.critical = make(map[string]bool, len(cfg.Services))
+	for _, name := range cfg.Services {
+		h.readiness.critical[name] = true
+	}
+	h.readiness.last = nil
+}
+
+// AddReadinessCheck registers a dependency reported by the readiness probe. The gateway
+// is not ready while a required dependency is down.
+func (h *HealthHandler) AddReadinessCheck(name string, required bool, check ReadinessCheck) {
+	h.readiness.mu.Lock()
+	defer h.readiness.mu.Unlock()
+	h.readiness.checks = append(h.readiness.checks, readinessCheck{name: name, required: required, check: check})
+	h.readiness.last = nil
+}
+
+// serviceStates summarizes the upstream health of every service. Only a critical
+// service with every upstream down affects readiness, through its readiness check;
+// anything else down merely degrades the report.
+func (h *HealthHandler) serviceStates() map[string]ServiceState {
+	h.readiness.mu.Lock()
+	critical := h.readiness.critical
+	h.readiness.mu.Unlock()
+
+	upstreams := h.upstreams.UpstreamStatus()
+	states := make(map[string]ServiceState, len(upstreams))
+	for name, statuses := range upstreams {
+		state := ServiceState{Critical: critical[name], Upstreams: len(statuses)}
+		for _, status := range statuses {
+			if status.Healthy {
+				state.HealthyUpstreams++
+			}
+		}
+		switch state.HealthyUpstreams {
+		case state.Upstreams:
+			state.Status = "up"
+		case 0:
+			state.Status = "down"
+		default:
+			state.Status = "degraded"
+		}
+		states[name] = state
+	}
+	return states
+}
+
+// report returns the cached report, or runs the checks when it is stale
+func (r *readiness) report() *readinessReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cacheTTL := r.cacheTTL
+	if cacheTTL <= 0 {
+		cacheTTL = defaultReadinessCacheTTL
+	}
+	if r.last != nil && time.Since(r.last.checkedAt) < cacheTTL {
+		return r.last
+	}
+
+	timeout := r.timeout
+	if timeout <= 0 {
+		timeout = defaultReadinessTimeout
+	}
+	// Checks get their own deadline so one probe giving up doesn't poison the cache
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	results := make([]error, len(r.checks))
+	var wg sync.WaitGroup
+	for i, check := range r.checks {
+		wg.Add(1)
+		go func(i int, check readinessCheck) {
+			defer wg.Done()
+			results[i] = check.check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := &readinessReport{ready: true, checks: make(map[string]DependencyStatus, len(r.checks)), checkedAt: time.Now()}
+	for i, check := range r.checks {
+		status := DependencyStatus{Status: "up", Required: check.required}
+		if err := results[i]; err != nil {
+			status.Status = "down"
+			status.Error = err.Error()
+			if check.required {
+				report.ready = false
+			}
+		}
+		report.checks[check.name] = status
+	}
+
+	r.last = report
+	return report
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// readyResponse requests /health/ready and decodes the body
+func readyResponse(t *testing.T, handler *HealthHandler) (int, map[string]interface{}) {
+	router, _ := setupTestRouter()
+	router.GET("/health/ready", handler.Ready)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health/ready", nil))
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return w.Code, response
+}
+
+// readinessDetails returns the readiness section of /health/detailed
+func readinessDetails(t *testing.T, handler *HealthHandler) map[string]interface{} {
+	return detailedResponse(t, handler)["readiness"].(map[string]interface{})
+}
+
+func checkOK(ctx context.Context) error { return nil }
+
+func checkDown(ctx context.Context) error { return errors.New("connection refused") }
+
+func TestReadyAllDependenciesHealthy(t *testing.T) {
+	_, handler := setupTestRouter()
+	handler.AddReadinessCheck("redis", true, checkOK)
+	handler.AddReadinessCheck("service:users", true, checkOK)
+
+	code, response := readyResponse(t, handler)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", response["status"])
+	assert.Equal(t, map[string]interface{}{
+		"redis":         map[string]interface{}{"status": "up", "required": true},
+		"service:users": map[string]interface{}{"status": "up", "required": true},
+	}, readinessDetails(t, handler)["checks"])
+}
+
+func TestReadyRequiredDependencyDown(t *testing.T) {
+	_, handler := setupTestRouter()
+	handler.AddReadinessCheck("redis", true, checkDown)
+	handler.AddReadinessCheck("service:users", true, checkOK)
+
+	code, response := readyResponse(t, handler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not ready", response["status"])
+	checks := readinessDetails(t, handler)["checks"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"status": "down", "required": true, "error": "connection refused"}, checks["redis"])
+	assert.Equal(t, "up", checks["service:users"].(map[string]interface{})["status"])
+}
+
+func TestReadyOptionalDependencyDown(t *testing.T) {
+	_, handler := setupTestRouter()
+	handler.AddReadinessCheck("redis", false, checkDown)
+
+	code, response := readyResponse(t, handler)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", response["status"])
+	assert.Equal(t, "degraded", response["health"])
+	assert.Equal(t, "down", readinessDetails(t, handler)["checks"].(map[string]interface{})["redis"].(map[string]interface{})["status"])
+}
+
+func TestReadyOmitsDependencyDetails(t *testing.T) {
+	_, handler := setupTestRouter()
+	handler.SetUpstreamReporter(fakeHealthSources{})
+	handler.AddReadinessCheck("redis", true, checkDown)
+
+	code, response := readyResponse(t, handler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.ElementsMatch(t, []string{"status", "health", "timestamp"}, fieldNames(response))
+}
+
+func fieldNames(m map[string]interface{}) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestReadyCachesResults(t *testing.T) {
+	_, handler := setupTestRouter()
+	handler.ConfigureReadiness(config.ReadinessConfig{CacheTTL: time.Hour, Timeout: time.Second})
+	var calls int32
+	handler.AddReadinessCheck("redis", true, func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+
+	readyResponse(t, handler)
+	readyResponse(t, handler)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestReadyCheckTimeout(t *testing.T) {
+	_, handler := setupTestRouter()
+	handler.ConfigureReadiness(config.ReadinessConfig{Timeout: 50 * time.Millisecond})
+	handler.AddReadinessCheck("slow", true, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	code, _ := readyResponse(t, handler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestCheckService(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	proxy := NewProxyHandler(&config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"up":   {BaseURL: backend.URL},
+			"down": {BaseURL: down.URL},
+		},
+	}, zap.NewNop())
+	defer proxy.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, proxy.CheckService(ctx, "up"))
+	assert.Error(t, proxy.CheckService(ctx, "down"))
+	assert.Error(t, proxy.CheckService(ctx, "missing"))
+}
+
+func TestReadyReflectsUpstreamState(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	// Probe once at startup, then leave upstream state to the test
+	healthCheck := config.HealthCheckConfig{
+		Enabled:            true,
+		Path:               "/health",
+		Interval:           time.Hour,
+		Timeout:            time.Second,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	}
+	proxy := NewProxyHandler(&config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"users": {
+				BaseURL:     backend.URL,
+				Upstreams:   []config.UpstreamEndpoint{{URL: backend.URL + "/replica", Weight: 1}},
+				HealthCheck: healthCheck,
+			},
+			"search": {BaseURL: backend.URL, HealthCheck: healthCheck},
+		},
+	}, zap.NewNop())
+	defer proxy.Close()
+	assert.Eventually(t, func() bool {
+		for _, statuses := range proxy.UpstreamStatus() {
+			for _, status := range statuses {
+				if status.LastChecked == "" {
+					return false
+				}
+			}
+		}
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+
+	_, handler := setupTestRouter()
+	handler.SetUpstreamReporter(proxy)
+	handler.ConfigureReadiness(config.ReadinessConfig{Services: []string{"users"}, CacheTTL: time.Nanosecond})
+	handler.AddReadinessCheck("service:users", true, func(ctx context.Context) error {
+		return proxy.CheckService(ctx, "users")
+	})
+	markDown := func(service string, i int) {
+		proxy.services[service].pool.upstreams[i].healthy.Store(false)
+	}
+	serviceState := func(name string) map[string]interface{} {
+		return readinessDetails(t, handler)["services"].(map[string]interface{})[name].(map[string]interface{})
+	}
+
+	code, response := readyResponse(t, handler)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "healthy", response["health"])
+	assert.Equal(t, map[string]interface{}{
+		"status": "up", "critical": true, "healthy_upstreams": float64(2), "upstreams": float64(2),
+	}, serviceState("users"))
+
+	// A non-critical service going down only degrades the report
+	markDown("search", 0)
+	code, response = readyResponse(t, handler)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "degraded", response["health"])
+	assert.Equal(t, "down", serviceState("search")["status"])
+	assert.Equal(t, false, serviceState("search")["critical"])
+
+	// So does a critical service losing some of its upstreams
+	markDown("users", 0)
+	code, response = readyResponse(t, handler)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "degraded", serviceState("users")["status"])
+
+	// The gateway is not ready once every upstream of a critical service is down
+	markDown("users", 1)
+	code, response = readyResponse(t, handler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not ready", response["status"])
+	assert.Equal(t, "down", serviceState("users")["status"])
+}
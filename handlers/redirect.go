@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/api-gateway/middleware"
+)
+
+// redirectOrigin is where the client sent a proxied request: the scheme, host and path
+// it used, before the route stripped or rewrote the path
+type redirectOrigin struct {
+	scheme string
+	host   string
+	path   string
+}
+
+// redirectOriginKey is the context key of a request's redirectOrigin
+type redirectOriginKey struct{}
+
+// withRedirectOrigin returns a copy of r remembering where the client sent it, so
+// backend Location headers can be pointed back at the gateway. X-Forwarded-Proto is
+// only believed from trusted proxies.
+func (p *ProxyHandler) withRedirectOrigin(r *http.Request) *http.Request {
+	origin := redirectOrigin{scheme: "http", host: r.Host, path: r.URL.Path}
+	if r.TLS != nil {
+		origin.scheme = "https"
+	}
+	if proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); (proto == "http" || proto == "https") &&
+		p.trustedProxies.Contains(middleware.ParseRemoteIP(r.RemoteAddr)) {
+		origin.scheme = proto
+	}
+	// Handlers replace the path with the part sent to the backend; the request line
+	// still has what the client asked for
+	if requested, err := url.ParseRequestURI(r.RequestURI); err == nil && requested.Path != "" {
+		origin.path = requested.Path
+	}
+	return r.WithContext(context.WithValue(r.Context(), redirectOriginKey{}, origin))
+}
+
+// rewriteLocation points an absolute Location header addressing the upstream that
+// answered back at the gateway. When the backend path is a suffix of the client's path,
+// the prefix the route stripped is restored; other paths are kept as they are. Locations
+// on other hosts and relative ones are passed through.
+func rewriteLocation(resp *http.Response) {
+	raw := resp.Header.Get("Location")
+	if raw == "" || resp.Request == nil {
+		return
+	}
+	origin, ok := resp.Request.Context().Value(redirectOriginKey{}).(redirectOrigin)
+	if !ok {
+		return
+	}
+	location, err := url.Parse(raw)
+	if err != nil || !location.IsAbs() || !isUpstreamHost(location.Host, resp.Request) {
+		return
+	}
+
+	location.Scheme, location.Host = origin.scheme, origin.host
+	if prefix, ok := strings.CutSuffix(origin.path, resp.Request.URL.Path); ok && prefix != "" {
+		location.Path = strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(location.Path, "/")
+		location.RawPath = ""
+	}
+	resp.Header.Set("Location", location.String())
+}
+
+// isUpstreamHost reports whether host is the upstream a request was sent to, by address
+// or by the Host header it was sent with
+func isUpstreamHost(host string, req *http.Request) bool {
+	return strings.EqualFold(host, req.URL.Host) || (req.Host != "" && strings.EqualFold(host, req.Host))
+}
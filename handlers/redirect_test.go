@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	var backend *httptest.Server
+	backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, backend.URL+"/new?page=2", http.StatusFound)
+		case "/by-host":
+			http.Redirect(w, r, "http://"+r.Host+"/new", http.StatusMovedPermanently)
+		case "/relative":
+			http.Redirect(w, r, "/new", http.StatusFound)
+		case "/external":
+			http.Redirect(w, r, "https://login.example.com/sso", http.StatusFound)
+		case "/new":
+			w.Write([]byte("new content"))
+		}
+	}))
+	defer backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"rewriting": {BaseURL: backend.URL, Redirect: config.RedirectPolicy{RewriteLocation: true}},
+			"virtual": {BaseURL: backend.URL, HostHeader: "users.internal",
+				Redirect: config.RedirectPolicy{RewriteLocation: true}},
+			"following":   {BaseURL: backend.URL, Redirect: config.RedirectPolicy{Follow: 2, RewriteLocation: true}},
+			"passthrough": {BaseURL: backend.URL},
+		},
+	}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	for name := range cfg.Services {
+		router.GET("/"+name+"/*path", proxy.ProxyToService(name))
+	}
+	router.GET("/fixed", proxy.ProxyToServiceWithPath("rewriting", "/old"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	get := func(path string, headers ...string) *http.Response {
+		req, _ := http.NewRequest("GET", gateway.URL+path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := client.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	location := func(path string, headers ...string) string {
+		return get(path, headers...).Header.Get("Location")
+	}
+
+	// Internal locations point at the gateway, under the route's prefix
+	assert.Equal(t, gateway.URL+"/rewriting/new?page=2", location("/rewriting/old"))
+	assert.Equal(t, gateway.URL+"/virtual/new", location("/virtual/by-host"))
+	// The prefix can't be restored when the route replaced the whole path
+	assert.Equal(t, gateway.URL+"/new?page=2", location("/fixed"))
+
+	// Untrusted clients can't choose the scheme
+	assert.Equal(t, gateway.URL+"/rewriting/new?page=2", location("/rewriting/old", "X-Forwarded-Proto", "https"))
+
+	// Relative and foreign locations are passed through
+	assert.Equal(t, "/new", location("/rewriting/relative"))
+	assert.Equal(t, "https://login.example.com/sso", location("/rewriting/external"))
+
+	// Without a policy the internal location leaks
+	assert.True(t, strings.HasPrefix(location("/passthrough/old"), backend.URL))
+
+	// Followed redirects are answered by the gateway
+	resp := get("/following/old")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	status, body := gatewayGet(t, gateway, "/following/by-host")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "new content", body)
+}
+
+func TestRedirectOriginTrustedProxyScheme(t *testing.T) {
+	cfg := &config.Config{TrustedProxies: []string{"10.0.0.0/8"}}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	defer proxy.Close()
+
+	origin := func(remoteAddr string) redirectOrigin {
+		req := httptest.NewRequest("GET", "/users/profile", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.URL.Path = "/profile"
+		return proxy.withRedirectOrigin(req).Context().Value(redirectOriginKey{}).(redirectOrigin)
+	}
+
+	assert.Equal(t, redirectOrigin{scheme: "https", host: "example.com", path: "/users/profile"}, origin("10.1.2.3:1234"))
+	assert.Equal(t, "http", origin("203.0.113.9:1234").scheme)
+}
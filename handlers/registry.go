@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var (
+	errServiceExists   = errors.New("service already registered")
+	errServiceNotFound = errors.New("service not registered")
+	errStaticService   = errors.New("service is defined in configuration")
+)
+
+// serviceNamePattern restricts registered service names to URL-safe identifiers
+var serviceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,62}$`)
+
+// ServiceDefinition describes a backend service registered at runtime
+type ServiceDefinition struct {
+	Name        string                 `json:"name"`
+	BaseURL     string                 `json:"base_url"`
+	Upstreams   []UpstreamDefinition   `json:"upstreams,omitempty"`
+	Timeout     string                 `json:"timeout,omitempty"`
+	HostHeader  string                 `json:"host_header,omitempty"`
+	HealthCheck *HealthCheckDefinition `json:"health_check,omitempty"`
+}
+
+// UpstreamDefinition is an additional instance of a registered service
+type UpstreamDefinition struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+// HealthCheckDefinition enables active health checks for a registered service
+type HealthCheckDefinition struct {
+	Path     string `json:"path,omitempty"`
+	Interval string `json:"interval,omitempty"`
+}
+
+// Endpoint converts the definition into a service endpoint configuration
+func (d ServiceDefinition) Endpoint() (config.ServiceEndpoint, error) {
+	if !serviceNamePattern.MatchString(d.Name) {
+		return config.ServiceEndpoint{}, fmt.Errorf("invalid service name %q", d.Name)
+	}
+	if d.BaseURL == "" && len(d.Upstreams) == 0 {
+		return config.ServiceEndpoint{}, fmt.Errorf("base_url or upstreams is required")
+	}
+
+	endpoint := config.ServiceEndpoint{BaseURL: d.BaseURL, HostHeader: d.HostHeader}
+	for _, u := range d.Upstreams {
+		endpoint.Upstreams = append(endpoint.Upstreams, config.UpstreamEndpoint{URL: u.URL, Weight: u.Weight})
+	}
+
+	if d.Timeout != "" {
+		timeout, err := time.ParseDuration(d.Timeout)
+		if err != nil {
+			return config.ServiceEndpoint{}, fmt.Errorf("invalid timeout: %w", err)
+		}
+		endpoint.Timeout = timeout
+	}
+
+	if d.HealthCheck != nil {
+		endpoint.HealthCheck = config.HealthCheckConfig{Enabled: true, Path: d.HealthCheck.Path}
+		if d.HealthCheck.Interval != "" {
+			interval, err := time.ParseDuration(d.HealthCheck.Interval)
+			if err != nil {
+				return config.ServiceEndpoint{}, fmt.Errorf("invalid health check interval: %w", err)
+			}
+			endpoint.HealthCheck.Interval = interval
+		}
+	}
+
+	return endpoint, nil
+}
+
+// serviceRegistry persists registered services to a JSON file
+type serviceRegistry struct {
+	path string
+}
+
+// load reads the persisted service definitions; a missing file is an empty registry
+func (r *serviceRegistry) load() ([]ServiceDefinition, error) {
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var definitions []ServiceDefinition
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		return nil, fmt.Errorf("invalid service registry file: %w", err)
+	}
+	return definitions, nil
+}
+
+// save atomically replaces the persisted service definitions
+func (r *serviceRegistry) save(definitions []ServiceDefinition) error {
+	data, err := json.MarshalIndent(definitions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// loadRegisteredServices restores persisted services at startup
+func (p *ProxyHandler) loadRegisteredServices() {
+	definitions, err := p.registry.load()
+	if err != nil {
+		p.logger.Error("Failed to load service registry",
+			zap.String("file", p.registry.path),
+			zap.Error(err),
+		)
+		return
+	}
+
+	for _, def := range definitions {
+		if err := p.registerService(def, false); err != nil {
+			p.logger.Error("Failed to restore registered service",
+				zap.String("service", def.Name),
+				zap.Error(err),
+			)
+		}
+	}
+
+	p.logger.Info("Restored registered services", zap.Int("services", len(p.registered)))
+}
+
+// RegisterService adds a service at runtime, or replaces a previously registered one
+// when replace is set. Services defined in configuration cannot be changed.
+func (p *ProxyHandler) RegisterService(def ServiceDefinition, replace bool) error {
+	return p.registerService(def, replace)
+}
+
+// registerService builds the service proxy and swaps it in under the lock. In-flight
+// requests keep using the proxy they started with.
+func (p *ProxyHandler) registerService(def ServiceDefinition, replace bool) error {
+	endpoint, err := def.Endpoint()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, static := p.config.Services[def.Name]; static {
+		return errStaticService
+	}
+	_, exists := p.registered[def.Name]
+	if exists && !replace {
+		return errServiceExists
+	}
+	if !exists && replace {
+		return errServiceNotFound
+	}
+
+	svc, err := p.buildServiceProxy(def.Name, endpoint)
+	if err != nil {
+		return err
+	}
+
+	previous, hadPrevious := p.registered[def.Name]
+	oldProxy := p.services[def.Name]
+	p.services[def.Name] = svc
+	p.registered[def.Name] = def
+
+	if err := p.persistLocked(); err != nil {
+		// Roll back so memory and the registry file stay consistent
+		svc.stop()
+		if hadPrevious {
+			p.services[def.Name] = oldProxy
+			p.registered[def.Name] = previous
+		} else {
+			delete(p.services, def.Name)
+			delete(p.registered, def.Name)
+		}
+		return fmt.Errorf("failed to persist service registry: %w", err)
+	}
+
+	if oldProxy != nil {
+		oldProxy.stop()
+	}
+	return nil
+}
+
+// RemoveService removes a service registered at runtime
+func (p *ProxyHandler) RemoveService(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, static := p.config.Services[name]; static {
+		return errStaticService
+	}
+	def, exists := p.registered[name]
+	if !exists {
+		return errServiceNotFound
+	}
+
+	svc := p.services[name]
+	delete(p.services, name)
+	delete(p.registered, name)
+
+	if err := p.persistLocked(); err != nil {
+		p.services[name] = svc
+		p.registered[name] = def
+		return fmt.Errorf("failed to persist service registry: %w", err)
+	}
+
+	svc.stop()
+	p.metrics.remove(name)
+	p.backendMetrics.remove(name)
+	return nil
+}
+
+// RegisteredServices returns the services registered at runtime, sorted by name
+func (p *ProxyHandler) RegisteredServices() []ServiceDefinition {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.registeredLocked()
+}
+
+func (p *ProxyHandler) registeredLocked() []ServiceDefinition {
+	definitions := make([]ServiceDefinition, 0, len(p.registered))
+	for _, def := range p.registered {
+		definitions = append(definitions, def)
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Name < definitions[j].Name })
+	return definitions
+}
+
+// persistLocked writes the registry file if persistence is configured; the caller must hold p.mu
+func (p *ProxyHandler) persistLocked() error {
+	if p.registry == nil {
+		return nil
+	}
+	return p.registry.save(p.registeredLocked())
+}
+
+// ListServices returns the services registered at runtime
+func (p *ProxyHandler) ListServices(c *gin.Context) {
+	services := p.RegisteredServices()
+	c.JSON(http.StatusOK, gin.H{
+		"services": services,
+		"count":    len(services),
+	})
+}
+
+// CreateService registers a new backend service
+func (p *ProxyHandler) CreateService(c *gin.Context) {
+	var def ServiceDefinition
+	if err := c.ShouldBindJSON(&def); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid service definition",
+		})
+		return
+	}
+
+	if err := p.RegisterService(def, false); err != nil {
+		p.serviceRegistryError(c, def.Name, err)
+		return
+	}
+
+	p.logger.Info("Service registered", zap.String("service", def.Name))
+	c.JSON(http.StatusCreated, def)
+}
+
+// UpdateService replaces a registered backend service
+func (p *ProxyHandler) UpdateService(c *gin.Context) {
+	var def ServiceDefinition
+	if err := c.ShouldBindJSON(&def); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid service definition",
+		})
+		return
+	}
+	def.Name = c.Param("name")
+
+	if err := p.RegisterService(def, true); err != nil {
+		p.serviceRegistryError(c, def.Name, err)
+		return
+	}
+
+	p.logger.Info("Service updated", zap.String("service", def.Name))
+	c.JSON(http.StatusOK, def)
+}
+
+// DeleteService removes a registered backend service
+func (p *ProxyHandler) DeleteService(c *gin.Context) {
+	name := c.Param("name")
+	if err := p.RemoveService(name); err != nil {
+		p.serviceRegistryError(c, name, err)
+		return
+	}
+
+	p.logger.Info("Service removed", zap.String("service", name))
+	c.Status(http.StatusNoContent)
+}
+
+// serviceRegistryError maps registry errors to HTTP responses
+func (p *ProxyHandler) serviceRegistryError(c *gin.Context, name string, err error) {
+	switch {
+	case errors.Is(err, errServiceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Not Found",
+			"message": fmt.Sprintf("Service %s is not registered", name),
+		})
+	case errors.Is(err, errServiceExists), errors.Is(err, errStaticService):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Conflict",
+			"message": fmt.Sprintf("Service %s: %s", name, err.Error()),
+		})
+	default:
+		p.logger.Warn("Service registration rejected", zap.String("service", name), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+	}
+}
+
+// ProxyToRegisteredService returns a catch-all handler that proxies /:service/*path
+// to a service registered at runtime
+func (p *ProxyHandler) ProxyToRegisteredService() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serviceName := c.Param("service")
+
+		p.mu.RLock()
+		_, registered := p.registered[serviceName]
+		svc := p.services[serviceName]
+		p.mu.RUnlock()
+
+		if !registered {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Not Found",
+				"message": fmt.Sprintf("Service %s is not registered", serviceName),
+			})
+			return
+		}
+
+		p.logger.Info("Proxying request",
+			zap.String("service", serviceName),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+		)
+
+		c.Request.URL.Path = c.Param("path")
+		if c.Request.URL.Path == "" {
+			c.Request.URL.Path = "/"
+		}
+		c.Request.URL.RawPath = ""
+
+		p.serveService(c, svc)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func setupRegistryGateway(t *testing.T, cfg *config.Config) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	t.Cleanup(proxy.Close)
+
+	router := gin.New()
+	router.GET("/admin/services", proxy.ListServices)
+	router.POST("/admin/services", proxy.CreateService)
+	router.PUT("/admin/services/:name", proxy.UpdateService)
+	router.DELETE("/admin/services/:name", proxy.DeleteService)
+	router.Any("/services/:service/*path", proxy.ProxyToRegisteredService())
+
+	gateway := httptest.NewServer(router)
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+func adminRequest(t *testing.T, gateway *httptest.Server, method, path, body string) int {
+	req, _ := http.NewRequest(method, gateway.URL+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestDynamicServiceRegistration(t *testing.T) {
+	v1 := newPathEchoBackend()
+	defer v1.Close()
+	v2, _ := newFlappingBackend("v2")
+	defer v2.Close()
+
+	registryFile := filepath.Join(t.TempDir(), "services.json")
+	cfg := &config.Config{
+		Services:        map[string]config.ServiceEndpoint{"static": {BaseURL: v1.URL}},
+		ServiceRegistry: config.ServiceRegistryConfig{File: registryFile},
+	}
+	gateway := setupRegistryGateway(t, cfg)
+
+	status, _ := gatewayGet(t, gateway, "/services/orders/items")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// Register and proxy immediately, without restart
+	assert.Equal(t, http.StatusCreated, adminRequest(t, gateway, "POST", "/admin/services",
+		`{"name":"orders","base_url":"`+v1.URL+`","timeout":"5s"}`))
+	status, body := gatewayGet(t, gateway, "/services/orders/items/42")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "/items/42", body)
+
+	// Duplicates and configured services are rejected
+	assert.Equal(t, http.StatusConflict, adminRequest(t, gateway, "POST", "/admin/services",
+		`{"name":"orders","base_url":"`+v1.URL+`"}`))
+	assert.Equal(t, http.StatusConflict, adminRequest(t, gateway, "POST", "/admin/services",
+		`{"name":"static","base_url":"`+v1.URL+`"}`))
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, gateway, "POST", "/admin/services",
+		`{"name":"bad name","base_url":"`+v1.URL+`"}`))
+
+	// Update swaps the backend
+	assert.Equal(t, http.StatusOK, adminRequest(t, gateway, "PUT", "/admin/services/orders",
+		`{"base_url":"`+v2.URL+`"}`))
+	_, body = gatewayGet(t, gateway, "/services/orders/items")
+	assert.Equal(t, "v2", body)
+
+	// The registry survives a restart
+	restarted := setupRegistryGateway(t, cfg)
+	_, body = gatewayGet(t, restarted, "/services/orders/items")
+	assert.Equal(t, "v2", body)
+
+	// Removal takes effect immediately and is persisted
+	assert.Equal(t, http.StatusNoContent, adminRequest(t, gateway, "DELETE", "/admin/services/orders", ""))
+	status, _ = gatewayGet(t, gateway, "/services/orders/items")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, gateway, "DELETE", "/admin/services/orders", ""))
+
+	restarted = setupRegistryGateway(t, cfg)
+	status, _ = gatewayGet(t, restarted, "/services/orders/items")
+	assert.Equal(t, http.StatusNotFound, status)
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/api-gateway/config"
+)
+
+const (
+	defaultRetryBackoff     = 100 * time.Millisecond
+	defaultRetryMaxBackoff  = 2 * time.Second
+	defaultRetryMaxBodySize = 1 << 20
+)
+
+// backoffPolicy computes the delay before each retry. Jitter spreads the delays of
+// clients that failed at the same moment so they don't retry in lockstep.
+type backoffPolicy struct {
+	base   time.Duration
+	max    time.Duration
+	jitter string
+	random func() float64 // Returns a value in [0, 1)
+}
+
+// newBackoffPolicy applies defaults to the retry configuration; jitter defaults to full
+func newBackoffPolicy(cfg config.RetryConfig) backoffPolicy {
+	policy := backoffPolicy{base: cfg.Backoff, max: cfg.MaxBackoff, jitter: cfg.Jitter, random: rand.Float64}
+	if policy.base <= 0 {
+		policy.base = defaultRetryBackoff
+	}
+	if policy.max <= 0 {
+		policy.max = defaultRetryMaxBackoff
+	}
+	if policy.max < policy.base {
+		policy.max = policy.base
+	}
+	if policy.jitter == "" {
+		policy.jitter = "full"
+	}
+	return policy
+}
+
+// delay returns the wait before the given retry, counting from zero. The exponential
+// delay is capped at max; full jitter picks from [0, delay] and equal jitter from
+// [delay/2, delay].
+func (b backoffPolicy) delay(retry int) time.Duration {
+	delay := b.max
+	if retry < 32 && b.base<<retry > 0 && b.base<<retry < b.max {
+		delay = b.base << retry
+	}
+
+	switch b.jitter {
+	case "full":
+		return time.Duration(b.random() * float64(delay+1))
+	case "equal":
+		half := delay / 2
+		return half + time.Duration(b.random()*float64(delay-half+1))
+	default:
+		return delay
+	}
+}
+
+// retryTransport retries replayable requests that fail with a connection error or a
+// 502/503/504 response, waiting the backoff delay between attempts
+type retryTransport struct {
+	next        http.RoundTripper
+	attempts    int
+	backoff     backoffPolicy
+	maxBodySize int64 // Larger bodies are streamed and not retried
+}
+
+// newRetryTransport wraps next with the retry policy of a service
+func newRetryTransport(next http.RoundTripper, cfg config.RetryConfig) *retryTransport {
+	maxBodySize := cfg.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultRetryMaxBodySize
+	}
+	return &retryTransport{
+		next:        next,
+		attempts:    cfg.Attempts,
+		backoff:     newBackoffPolicy(cfg),
+		maxBodySize: maxBodySize,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = t.bufferBody(req)
+	resp, err := t.next.RoundTrip(req)
+
+	for retry := 0; retry < t.attempts && shouldRetry(resp, err) && req.Context().Err() == nil; retry++ {
+		next, ok := replayableRequest(req)
+		if !ok {
+			break
+		}
+		if !sleepContext(req.Context(), t.backoff.delay(retry)) {
+			break
+		}
+
+		if resp != nil {
+			drainAndClose(resp.Body)
+		}
+		resp, err = t.next.RoundTrip(next)
+	}
+	return resp, err
+}
+
+// bufferBody returns req with its body buffered so it can be replayed. Bodies of
+// requests that are never retried stream through untouched, and so do bodies over the
+// size cap: without GetBody the request is then simply not retried.
+func (t *retryTransport) bufferBody(req *http.Request) *http.Request {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil || !replayableMethod(req) {
+		return req
+	}
+	if req.ContentLength > t.maxBodySize {
+		return req
+	}
+
+	original := req.Body
+	body, err := io.ReadAll(io.LimitReader(original, t.maxBodySize+1))
+	buffered := *req
+	if err != nil || int64(len(body)) > t.maxBodySize {
+		// Hand the backend the bytes already read followed by the rest
+		buffered.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), original), Closer: original}
+		return &buffered
+	}
+	original.Close()
+
+	buffered.Body = io.NopCloser(bytes.NewReader(body))
+	buffered.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return &buffered
+}
+
+// shouldRetry reports whether an attempt failed in a way another attempt may fix
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// sleepContext waits for d, returning false if the context is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
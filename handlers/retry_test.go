@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffDelayRanges(t *testing.T) {
+	base := 100 * time.Millisecond
+	maxDelay := time.Second
+
+	for _, jitter := range []string{"none", "full", "equal"} {
+		policy := newBackoffPolicy(config.RetryConfig{Backoff: base, MaxBackoff: maxDelay, Jitter: jitter})
+		for retry := 0; retry < 6; retry++ {
+			ceiling := base << retry
+			if ceiling > maxDelay {
+				ceiling = maxDelay
+			}
+			floor := time.Duration(0)
+			switch jitter {
+			case "none":
+				floor = ceiling
+			case "equal":
+				floor = ceiling / 2
+			}
+
+			for i := 0; i < 100; i++ {
+				delay := policy.delay(retry)
+				assert.GreaterOrEqual(t, delay, floor, "%s jitter, retry %d", jitter, retry)
+				assert.LessOrEqual(t, delay, ceiling, "%s jitter, retry %d", jitter, retry)
+			}
+		}
+	}
+}
+
+func TestBackoffJitterBounds(t *testing.T) {
+	policy := newBackoffPolicy(config.RetryConfig{Backoff: 100 * time.Millisecond, Jitter: "full"})
+
+	policy.random = func() float64 { return 0 }
+	assert.Equal(t, time.Duration(0), policy.delay(2))
+
+	policy.jitter = "equal"
+	assert.Equal(t, 200*time.Millisecond, policy.delay(2))
+
+	policy.random = func() float64 { return 0.9999999999 }
+	assert.InDelta(t, float64(400*time.Millisecond), float64(policy.delay(2)), float64(time.Microsecond))
+}
+
+func TestConcurrentRetriersDiverge(t *testing.T) {
+	policy := newBackoffPolicy(config.RetryConfig{Backoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second})
+
+	var wg sync.WaitGroup
+	delays := make([][]time.Duration, 2)
+	for i := range delays {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for retry := 0; retry < 5; retry++ {
+				delays[i] = append(delays[i], policy.delay(retry))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.NotEqual(t, delays[0], delays[1])
+}
+
+func TestRetryTransportRetriesUnavailable(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	transport := &retryTransport{
+		next:     http.DefaultTransport,
+		attempts: 3,
+		backoff:  newBackoffPolicy(config.RetryConfig{Backoff: time.Millisecond}),
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, backend.URL, nil)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// Non-idempotent requests are never retried
+	calls.Store(0)
+	req, _ = http.NewRequest(http.MethodPost, backend.URL, nil)
+	resp, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRetryTransportReplaysBufferedBody(t *testing.T) {
+	var calls atomic.Int32
+	var bodies []string
+	var mu sync.Mutex
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		if calls.Add(1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	transport := newRetryTransport(http.DefaultTransport, config.RetryConfig{Attempts: 2, Backoff: time.Millisecond, MaxBodySize: 16})
+
+	req, _ := http.NewRequest(http.MethodPut, backend.URL, strings.NewReader("small body"))
+	req.Header.Set("Idempotency-Key", "k1")
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"small body", "small body"}, bodies)
+
+	// Beyond the cap the body is forwarded whole, but the request is not retried
+	calls.Store(0)
+	bodies = nil
+	large := strings.Repeat("x", 100)
+	req, _ = http.NewRequest(http.MethodPut, backend.URL, io.NopCloser(strings.NewReader(large)))
+	req.Header.Set("Idempotency-Key", "k2")
+	resp, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, []string{large}, bodies)
+}
+
+func TestLargeUploadStreamsWithoutBuffering(t *testing.T) {
+	const chunk = 64 << 10
+	firstChunk := make(chan struct{})
+	var received atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, chunk)
+		n, _ := io.ReadFull(r.Body, buf)
+		received.Add(int64(n))
+		close(firstChunk)
+		n64, _ := io.Copy(io.Discard, r.Body)
+		received.Add(n64)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer backend.Close()
+
+	for _, retry := range []config.RetryConfig{
+		{},                               // Retries disabled
+		{Attempts: 2, MaxBodySize: 1024}, // Body over the cap
+	} {
+		firstChunk = make(chan struct{})
+		received.Store(0)
+		transport, err := newServiceTransport(config.ServiceEndpoint{Retry: retry}, config.GatewaySigningConfig{})
+		if err != nil {
+			t.Fatalf("failed to build transport: %v", err)
+		}
+
+		// The upload is only finished once the backend has seen its start, which it
+		// can't if the gateway buffers the body first
+		pr, pw := io.Pipe()
+		go func() {
+			pw.Write(make([]byte, chunk))
+			select {
+			case <-firstChunk:
+			case <-time.After(2 * time.Second):
+				pw.CloseWithError(errors.New("body was buffered"))
+				return
+			}
+			for i := 0; i < 16; i++ {
+				pw.Write(make([]byte, chunk))
+			}
+			pw.Close()
+		}()
+
+		req, _ := http.NewRequest(http.MethodPut, backend.URL, pr)
+		req.Header.Set("Idempotency-Key", "upload")
+		resp, err := transport.RoundTrip(req)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, int64(17*chunk), received.Load())
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// rewriteContextKey is the request context key for route-level rewrite rules
+type rewriteContextKey struct{}
+
+// pathRewriter applies an ordered list of rewrite rules to request paths
+type pathRewriter struct {
+	rules []compiledRewrite
+}
+
+// compiledRewrite is a rewrite rule ready to be applied
+type compiledRewrite struct {
+	prefix      string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// newPathRewriter compiles rewrite rules, returning nil when there are none
+func newPathRewriter(rules []config.RewriteRule) (*pathRewriter, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	rewriter := &pathRewriter{rules: make([]compiledRewrite, 0, len(rules))}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+
+		compiled := compiledRewrite{replacement: rule.Replacement}
+		if rule.Regex {
+			compiled.pattern = regexp.MustCompile(rule.Match)
+		} else {
+			compiled.prefix = rule.Match
+		}
+		rewriter.rules = append(rewriter.rules, compiled)
+	}
+	return rewriter, nil
+}
+
+// rewrite applies the first matching rule to the path
+func (r *pathRewriter) rewrite(path string) (string, bool) {
+	if r == nil {
+		return path, false
+	}
+
+	for _, rule := range r.rules {
+		if rule.pattern != nil {
+			if !rule.pattern.MatchString(path) {
+				continue
+			}
+			return ensureLeadingSlash(rule.pattern.ReplaceAllString(path, rule.replacement)), true
+		}
+
+		if hasPathPrefix(path, rule.prefix) {
+			return ensureLeadingSlash(rule.replacement + strings.TrimPrefix(path, rule.prefix)), true
+		}
+	}
+	return path, false
+}
+
+// applyRewrites rewrites the outgoing request path using the route-level rules, if any
+// matched, otherwise the service-level rules
+func applyRewrites(req *http.Request, serviceRewriter *pathRewriter) {
+	if routeRewriter, ok := req.Context().Value(rewriteContextKey{}).(*pathRewriter); ok {
+		if path, matched := routeRewriter.rewrite(req.URL.Path); matched {
+			req.URL.Path = path
+			req.URL.RawPath = ""
+			return
+		}
+	}
+
+	if path, matched := serviceRewriter.rewrite(req.URL.Path); matched {
+		req.URL.Path = path
+		req.URL.RawPath = ""
+	}
+}
+
+// ProxyToServiceWithRewrite returns a handler that proxies requests to a backend service,
+// rewriting the full request path with route-specific rules before the service's own rules
+func (p *ProxyHandler) ProxyToServiceWithRewrite(serviceName string, rules ...config.RewriteRule) gin.HandlerFunc {
+	rewriter, err := newPathRewriter(rules)
+	if err != nil {
+		p.logger.Error("Invalid rewrite rules for route",
+			zap.String("service", serviceName),
+			zap.Error(err),
+		)
+	}
+
+	return func(c *gin.Context) {
+		svc, exists := p.service(serviceName)
+		if !exists || err != nil {
+			p.logger.Error("Proxy not found for service", zap.String("service", serviceName))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal Server Error",
+				"message": "Service configuration not found",
+			})
+			return
+		}
+
+		p.logger.Info("Proxying request",
+			zap.String("service", serviceName),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+		)
+
+		if rewriter != nil {
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), rewriteContextKey{}, rewriter))
+		}
+
+		p.serveService(c, svc)
+	}
+}
+
+// hasPathPrefix reports whether path starts with prefix on a segment boundary
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// ensureLeadingSlash makes sure a rewritten path is absolute
+func ensureLeadingSlash(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
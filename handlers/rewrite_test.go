@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// newPathEchoBackend returns a backend that responds with the request path it received
+func newPathEchoBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+}
+
+func TestRewriteRules(t *testing.T) {
+	backend := newPathEchoBackend()
+	defer backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"projects": {
+				BaseURL:  backend.URL,
+				Rewrites: []config.RewriteRule{{Match: "/api/v1/projects", Replacement: ""}},
+			},
+			"users": {BaseURL: backend.URL},
+		},
+	}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.GET("/api/v1/projects/*rest", proxy.ProxyToServiceWithRewrite("projects"))
+	router.GET("/api/v1/users/*rest", proxy.ProxyToServiceWithRewrite("users", config.RewriteRule{
+		Match:       `^/api/v1/users/(\d+)/avatar$`,
+		Replacement: "/avatars/$1.png",
+		Regex:       true,
+	}))
+	router.GET("/items/:id", proxy.ProxyToServiceWithPath("users", "/internal/items/:id"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		wantPath string
+	}{
+		{"prefix strip", "/api/v1/projects/tasks/7", "/tasks/7"},
+		{"prefix strip to root", "/api/v1/projects", "/"},
+		{"regex capture", "/api/v1/users/42/avatar", "/avatars/42.png"},
+		{"no match passthrough", "/api/v1/users/42/profile", "/api/v1/users/42/profile"},
+		{"param substitution", "/items/99", "/internal/items/99"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := gatewayGet(t, gateway, tt.path)
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, tt.wantPath, body)
+		})
+	}
+}
+
+func TestRewritePrefixMatchesSegmentBoundary(t *testing.T) {
+	rewriter, err := newPathRewriter([]config.RewriteRule{{Match: "/api/v1/projects", Replacement: "/p"}})
+	assert.NoError(t, err)
+
+	path, matched := rewriter.rewrite("/api/v1/projectsX/1")
+	assert.False(t, matched)
+	assert.Equal(t, "/api/v1/projectsX/1", path)
+
+	_, err = newPathRewriter([]config.RewriteRule{{Match: "([", Regex: true}})
+	assert.Error(t, err)
+}
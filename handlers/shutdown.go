@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// tunnelPollInterval is how often Shutdown checks whether upgraded connections have closed
+const tunnelPollInterval = 50 * time.Millisecond
+
+// Shutdown gracefully stops srv. It stops accepting connections and waits for in-flight
+// requests and for the upgraded connections tunneled by proxy (which http.Server does
+// not track once hijacked) to finish. When ctx expires first, the remaining connections
+// are force-closed and ctx's error is returned.
+func Shutdown(ctx context.Context, srv *http.Server, proxy *ProxyHandler, logger *zap.Logger) error {
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		// Long responses such as streams and server-sent events are still running
+		logger.Warn("Shutdown timeout expired, closing active connections", zap.Error(err))
+		srv.Close()
+	}
+
+	if open := proxy.tunnels.wait(ctx); open > 0 {
+		closed := proxy.tunnels.closeAll()
+		logger.Warn("Shutdown timeout expired, closing upgraded connections", zap.Int("connections", closed))
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
+// tunnelTracker records the client connections hijacked for upgraded requests
+type tunnelTracker struct {
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+}
+
+func newTunnelTracker() *tunnelTracker {
+	return &tunnelTracker{conns: make(map[*trackedConn]struct{})}
+}
+
+// track wraps w so that a connection hijacked through it is tracked until closed
+func (t *tunnelTracker) track(w http.ResponseWriter) http.ResponseWriter {
+	return &tunnelWriter{ResponseWriter: w, tracker: t}
+}
+
+// count returns the number of open tunnels
+func (t *tunnelTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// wait blocks until every tunnel has closed or ctx expires, returning how many are still open
+func (t *tunnelTracker) wait(ctx context.Context) int {
+	ticker := time.NewTicker(tunnelPollInterval)
+	defer ticker.Stop()
+	for {
+		open := t.count()
+		if open == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return open
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeAll closes every open tunnel, returning how many were closed
+func (t *tunnelTracker) closeAll() int {
+	t.mu.Lock()
+	conns := make([]*trackedConn, 0, len(t.conns))
+	for conn := range t.conns {
+		conns = append(conns, conn)
+	}
+	t.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	return len(conns)
+}
+
+// tunnelWriter is a response writer whose hijacked connection is tracked
+type tunnelWriter struct {
+	http.ResponseWriter
+	tracker *tunnelTracker
+}
+
+// Hijack takes over the client connection and tracks it
+func (w *tunnelWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tracked := &trackedConn{Conn: conn, tracker: w.tracker}
+	w.tracker.mu.Lock()
+	w.tracker.conns[tracked] = struct{}{}
+	w.tracker.mu.Unlock()
+	return tracked, rw, nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush
+func (w *tunnelWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// trackedConn removes itself from its tracker when closed
+type trackedConn struct {
+	net.Conn
+	tracker *tunnelTracker
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.tracker.mu.Lock()
+		delete(c.tracker.conns, c)
+		c.tracker.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// shutdownWithin shuts srv down with the given timeout and returns the error and time taken
+func shutdownWithin(srv *http.Server, proxy *ProxyHandler, timeout time.Duration) (error, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	err := Shutdown(ctx, srv, proxy, zap.NewNop())
+	return err, time.Since(start)
+}
+
+func TestShutdownClosesUpgradedConnections(t *testing.T) {
+	backend := newUpgradeEchoBackend(t)
+	defer backend.Close()
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL}},
+	}, "backend")
+
+	conn, err := net.Dial("tcp", gateway.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET /svc/tunnel HTTP/1.1\r\nHost: gateway\r\nConnection: Upgrade\r\nUpgrade: echo-tcp\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("reading upgrade response failed: %v", err)
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, 1, proxy.tunnels.count())
+
+	err, elapsed := shutdownWithin(gateway.Config, proxy, 200*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, elapsed, 2*time.Second)
+	assert.Equal(t, 0, proxy.tunnels.count())
+
+	// The client sees the tunnel closed rather than hanging
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestShutdownClosesStreamingResponses(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer backend.Close()
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL}},
+	}, "backend")
+
+	resp, err := http.Get(gateway.URL + "/svc/events")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Equal(t, "data: hello\n", line)
+
+	err, elapsed := shutdownWithin(gateway.Config, proxy, 200*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, elapsed, 2*time.Second)
+}
+
+func TestShutdownWithoutActiveConnections(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL}},
+	}, "backend")
+
+	code, _ := gatewayGet(t, gateway, "/svc/")
+	assert.Equal(t, http.StatusOK, code)
+
+	err, elapsed := shutdownWithin(gateway.Config, proxy, 5*time.Second)
+	assert.NoError(t, err)
+	assert.Less(t, elapsed, time.Second)
+	_, err = net.DialTimeout("tcp", gateway.Listener.Addr().String(), time.Second)
+	assert.Error(t, err, "the listener is closed")
+}
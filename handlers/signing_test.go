@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGatewaySignatureVerifiesAtBackend(t *testing.T) {
+	signing := config.GatewaySigningConfig{
+		Enabled: true,
+		Secret:  "signing-secret",
+		Headers: []string{"X-Gateway", "X-Real-IP", "X-Request-ID"},
+	}
+
+	// The backend rejects requests that did not come through the gateway
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := VerifyGatewaySignature(r, signing, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services:       map[string]config.ServiceEndpoint{"users": {BaseURL: backend.URL}},
+		GatewaySigning: signing,
+	}, "users")
+
+	status, _ := gatewayGet(t, gateway, "/svc/profile?id=7")
+	assert.Equal(t, http.StatusOK, status)
+
+	// Forged headers sent straight to the backend don't verify
+	req, _ := http.NewRequest("GET", backend.URL+"/profile?id=7", nil)
+	req.Header.Set("X-Gateway", "api-gateway")
+	req.Header.Set(SignatureTimestampHeader, "1")
+	req.Header.Set(SignatureHeader, "v1=00")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestGatewaySignatureFollowedRedirect(t *testing.T) {
+	signing := config.GatewaySigningConfig{Enabled: true, Secret: "signing-secret", Headers: []string{"X-Gateway"}}
+
+	// Every hop must verify; a POST answered with 303 is followed as a GET to another path
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := VerifyGatewaySignature(r, signing, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/orders" {
+			http.Redirect(w, r, "/orders/7", http.StatusSeeOther)
+			return
+		}
+		w.Write([]byte(r.Method + " " + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services:       map[string]config.ServiceEndpoint{"orders": {BaseURL: backend.URL, MaxRedirects: 3}},
+		GatewaySigning: signing,
+	}, "orders")
+
+	resp := sendRequest(t, "POST", gateway.URL+"/svc/orders", `{"item":"book"}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "GET /orders/7", resp.Body)
+}
+
+func TestGatewaySignatureTampering(t *testing.T) {
+	now := time.Now()
+	cfg := config.GatewaySigningConfig{Secret: "signing-secret", Headers: []string{"X-Real-IP"}}
+
+	newSignedRequest := func() *http.Request {
+		req := httptest.NewRequest("POST", "http://users:8080/orders?limit=10", nil)
+		req.Header.Set("X-Real-IP", "203.0.113.9")
+		signRequest(req, cfg, now)
+		return req
+	}
+	assert.NoError(t, VerifyGatewaySignature(newSignedRequest(), cfg, now))
+
+	tests := []struct {
+		name    string
+		tamper  func(req *http.Request)
+		cfg     config.GatewaySigningConfig
+		wantErr error
+	}{
+		{"signed header changed", func(req *http.Request) { req.Header.Set("X-Real-IP", "198.51.100.1") }, cfg, ErrSignatureInvalid},
+		{"query changed", func(req *http.Request) { req.URL.RawQuery = "limit=1000" }, cfg, ErrSignatureInvalid},
+		{"method changed", func(req *http.Request) { req.Method = "DELETE" }, cfg, ErrSignatureInvalid},
+		{"host changed", func(req *http.Request) { req.Host = "admin:8080" }, cfg, ErrSignatureInvalid},
+		{"timestamp changed", func(req *http.Request) {
+			req.Header.Set(SignatureTimestampHeader, req.Header.Get(SignatureTimestampHeader)+"0")
+		}, cfg, ErrSignatureExpired},
+		{"signature removed", func(req *http.Request) { req.Header.Del(SignatureHeader) }, cfg, ErrSignatureMissing},
+		{"wrong secret", func(*http.Request) {}, config.GatewaySigningConfig{Secret: "other", Headers: cfg.Headers}, ErrSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newSignedRequest()
+			tt.tamper(req)
+			assert.ErrorIs(t, VerifyGatewaySignature(req, tt.cfg, now), tt.wantErr)
+		})
+	}
+
+	// A signature too old to replay is rejected
+	assert.ErrorIs(t, VerifyGatewaySignature(newSignedRequest(), cfg, now.Add(10*time.Minute)), ErrSignatureExpired)
+}
+
+func TestGatewaySignatureRotation(t *testing.T) {
+	now := time.Now()
+	req := httptest.NewRequest("GET", "http://users:8080/", nil)
+	signRequest(req, config.GatewaySigningConfig{Secret: "old-secret"}, now)
+
+	// Backends that already know the new secret keep accepting the old one
+	rotated := config.GatewaySigningConfig{Secret: "new-secret", PreviousSecrets: []string{"old-secret"}}
+	assert.NoError(t, VerifyGatewaySignature(req, rotated, now))
+	assert.ErrorIs(t, VerifyGatewaySignature(req, config.GatewaySigningConfig{Secret: "new-secret"}, now), ErrSignatureInvalid)
+}
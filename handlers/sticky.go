@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/api-gateway/config"
+)
+
+// affinityCookiePrefix prefixes the default affinity cookie name of a service
+const affinityCookiePrefix = "gw_affinity_"
+
+// stickySessions pins clients to an upstream of a service's default pool with an
+// affinity cookie holding the upstream's opaque ID
+type stickySessions struct {
+	cookieName string
+	cfg        config.StickySessionConfig
+}
+
+// newStickySessions returns the session affinity of a service, or nil when disabled
+func newStickySessions(serviceName string, cfg config.StickySessionConfig) *stickySessions {
+	if !cfg.Enabled {
+		return nil
+	}
+	cookieName := cfg.CookieName
+	if cookieName == "" {
+		cookieName = affinityCookiePrefix + serviceName
+	}
+	return &stickySessions{cookieName: cookieName, cfg: cfg}
+}
+
+// pinned returns the upstream named by the request's affinity cookie while it is
+// healthy, or nil
+func (s *stickySessions) pinned(r *http.Request, pool *upstreamPool) *upstream {
+	cookie, err := r.Cookie(s.cookieName)
+	if err != nil {
+		return nil
+	}
+	if target := pool.byID(cookie.Value); target != nil && target.healthy.Load() {
+		return target
+	}
+	return nil
+}
+
+// pin sets the affinity cookie for target on the response
+func (s *stickySessions) pin(w http.ResponseWriter, r *http.Request, target *upstream) {
+	cookie := &http.Cookie{
+		Name:     s.cookieName,
+		Value:    target.id,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if s.cfg.TTL > 0 {
+		cookie.MaxAge = int(s.cfg.TTL.Seconds())
+	}
+	http.SetCookie(w, cookie)
+}
+
+// strip removes the affinity cookie from the request forwarded to the backend, leaving
+// the other cookies as the client sent them
+func (s *stickySessions) strip(r *http.Request) {
+	values := r.Header.Values("Cookie")
+	if len(values) == 0 {
+		return
+	}
+
+	r.Header.Del("Cookie")
+	for _, value := range values {
+		parts := strings.Split(value, ";")
+		kept := parts[:0]
+		for _, part := range parts {
+			name, _, _ := strings.Cut(part, "=")
+			if strings.TrimSpace(name) != s.cookieName {
+				kept = append(kept, part)
+			}
+		}
+		if len(kept) > 0 {
+			r.Header.Add("Cookie", strings.TrimSpace(strings.Join(kept, ";")))
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStickySessions(t *testing.T) {
+	first, second := newEchoBackend(t, "first"), newEchoBackend(t, "second")
+	gateway, proxy := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"users": {
+			BaseURL:       first.URL,
+			Upstreams:     []config.UpstreamEndpoint{{URL: second.URL, Weight: 1}},
+			StickySession: config.StickySessionConfig{Enabled: true, TTL: time.Hour},
+		}},
+	}, "users")
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	get := func() string {
+		resp, err := client.Get(gateway.URL + "/svc/")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// Round-robin would alternate; the affinity cookie keeps the client in place
+	pinned := get()
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, pinned, get())
+	}
+
+	// The pinned upstream goes down: the client moves and stays on the other one
+	pool := proxy.services["users"].pool
+	for _, u := range pool.upstreams {
+		if (pinned == "first:") == (u.url.Host == first.Listener.Addr().String()) {
+			u.healthy.Store(false)
+		}
+	}
+	moved := get()
+	assert.NotEqual(t, pinned, moved)
+	for _, u := range pool.upstreams {
+		u.healthy.Store(true)
+	}
+	assert.Equal(t, moved, get())
+}
+
+func TestStickySessionsStripCookie(t *testing.T) {
+	sticky := newStickySessions("users", config.StickySessionConfig{Enabled: true})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Cookie", "session=abc; gw_affinity_users=0123; theme=dark")
+	req.Header.Add("Cookie", "gw_affinity_users=0123")
+
+	sticky.strip(req)
+	assert.Equal(t, []string{"session=abc; theme=dark"}, req.Header.Values("Cookie"))
+}
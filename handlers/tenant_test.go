@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// setupTenantGateway serves a tenant-scoped service; a X-Test-Tenant-Claim header
+// simulates an authenticated user carrying that tenant claim
+func setupTenantGateway(t *testing.T, endpoint config.ServiceEndpoint) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": endpoint},
+	}, zap.NewNop())
+	t.Cleanup(proxy.Close)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if tenant, ok := c.Request.Header["X-Test-Tenant-Claim"]; ok {
+			c.Set(string(middleware.UserContextKey), &middleware.Claims{UserID: "user-1", TenantID: tenant[0]})
+		}
+		c.Next()
+	})
+	router.Any("/svc/*path", proxy.ProxyToService("backend"))
+	gateway := httptest.NewServer(router)
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+func tenantRequest(t *testing.T, gateway *httptest.Server, headers map[string]string) (int, map[string]string) {
+	req, _ := http.NewRequest("GET", gateway.URL+"/svc/", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var echoed map[string]string
+	json.NewDecoder(resp.Body).Decode(&echoed)
+	return resp.StatusCode, echoed
+}
+
+func TestTenantRoutingFromClaim(t *testing.T) {
+	shared := newHeaderEchoBackend()
+	defer shared.Close()
+	dedicated := newHeaderEchoBackend()
+	defer dedicated.Close()
+
+	gateway := setupTenantGateway(t, config.ServiceEndpoint{
+		BaseURL: shared.URL,
+		TenantRouting: config.TenantRoutingConfig{
+			Enabled: true,
+			Tenants: map[string]string{"acme": dedicated.URL},
+		},
+	})
+
+	// The claim wins over a spoofed header and selects the tenant's upstream
+	status, echoed := tenantRequest(t, gateway, map[string]string{
+		"X-Test-Tenant-Claim": "acme",
+		"X-Tenant-ID":         "globex",
+	})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "acme", echoed["X-Tenant-Id"])
+	assert.Equal(t, dedicated.Listener.Addr().String(), echoed["Host"])
+
+	// Tenants without a dedicated upstream use the shared pool
+	status, echoed = tenantRequest(t, gateway, map[string]string{"X-Test-Tenant-Claim": "initech"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "initech", echoed["X-Tenant-Id"])
+	assert.Equal(t, shared.Listener.Addr().String(), echoed["Host"])
+}
+
+func TestTenantRoutingFromHeader(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gateway := setupTenantGateway(t, config.ServiceEndpoint{
+		BaseURL:       backend.URL,
+		TenantRouting: config.TenantRoutingConfig{Enabled: true},
+	})
+
+	// Principals of any tenant choose one with the header
+	status, echoed := tenantRequest(t, gateway, map[string]string{
+		"X-Test-Tenant-Claim": middleware.AnyTenant,
+		"X-Tenant-ID":         "globex",
+	})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "globex", echoed["X-Tenant-Id"])
+
+	// Anonymous callers can't
+	status, _ = tenantRequest(t, gateway, map[string]string{"X-Tenant-ID": "globex"})
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestTenantRoutingMissingTenant(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gateway := setupTenantGateway(t, config.ServiceEndpoint{
+		BaseURL:       backend.URL,
+		TenantRouting: config.TenantRoutingConfig{Enabled: true},
+	})
+
+	status, _ := tenantRequest(t, gateway, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Authenticated users without a tenant claim can't pick one with the header
+	status, _ = tenantRequest(t, gateway, map[string]string{
+		"X-Test-Tenant-Claim": "",
+		"X-Tenant-ID":         "acme",
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestTenantRoutingDedicatedBackends(t *testing.T) {
+	shared := newHeaderEchoBackend()
+	defer shared.Close()
+	acme := newHeaderEchoBackend()
+	defer acme.Close()
+	globex := newHeaderEchoBackend()
+	defer globex.Close()
+
+	gateway := setupTenantGateway(t, config.ServiceEndpoint{
+		BaseURL: shared.URL,
+		TenantRouting: config.TenantRoutingConfig{
+			Enabled: true,
+			Tenants: map[string]string{"acme": acme.URL, "globex": globex.URL},
+		},
+	})
+
+	tests := []struct {
+		tenant  string
+		backend *httptest.Server
+	}{
+		{"acme", acme},
+		{"globex", globex},
+		{"initech", shared},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tenant, func(t *testing.T) {
+			status, echoed := tenantRequest(t, gateway, map[string]string{"X-Test-Tenant-Claim": tt.tenant})
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, tt.backend.Listener.Addr().String(), echoed["Host"])
+		})
+	}
+}
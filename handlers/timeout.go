@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutOverrideHeader carries the timeout requested by a trusted caller
+const timeoutOverrideHeader = "X-Gateway-Timeout"
+
+// timeoutOverrideKey is the request context key of a granted timeout override
+type timeoutOverrideKey struct{}
+
+// writeDeadlineSlack is left after an overridden timeout to write the timeout response
+const writeDeadlineSlack = 5 * time.Second
+
+// timeoutOverride returns the backend timeout requested by a trusted caller in
+// X-Gateway-Timeout, clamped to the configured maximum. It reports false when
+// overrides are disabled, the caller is not trusted or the header is not a positive
+// number of seconds.
+func timeoutOverride(c *gin.Context, cfg config.TimeoutOverrideConfig) (time.Duration, bool) {
+	value := c.GetHeader(timeoutOverrideHeader)
+	if !cfg.Enabled || value == "" || !trustedForOverride(c, cfg) {
+		return 0, false
+	}
+
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 || math.IsInf(seconds, 0) {
+		return 0, false
+	}
+	if seconds >= cfg.Max.Seconds() {
+		return cfg.Max, true
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// trustedForOverride reports whether the caller has one of the override roles or
+// sends one of the override API keys
+func trustedForOverride(c *gin.Context, cfg config.TimeoutOverrideConfig) bool {
+	if claims, ok := middleware.GetUserFromContext(c); ok {
+		for _, role := range cfg.Roles {
+			for _, userRole := range claims.Roles {
+				if userRole == role {
+					return true
+				}
+			}
+		}
+	}
+
+	if key := c.GetHeader(middleware.APIKeyHeader); key != "" {
+		for _, allowed := range cfg.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(allowed)) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// extendWriteDeadline lets the response be written past the server's write timeout
+// when an override outlasts it. Writers that don't support deadlines are left alone.
+func extendWriteDeadline(w http.ResponseWriter, timeout time.Duration) {
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + writeDeadlineSlack))
+}
+
+// withTimeoutOverride records a granted override on the request, so that the service
+// transport raises its response header timeout to match
+func withTimeoutOverride(req *http.Request, timeout time.Duration) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), timeoutOverrideKey{}, timeout))
+}
+
+// timeoutOverrideFrom returns the override granted to a request, if any
+func timeoutOverrideFrom(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(timeoutOverrideKey{}).(time.Duration)
+	return timeout, ok
+}
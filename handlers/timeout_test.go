@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTimeoutOverride(t *testing.T) {
+	// A report that takes longer than the service timeout
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]string{"override": r.Header.Get(timeoutOverrideHeader)})
+	}))
+	defer backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{
+		Services: map[string]config.ServiceEndpoint{"reports": {BaseURL: backend.URL, Timeout: 50 * time.Millisecond}},
+		TimeoutOverride: config.TimeoutOverrideConfig{
+			Enabled: true,
+			Max:     2 * time.Second,
+			Roles:   []string{"admin"},
+			APIKeys: []string{"internal-key"},
+		},
+	}, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// Stand-in for the authentication middleware
+		if role := c.GetHeader("X-Test-Role"); role != "" {
+			c.Set(string(middleware.UserContextKey), &middleware.Claims{UserID: "1", Roles: []string{role}})
+		}
+		c.Next()
+	})
+	router.Any("/svc/*path", proxy.ProxyToService("reports"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{"privileged role", map[string]string{"X-Test-Role": "admin", timeoutOverrideHeader: "1"}, http.StatusOK},
+		{"api key", map[string]string{middleware.APIKeyHeader: "internal-key", timeoutOverrideHeader: "1.5"}, http.StatusOK},
+		{"clamped to max", map[string]string{"X-Test-Role": "admin", timeoutOverrideHeader: "3600"}, http.StatusOK},
+		{"other role", map[string]string{"X-Test-Role": "user", timeoutOverrideHeader: "1"}, http.StatusGatewayTimeout},
+		{"wrong api key", map[string]string{middleware.APIKeyHeader: "guess", timeoutOverrideHeader: "1"}, http.StatusGatewayTimeout},
+		{"anonymous", map[string]string{timeoutOverrideHeader: "1"}, http.StatusGatewayTimeout},
+		{"invalid value", map[string]string{"X-Test-Role": "admin", timeoutOverrideHeader: "soon"}, http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", gateway.URL+"/svc/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if resp.StatusCode == http.StatusOK {
+				var echoed map[string]string
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&echoed))
+				assert.Empty(t, echoed["override"], "override header must not reach the backend")
+			}
+		})
+	}
+}
+
+func TestTimeoutOverrideHeaderStripped(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"echo": {BaseURL: backend.URL}},
+	}, "echo")
+
+	echoed := gatewayHeaders(t, gateway, "/svc/", map[string]string{timeoutOverrideHeader: "600"})
+	assert.NotContains(t, echoed, timeoutOverrideHeader)
+}
+
+func TestTimeoutOverrideRaisesResponseHeaderTimeout(t *testing.T) {
+	// Headers arrive later than the service's response header timeout
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"reports": {BaseURL: backend.URL, ResponseHeaderTimeout: 50 * time.Millisecond},
+		},
+		TimeoutOverride: config.TimeoutOverrideConfig{Enabled: true, Max: 2 * time.Second, APIKeys: []string{"internal-key"}},
+	}, "reports")
+
+	get := func(headers map[string]string) int {
+		req, _ := http.NewRequest("GET", gateway.URL+"/svc/", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusGatewayTimeout, get(nil))
+	assert.Equal(t, http.StatusOK, get(map[string]string{middleware.APIKeyHeader: "internal-key", timeoutOverrideHeader: "1"}))
+}
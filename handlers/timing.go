@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// backendTiming is the backend's share of a proxied request: time to the response
+// headers, time until the response body was read, body bytes each way, and whether the
+// backend itself answered with a 5xx. Fields are atomic as a timed-out request is
+// reported while the proxy may still be running.
+type backendTiming struct {
+	ttfb          atomic.Int64 // Nanoseconds; 0 until the backend responds
+	total         atomic.Int64 // Nanoseconds; 0 until the response body is done
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+	upstreamError atomic.Bool
+	errorBody     atomic.Pointer[string] // Start of the 5xx body, when captured
+}
+
+// backendTimingKey is the context key of a request's backendTiming
+type backendTimingKey struct{}
+
+// withBackendTiming returns a copy of r recording its backend timing, and the timing
+func withBackendTiming(r *http.Request) (*http.Request, *backendTiming) {
+	timing := &backendTiming{}
+	return r.WithContext(context.WithValue(r.Context(), backendTimingKey{}, timing)), timing
+}
+
+// backendTimingFrom returns the backend timing recorded for a request, if any
+func backendTimingFrom(ctx context.Context) (*backendTiming, bool) {
+	timing, ok := ctx.Value(backendTimingKey{}).(*backendTiming)
+	return timing, ok
+}
+
+// report adds the timing to the access log fields of the request and to the metrics.
+// Nothing is reported when the backend never responded.
+func (t *backendTiming) report(c *gin.Context, service string, metrics *backendMetrics) {
+	ttfb := time.Duration(t.ttfb.Load())
+	if ttfb == 0 {
+		return
+	}
+	total := time.Duration(t.total.Load())
+	sent, received := t.bytesSent.Load(), t.bytesReceived.Load()
+
+	c.Set(middleware.BackendTTFBContextKey, ttfb)
+	if total > 0 {
+		c.Set(middleware.BackendLatencyContextKey, total)
+	}
+	c.Set(middleware.BackendBytesSentContextKey, sent)
+	c.Set(middleware.BackendBytesReceivedContextKey, received)
+
+	metrics.ttfb.WithLabelValues(service).Observe(ttfb.Seconds())
+	if total > 0 {
+		metrics.duration.WithLabelValues(service).Observe(total.Seconds())
+	}
+	metrics.bytesSent.WithLabelValues(service).Add(float64(sent))
+	metrics.bytesReceived.WithLabelValues(service).Add(float64(received))
+
+	if t.upstreamError.Load() {
+		c.Set(middleware.UpstreamErrorContextKey, true)
+		if body := t.errorBody.Load(); body != nil {
+			c.Set(middleware.UpstreamErrorBodyContextKey, *body)
+		}
+	}
+}
+
+// recordServerError counts a 5xx response of a service, labelled by whether the
+// backend returned it or the gateway generated it
+func (m *backendMetrics) recordServerError(service string, status int, timing *backendTiming) {
+	if status < 500 {
+		return
+	}
+	upstream := timing != nil && timing.upstreamError.Load()
+	m.serverErrors.WithLabelValues(service, strconv.FormatBool(upstream)).Inc()
+}
+
+// timingTransport records the backend timing of requests that carry one
+type timingTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timing, ok := backendTimingFrom(req.Context())
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		counted := *req
+		counted.Body = &countingBody{ReadCloser: req.Body, n: &timing.bytesSent}
+		req = &counted
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start)
+	timing.ttfb.Store(int64(elapsed))
+	if err != nil {
+		timing.total.Store(int64(elapsed))
+		return nil, err
+	}
+	// Upgraded connections keep their read-write body for the tunnel
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body = &countingBody{ReadCloser: resp.Body, n: &timing.bytesReceived, done: func() {
+			timing.total.CompareAndSwap(0, int64(time.Since(start)))
+		}}
+	}
+	return resp, nil
+}
+
+// countingBody counts the bytes read from a body, calling done once it is read to
+// the end or closed
+type countingBody struct {
+	io.ReadCloser
+	n    *atomic.Int64
+	done func()
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	if err == io.EOF && b.done != nil {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	if b.done != nil {
+		b.done()
+	}
+	return b.ReadCloser.Close()
+}
+
+// backendMetrics are the Prometheus metrics of backend calls, by service
+type backendMetrics struct {
+	ttfb          *prometheus.HistogramVec
+	duration      *prometheus.HistogramVec
+	bytesSent     *prometheus.CounterVec
+	bytesReceived *prometheus.CounterVec
+	serverErrors  *prometheus.CounterVec
+}
+
+func newBackendMetrics() *backendMetrics {
+	buckets := []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+	return &backendMetrics{
+		ttfb: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gateway_backend_ttfb_seconds",
+			Help:    "Time from sending a request to a backend until its response headers arrived, by service.",
+			Buckets: buckets,
+		}, []string{"service"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gateway_backend_duration_seconds",
+			Help:    "Time from sending a request to a backend until its response body was read, by service.",
+			Buckets: buckets,
+		}, []string{"service"}),
+		bytesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_backend_sent_bytes_total",
+			Help: "Request body bytes sent to backends, by service.",
+		}, []string{"service"}),
+		bytesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_backend_received_bytes_total",
+			Help: "Response body bytes received from backends, by service.",
+		}, []string{"service"}),
+		serverErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_service_server_errors_total",
+			Help: "5xx responses of proxied requests, by service and whether the backend returned them (upstream_error=\"true\") or the gateway generated them.",
+		}, []string{"service", "upstream_error"}),
+	}
+}
+
+// collectors returns every metric
+func (m *backendMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.ttfb, m.duration, m.bytesSent, m.bytesReceived, m.serverErrors}
+}
+
+// remove drops the metrics of a service that no longer exists
+func (m *backendMetrics) remove(service string) {
+	m.ttfb.DeleteLabelValues(service)
+	m.duration.DeleteLabelValues(service)
+	m.bytesSent.DeleteLabelValues(service)
+	m.bytesReceived.DeleteLabelValues(service)
+	m.serverErrors.DeletePartialMatch(prometheus.Labels{"service": service})
+}
+
+// Describe implements prometheus.Collector, so the proxy can be registered with a
+// Prometheus registry
+func (p *ProxyHandler) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range p.backendMetrics.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (p *ProxyHandler) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range p.backendMetrics.collectors() {
+		collector.Collect(ch)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestBackendTimingLogged(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	}))
+	defer backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{Services: map[string]config.ServiceEndpoint{"users": {BaseURL: backend.URL}}}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	defer proxy.Close()
+
+	core, logs := observer.New(zap.InfoLevel)
+	router := gin.New()
+	router.Use(middleware.Logger(zap.New(core), cfg))
+	router.Any("/svc/*path", proxy.ProxyToService("users"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	resp, err := http.Post(gateway.URL+"/svc/orders", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	entries := logs.FilterMessage("Request completed").All()
+	if !assert.Len(t, entries, 1) {
+		return
+	}
+	fields := entries[0].ContextMap()
+	assert.EqualValues(t, 1000, fields["response_size"])
+	assert.EqualValues(t, 5, fields["backend_bytes_sent"])
+	assert.EqualValues(t, 1000, fields["backend_bytes_received"])
+
+	durations := make(map[string]time.Duration)
+	for _, field := range entries[0].Context {
+		if field.Type == zapcore.DurationType {
+			durations[field.Key] = time.Duration(field.Integer)
+		}
+	}
+	assert.GreaterOrEqual(t, durations["backend_ttfb"], 20*time.Millisecond)
+	assert.GreaterOrEqual(t, durations["backend_latency"], durations["backend_ttfb"])
+	assert.GreaterOrEqual(t, durations["latency"], durations["backend_latency"])
+	assert.Equal(t, durations["latency"]-durations["backend_latency"], durations["gateway_latency"])
+
+	assert.Equal(t, float64(1000), testutil.ToFloat64(proxy.backendMetrics.bytesReceived.WithLabelValues("users")))
+	assert.Equal(t, 1, testutil.CollectAndCount(proxy, "gateway_backend_ttfb_seconds"))
+}
+
+func TestUpstreamServerErrorsLabelled(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"database connection lost","trace":"..."}`))
+	}))
+	defer backend.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Logging: config.LoggingConfig{UpstreamErrorBodyBytes: 35},
+		Services: map[string]config.ServiceEndpoint{
+			"users":  {BaseURL: backend.URL},
+			"orders": {BaseURL: down.URL},
+		},
+	}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	defer proxy.Close()
+
+	core, logs := observer.New(zap.InfoLevel)
+	router := gin.New()
+	router.Use(middleware.Logger(zap.New(core), cfg))
+	router.Any("/users/*path", proxy.ProxyToService("users"))
+	router.Any("/orders/*path", proxy.ProxyToService("orders"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(gateway.URL + path)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// The backend's error reaches the client unchanged
+	status, body := get("/users/1")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, `{"error":"database connection lost","trace":"..."}`, body)
+
+	status, _ = get("/orders/1")
+	assert.Equal(t, http.StatusBadGateway, status)
+
+	entries := logs.FilterMessage("Server error").All()
+	if !assert.Len(t, entries, 2) {
+		return
+	}
+	upstream, generated := entries[0].ContextMap(), entries[1].ContextMap()
+	assert.Equal(t, "users", upstream["service"])
+	assert.Equal(t, true, upstream["upstream_error"])
+	assert.Equal(t, `{"error":"database connection lost"`, upstream["upstream_error_body"])
+	assert.Equal(t, "orders", generated["service"])
+	assert.Equal(t, false, generated["upstream_error"])
+	assert.NotContains(t, generated, "upstream_error_body")
+
+	errors := proxy.backendMetrics.serverErrors
+	assert.Equal(t, 1.0, testutil.ToFloat64(errors.WithLabelValues("users", "true")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(errors.WithLabelValues("users", "false")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(errors.WithLabelValues("orders", "false")))
+}
+
+func TestUpstreamErrorBodyStreamed(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("warming up"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Logging:  config.LoggingConfig{UpstreamErrorBodyBytes: 1024},
+		Services: map[string]config.ServiceEndpoint{"users": {BaseURL: backend.URL}},
+	}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	defer proxy.Close()
+	router := gin.New()
+	router.Any("/users/*path", proxy.ProxyToService("users"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	// The status arrives while the backend is still sending the body, though less than
+	// the capture limit has been read
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(gateway.URL + "/users/1")
+	if err != nil {
+		t.Fatalf("response held back: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
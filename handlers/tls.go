@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/api-gateway/config"
+	"go.uber.org/zap"
+)
+
+// ServerTLS terminates TLS for client connections. The certificate is reloaded when
+// its files change, so renewals don't need a restart.
+type ServerTLS struct {
+	cfg       config.TLSConfig
+	logger    *zap.Logger
+	clientCAs *x509.CertPool // Verifies client certificates; nil when none are requested
+	cert      atomic.Pointer[tls.Certificate]
+	loadedAt  time.Time // Latest modification time of the loaded files
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewServerTLS loads the configured certificate and starts watching its files
+func NewServerTLS(cfg config.TLSConfig, logger *zap.Logger) (*ServerTLS, error) {
+	s := &ServerTLS{
+		cfg:    cfg,
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+	if _, err := cipherSuites(cfg.CipherSuites); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		s.clientCAs = x509.NewCertPool()
+		if !s.clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", cfg.ClientCAFile)
+		}
+	}
+
+	if cfg.ReloadInterval > 0 {
+		go s.watch(cfg.ReloadInterval)
+	}
+	return s, nil
+}
+
+// Configure sets up srv to terminate TLS. HTTP/2 is only served when ALPN offers "h2".
+// With a client CA, client certificates are requested and verified when presented.
+func (s *ServerTLS) Configure(srv *http.Server) {
+	suites, _ := cipherSuites(s.cfg.CipherSuites)
+	srv.TLSConfig = &tls.Config{
+		MinVersion:     tlsVersion(s.cfg.MinVersion),
+		CipherSuites:   suites,
+		NextProtos:     s.cfg.ALPN,
+		GetCertificate: s.getCertificate,
+	}
+	if s.clientCAs != nil {
+		srv.TLSConfig.ClientCAs = s.clientCAs
+		srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	hasH2 := false
+	for _, proto := range s.cfg.ALPN {
+		if proto == "h2" {
+			hasH2 = true
+		}
+	}
+	if !hasH2 {
+		// A non-nil map keeps net/http from enabling HTTP/2 on its own
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+}
+
+// Close stops watching the certificate files
+func (s *ServerTLS) Close() {
+	s.closeOnce.Do(func() { close(s.stop) })
+}
+
+func (s *ServerTLS) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.cert.Load(), nil
+}
+
+// load reads the certificate and key
+func (s *ServerTLS) load() error {
+	modTime, err := s.modTime()
+	if err != nil {
+		return fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(s.cfg.CertFile, s.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	s.cert.Store(&cert)
+	s.loadedAt = modTime
+	return nil
+}
+
+// modTime returns the latest modification time of the certificate and key files
+func (s *ServerTLS) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{s.cfg.CertFile, s.cfg.KeyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// watch reloads the certificate when its files change. A certificate that fails to
+// load, e.g. while only one of the files has been replaced, is retried on the next
+// check; the previous certificate is served meanwhile.
+func (s *ServerTLS) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := s.modTime()
+		if err != nil || modTime.Equal(s.loadedAt) {
+			continue
+		}
+		if err := s.load(); err != nil {
+			s.logger.Warn("Keeping the current TLS certificate", zap.Error(err))
+			continue
+		}
+		s.logger.Info("TLS certificate reloaded", zap.String("cert_file", s.cfg.CertFile))
+	}
+}
+
+// tlsVersion maps a configured minimum version to its constant, TLS 1.2 by default
+func tlsVersion(version string) uint16 {
+	if version == "1.3" {
+		return tls.VersionTLS13
+	}
+	return tls.VersionTLS12
+}
+
+// cipherSuites resolves cipher suite names; nil leaves the choice to Go
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// RedirectToHTTPS returns a handler redirecting plaintext requests to the same URL over
+// HTTPS on httpsPort. 308 keeps the method and body of non-GET requests.
+func RedirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 with the given
+// serial number to dir and returns it
+func writeSelfSignedCert(t *testing.T, dir string, serial int64) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "gateway-test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), certPEM, 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), keyPEM, 0o600))
+
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+// startTLSServer serves an OK handler with TLS terminated by serverTLS
+func startTLSServer(t *testing.T, serverTLS *ServerTLS) string {
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})}
+	serverTLS.Configure(srv)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return "https://" + ln.Addr().String()
+}
+
+// tlsClient trusts cert and offers HTTP/2
+func tlsClient(cert *x509.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+}
+
+func newTestServerTLS(t *testing.T, dir string, cfg config.TLSConfig) *ServerTLS {
+	cfg.Enabled = true
+	cfg.CertFile = filepath.Join(dir, "tls.crt")
+	cfg.KeyFile = filepath.Join(dir, "tls.key")
+	serverTLS, err := NewServerTLS(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("failed to set up TLS: %v", err)
+	}
+	t.Cleanup(serverTLS.Close)
+	return serverTLS
+}
+
+func TestServerTLS(t *testing.T) {
+	tests := []struct {
+		name      string
+		alpn      []string
+		wantProto int
+	}{
+		{"http2", []string{"h2", "http/1.1"}, 2},
+		{"http1 only", []string{"http/1.1"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cert := writeSelfSignedCert(t, dir, 1)
+			url := startTLSServer(t, newTestServerTLS(t, dir, config.TLSConfig{ALPN: tt.alpn}))
+
+			resp, err := tlsClient(cert).Get(url)
+			if err != nil {
+				t.Fatalf("TLS request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.wantProto, resp.ProtoMajor)
+			assert.Equal(t, uint16(tls.VersionTLS13), resp.TLS.Version)
+		})
+	}
+}
+
+func TestServerTLSReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	writeSelfSignedCert(t, dir, 1)
+	serverTLS := newTestServerTLS(t, dir, config.TLSConfig{ReloadInterval: 10 * time.Millisecond})
+
+	renewed := writeSelfSignedCert(t, dir, 2)
+	later := time.Now().Add(time.Minute)
+	for _, file := range []string{"tls.crt", "tls.key"} {
+		assert.NoError(t, os.Chtimes(filepath.Join(dir, file), later, later))
+	}
+
+	assert.Eventually(t, func() bool {
+		cert, _ := serverTLS.getCertificate(nil)
+		return bytes.Equal(cert.Certificate[0], renewed.Raw)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestServerTLSRejectsUnknownCipherSuite(t *testing.T) {
+	dir := t.TempDir()
+	writeSelfSignedCert(t, dir, 1)
+
+	_, err := NewServerTLS(config.TLSConfig{
+		Enabled:      true,
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"},
+	}, zap.NewNop())
+	assert.Error(t, err)
+}
+
+func TestServerTLSClientCA(t *testing.T) {
+	dir := t.TempDir()
+	cert := writeSelfSignedCert(t, dir, 1)
+	serverTLS := newTestServerTLS(t, dir, config.TLSConfig{ClientCAFile: filepath.Join(dir, "tls.crt")})
+
+	srv := &http.Server{}
+	serverTLS.Configure(srv)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, srv.TLSConfig.ClientAuth)
+	assert.True(t, srv.TLSConfig.ClientCAs.Equal(func() *x509.CertPool {
+		pool := x509.NewCertPool()
+		pool.AddCert(cert)
+		return pool
+	}()))
+
+	// Clients without a certificate still connect
+	resp, err := tlsClient(cert).Get(startTLSServer(t, serverTLS))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	_, err = NewServerTLS(config.TLSConfig{
+		Enabled:      true,
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "tls.key"),
+	}, zap.NewNop())
+	assert.ErrorContains(t, err, "no certificates found in client CA file")
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		host      string
+		httpsPort int
+		want      string
+	}{
+		{"example.com", 443, "https://example.com/a?b=c"},
+		{"example.com:80", 8443, "https://example.com:8443/a?b=c"},
+		{"[::1]:80", 443, "https://[::1]/a?b=c"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "http://"+tt.host+"/a?b=c", nil)
+		w := httptest.NewRecorder()
+		RedirectToHTTPS(tt.httpsPort).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+		assert.Equal(t, tt.want, w.Header().Get("Location"))
+	}
+}
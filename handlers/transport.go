@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/api-gateway/config"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Connection pool defaults for service transports. Go's default of two idle
+// connections per host makes a busy backend reopen connections constantly.
+const (
+	defaultMaxIdleConns        = 512
+	defaultMaxIdleConnsPerHost = 64
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultDialTimeout         = 5 * time.Second
+	defaultTLSHandshakeTimeout = 5 * time.Second
+)
+
+// newServiceTransport builds the HTTP transport used to reach a backend service.
+// Followed redirects are signed with signing when it is enabled.
+func newServiceTransport(endpoint config.ServiceEndpoint, signing config.GatewaySigningConfig) (http.RoundTripper, error) {
+	transport, err := newHTTPTransport(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// Response headers are awaited by headerTimeoutTransport instead, so that a trusted
+	// caller's timeout override can raise the bound for its request
+	var base http.RoundTripper = transport
+	if transport.ResponseHeaderTimeout > 0 {
+		base = &headerTimeoutTransport{next: transport, timeout: transport.ResponseHeaderTimeout}
+		transport.ResponseHeaderTimeout = 0
+	}
+
+	var roundTripper http.RoundTripper = &idleConnRetryTransport{next: base}
+	if endpoint.Retry.Attempts > 0 {
+		roundTripper = newRetryTransport(roundTripper, endpoint.Retry)
+	}
+	if hops := endpoint.Redirect.Hops(endpoint.MaxRedirects); hops > 0 {
+		roundTripper = &redirectTransport{next: roundTripper, maxRedirects: hops, signing: signing}
+	}
+
+	return roundTripper, nil
+}
+
+// newHTTPTransport builds the dedicated connection pool for a backend service
+func newHTTPTransport(endpoint config.ServiceEndpoint) (*http.Transport, error) {
+	tuning := endpoint.Transport
+	dialTimeout := durationOr(tuning.DialTimeout, defaultDialTimeout)
+	tlsHandshakeTimeout := durationOr(tuning.TLSHandshakeTimeout, defaultTLSHandshakeTimeout)
+	if endpoint.ConnectTimeout > 0 {
+		dialTimeout, tlsHandshakeTimeout = endpoint.ConnectTimeout, endpoint.ConnectTimeout
+	}
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.MaxIdleConns = intOr(tuning.MaxIdleConns, defaultMaxIdleConns)
+	transport.MaxIdleConnsPerHost = intOr(tuning.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost)
+	transport.MaxConnsPerHost = tuning.MaxConnsPerHost
+	transport.IdleConnTimeout = durationOr(tuning.IdleConnTimeout, defaultIdleConnTimeout)
+	transport.TLSHandshakeTimeout = tlsHandshakeTimeout
+	transport.ResponseHeaderTimeout = endpoint.ResponseHeaderTimeout
+
+	tlsConfig, err := upstreamTLSConfig(endpoint.TLS)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if endpoint.EgressProxy.URL != "" {
+		proxyFunc, err := egressProxyFunc(endpoint.EgressProxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = proxyFunc
+	}
+
+	return transport, nil
+}
+
+// intOr returns value, or fallback when value is zero
+func intOr(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+// durationOr returns value, or fallback when value is zero
+func durationOr(value, fallback time.Duration) time.Duration {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+// upstreamTLSConfig builds the TLS client configuration for a backend: an optional
+// private CA bundle replacing the system roots, a client certificate for mutual TLS
+// and a server name override. It returns nil when nothing is configured.
+func upstreamTLSConfig(cfg config.UpstreamTLSConfig) (*tls.Config, error) {
+	if cfg == (config.UpstreamTLSConfig{}) {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// egressProxyFunc returns a transport proxy function that routes requests through
+// the configured egress proxy, honoring NO_PROXY rules
+func egressProxyFunc(cfg config.EgressProxyConfig) (func(*http.Request) (*url.URL, error), error) {
+	proxyURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid egress proxy url: %w", err)
+	}
+
+	// Credentials in the proxy URL are sent as Proxy-Authorization by the transport
+	if cfg.Username != "" {
+		proxyURL.User = url.UserPassword(cfg.Username, cfg.Password)
+	}
+
+	noProxy := cfg.NoProxy
+	if noProxy == "" {
+		noProxy = os.Getenv("NO_PROXY")
+		if noProxy == "" {
+			noProxy = os.Getenv("no_proxy")
+		}
+	}
+
+	proxyConfig := &httpproxy.Config{
+		HTTPProxy:  proxyURL.String(),
+		HTTPSProxy: proxyURL.String(),
+		NoProxy:    noProxy,
+	}
+	resolve := proxyConfig.ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return resolve(req.URL)
+	}, nil
+}
+
+// errResponseHeaderTimeout is returned when a backend's response headers don't arrive
+// in time; it is a net.Error timeout like http.Transport's own
+var errResponseHeaderTimeout error = headerTimeoutError{}
+
+type headerTimeoutError struct{}
+
+func (headerTimeoutError) Error() string   { return "net/http: timeout awaiting response headers" }
+func (headerTimeoutError) Timeout() bool   { return true }
+func (headerTimeoutError) Temporary() bool { return true }
+
+// headerTimeoutTransport bounds the wait for response headers once the request has been
+// written, like http.Transport.ResponseHeaderTimeout, except that a timeout override
+// on the request (see withTimeoutOverride) raises the bound to match
+type headerTimeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *headerTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout := t.timeout
+	if override, ok := timeoutOverrideFrom(req.Context()); ok && override > timeout {
+		timeout = override
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	var (
+		mu      sync.Mutex
+		timer   *time.Timer
+		done    bool
+		expired atomic.Bool
+	)
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !done {
+				timer = time.AfterFunc(timeout, func() {
+					expired.Store(true)
+					cancel()
+				})
+			}
+		},
+	}
+
+	resp, err := t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(ctx, trace)))
+	mu.Lock()
+	done = true
+	if timer != nil {
+		timer.Stop()
+	}
+	mu.Unlock()
+
+	if expired.Load() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, errResponseHeaderTimeout
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelingBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// idleConnRetryTransport retries an idempotent request once when it fails because the
+// backend closed a reused keep-alive connection before sending a response. This masks
+// the race between the transport picking an idle connection and the server timing it
+// out; it is deliberately narrower than a general retry policy.
+type idleConnRetryTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *idleConnRetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reused := false
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused = info.Reused
+		},
+	}
+
+	resp, err := t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err == nil || !reused || !isClosedConnError(err) || req.Context().Err() != nil {
+		return resp, err
+	}
+
+	retry, ok := replayableRequest(req)
+	if !ok {
+		return resp, err
+	}
+	return t.next.RoundTrip(retry)
+}
+
+// replayableMethod reports whether a request is idempotent, by its method or an
+// Idempotency-Key header, so it may be sent again
+func replayableMethod(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// replayableRequest returns a copy of an idempotent request that can safely be sent again
+func replayableRequest(req *http.Request) (*http.Request, bool) {
+	if !replayableMethod(req) {
+		return nil, false
+	}
+
+	retry := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, false
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, false
+		}
+		retry.Body = body
+	}
+	return retry, true
+}
+
+// isClosedConnError reports whether err means the connection was closed before a response arrived
+func isClosedConnError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	// The transport does not export its idle-close error
+	return strings.Contains(err.Error(), "server closed idle connection")
+}
+
+// errRedirectLoop is returned when a backend redirects back to an already visited URL
+var errRedirectLoop = errors.New("backend redirect loop detected")
+
+// redirectTransport follows a bounded number of backend redirects server-side.
+// Redirects to another host, or that cannot be replayed, are passed through to the client.
+type redirectTransport struct {
+	next         http.RoundTripper
+	maxRedirects int
+	signing      config.GatewaySigningConfig
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	visited := map[string]bool{req.URL.String(): true}
+
+	for hops := 0; ; hops++ {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || hops >= t.maxRedirects || !isRedirect(resp.StatusCode) {
+			return resp, err
+		}
+
+		location, err := resp.Location()
+		if err != nil {
+			return resp, nil
+		}
+
+		// Never follow redirects that leave the backend host
+		if location.Scheme != req.URL.Scheme || location.Host != req.URL.Host {
+			return resp, nil
+		}
+
+		next, ok := redirectRequest(req, resp.StatusCode, location)
+		if !ok {
+			return resp, nil
+		}
+
+		if visited[location.String()] {
+			drainAndClose(resp.Body)
+			return nil, errRedirectLoop
+		}
+		visited[location.String()] = true
+
+		// The gateway signature covers the method and path the redirect changed
+		if t.signing.Enabled {
+			signRequest(next, t.signing, time.Now())
+		}
+
+		drainAndClose(resp.Body)
+		req = next
+	}
+}
+
+// redirectRequest builds the follow-up request for a redirect, following the same
+// method rules as http.Client. It reports false when the body cannot be replayed.
+func redirectRequest(req *http.Request, status int, location *url.URL) (*http.Request, bool) {
+	next := req.Clone(req.Context())
+	// The location is on the same backend host, so keep the Host chosen by modifyRequest
+	next.URL = location
+
+	hasBody := req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0
+	switch {
+	case status == http.StatusSeeOther || ((status == http.StatusMovedPermanently || status == http.StatusFound) && req.Method == http.MethodPost):
+		if req.Method != http.MethodHead {
+			next.Method = http.MethodGet
+		}
+		next.Body = nil
+		next.ContentLength = 0
+		next.Header.Del("Content-Type")
+		next.Header.Del("Content-Length")
+	case hasBody:
+		if req.GetBody == nil {
+			return nil, false
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, false
+		}
+		next.Body = body
+	}
+
+	return next, true
+}
+
+// isRedirect reports whether the status code is a followable redirect
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// drainAndClose discards a small remainder of the body so the connection can be reused
+func drainAndClose(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, 4096))
+	body.Close()
+}
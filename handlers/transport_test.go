@@ -0,0 +1,624 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestEgressProxyRoutesRequests(t *testing.T) {
+	// Fake forward proxy: records the proxied request and answers on behalf of the backend
+	var proxiedURL, proxyAuth string
+	fakeProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedURL = r.URL.String()
+		proxyAuth = r.Header.Get("Proxy-Authorization")
+		w.Write([]byte("via proxy"))
+	}))
+	defer fakeProxy.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"backend": {
+				BaseURL: "http://backend.internal:8080",
+				EgressProxy: config.EgressProxyConfig{
+					URL:      fakeProxy.URL,
+					Username: "gateway",
+					Password: "s3cret",
+				},
+			},
+		},
+	}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.GET("/backend/*path", proxy.ProxyToService("backend"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	status, body := gatewayGet(t, gateway, "/backend/items?page=2")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "via proxy", body)
+	assert.Equal(t, "http://backend.internal:8080/items?page=2", proxiedURL)
+	assert.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("gateway:s3cret")), proxyAuth)
+}
+
+func TestEgressProxyRespectsNoProxy(t *testing.T) {
+	proxyFunc, err := egressProxyFunc(config.EgressProxyConfig{
+		URL:     "http://proxy.corp:3128",
+		NoProxy: "internal.corp,.svc.cluster.local",
+	})
+	assert.NoError(t, err)
+
+	for target, wantProxy := range map[string]bool{
+		"http://api.example.com/":                true,
+		"http://internal.corp/":                  false,
+		"http://users.default.svc.cluster.local": false,
+	} {
+		u, _ := url.Parse(target)
+		proxyURL, err := proxyFunc(&http.Request{URL: u})
+		assert.NoError(t, err)
+		assert.Equal(t, wantProxy, proxyURL != nil, target)
+	}
+}
+
+func TestRedirectFollowing(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("other host"))
+	}))
+	defer other.Close()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusFound)
+		case "/new":
+			w.Write([]byte("new content"))
+		case "/loop-a":
+			http.Redirect(w, r, "/loop-b", http.StatusFound)
+		case "/loop-b":
+			http.Redirect(w, r, "/loop-a", http.StatusFound)
+		case "/external":
+			http.Redirect(w, r, other.URL+"/landing", http.StatusFound)
+		}
+	}))
+	defer backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"following":   {BaseURL: backend.URL, MaxRedirects: 3},
+			"passthrough": {BaseURL: backend.URL},
+		},
+	}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.GET("/following/*path", proxy.ProxyToService("following"))
+	router.GET("/passthrough/*path", proxy.ProxyToService("passthrough"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	get := func(path string) *http.Response {
+		resp, err := client.Get(gateway.URL + path)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	status, body := gatewayGet(t, gateway, "/following/old")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "new content", body)
+
+	assert.Equal(t, http.StatusFound, get("/passthrough/old").StatusCode)
+	assert.Equal(t, http.StatusBadGateway, get("/following/loop-a").StatusCode)
+
+	resp := get("/following/external")
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, other.URL+"/landing", resp.Header.Get("Location"))
+}
+
+func TestRedirectFollowingKeepsHostHeader(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		w.Write([]byte(r.Host))
+	}))
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"backend": {BaseURL: backend.URL, HostHeader: "tenant-a.internal.example", MaxRedirects: 3},
+		},
+	}, "backend")
+
+	status, body := gatewayGet(t, gateway, "/svc/old")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "tenant-a.internal.example", body)
+}
+
+// staleConnTransport fails the first request as if a reused keep-alive connection
+// had been closed by the backend, then delegates to next
+type staleConnTransport struct {
+	next  http.RoundTripper
+	calls int
+}
+
+func (t *staleConnTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	if t.calls == 1 {
+		if trace := httptrace.ContextClientTrace(req.Context()); trace != nil && trace.GotConn != nil {
+			trace.GotConn(httptrace.GotConnInfo{Reused: true})
+		}
+		return nil, io.EOF
+	}
+	return t.next.RoundTrip(req)
+}
+
+func TestIdleConnRetryTransport(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	for _, tt := range []struct {
+		method    string
+		header    string
+		wantCalls int
+		wantErr   bool
+	}{
+		{http.MethodGet, "", 2, false},
+		{http.MethodPost, "", 1, true},
+		{http.MethodPost, "key-123", 2, false},
+	} {
+		stale := &staleConnTransport{next: http.DefaultTransport}
+		transport := &idleConnRetryTransport{next: stale}
+
+		req, _ := http.NewRequest(tt.method, backend.URL, nil)
+		if tt.header != "" {
+			req.Header.Set("Idempotency-Key", tt.header)
+		}
+		resp, err := transport.RoundTrip(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		assert.Equal(t, tt.wantErr, err != nil, tt.method)
+		assert.Equal(t, tt.wantCalls, stale.calls, tt.method)
+	}
+}
+
+func TestIdleConnRetryMasksServerClose(t *testing.T) {
+	// Backend that advertises keep-alive but drops every second request on a connection
+	// without answering, the way a server closes an idle connection the client is reusing
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				req, err := http.ReadRequest(reader)
+				if err != nil {
+					return
+				}
+				io.Copy(io.Discard, req.Body)
+				io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: keep-alive\r\n\r\nok")
+				http.ReadRequest(reader)
+			}(conn)
+		}
+	}()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"backend": {BaseURL: "http://" + listener.Addr().String()},
+		},
+	}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.GET("/backend/*path", proxy.ProxyToService("backend"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	for i := 0; i < 5; i++ {
+		status, body := gatewayGet(t, gateway, "/backend/items")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "ok", body)
+	}
+}
+
+// testCA is a throwaway certificate authority for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a leaf certificate for a server (with the given DNS name) or a client
+func (ca *testCA) issue(t *testing.T, serial int64, dnsName string, usage x509.ExtKeyUsage) (tls.Certificate, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	if dnsName != "" {
+		template.DNSNames = []string{dnsName}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	assert.NoError(t, err)
+	return cert, certPEM, keyPEM
+}
+
+// writeTestFile writes data to a file in the test's temporary directory
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+// newPrivateTLSBackend starts an HTTPS backend with a certificate for backend.internal
+// issued by the CA, optionally requiring a client certificate from the same CA
+func newPrivateTLSBackend(t *testing.T, ca *testCA, requireClientCert bool) *httptest.Server {
+	serverCert, _, _ := ca.issue(t, 2, "backend.internal", x509.ExtKeyUsageServerAuth)
+
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure backend"))
+	}))
+	backend.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	if requireClientCert {
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.cert)
+		backend.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+		backend.TLS.ClientCAs = pool
+	}
+	backend.StartTLS()
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func TestUpstreamTLSCustomCA(t *testing.T) {
+	ca := newTestCA(t)
+	backend := newPrivateTLSBackend(t, ca, false)
+	caFile := writeTestFile(t, "ca.pem", ca.pem)
+
+	tests := []struct {
+		name       string
+		tls        config.UpstreamTLSConfig
+		wantStatus int
+	}{
+		{"system roots", config.UpstreamTLSConfig{ServerName: "backend.internal"}, http.StatusBadGateway},
+		{"custom CA", config.UpstreamTLSConfig{CAFile: caFile, ServerName: "backend.internal"}, http.StatusOK},
+		{"wrong server name", config.UpstreamTLSConfig{CAFile: caFile, ServerName: "other.internal"}, http.StatusBadGateway},
+		{"insecure skip verify", config.UpstreamTLSConfig{InsecureSkipVerify: true}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway, _ := setupServiceGateway(t, &config.Config{
+				Services: map[string]config.ServiceEndpoint{"secure": {BaseURL: backend.URL, TLS: tt.tls}},
+			}, "secure")
+
+			status, body := gatewayGet(t, gateway, "/svc/")
+			assert.Equal(t, tt.wantStatus, status)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, "secure backend", body)
+			}
+		})
+	}
+}
+
+func TestUpstreamMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	backend := newPrivateTLSBackend(t, ca, true)
+	_, certPEM, keyPEM := ca.issue(t, 3, "", x509.ExtKeyUsageClientAuth)
+
+	caFile := writeTestFile(t, "ca.pem", ca.pem)
+	certFile := writeTestFile(t, "client.pem", certPEM)
+	keyFile := writeTestFile(t, "client-key.pem", keyPEM)
+
+	withoutCert, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"secure": {
+			BaseURL: backend.URL,
+			TLS:     config.UpstreamTLSConfig{CAFile: caFile, ServerName: "backend.internal"},
+		}},
+	}, "secure")
+	status, _ := gatewayGet(t, withoutCert, "/svc/")
+	assert.Equal(t, http.StatusBadGateway, status)
+
+	withCert, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"secure": {
+			BaseURL: backend.URL,
+			TLS: config.UpstreamTLSConfig{
+				CAFile:     caFile,
+				CertFile:   certFile,
+				KeyFile:    keyFile,
+				ServerName: "backend.internal",
+			},
+		}},
+	}, "secure")
+	status, body := gatewayGet(t, withCert, "/svc/")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "secure backend", body)
+}
+
+func TestUpstreamTLSConfigErrors(t *testing.T) {
+	_, err := upstreamTLSConfig(config.UpstreamTLSConfig{CAFile: "/nonexistent/ca.pem"})
+	assert.Error(t, err)
+
+	_, err = upstreamTLSConfig(config.UpstreamTLSConfig{CAFile: writeTestFile(t, "empty.pem", []byte("not a certificate"))})
+	assert.Error(t, err)
+
+	tlsConfig, err := upstreamTLSConfig(config.UpstreamTLSConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+}
+
+func TestTransportTuningApplied(t *testing.T) {
+	transport, err := newHTTPTransport(config.ServiceEndpoint{
+		Transport: config.TransportConfig{
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 32,
+			MaxConnsPerHost:     48,
+			IdleConnTimeout:     30 * time.Second,
+			TLSHandshakeTimeout: 2 * time.Second,
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 100, transport.MaxIdleConns)
+	assert.Equal(t, 32, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 48, transport.MaxConnsPerHost)
+	assert.Equal(t, 30*time.Second, transport.IdleConnTimeout)
+	assert.Equal(t, 2*time.Second, transport.TLSHandshakeTimeout)
+}
+
+func TestTransportTuningDefaults(t *testing.T) {
+	transport, err := newHTTPTransport(config.ServiceEndpoint{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, defaultMaxIdleConns, transport.MaxIdleConns)
+	assert.Equal(t, defaultMaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 0, transport.MaxConnsPerHost)
+	assert.Equal(t, defaultIdleConnTimeout, transport.IdleConnTimeout)
+	assert.Equal(t, defaultTLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+	assert.NotSame(t, http.DefaultTransport, transport)
+}
+
+// BenchmarkSingleHostThroughput sends bursts of concurrent requests to one backend,
+// comparing Go's default of two idle connections per host with the gateway default.
+// With a small idle pool most connections are closed between bursts and redialed.
+func BenchmarkSingleHostThroughput(b *testing.B) {
+	const burst = 32
+
+	var newConns atomic.Int64
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	for _, perHost := range []int{2, defaultMaxIdleConnsPerHost} {
+		b.Run(fmt.Sprintf("max_idle_conns_per_host=%d", perHost), func(b *testing.B) {
+			transport, err := newHTTPTransport(config.ServiceEndpoint{
+				Transport: config.TransportConfig{MaxIdleConnsPerHost: perHost},
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer transport.CloseIdleConnections()
+			client := &http.Client{Transport: transport}
+
+			newConns.Store(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for j := 0; j < burst; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						resp, err := client.Get(backend.URL)
+						if err != nil {
+							b.Error(err)
+							return
+						}
+						io.Copy(io.Discard, resp.Body)
+						resp.Body.Close()
+					}()
+				}
+				wg.Wait()
+			}
+			b.ReportMetric(float64(newConns.Load())/float64(b.N), "conns/burst")
+		})
+	}
+}
+
+func TestConnectTimeoutOverridesTransportTuning(t *testing.T) {
+	transport, err := newHTTPTransport(config.ServiceEndpoint{
+		ConnectTimeout:        250 * time.Millisecond,
+		ResponseHeaderTimeout: time.Second,
+		Transport:             config.TransportConfig{TLSHandshakeTimeout: 2 * time.Second},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 250*time.Millisecond, transport.TLSHandshakeTimeout)
+	assert.Equal(t, time.Second, transport.ResponseHeaderTimeout)
+}
+
+// newSilentListener accepts connections and never answers, like a backend stuck in a
+// TLS handshake
+func newSilentListener(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestConnectTimeoutFailsFast(t *testing.T) {
+	addr := newSilentListener(t)
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"backend": {BaseURL: "https://" + addr, Timeout: 10 * time.Second, ConnectTimeout: 100 * time.Millisecond},
+		},
+	}, "backend")
+
+	start := time.Now()
+	resp, err := http.Get(gateway.URL + "/svc/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"backend": {BaseURL: backend.URL, ResponseHeaderTimeout: 100 * time.Millisecond},
+		},
+	}, "backend")
+
+	start := time.Now()
+	resp, err := http.Get(gateway.URL + "/svc/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+// newSlowStreamBackend sends headers at once, then a chunk every interval
+func newSlowStreamBackend(chunks int, interval time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for i := 0; i < chunks; i++ {
+			time.Sleep(interval)
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+func TestSlowStreamOutlivesResponseHeaderTimeout(t *testing.T) {
+	backend := newSlowStreamBackend(5, 100*time.Millisecond)
+	defer backend.Close()
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"backend": {BaseURL: backend.URL, ConnectTimeout: 100 * time.Millisecond, ResponseHeaderTimeout: 100 * time.Millisecond},
+		},
+	}, "backend")
+
+	resp, err := http.Get(gateway.URL + "/svc/events")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 5, strings.Count(string(body), "data: "))
+}
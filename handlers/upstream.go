@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/api-gateway/config"
+	"golang.org/x/net/idna"
+)
+
+// upstreamContextKey is the request context key for the selected upstream
+type upstreamContextKey struct{}
+
+// upstream represents a single backend instance of a service
+type upstream struct {
+	url    *url.URL
+	weight int
+	id     string // Opaque, stable identifier for affinity cookies
+	// removed is closed once discovery drops the upstream from its pool; nil for
+	// upstreams outside a pool
+	removed chan struct{}
+
+	healthy     atomic.Bool
+	mu          sync.Mutex
+	successes   int
+	failures    int
+	lastChecked time.Time
+	lastError   string
+}
+
+// UpstreamStatus describes the health of a single backend instance
+type UpstreamStatus struct {
+	URL         string `json:"url"`
+	Healthy     bool   `json:"healthy"`
+	LastChecked string `json:"last_checked,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+// upstreamPool load-balances requests across the instances of a service
+// using smooth weighted round-robin, skipping instances marked down
+type upstreamPool struct {
+	upstreams       []*upstream // Replaced, never modified, when discovery updates the pool
+	mu              sync.Mutex
+	current         []int
+	keepTrailingDot bool
+	onAdd           []func(*upstream) // Called for upstreams discovery adds to the pool
+}
+
+// newUpstreamPool builds the pool for a service from its base URL and additional upstreams
+func newUpstreamPool(endpoint config.ServiceEndpoint) (*upstreamPool, error) {
+	pool := &upstreamPool{keepTrailingDot: endpoint.KeepTrailingDot}
+
+	for _, u := range staticUpstreams(endpoint) {
+		if err := pool.add(u.URL, u.Weight); err != nil {
+			return nil, err
+		}
+	}
+
+	// Discovered services may start empty and fill in on the first lookup
+	if len(pool.upstreams) == 0 && !endpoint.Discovery.Enabled() {
+		return nil, fmt.Errorf("no upstream configured")
+	}
+
+	pool.current = make([]int, len(pool.upstreams))
+	return pool, nil
+}
+
+// add parses and appends an upstream to the pool
+func (p *upstreamPool) add(rawURL string, weight int) error {
+	target, err := parseBackendURL(rawURL, p.keepTrailingDot)
+	if err != nil {
+		return err
+	}
+	if weight <= 0 {
+		weight = 1
+	}
+
+	p.upstreams = append(p.upstreams, newPoolUpstream(target, weight))
+	return nil
+}
+
+// newPoolUpstream returns a healthy upstream for a pool
+func newPoolUpstream(target *url.URL, weight int) *upstream {
+	u := &upstream{url: target, weight: weight, id: upstreamID(target), removed: make(chan struct{})}
+	u.healthy.Store(true)
+	return u
+}
+
+// members returns the upstreams currently in the pool
+func (p *upstreamPool) members() []*upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.upstreams
+}
+
+// watch registers fn to be called for every upstream added to the pool later, and
+// returns the upstreams in the pool now
+func (p *upstreamPool) watch(fn func(*upstream)) []*upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onAdd = append(p.onAdd, fn)
+	return p.upstreams
+}
+
+// update replaces the instances of the pool with endpoints. Instances that stay keep
+// their health and balancing state; removed ones are signalled through their removed
+// channel. It returns the number of instances added and removed.
+func (p *upstreamPool) update(endpoints []config.UpstreamEndpoint) (added, removed int, err error) {
+	type candidate struct {
+		url    *url.URL
+		weight int
+	}
+	candidates := make([]candidate, 0, len(endpoints))
+	seen := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		target, err := parseBackendURL(endpoint.URL, p.keepTrailingDot)
+		if err != nil {
+			return 0, 0, err
+		}
+		if seen[target.String()] {
+			continue
+		}
+		seen[target.String()] = true
+		candidates = append(candidates, candidate{url: target, weight: max(endpoint.Weight, 1)})
+	}
+
+	p.mu.Lock()
+	existing := make(map[string]int, len(p.upstreams))
+	for i, u := range p.upstreams {
+		existing[u.url.String()] = i
+	}
+
+	upstreams := make([]*upstream, 0, len(candidates))
+	current := make([]int, 0, len(candidates))
+	var fresh []*upstream
+	for _, cand := range candidates {
+		if i, ok := existing[cand.url.String()]; ok {
+			u := p.upstreams[i]
+			u.weight = cand.weight
+			upstreams = append(upstreams, u)
+			current = append(current, p.current[i])
+			delete(existing, cand.url.String())
+			continue
+		}
+		u := newPoolUpstream(cand.url, cand.weight)
+		upstreams = append(upstreams, u)
+		current = append(current, 0)
+		fresh = append(fresh, u)
+	}
+	for _, i := range existing {
+		close(p.upstreams[i].removed)
+	}
+	p.upstreams = upstreams
+	p.current = current
+	onAdd := p.onAdd
+	p.mu.Unlock()
+
+	for _, u := range fresh {
+		for _, fn := range onAdd {
+			fn(u)
+		}
+	}
+	return len(fresh), len(existing), nil
+}
+
+// upstreamID derives an identifier from the upstream URL that doesn't reveal it
+func upstreamID(target *url.URL) string {
+	sum := sha256.Sum256([]byte(target.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// byID returns the upstream with the given identifier, or nil
+func (p *upstreamPool) byID(id string) *upstream {
+	for _, u := range p.members() {
+		if u.id == id {
+			return u
+		}
+	}
+	return nil
+}
+
+// primary returns the first upstream, or nil when discovery found none yet
+func (p *upstreamPool) primary() *upstream {
+	upstreams := p.members()
+	if len(upstreams) == 0 {
+		return nil
+	}
+	return upstreams[0]
+}
+
+// next selects the next healthy upstream, or nil if all are down
+func (p *upstreamPool) next() *upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	total := 0
+	best := -1
+	for i, u := range p.upstreams {
+		if !u.healthy.Load() {
+			continue
+		}
+		p.current[i] += u.weight
+		total += u.weight
+		if best == -1 || p.current[i] > p.current[best] {
+			best = i
+		}
+	}
+
+	if best == -1 {
+		return nil
+	}
+
+	p.current[best] -= total
+	return p.upstreams[best]
+}
+
+// status returns the health status of every upstream in the pool
+func (p *upstreamPool) status() []UpstreamStatus {
+	upstreams := p.members()
+	statuses := make([]UpstreamStatus, 0, len(upstreams))
+	for _, u := range upstreams {
+		statuses = append(statuses, u.status())
+	}
+	return statuses
+}
+
+// status returns the health status of the upstream
+func (u *upstream) status() UpstreamStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	status := UpstreamStatus{
+		URL:       u.url.String(),
+		Healthy:   u.healthy.Load(),
+		LastError: u.lastError,
+	}
+	if !u.lastChecked.IsZero() {
+		status.LastChecked = u.lastChecked.UTC().Format(time.RFC3339)
+	}
+	return status
+}
+
+// parseBackendURL parses a backend URL and normalizes its hostname so it can be used
+// for dialing and the Host header: internationalized domain names are converted to
+// punycode and a trailing dot is stripped unless keepTrailingDot is set
+func parseBackendURL(rawURL string, keepTrailingDot bool) (*url.URL, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid backend url: %s", rawURL)
+	}
+
+	hostname := target.Hostname()
+	port := target.Port()
+
+	// IP literals need no normalization
+	if net.ParseIP(hostname) != nil {
+		return target, nil
+	}
+
+	trailingDot := strings.HasSuffix(hostname, ".")
+	hostname = strings.TrimSuffix(hostname, ".")
+
+	asciiHost, err := idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend hostname %q: %w", target.Hostname(), err)
+	}
+	if trailingDot && keepTrailingDot {
+		asciiHost += "."
+	}
+
+	target.Host = asciiHost
+	if port != "" {
+		target.Host = net.JoinHostPort(asciiHost, port)
+	}
+	return target, nil
+}
+
+// withUpstream stores the selected upstream in the request context
+func withUpstream(req *http.Request, u *upstream) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), upstreamContextKey{}, u))
+}
+
+// upstreamFromContext returns the upstream selected for the request, if any
+func upstreamFromContext(ctx context.Context) (*upstream, bool) {
+	u, ok := ctx.Value(upstreamContextKey{}).(*upstream)
+	return u, ok
+}
+
+// rewriteRequestURL points the outgoing request at the target, joining paths and queries
+// the same way httputil.NewSingleHostReverseProxy does
+func rewriteRequestURL(req *http.Request, target *url.URL) {
+	targetQuery := target.RawQuery
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path, req.URL.RawPath = joinURLPath(target, req.URL)
+	if targetQuery == "" || req.URL.RawQuery == "" {
+		req.URL.RawQuery = targetQuery + req.URL.RawQuery
+	} else {
+		req.URL.RawQuery = targetQuery + "&" + req.URL.RawQuery
+	}
+}
+
+func joinURLPath(a, b *url.URL) (path, rawpath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+
+	apath := a.EscapedPath()
+	bpath := b.EscapedPath()
+
+	aslash := strings.HasSuffix(apath, "/")
+	bslash := strings.HasPrefix(bpath, "/")
+
+	switch {
+	case aslash && bslash:
+		return a.Path + b.Path[1:], apath + bpath[1:]
+	case !aslash && !bslash:
+		return a.Path + "/" + b.Path, apath + "/" + bpath
+	}
+	return a.Path + b.Path, apath + bpath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestParseBackendURLNormalizesHostnames(t *testing.T) {
+	tests := []struct {
+		name            string
+		rawURL          string
+		keepTrailingDot bool
+		wantHost        string
+	}{
+		{"trailing dot", "http://api.example.com./v1", false, "api.example.com"},
+		{"trailing dot with port", "http://api.example.com.:8080", false, "api.example.com:8080"},
+		{"trailing dot kept", "http://api.example.com./v1", true, "api.example.com."},
+		{"idn", "http://bücher.example/", false, "xn--bcher-kva.example"},
+		{"idn with port and trailing dot", "https://Bücher.example.:8443", false, "xn--bcher-kva.example:8443"},
+		{"ipv6 literal", "http://[::1]:9000", false, "[::1]:9000"},
+		{"plain", "http://users:8080", false, "users:8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := parseBackendURL(tt.rawURL, tt.keepTrailingDot)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantHost, target.Host)
+		})
+	}
+
+	_, err := parseBackendURL("/relative/path", false)
+	assert.Error(t, err)
+}
+
+func TestProxyUsesNormalizedHost(t *testing.T) {
+	var proxiedHost string
+	fakeProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHost = r.Host
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fakeProxy.Close()
+
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Services: map[string]config.ServiceEndpoint{
+			"idn":         {BaseURL: "http://bücher.example:8080", EgressProxy: config.EgressProxyConfig{URL: fakeProxy.URL}},
+			"trailingdot": {BaseURL: "http://api.example.com.:8080", EgressProxy: config.EgressProxyConfig{URL: fakeProxy.URL}},
+		},
+	}
+	proxy := NewProxyHandler(cfg, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.GET("/idn/*path", proxy.ProxyToService("idn"))
+	router.GET("/trailingdot/*path", proxy.ProxyToService("trailingdot"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	status, _ := gatewayGet(t, gateway, "/idn/books")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "xn--bcher-kva.example:8080", proxiedHost)
+
+	status, _ = gatewayGet(t, gateway, "/trailingdot/items")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "api.example.com:8080", proxiedHost)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/api-gateway/config"
+)
+
+// apiVersionHeader carries the normalized API version to backends
+const apiVersionHeader = "X-Api-Version"
+
+// negotiateAPIVersion returns the normalized version the client asked for, trying the
+// configured path segment ("v<N>"), the configured header, then a version parameter on
+// Accept. Values that aren't versions are skipped. Falls back to the configured default.
+func negotiateAPIVersion(req *http.Request, cfg config.APIVersionConfig) string {
+	// Handlers may already have rewritten the path, so use the one the client sent
+	path := req.URL.Path
+	if req.RequestURI != "" {
+		if original, err := url.ParseRequestURI(req.RequestURI); err == nil {
+			path = original.Path
+		}
+	}
+	if version, ok := pathAPIVersion(path, cfg.PathSegment); ok {
+		return version
+	}
+
+	header := cfg.Header
+	if header == "" {
+		header = "Api-Version"
+	}
+	if version, ok := config.NormalizeAPIVersion(req.Header.Get(header)); ok {
+		return version
+	}
+
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		if _, params, err := mime.ParseMediaType(accept); err == nil {
+			if version, ok := config.NormalizeAPIVersion(params["version"]); ok {
+				return version
+			}
+		}
+	}
+
+	version, _ := config.NormalizeAPIVersion(cfg.Default)
+	return version
+}
+
+// pathAPIVersion returns the version in the path segment at position (1-based, 0 for
+// the leading segment). Only a "v<N>" segment counts, so a bare number isn't a version.
+func pathAPIVersion(path string, position int) (string, bool) {
+	if position <= 0 {
+		position = 1
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if position > len(segments) {
+		return "", false
+	}
+	segment := segments[position-1]
+	if len(segment) < 2 || (segment[0] != 'v' && segment[0] != 'V') {
+		return "", false
+	}
+	return config.NormalizeAPIVersion(segment)
+}
+
+// forwardAPIVersion replaces any client-supplied X-Api-Version with the negotiated one
+func forwardAPIVersion(req *http.Request, cfg config.APIVersionConfig) {
+	if !cfg.Enabled {
+		return
+	}
+
+	version := negotiateAPIVersion(req, cfg)
+	req.Header.Del(apiVersionHeader)
+	if version != "" {
+		req.Header.Set(apiVersionHeader, version)
+	}
+}
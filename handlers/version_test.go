@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestForwardAPIVersion(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gin.SetMode(gin.TestMode)
+	proxy := NewProxyHandler(&config.Config{
+		APIVersion: config.APIVersionConfig{Enabled: true, Header: "Api-Version", Default: "1", PathSegment: 2},
+		Services:   map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL}},
+	}, zap.NewNop())
+	defer proxy.Close()
+
+	router := gin.New()
+	router.Any("/svc/*path", proxy.ProxyToService("backend"))
+	// The backend path no longer carries the version the client used
+	router.GET("/api/v3/users", proxy.ProxyToServiceWithPath("backend", "/users"))
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		want    string
+	}{
+		{"path segment", "/svc/v2/users", nil, "v2"},
+		{"path before rewrite", "/api/v3/users", nil, "v3"},
+		{"path wins over header", "/svc/v2/users", map[string]string{"Api-Version": "4"}, "v2"},
+		{"other segments are not versions", "/svc/files/v2", map[string]string{"Api-Version": "4"}, "v4"},
+		{"bare number segment", "/svc/2/users", nil, "v1"},
+		{"header", "/svc/users", map[string]string{"Api-Version": "4"}, "v4"},
+		{"header with prefix and minor", "/svc/users", map[string]string{"Api-Version": "V4.1"}, "v4.1"},
+		{"accept parameter", "/svc/users", map[string]string{"Accept": "text/html, application/json; version=5"}, "v5"},
+		{"invalid header falls through", "/svc/users", map[string]string{"Api-Version": "latest", "Accept": "application/json;version=5"}, "v5"},
+		{"default", "/svc/users", nil, "v1"},
+		{"client copy replaced", "/svc/users", map[string]string{"X-Api-Version": "v9"}, "v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			echoed := gatewayHeaders(t, gateway, tt.path, tt.headers)
+			assert.Equal(t, tt.want, echoed["X-Api-Version"])
+		})
+	}
+}
+
+func TestForwardAPIVersionDisabled(t *testing.T) {
+	backend := newHeaderEchoBackend()
+	defer backend.Close()
+
+	gateway, _ := setupServiceGateway(t, &config.Config{
+		Services: map[string]config.ServiceEndpoint{"backend": {BaseURL: backend.URL}},
+	}, "backend")
+
+	echoed := gatewayHeaders(t, gateway, "/svc/v2/users", nil)
+	assert.NotContains(t, echoed, "X-Api-Version")
+}
+
+func TestPathAPIVersion(t *testing.T) {
+	tests := []struct {
+		path     string
+		position int
+		want     string
+	}{
+		{"/v2/users", 0, "v2"},
+		{"/v2/users", 1, "v2"},
+		{"/users/v2", 1, ""},
+		{"/api/v3/users", 2, "v3"},
+		{"/api/users/v3", 2, ""},
+		{"/api", 2, ""},
+		{"/vip/users", 1, ""},
+	}
+	for _, tt := range tests {
+		version, _ := pathAPIVersion(tt.path, tt.position)
+		assert.Equal(t, tt.want, version, "%s at %d", tt.path, tt.position)
+	}
+}
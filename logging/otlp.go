@@ -0,0 +1,346 @@
+// Package logging exports the gateway's structured logs to OpenTelemetry collectors.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/api-gateway/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultBatchSize     = 512
+	defaultFlushInterval = 5 * time.Second
+	defaultTimeout       = 10 * time.Second
+
+	// traceIDField and spanIDField are lifted from log fields into the record's trace context
+	traceIDField = "trace_id"
+	spanIDField  = "span_id"
+)
+
+// WithOTLP returns a logger that also (mode "tee") or only (mode "otlp") exports log
+// records over OTLP/HTTP, and a function that flushes pending records and stops the exporter.
+// When export is disabled the logger is returned unchanged.
+func WithOTLP(logger *zap.Logger, cfg config.OTLPLogsConfig) (*zap.Logger, func()) {
+	if !cfg.Enabled {
+		return logger, func() {}
+	}
+
+	exporter := newOTLPExporter(cfg)
+	wrapped := logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		otlpCore := &otlpCore{LevelEnabler: core, exporter: exporter}
+		if cfg.Mode == "otlp" {
+			return otlpCore
+		}
+		return zapcore.NewTee(core, otlpCore)
+	}))
+	return wrapped, exporter.shutdown
+}
+
+// otlpCore is a zapcore.Core that converts entries into OTLP log records
+type otlpCore struct {
+	zapcore.LevelEnabler
+	exporter *otlpExporter
+	fields   []zapcore.Field
+}
+
+// With implements zapcore.Core
+func (c *otlpCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(append([]zapcore.Field{}, c.fields...), fields...)
+	return &clone
+}
+
+// Check implements zapcore.Core
+func (c *otlpCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write implements zapcore.Core
+func (c *otlpCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(encoder)
+	}
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+
+	c.exporter.enqueue(newLogRecord(entry, encoder.Fields))
+	return nil
+}
+
+// Sync implements zapcore.Core
+func (c *otlpCore) Sync() error {
+	return c.exporter.flush()
+}
+
+// logRecord is an OTLP log record in the OTLP/JSON encoding
+type logRecord struct {
+	TimeUnixNano         string     `json:"timeUnixNano"`
+	ObservedTimeUnixNano string     `json:"observedTimeUnixNano"`
+	SeverityNumber       int        `json:"severityNumber"`
+	SeverityText         string     `json:"severityText"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+	TraceID              string     `json:"traceId,omitempty"`
+	SpanID               string     `json:"spanId,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// newLogRecord converts a zap entry and its encoded fields into an OTLP log record
+func newLogRecord(entry zapcore.Entry, fields map[string]interface{}) logRecord {
+	message := entry.Message
+	record := logRecord{
+		TimeUnixNano:         strconv.FormatInt(entry.Time.UnixNano(), 10),
+		ObservedTimeUnixNano: strconv.FormatInt(time.Now().UnixNano(), 10),
+		SeverityNumber:       severityNumber(entry.Level),
+		SeverityText:         entry.Level.CapitalString(),
+		Body:                 anyValue{StringValue: &message},
+	}
+
+	if traceID, ok := fields[traceIDField].(string); ok && isHexID(traceID, 32) {
+		record.TraceID = traceID
+	}
+	if spanID, ok := fields[spanIDField].(string); ok && isHexID(spanID, 16) {
+		record.SpanID = spanID
+	}
+
+	if entry.LoggerName != "" {
+		fields["logger"] = entry.LoggerName
+	}
+	for key, value := range fields {
+		record.Attributes = append(record.Attributes, keyValue{Key: key, Value: toAnyValue(value)})
+	}
+	return record
+}
+
+// toAnyValue converts an encoded zap field value into an OTLP attribute value
+func toAnyValue(value interface{}) anyValue {
+	switch v := value.(type) {
+	case string:
+		return anyValue{StringValue: &v}
+	case bool:
+		return anyValue{BoolValue: &v}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s := fmt.Sprint(v)
+		return anyValue{IntValue: &s}
+	case float32:
+		f := float64(v)
+		return anyValue{DoubleValue: &f}
+	case float64:
+		return anyValue{DoubleValue: &v}
+	case time.Duration:
+		s := v.String()
+		return anyValue{StringValue: &s}
+	case time.Time:
+		s := v.UTC().Format(time.RFC3339Nano)
+		return anyValue{StringValue: &s}
+	}
+
+	// Nested objects and arrays are flattened to JSON strings
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		s := fmt.Sprint(value)
+		return anyValue{StringValue: &s}
+	}
+	s := string(encoded)
+	return anyValue{StringValue: &s}
+}
+
+// severityNumber maps zap levels onto the OpenTelemetry severity scale
+func severityNumber(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return 5
+	case zapcore.InfoLevel:
+		return 9
+	case zapcore.WarnLevel:
+		return 13
+	case zapcore.ErrorLevel:
+		return 17
+	default:
+		return 21
+	}
+}
+
+// isHexID reports whether id is a non-zero lowercase hex string of the given length
+func isHexID(id string, length int) bool {
+	decoded, err := hex.DecodeString(id)
+	if err != nil || len(id) != length || bytes.Count(decoded, []byte{0}) == len(decoded) {
+		return false
+	}
+	return id == hex.EncodeToString(decoded)
+}
+
+// otlpExporter batches log records and posts them to an OTLP/HTTP endpoint
+type otlpExporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	batchSize   int
+	client      *http.Client
+
+	mu      sync.Mutex
+	pending []logRecord
+	sendMu  sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// newOTLPExporter creates an exporter and starts its periodic flush loop
+func newOTLPExporter(cfg config.OTLPLogsConfig) *otlpExporter {
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	flushInterval := cfg.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "api-gateway"
+	}
+
+	e := &otlpExporter{
+		endpoint:    cfg.Endpoint,
+		headers:     cfg.Headers,
+		serviceName: serviceName,
+		batchSize:   batchSize,
+		client:      &http.Client{Timeout: timeout},
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go e.flushLoop(flushInterval)
+	return e
+}
+
+// enqueue buffers a record, flushing in the background once a batch is full
+func (e *otlpExporter) enqueue(record logRecord) {
+	e.mu.Lock()
+	e.pending = append(e.pending, record)
+	full := len(e.pending) >= e.batchSize
+	e.mu.Unlock()
+
+	if full {
+		go e.flush()
+	}
+}
+
+// flushLoop periodically exports buffered records until shutdown
+func (e *otlpExporter) flushLoop(interval time.Duration) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			e.flush()
+			return
+		case <-ticker.C:
+			e.flush()
+		}
+	}
+}
+
+// flush exports all buffered records. Export failures drop the batch: logging must
+// never block or fail requests because the collector is unavailable.
+func (e *otlpExporter) flush() error {
+	e.sendMu.Lock()
+	defer e.sendMu.Unlock()
+
+	e.mu.Lock()
+	records := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+
+	if len(records) == 0 {
+		return nil
+	}
+	return e.send(records)
+}
+
+// send posts a batch of records as an OTLP/JSON ExportLogsServiceRequest
+func (e *otlpExporter) send(records []logRecord) error {
+	serviceName := e.serviceName
+	payload := map[string]interface{}{
+		"resourceLogs": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []keyValue{{Key: "service.name", Value: anyValue{StringValue: &serviceName}}},
+				},
+				"scopeLogs": []interface{}{
+					map[string]interface{}{
+						"scope":      map[string]string{"name": "github.com/api-gateway"},
+						"logRecords": records,
+					},
+				},
+			},
+		},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp log export failed: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp log export failed: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// shutdown flushes pending records and stops the flush loop
+func (e *otlpExporter) shutdown() {
+	e.once.Do(func() {
+		close(e.stop)
+	})
+	<-e.done
+}
@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// otlpSink is an in-memory OTLP/HTTP logs collector
+type otlpSink struct {
+	mu      sync.Mutex
+	records []logRecord
+	headers http.Header
+}
+
+func (s *otlpSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				LogRecords []logRecord `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	json.NewDecoder(r.Body).Decode(&payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.headers = r.Header.Clone()
+	for _, resource := range payload.ResourceLogs {
+		for _, scope := range resource.ScopeLogs {
+			s.records = append(s.records, scope.LogRecords...)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *otlpSink) snapshot() ([]logRecord, http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]logRecord{}, s.records...), s.headers
+}
+
+func attribute(record logRecord, key string) *anyValue {
+	for _, attr := range record.Attributes {
+		if attr.Key == key {
+			return &attr.Value
+		}
+	}
+	return nil
+}
+
+func TestWithOTLPExportsTraceCorrelatedRecords(t *testing.T) {
+	sink := &otlpSink{}
+	collector := httptest.NewServer(sink)
+	defer collector.Close()
+
+	core, stdout := observer.New(zap.InfoLevel)
+	logger, shutdown := WithOTLP(zap.New(core), config.OTLPLogsConfig{
+		Enabled:       true,
+		Endpoint:      collector.URL + "/v1/logs",
+		Headers:       map[string]string{"X-Api-Key": "collector-key"},
+		Mode:          "tee",
+		FlushInterval: time.Hour,
+	})
+
+	logger.With(zap.String("component", "proxy")).Info("Request completed",
+		zap.Int("status", 200),
+		zap.String("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"),
+		zap.String("span_id", "00f067aa0ba902b7"),
+	)
+	logger.Debug("Below the configured level")
+	shutdown()
+
+	// Tee mode keeps writing to the original core
+	assert.Equal(t, 1, stdout.Len())
+
+	records, headers := sink.snapshot()
+	assert.Equal(t, "collector-key", headers.Get("X-Api-Key"))
+	if assert.Len(t, records, 1) {
+		record := records[0]
+		assert.Equal(t, "Request completed", *record.Body.StringValue)
+		assert.Equal(t, 9, record.SeverityNumber)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", record.TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", record.SpanID)
+		assert.Equal(t, "200", *attribute(record, "status").IntValue)
+		assert.Equal(t, "proxy", *attribute(record, "component").StringValue)
+	}
+}
+
+func TestWithOTLPReplaceMode(t *testing.T) {
+	sink := &otlpSink{}
+	collector := httptest.NewServer(sink)
+	defer collector.Close()
+
+	core, stdout := observer.New(zap.InfoLevel)
+	logger, shutdown := WithOTLP(zap.New(core), config.OTLPLogsConfig{
+		Enabled:  true,
+		Endpoint: collector.URL,
+		Mode:     "otlp",
+	})
+
+	logger.Warn("Upstream marked unhealthy", zap.String("trace_id", "not-a-trace-id"))
+	shutdown()
+
+	assert.Equal(t, 0, stdout.Len())
+	records, _ := sink.snapshot()
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, 13, records[0].SeverityNumber)
+		assert.Empty(t, records[0].TraceID)
+	}
+}
+
+func TestWithOTLPDisabled(t *testing.T) {
+	logger := zap.NewNop()
+	wrapped, shutdown := WithOTLP(logger, config.OTLPLogsConfig{})
+	shutdown()
+	assert.Same(t, logger, wrapped)
+}
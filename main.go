@@ -3,17 +3,22 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/api-gateway/config"
+	"github.com/api-gateway/handlers"
+	"github.com/api-gateway/logging"
 	"github.com/api-gateway/middleware"
 	"github.com/api-gateway/routes"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func main() {
@@ -31,6 +36,10 @@ func main() {
 		logger.Fatal("Failed to load configuration", zap.Error(err))
 	}
 
+	// Optionally export logs to an OpenTelemetry collector
+	logger, shutdownLogExport := logging.WithOTLP(logger, cfg.Tracing.Logs)
+	defer shutdownLogExport()
+
 	// Set Gin mode based on environment
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -38,14 +47,41 @@ func main() {
 		gin.SetMode(gin.DebugMode)
 	}
 
+	// Route registration is logged at debug level; SetupRoutes logs a summary
+	gin.DebugPrintRouteFunc = func(httpMethod, absolutePath, handlerName string, nuHandlers int) {
+		logger.Debug("Route registered",
+			zap.String("method", httpMethod),
+			zap.String("path", absolutePath),
+			zap.String("handler", handlerName),
+		)
+	}
+
 	// Create Gin router
 	router := gin.New()
 
+	// Resolve client IPs through the trusted proxies only
+	if err := middleware.TrustProxies(router, cfg.TrustedProxies); err != nil {
+		logger.Fatal("Failed to configure trusted proxies", zap.Error(err))
+	}
+
 	// Global middleware
-	router.Use(gin.Recovery())
-	router.Use(middleware.Logger(logger))
-	router.Use(middleware.CORS(cfg))
-	router.Use(middleware.RequestID())
+	recovery := middleware.NewRecovery(logger)
+	prometheus.MustRegister(recovery)
+	router.Use(recovery.Middleware())
+	accessLogger := middleware.NewAccessLogger(logger, cfg)
+	prometheus.MustRegister(accessLogger)
+	router.Use(accessLogger.Middleware())
+	router.Use(middleware.SecurityHeaders(cfg.SecurityHeaders))
+	corsPolicy := middleware.NewCORSPolicy(cfg)
+	router.Use(corsPolicy.Middleware())
+	router.Use(middleware.RequestID(cfg))
+	router.Use(middleware.HeaderSizeLimit(cfg.Server.MaxHeaderBytes))
+	router.Use(middleware.RequestDeadline(cfg.Server.RequestBudget))
+	router.Use(middleware.MethodFilter(cfg))
+	if cfg.IPFilter.Global.Enabled() {
+		router.Use(middleware.IPFilterMiddleware(cfg.IPFilter.Global, cfg.IPFilter.TrustedProxies))
+	}
+	router.Use(middleware.WebSocketLimit(cfg))
 
 	// Initialize rate limiter
 	rateLimiter, err := middleware.NewRateLimiter(cfg)
@@ -53,33 +89,144 @@ func main() {
 		logger.Fatal("Failed to initialize rate limiter", zap.Error(err))
 	}
 	defer rateLimiter.Close()
+	prometheus.MustRegister(rateLimiter)
+
+	// Audit trail of authentication outcomes and admin requests
+	auditor, err := rateLimiter.Auditor(cfg, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize audit log", zap.Error(err))
+	}
+	defer auditor.Close()
+	router.Use(auditor.Middleware())
 
 	// Apply rate limiting middleware
 	router.Use(rateLimiter.Middleware())
 
+	// Maintenance mode answers 503 to everything but health checks, login and admin
+	maintenance := middleware.NewMaintenance(cfg.Maintenance)
+	router.Use(maintenance.Middleware())
+
+	// Effective configuration, reported to administrators
+	configView := handlers.NewConfigHandler(cfg)
+
+	// Optionally hold back traffic until startup-critical dependencies are reachable
+	startup := middleware.NewStartupGate(cfg.Readiness.Startup, logger)
+
 	// Setup routes
-	routes.SetupRoutes(router, cfg, logger)
+	proxy := routes.SetupRoutes(router, cfg, logger, routes.Components{
+		RateLimiter: rateLimiter,
+		CORSPolicy:  corsPolicy,
+		Maintenance: maintenance,
+		Config:      configView,
+		Startup:     startup,
+	})
+	defer proxy.Close()
+	prometheus.MustRegister(proxy)
+
+	// Apply config file changes at runtime where possible. Restart warnings name the
+	// settings changed since the previous reload, so each change is reported once; the
+	// admin config endpoint lists everything pending since startup.
+	previous := cfg
+	config.WatchConfig(func(newCfg *config.Config, err error) {
+		if err != nil {
+			logger.Error("Ignoring invalid configuration change", zap.Error(err))
+			return
+		}
+
+		rateLimiter.UpdateConfig(newCfg.RateLimit)
+		if err := corsPolicy.Update(newCfg); err != nil {
+			logger.Error("Ignoring invalid CORS configuration change", zap.Error(err))
+		}
+		maintenance.Update(newCfg.Maintenance)
+		proxy.UpdateTimeouts(newCfg)
+		configView.Update(newCfg)
+
+		for _, setting := range config.RestartRequired(previous, newCfg) {
+			logger.Warn("Configuration change requires a restart to take effect", zap.String("setting", setting))
+		}
+		previous = newCfg
+		logger.Info("Configuration reloaded")
+	})
+
+	// Normalize request paths before the startup gate and routing, so both see the
+	// path the request is routed on
+	handler := startup.Handler(router)
+	handler = middleware.NormalizePath(cfg.Server.PathNormalization, handler)
+
+	// Accept cleartext HTTP/2 when enabled, e.g. for gRPC passthrough
+	if cfg.Server.H2C {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
 
 	// Create HTTP server
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      router,
+		Handler:      handler,
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  cfg.Server.IdleTimeout,
+		// Read headers past the configured limit so they get a JSON 431
+		MaxHeaderBytes: middleware.ServerMaxHeaderBytes(cfg.Server.MaxHeaderBytes),
+	}
+
+	// Terminate TLS when enabled, optionally redirecting plaintext requests to HTTPS
+	var redirectSrv *http.Server
+	if cfg.Server.TLS.Enabled {
+		serverTLS, err := handlers.NewServerTLS(cfg.Server.TLS, logger)
+		if err != nil {
+			logger.Fatal("Failed to initialize TLS", zap.Error(err))
+		}
+		defer serverTLS.Close()
+		serverTLS.Configure(srv)
+
+		if cfg.Server.TLS.RedirectPort > 0 {
+			redirectSrv = &http.Server{
+				Addr:         fmt.Sprintf(":%d", cfg.Server.TLS.RedirectPort),
+				Handler:      handlers.RedirectToHTTPS(cfg.Port),
+				ReadTimeout:  cfg.Server.ReadTimeout,
+				WriteTimeout: cfg.Server.WriteTimeout,
+				IdleTimeout:  cfg.Server.IdleTimeout,
+			}
+			go func() {
+				if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.Fatal("Failed to start HTTPS redirect listener", zap.Error(err))
+				}
+			}()
+		}
+	}
+
+	// Count client connections, capped at server.connections.max
+	connections := handlers.NewConnectionLimiter(cfg.Server.Connections)
+	prometheus.MustRegister(connections)
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		logger.Fatal("Failed to listen", zap.String("addr", srv.Addr), zap.Error(err))
 	}
+	listener = connections.Listener(listener)
 
 	// Start server in goroutine
 	go func() {
 		logger.Info("Starting API Gateway",
 			zap.Int("port", cfg.Port),
+			zap.Bool("tls", cfg.Server.TLS.Enabled),
 			zap.String("environment", cfg.Environment),
+			zap.Int("max_connections", cfg.Server.Connections.Max),
 		)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.Server.TLS.Enabled {
+			err = srv.ServeTLS(listener, "", "")
+		} else {
+			err = srv.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Fatal("Failed to start server", zap.Error(err))
 		}
 	}()
 
+	// Accept traffic once startup-critical dependencies are reachable; liveness probes
+	// are answered meanwhile
+	go startup.Wait(context.Background())
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -87,12 +234,15 @@ func main() {
 
 	logger.Info("Shutting down API Gateway...")
 
-	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Graceful shutdown with timeout; connections still open afterwards are closed
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal("Server forced to shutdown", zap.Error(err))
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(ctx)
+	}
+	if err := handlers.Shutdown(ctx, srv, proxy, logger); err != nil {
+		logger.Warn("Server forced to shutdown", zap.Error(err))
 	}
 
 	logger.Info("API Gateway stopped")
@@ -0,0 +1,295 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Audit event types
+const (
+	AuditLoginSuccess   = "login.success"
+	AuditLoginFailure   = "login.failure"
+	AuditLoginLocked    = "login.locked_out"
+	AuditTokenRejected  = "auth.token_rejected"
+	AuditRoleDenied     = "auth.role_denied"
+	AuditScopeDenied    = "auth.scope_denied"
+	AuditAdminAccess    = "admin.access"
+	AuditRateLimitFlush = "admin.ratelimit_flush"
+	AuditCacheFlush     = "admin.cache_flush"
+)
+
+// Audit outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+	AuditOutcomeDenied  = "denied"
+)
+
+// auditContextKey stores the auditor in the Gin context
+const auditContextKey = "auditor"
+
+// Audit defaults
+const (
+	defaultAuditStream    = "audit:events"
+	defaultAuditMaxLen    = 100000
+	defaultAuditQueueSize = 1024
+	auditWriteTimeout     = 5 * time.Second
+)
+
+// AuditEvent is one entry of the audit trail
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`    // e.g. login.failure, see the Audit* constants
+	Outcome   string    `json:"outcome"` // success, failure or denied
+	UserID    string    `json:"user_id,omitempty"`
+	Username  string    `json:"username,omitempty"` // Login attempts, where there is no user ID yet
+	TenantID  string    `json:"tenant_id,omitempty"`
+	IP        string    `json:"ip"`
+	RequestID string    `json:"request_id,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Target    string    `json:"target,omitempty"` // What an admin action applied to, e.g. a client ID
+}
+
+// AuditSink stores audit events, e.g. in a log file or a message stream
+type AuditSink interface {
+	Write(ctx context.Context, event AuditEvent) error
+}
+
+// Auditor records security-relevant events (authentication outcomes, denied and
+// admin requests) apart from the access log. Events are written to the sink in the
+// background so a slow sink never delays requests; when the queue is full, events are
+// dropped with a warning in the gateway log, as are events recorded after Close.
+type Auditor struct {
+	sink   AuditSink
+	logger *zap.Logger
+	events chan AuditEvent
+	done   chan struct{}
+
+	mu     sync.RWMutex // guards closed against sends on the closed events channel
+	closed bool
+}
+
+// NewAuditor creates the configured auditor, or returns nil when auditing is disabled.
+// The log sink writes to cfg.File, or to the gateway logger when no file is set; the
+// Redis sink uses redisClient, which must not be nil.
+func NewAuditor(cfg config.AuditConfig, logger *zap.Logger, redisClient *redis.Client) (*Auditor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var sink AuditSink
+	switch cfg.Sink {
+	case "", "log":
+		auditLogger := logger.Named("audit")
+		if cfg.File != "" {
+			zapCfg := zap.NewProductionConfig()
+			zapCfg.OutputPaths = []string{cfg.File}
+			zapCfg.Sampling = nil
+			fileLogger, err := zapCfg.Build()
+			if err != nil {
+				return nil, fmt.Errorf("failed to open audit log: %w", err)
+			}
+			auditLogger = fileLogger
+		}
+		sink = NewLogAuditSink(auditLogger)
+	case "redis":
+		if redisClient == nil {
+			return nil, fmt.Errorf("audit sink redis requires a redis client")
+		}
+		sink = NewRedisAuditSink(redisClient, cfg.Stream, cfg.MaxLen)
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q", cfg.Sink)
+	}
+	return NewAuditorWithSink(sink, logger), nil
+}
+
+// Auditor creates the configured auditor, sharing the rate limiter's Redis client
+func (rl *RateLimiter) Auditor(cfg *config.Config, logger *zap.Logger) (*Auditor, error) {
+	return NewAuditor(cfg.Audit, logger, rl.redisClient)
+}
+
+// NewAuditorWithSink creates an auditor writing to a custom sink
+func NewAuditorWithSink(sink AuditSink, logger *zap.Logger) *Auditor {
+	a := &Auditor{
+		sink:   sink,
+		logger: logger,
+		events: make(chan AuditEvent, defaultAuditQueueSize),
+		done:   make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// run writes queued events to the sink until the auditor is closed
+func (a *Auditor) run() {
+	defer close(a.done)
+	for event := range a.events {
+		ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+		if err := a.sink.Write(ctx, event); err != nil {
+			a.logger.Error("Failed to write audit event", zap.String("type", event.Type), zap.Error(err))
+		}
+		cancel()
+	}
+}
+
+// Close writes the queued events and stops the auditor, once requests have stopped
+func (a *Auditor) Close() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.events)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
+
+// Middleware makes the auditor available to the authentication middleware and
+// handlers of the request. A nil auditor records nothing.
+func (a *Auditor) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a != nil {
+			c.Set(auditContextKey, a)
+		}
+		c.Next()
+	}
+}
+
+// record queues an event, completing it from the request
+func (a *Auditor) record(c *gin.Context, event AuditEvent) {
+	event.Time = time.Now().UTC()
+	event.IP = ClientIP(c)
+	event.RequestID = c.GetString("request_id")
+	event.Method = c.Request.Method
+	event.Path = c.Request.URL.Path
+	if claims, ok := GetUserFromContext(c); ok {
+		if event.UserID == "" {
+			event.UserID = claims.UserID
+		}
+		if event.TenantID == "" {
+			event.TenantID = claims.TenantID
+		}
+	}
+	if event.TenantID == "" {
+		event.TenantID = c.GetString(TenantContextKey)
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		a.logger.Warn("Auditor closed, dropping event", zap.String("type", event.Type))
+		return
+	}
+	select {
+	case a.events <- event:
+	default:
+		a.logger.Warn("Audit queue full, dropping event", zap.String("type", event.Type))
+	}
+}
+
+// RecordAudit records an event for the request when auditing is enabled. The
+// request's IP, ID, method, path and user are filled in.
+func RecordAudit(c *gin.Context, event AuditEvent) {
+	if value, ok := c.Get(auditContextKey); ok {
+		value.(*Auditor).record(c, event)
+	}
+}
+
+// AuditAdmin returns a middleware recording each admin request and its status. It
+// belongs after the authentication and role checks, which record their own denials.
+func AuditAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		outcome := AuditOutcomeSuccess
+		if c.Writer.Status() >= 400 {
+			outcome = AuditOutcomeFailure
+		}
+		RecordAudit(c, AuditEvent{Type: AuditAdminAccess, Outcome: outcome, Status: c.Writer.Status()})
+	}
+}
+
+// LogAuditSink writes audit events to a zap logger, typically a dedicated file
+type LogAuditSink struct {
+	logger *zap.Logger
+}
+
+// NewLogAuditSink creates a sink writing to logger
+func NewLogAuditSink(logger *zap.Logger) *LogAuditSink {
+	return &LogAuditSink{logger: logger}
+}
+
+// Write implements AuditSink
+func (s *LogAuditSink) Write(ctx context.Context, event AuditEvent) error {
+	s.logger.Info("Audit event",
+		zap.Time("time", event.Time),
+		zap.String("type", event.Type),
+		zap.String("outcome", event.Outcome),
+		zap.String("user_id", event.UserID),
+		zap.String("username", event.Username),
+		zap.String("tenant_id", event.TenantID),
+		zap.String("ip", event.IP),
+		zap.String("request_id", event.RequestID),
+		zap.String("method", event.Method),
+		zap.String("path", event.Path),
+		zap.Int("status", event.Status),
+		zap.String("reason", event.Reason),
+		zap.String("target", event.Target),
+	)
+	return nil
+}
+
+// RedisAuditSink appends audit events to a Redis stream, for consumers such as a SIEM
+// forwarder. The stream is capped at roughly maxLen entries.
+type RedisAuditSink struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewRedisAuditSink creates a sink appending to stream
+func NewRedisAuditSink(client *redis.Client, stream string, maxLen int64) *RedisAuditSink {
+	if stream == "" {
+		stream = defaultAuditStream
+	}
+	if maxLen <= 0 {
+		maxLen = defaultAuditMaxLen
+	}
+	return &RedisAuditSink{client: client, stream: stream, maxLen: maxLen}
+}
+
+// Write implements AuditSink
+func (s *RedisAuditSink) Write(ctx context.Context, event AuditEvent) error {
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"time":       event.Time.Format(time.RFC3339Nano),
+			"type":       event.Type,
+			"outcome":    event.Outcome,
+			"user_id":    event.UserID,
+			"username":   event.Username,
+			"tenant_id":  event.TenantID,
+			"ip":         event.IP,
+			"request_id": event.RequestID,
+			"method":     event.Method,
+			"path":       event.Path,
+			"status":     event.Status,
+			"reason":     event.Reason,
+			"target":     event.Target,
+		},
+	}).Err()
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// memoryAuditSink keeps audit events for inspection
+type memoryAuditSink struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+func (s *memoryAuditSink) Write(ctx context.Context, event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// setupAuditedRouter serves /admin behind authentication and the admin role, and
+// returns a function closing the auditor and returning the recorded events
+func setupAuditedRouter(t *testing.T, cfg *config.Config) (*gin.Engine, func() []AuditEvent) {
+	gin.SetMode(gin.TestMode)
+	sink := &memoryAuditSink{}
+	auditor := NewAuditorWithSink(sink, zap.NewNop())
+
+	router := gin.New()
+	TrustProxies(router, nil)
+	router.Use(RequestID(cfg), auditor.Middleware())
+	router.GET("/admin", AuthMiddleware(cfg), RequireRoles("admin"), AuditAdmin(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	return router, func() []AuditEvent {
+		auditor.Close()
+		return sink.events
+	}
+}
+
+func TestAuditRoleDenied(t *testing.T) {
+	cfg := &config.Config{JWT: config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour}}
+	router, events := setupAuditedRouter(t, cfg)
+
+	token, _ := GenerateToken("42", "user@example.com", []string{"user"}, cfg)
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.RemoteAddr = "203.0.113.7:1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	recorded := events()
+	if assert.Len(t, recorded, 1) {
+		event := recorded[0]
+		assert.Equal(t, AuditRoleDenied, event.Type)
+		assert.Equal(t, AuditOutcomeDenied, event.Outcome)
+		assert.Equal(t, "42", event.UserID)
+		assert.Equal(t, "203.0.113.7", event.IP)
+		assert.Equal(t, w.Header().Get(RequestIDHeader), event.RequestID)
+		assert.Equal(t, "/admin", event.Path)
+		assert.Equal(t, http.StatusForbidden, event.Status)
+	}
+}
+
+func TestAuditAdminAccess(t *testing.T) {
+	cfg := &config.Config{JWT: config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour}}
+	router, events := setupAuditedRouter(t, cfg)
+
+	token, _ := GenerateToken("1", "admin@example.com", []string{"admin"}, cfg)
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	recorded := events()
+	if assert.Len(t, recorded, 1) {
+		assert.Equal(t, AuditAdminAccess, recorded[0].Type)
+		assert.Equal(t, AuditOutcomeSuccess, recorded[0].Outcome)
+		assert.Equal(t, "1", recorded[0].UserID)
+		assert.Equal(t, http.StatusOK, recorded[0].Status)
+	}
+}
+
+func TestAuditTokenRejected(t *testing.T) {
+	cfg := &config.Config{JWT: config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour}}
+	router, events := setupAuditedRouter(t, cfg)
+
+	// A missing token is not an authentication attempt and is not recorded
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/admin", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	recorded := events()
+	if assert.Len(t, recorded, 1) {
+		assert.Equal(t, AuditTokenRejected, recorded[0].Type)
+		assert.Equal(t, AuditOutcomeFailure, recorded[0].Outcome)
+		assert.NotEmpty(t, recorded[0].Reason)
+	}
+}
+
+func TestAuditLogSink(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	auditor, err := NewAuditor(config.AuditConfig{Enabled: true, Sink: "log"}, zap.New(core), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/login", nil)
+	c.Set(auditContextKey, auditor)
+	RecordAudit(c, AuditEvent{Type: AuditLoginFailure, Outcome: AuditOutcomeFailure, Username: "alice"})
+	auditor.Close()
+
+	entries := logs.FilterMessage("Audit event").All()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "audit", entries[0].LoggerName)
+		fields := entries[0].ContextMap()
+		assert.Equal(t, AuditLoginFailure, fields["type"])
+		assert.Equal(t, "alice", fields["username"])
+		assert.Equal(t, "/login", fields["path"])
+	}
+}
+
+func TestNewAuditor(t *testing.T) {
+	auditor, err := NewAuditor(config.AuditConfig{}, zap.NewNop(), nil)
+	assert.NoError(t, err)
+	assert.Nil(t, auditor, "auditing is disabled by default")
+	auditor.Close()
+
+	_, err = NewAuditor(config.AuditConfig{Enabled: true, Sink: "redis"}, zap.NewNop(), nil)
+	assert.Error(t, err)
+	_, err = NewAuditor(config.AuditConfig{Enabled: true, Sink: "kafka"}, zap.NewNop(), nil)
+	assert.Error(t, err)
+}
+
+func TestAuditAfterClose(t *testing.T) {
+	cfg := &config.Config{JWT: config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour}}
+	router, events := setupAuditedRouter(t, cfg)
+	assert.Empty(t, events())
+
+	// Requests still in flight after Close have their events dropped
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	w := httptest.NewRecorder()
+	assert.NotPanics(t, func() { router.ServeHTTP(w, req) })
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, events())
+}
@@ -3,7 +3,7 @@ package middleware
 import (
 	"context"
 	"errors"
-	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -18,9 +18,28 @@ type Claims struct {
 	Email    string   `json:"email"`
 	Roles    []string `json:"roles"`
 	TenantID string   `json:"tenant_id,omitempty"`
+	Tier     string   `json:"tier,omitempty"` // Plan tier sizing the user's quota
+	Scope    string   `json:"scope,omitempty"` // Space-delimited OAuth scopes, e.g. "tasks:read tasks:write"
+	// TokenType marks tokens that don't grant access, e.g. TokenTypeRefresh; it is empty
+	// for access tokens
+	TokenType string `json:"typ,omitempty"`
+	// AuthScheme is the scheme the request authenticated with when a route accepts
+	// several; it is never part of a token
+	AuthScheme string `json:"-"`
 	jwt.RegisteredClaims
 }
 
+// Scopes returns the scopes granted to the token
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// TokenTypeRefresh is the token type of refresh tokens, which authentication rejects
+const TokenTypeRefresh = "refresh"
+
+// defaultTokenCookie is the cookie read for the token when cookie authentication is on
+const defaultTokenCookie = "access_token"
+
 // ContextKey is a custom type for context keys
 type ContextKey string
 
@@ -36,32 +55,37 @@ var (
 	ErrExpiredToken = errors.New("token expired")
 	// ErrMissingToken is returned when no token is provided
 	ErrMissingToken = errors.New("missing authorization token")
+	// ErrInvalidIssuer is returned when the token was issued by someone else
+	ErrInvalidIssuer = errors.New("invalid token issuer")
+	// ErrInvalidAudience is returned when the token is not meant for this gateway
+	ErrInvalidAudience = errors.New("invalid token audience")
+	// ErrTokenNotYetValid is returned when the token's nbf or iat is in the future
+	ErrTokenNotYetValid = errors.New("token not yet valid")
+	// ErrNotAccessToken is returned when a refresh token is presented for access
+	ErrNotAccessToken = errors.New("not an access token")
 )
 
 // AuthMiddleware creates a middleware for JWT authentication
 func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token, err := extractToken(c)
+		token, err := extractToken(c, cfg.JWT)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Unauthorized",
-				"message": err.Error(),
-			})
-			c.Abort()
+			code := CodeAuthTokenInvalid
+			if errors.Is(err, ErrMissingToken) {
+				code = CodeAuthTokenMissing
+			}
+			AbortWithError(c, code, err.Error())
 			return
 		}
 
-		claims, err := validateToken(token, cfg.JWT.SecretKey)
+		claims, err := validateToken(token, cfg.JWT)
 		if err != nil {
-			status := http.StatusUnauthorized
+			code := CodeAuthTokenInvalid
 			if errors.Is(err, ErrExpiredToken) {
-				status = http.StatusUnauthorized
+				code = CodeAuthTokenExpired
 			}
-			c.JSON(status, gin.H{
-				"error":   "Unauthorized",
-				"message": err.Error(),
-			})
-			c.Abort()
+			RecordAudit(c, AuditEvent{Type: AuditTokenRejected, Outcome: AuditOutcomeFailure, Status: code.Status(), Reason: err.Error()})
+			AbortWithError(c, code, err.Error())
 			return
 		}
 
@@ -78,14 +102,14 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 // It doesn't abort the request if no token is provided, but validates if one exists
 func OptionalAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token, err := extractToken(c)
+		token, err := extractToken(c, cfg.JWT)
 		if err != nil {
 			// No token provided, continue without authentication
 			c.Next()
 			return
 		}
 
-		claims, err := validateToken(token, cfg.JWT.SecretKey)
+		claims, err := validateToken(token, cfg.JWT)
 		if err != nil {
 			// Invalid token, but don't abort - just log it
 			c.Next()
@@ -106,21 +130,13 @@ func RequireRoles(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		claimsValue, exists := c.Get(string(UserContextKey))
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Unauthorized",
-				"message": "Authentication required",
-			})
-			c.Abort()
+			AbortWithError(c, CodeAuthRequired, "Authentication required")
 			return
 		}
 
 		claims, ok := claimsValue.(*Claims)
 		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Internal Server Error",
-				"message": "Invalid claims format",
-			})
-			c.Abort()
+			AbortWithError(c, CodeInternal, "Invalid claims format")
 			return
 		}
 
@@ -139,11 +155,13 @@ func RequireRoles(roles ...string) gin.HandlerFunc {
 		}
 
 		if !hasRole {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":   "Forbidden",
-				"message": "Insufficient permissions",
+			RecordAudit(c, AuditEvent{
+				Type:    AuditRoleDenied,
+				Outcome: AuditOutcomeDenied,
+				Status:  CodeInsufficientRole.Status(),
+				Reason:  "requires one of roles " + strings.Join(roles, ", "),
 			})
-			c.Abort()
+			AbortWithError(c, CodeInsufficientRole, "Insufficient permissions")
 			return
 		}
 
@@ -151,10 +169,65 @@ func RequireRoles(roles ...string) gin.HandlerFunc {
 	}
 }
 
-// extractToken extracts the JWT token from the Authorization header
-func extractToken(c *gin.Context) (string, error) {
+// RequireScopes creates a middleware that requires every one of the scopes
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return requireScopes(scopes, true)
+}
+
+// RequireAnyScope creates a middleware that requires at least one of the scopes
+func RequireAnyScope(scopes ...string) gin.HandlerFunc {
+	return requireScopes(scopes, false)
+}
+
+// requireScopes checks the token's scopes, answering 403 with the missing scope, and
+// the scopes required in WWW-Authenticate as RFC 6750 describes
+func requireScopes(scopes []string, all bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetUserFromContext(c)
+		if !ok {
+			AbortWithError(c, CodeAuthRequired, "Authentication required")
+			return
+		}
+
+		granted := claims.Scopes()
+		var message string
+		if all {
+			for _, scope := range scopes {
+				if !slices.Contains(granted, scope) {
+					message = "Missing required scope " + scope
+					break
+				}
+			}
+		} else if !slices.ContainsFunc(scopes, func(scope string) bool { return slices.Contains(granted, scope) }) {
+			message = "Missing one of the scopes " + strings.Join(scopes, ", ")
+		}
+
+		if message != "" {
+			RecordAudit(c, AuditEvent{
+				Type:    AuditScopeDenied,
+				Outcome: AuditOutcomeDenied,
+				Status:  CodeInsufficientScope.Status(),
+				Reason:  message,
+			})
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+			AbortWithError(c, CodeInsufficientScope, message)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// extractToken extracts the JWT token. The Authorization header takes precedence; only
+// when it is absent, and cookie authentication is enabled, is the token cookie read.
+func extractToken(c *gin.Context, cfg config.JWTConfig) (string, error) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
+		if cfg.CookieAuth {
+			if token, err := c.Cookie(cookieName(cfg)); err == nil && token != "" {
+				return token, nil
+			}
+		}
 		return "", ErrMissingToken
 	}
 
@@ -167,19 +240,34 @@ func extractToken(c *gin.Context) (string, error) {
 	return parts[1], nil
 }
 
-// validateToken validates the JWT token and returns the claims
-func validateToken(tokenString, secretKey string) (*Claims, error) {
+// cookieName returns the name of the cookie carrying the token
+func cookieName(cfg config.JWTConfig) string {
+	if cfg.CookieName == "" {
+		return defaultTokenCookie
+	}
+	return cfg.CookieName
+}
+
+// validateToken validates the JWT token and returns the claims. Besides the signature
+// (by the current or a previous secret) and expiry, it checks nbf and iat when present,
+// the issuer when one is configured and, when an audience is configured, that the
+// token's aud claim contains it. The time checks allow for the configured leeway. Only
+// access tokens are accepted; refresh tokens are rejected.
+func validateToken(tokenString string, cfg config.JWTConfig) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// Verify signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(secretKey), nil
-	})
+		return verificationKeys(cfg), nil
+	}, jwt.WithLeeway(cfg.Leeway), jwt.WithIssuedAt())
 
 	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired):
 			return nil, ErrExpiredToken
+		case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+			return nil, ErrTokenNotYetValid
 		}
 		return nil, ErrInvalidToken
 	}
@@ -189,36 +277,62 @@ func validateToken(tokenString, secretKey string) (*Claims, error) {
 		return nil, ErrInvalidToken
 	}
 
+	if cfg.Issuer != "" && claims.Issuer != cfg.Issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if cfg.Audience != "" && !slices.Contains(claims.Audience, cfg.Audience) {
+		return nil, ErrInvalidAudience
+	}
+	if claims.TokenType != "" {
+		return nil, ErrNotAccessToken
+	}
+
 	return claims, nil
 }
 
+// verificationKeys returns the secrets accepted for token signatures: the current
+// secret first, then the previous ones
+func verificationKeys(cfg config.JWTConfig) jwt.VerificationKeySet {
+	keys := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{[]byte(cfg.SecretKey)}}
+	for _, secret := range cfg.PreviousSecrets {
+		keys.Keys = append(keys.Keys, []byte(secret))
+	}
+	return keys
+}
+
 // GenerateToken generates a new JWT token for a user
 func GenerateToken(userID, email string, roles []string, cfg *config.Config) (string, error) {
+	return GenerateTokenForClaims(&Claims{UserID: userID, Email: email, Roles: roles}, cfg)
+}
+
+// GenerateTokenForClaims generates an access token carrying the user's claims, such as
+// tenant, tier and scope besides those of GenerateToken. The registered claims are set
+// from the configuration.
+func GenerateTokenForClaims(claims *Claims, cfg *config.Config) (string, error) {
 	now := time.Now()
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Roles:  roles,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    cfg.JWT.Issuer,
-			Subject:   userID,
-			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.JWT.TokenDuration)),
-			NotBefore: jwt.NewNumericDate(now),
-		},
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    cfg.JWT.Issuer,
+		Audience:  tokenAudience(cfg),
+		Subject:   claims.UserID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(cfg.JWT.TokenDuration)),
+		NotBefore: jwt.NewNumericDate(now),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(cfg.JWT.SecretKey))
 }
 
-// GenerateRefreshToken generates a refresh token
+// GenerateRefreshToken generates a refresh token. It is marked with TokenTypeRefresh, so
+// it can't be used as an access token.
 func GenerateRefreshToken(userID string, cfg *config.Config) (string, error) {
 	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		TokenType: TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    cfg.JWT.Issuer,
+			Audience:  tokenAudience(cfg),
 			Subject:   userID,
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.JWT.RefreshDuration)),
@@ -230,6 +344,14 @@ func GenerateRefreshToken(userID string, cfg *config.Config) (string, error) {
 	return token.SignedString([]byte(cfg.JWT.SecretKey))
 }
 
+// tokenAudience returns the aud claim for generated tokens: the configured audience, if any
+func tokenAudience(cfg *config.Config) jwt.ClaimStrings {
+	if cfg.JWT.Audience == "" {
+		return nil
+	}
+	return jwt.ClaimStrings{cfg.JWT.Audience}
+}
+
 // GetUserFromContext retrieves user claims from context
 func GetUserFromContext(c *gin.Context) (*Claims, bool) {
 	claimsValue, exists := c.Get(string(UserContextKey))
@@ -0,0 +1,282 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// signTestToken signs claims with the test secret
+func signTestToken(t *testing.T, claims jwt.RegisteredClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "1", RegisteredClaims: claims}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestValidateTokenIssuerAndAudience(t *testing.T) {
+	now := time.Now()
+	expires := jwt.NewNumericDate(now.Add(time.Hour))
+	jwtConfig := config.JWTConfig{SecretKey: "test-secret", Issuer: "api-gateway", Audience: "gateway-clients"}
+
+	tests := []struct {
+		name    string
+		claims  jwt.RegisteredClaims
+		wantErr error
+	}{
+		{"matching issuer and audience", jwt.RegisteredClaims{
+			Issuer: "api-gateway", Audience: jwt.ClaimStrings{"gateway-clients"}, ExpiresAt: expires,
+		}, nil},
+		{"audience among several", jwt.RegisteredClaims{
+			Issuer: "api-gateway", Audience: jwt.ClaimStrings{"billing", "gateway-clients"}, ExpiresAt: expires,
+		}, nil},
+		{"wrong issuer", jwt.RegisteredClaims{
+			Issuer: "billing-service", Audience: jwt.ClaimStrings{"gateway-clients"}, ExpiresAt: expires,
+		}, ErrInvalidIssuer},
+		{"missing issuer", jwt.RegisteredClaims{
+			Audience: jwt.ClaimStrings{"gateway-clients"}, ExpiresAt: expires,
+		}, ErrInvalidIssuer},
+		{"wrong audience", jwt.RegisteredClaims{
+			Issuer: "api-gateway", Audience: jwt.ClaimStrings{"billing"}, ExpiresAt: expires,
+		}, ErrInvalidAudience},
+		{"missing audience", jwt.RegisteredClaims{
+			Issuer: "api-gateway", ExpiresAt: expires,
+		}, ErrInvalidAudience},
+		{"not yet valid", jwt.RegisteredClaims{
+			Issuer: "api-gateway", Audience: jwt.ClaimStrings{"gateway-clients"}, ExpiresAt: expires,
+			NotBefore: jwt.NewNumericDate(now.Add(10 * time.Minute)),
+		}, ErrTokenNotYetValid},
+		{"expired", jwt.RegisteredClaims{
+			Issuer: "api-gateway", Audience: jwt.ClaimStrings{"gateway-clients"},
+			ExpiresAt: jwt.NewNumericDate(now.Add(-time.Minute)),
+		}, ErrExpiredToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := validateToken(signTestToken(t, tt.claims), jwtConfig)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, "1", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestValidateTokenAudienceOptional(t *testing.T) {
+	token := signTestToken(t, jwt.RegisteredClaims{
+		Issuer: "api-gateway", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+
+	_, err := validateToken(token, config.JWTConfig{SecretKey: "test-secret", Issuer: "api-gateway"})
+	assert.NoError(t, err)
+}
+
+func TestValidateTokenLeeway(t *testing.T) {
+	now := time.Now()
+	at := func(offset time.Duration) *jwt.NumericDate { return jwt.NewNumericDate(now.Add(offset)) }
+	jwtConfig := config.JWTConfig{SecretKey: "test-secret", Leeway: 30 * time.Second}
+
+	tests := []struct {
+		name    string
+		claims  jwt.RegisteredClaims
+		wantErr error
+	}{
+		{"expired within leeway", jwt.RegisteredClaims{ExpiresAt: at(-10 * time.Second)}, nil},
+		{"expired beyond leeway", jwt.RegisteredClaims{ExpiresAt: at(-time.Minute)}, ErrExpiredToken},
+		{"not yet valid within leeway", jwt.RegisteredClaims{
+			ExpiresAt: at(time.Hour), NotBefore: at(10 * time.Second),
+		}, nil},
+		{"not yet valid beyond leeway", jwt.RegisteredClaims{
+			ExpiresAt: at(time.Hour), NotBefore: at(time.Minute),
+		}, ErrTokenNotYetValid},
+		{"issued in the future within leeway", jwt.RegisteredClaims{
+			ExpiresAt: at(time.Hour), IssuedAt: at(10 * time.Second),
+		}, nil},
+		{"issued in the future beyond leeway", jwt.RegisteredClaims{
+			ExpiresAt: at(time.Hour), IssuedAt: at(time.Minute),
+		}, ErrTokenNotYetValid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateToken(signTestToken(t, tt.claims), jwtConfig)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	// Without leeway the boundaries are exact
+	_, err := validateToken(signTestToken(t, jwt.RegisteredClaims{ExpiresAt: at(-10 * time.Second)}), config.JWTConfig{SecretKey: "test-secret"})
+	assert.ErrorIs(t, err, ErrExpiredToken)
+}
+
+func TestGeneratedTokenPassesAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{JWT: config.JWTConfig{
+		SecretKey: "test-secret", Issuer: "api-gateway", Audience: "gateway-clients", TokenDuration: time.Hour,
+	}}
+
+	router := gin.New()
+	router.GET("/", AuthMiddleware(cfg), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	token, err := GenerateToken("1", "user@example.com", []string{"user"}, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, send(token).Code)
+
+	// A token minted for another service with the same secret is refused
+	other := *cfg
+	other.JWT.Audience = "billing"
+	foreign, _ := GenerateToken("1", "user@example.com", []string{"user"}, &other)
+	w := send(foreign)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), ErrInvalidAudience.Error())
+}
+
+func TestValidateTokenPreviousSecrets(t *testing.T) {
+	sign := func(secret string) string {
+		cfg := &config.Config{JWT: config.JWTConfig{SecretKey: secret, TokenDuration: time.Hour}}
+		token, err := GenerateToken("1", "user@example.com", nil, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	rotated := config.JWTConfig{SecretKey: "new-secret", PreviousSecrets: []string{"old-secret", "older-secret"}}
+
+	for _, secret := range []string{"new-secret", "old-secret", "older-secret"} {
+		claims, err := validateToken(sign(secret), rotated)
+		if assert.NoError(t, err, secret) {
+			assert.Equal(t, "1", claims.UserID)
+		}
+	}
+
+	_, err := validateToken(sign("unknown-secret"), rotated)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Once a previous secret is dropped its tokens are rejected
+	_, err = validateToken(sign("old-secret"), config.JWTConfig{SecretKey: "new-secret"})
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Expiry is still reported for tokens signed with a previous secret
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "1", RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+	}})
+	token, _ := expired.SignedString([]byte("old-secret"))
+	_, err = validateToken(token, rotated)
+	assert.ErrorIs(t, err, ErrExpiredToken)
+}
+
+func TestTokenFromCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{JWT: config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour, CookieAuth: true, CookieName: "session"}}
+	alice, _ := GenerateToken("alice", "alice@example.com", nil, cfg)
+	bob, _ := GenerateToken("bob", "bob@example.com", nil, cfg)
+
+	router := gin.New()
+	router.GET("/me", AuthMiddleware(cfg), func(c *gin.Context) {
+		claims, _ := GetUserFromContext(c)
+		c.String(http.StatusOK, claims.UserID)
+	})
+
+	send := func(header, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/me", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "session", Value: cookie})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("cookie only", func(t *testing.T) {
+		w := send("", alice)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "alice", w.Body.String())
+	})
+
+	t.Run("header only", func(t *testing.T) {
+		w := send("Bearer "+bob, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "bob", w.Body.String())
+	})
+
+	t.Run("both present", func(t *testing.T) {
+		w := send("Bearer "+bob, alice)
+		assert.Equal(t, "bob", w.Body.String(), "the header takes precedence")
+
+		// A malformed header is not replaced by the cookie
+		w = send("Basic Ym9iOg==", alice)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg.JWT.CookieAuth = false
+		defer func() { cfg.JWT.CookieAuth = true }()
+		w := send("", alice)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, CodeAuthTokenMissing, decodeAPIError(t, w).Code)
+	})
+}
+
+func TestRequireScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{JWT: config.JWTConfig{SecretKey: "test-secret"}}
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	router := gin.New()
+	router.POST("/tasks", AuthMiddleware(cfg), RequireScopes("tasks:read", "tasks:write"), ok)
+	router.GET("/tasks", AuthMiddleware(cfg), RequireAnyScope("tasks:read", "tasks:admin"), ok)
+
+	request := func(method, scope string) *httptest.ResponseRecorder {
+		claims := &Claims{UserID: "1", Scope: scope, RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}}
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+		req := httptest.NewRequest(method, "/tasks", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// All of the scopes are required
+	assert.Equal(t, http.StatusOK, request("POST", "tasks:read profile tasks:write").Code)
+	w := request("POST", "tasks:read")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"INSUFFICIENT_SCOPE"`)
+	assert.Contains(t, w.Body.String(), "Missing required scope tasks:write")
+	assert.Equal(t, `Bearer error="insufficient_scope", scope="tasks:read tasks:write"`, w.Header().Get("WWW-Authenticate"))
+
+	// Any one of them suffices
+	assert.Equal(t, http.StatusOK, request("GET", "tasks:read").Code)
+	assert.Equal(t, http.StatusOK, request("GET", "tasks:admin").Code)
+	w = request("GET", "tasks:write")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Missing one of the scopes tasks:read, tasks:admin")
+	assert.Equal(t, http.StatusForbidden, request("GET", "").Code)
+}
@@ -0,0 +1,260 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries the key of the api_key auth scheme
+const APIKeyHeader = "X-Api-Key"
+
+// authRealm is the realm named in WWW-Authenticate challenges
+const authRealm = "api-gateway"
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request carries no
+	// credentials for its scheme, so the next scheme is tried
+	ErrNoCredentials = errors.New("no credentials for auth scheme")
+	// ErrInvalidAPIKey is returned when the API key is not a configured one
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrUnknownClientCert is returned when a verified client certificate's subject has no
+	// configured principal
+	ErrUnknownClientCert = errors.New("client certificate not authorized")
+)
+
+// credentialHeadersKey is the request context key of the credential headers checked by
+// an auth chain
+type credentialHeadersKey struct{}
+
+// CredentialHeaders returns the request headers carrying credentials the gateway checks
+// itself on the request's route. They are meant for the gateway, not the backends.
+func CredentialHeaders(ctx context.Context) []string {
+	headers, _ := ctx.Value(credentialHeadersKey{}).([]string)
+	return headers
+}
+
+// Authenticator checks the credentials of one auth scheme, returning the principal
+// they authenticate as claims
+type Authenticator interface {
+	// Scheme names the auth scheme, e.g. config.AuthSchemeJWT
+	Scheme() string
+	// Challenge is the WWW-Authenticate challenge sent when authentication fails
+	Challenge() string
+	// Authenticate returns ErrNoCredentials when the request carries none for the scheme
+	Authenticate(c *gin.Context) (*Claims, error)
+}
+
+// Authenticators returns the authenticators of the schemes, in order. Schemes are
+// validated when the configuration is loaded; unknown ones are skipped.
+func Authenticators(cfg *config.Config, schemes ...string) []Authenticator {
+	var authenticators []Authenticator
+	for _, scheme := range schemes {
+		switch scheme {
+		case config.AuthSchemeJWT:
+			authenticators = append(authenticators, jwtAuthenticator{cfg: cfg.JWT})
+		case config.AuthSchemeAPIKey:
+			authenticators = append(authenticators, apiKeyAuthenticator{keys: cfg.Auth.APIKeys})
+		case config.AuthSchemeMTLS:
+			authenticators = append(authenticators, clientCertAuthenticator{mappings: cfg.Auth.ClientCerts})
+		}
+	}
+	return authenticators
+}
+
+// AuthChain creates a middleware authenticating requests by the first of the
+// authenticators whose credentials are presented. The claims are stored in the context
+// as AuthMiddleware stores a token's. When none authenticates the request, it answers
+// 401 with a challenge per scheme, and the error of the first credentials rejected.
+func AuthChain(authenticators ...Authenticator) gin.HandlerFunc {
+	consumed := credentialHeaders(authenticators)
+	return func(c *gin.Context) {
+		markCredentialHeaders(c, consumed)
+		claims, err := authenticate(c, authenticators)
+		if err != nil {
+			for _, authenticator := range authenticators {
+				c.Writer.Header().Add("WWW-Authenticate", authenticator.Challenge())
+			}
+			if errors.Is(err, ErrNoCredentials) {
+				AbortWithError(c, CodeAuthRequired, "Authentication required")
+				return
+			}
+			code := authFailureCode(err)
+			RecordAudit(c, AuditEvent{Type: AuditTokenRejected, Outcome: AuditOutcomeFailure, Status: code.Status(), Reason: err.Error()})
+			AbortWithError(c, code, err.Error())
+			return
+		}
+
+		setUser(c, claims)
+		c.Next()
+	}
+}
+
+// OptionalAuthChain creates a middleware that authenticates requests like AuthChain
+// when they carry valid credentials, and lets every other request through
+func OptionalAuthChain(authenticators ...Authenticator) gin.HandlerFunc {
+	consumed := credentialHeaders(authenticators)
+	return func(c *gin.Context) {
+		markCredentialHeaders(c, consumed)
+		if claims, err := authenticate(c, authenticators); err == nil {
+			setUser(c, claims)
+		}
+		c.Next()
+	}
+}
+
+// credentialHeaders returns the request headers carrying the authenticators' credentials,
+// besides the Authorization header and cookies that are forwarded as before
+func credentialHeaders(authenticators []Authenticator) []string {
+	var headers []string
+	for _, authenticator := range authenticators {
+		if authenticator.Scheme() == config.AuthSchemeAPIKey {
+			headers = append(headers, APIKeyHeader)
+		}
+	}
+	return headers
+}
+
+// markCredentialHeaders records the credential headers of the request's route in its
+// context, so that the proxy strips them
+func markCredentialHeaders(c *gin.Context, headers []string) {
+	if len(headers) == 0 {
+		return
+	}
+	ctx := context.WithValue(c.Request.Context(), credentialHeadersKey{}, headers)
+	c.Request = c.Request.WithContext(ctx)
+}
+
+// authenticate tries each authenticator in turn. Rejected credentials don't stop the
+// others being tried, but their error is returned if none succeeds.
+func authenticate(c *gin.Context, authenticators []Authenticator) (*Claims, error) {
+	var rejected error
+	for _, authenticator := range authenticators {
+		claims, err := authenticator.Authenticate(c)
+		if err == nil {
+			claims.AuthScheme = authenticator.Scheme()
+			return claims, nil
+		}
+		if rejected == nil && !errors.Is(err, ErrNoCredentials) {
+			rejected = err
+		}
+	}
+	if rejected != nil {
+		return nil, rejected
+	}
+	return nil, ErrNoCredentials
+}
+
+// authFailureCode returns the error code for rejected credentials
+func authFailureCode(err error) ErrorCode {
+	switch {
+	case errors.Is(err, ErrExpiredToken):
+		return CodeAuthTokenExpired
+	case errors.Is(err, ErrInvalidAPIKey), errors.Is(err, ErrUnknownClientCert):
+		return CodeInvalidCredentials
+	}
+	return CodeAuthTokenInvalid
+}
+
+// setUser stores the authenticated claims in the gin and request contexts
+func setUser(c *gin.Context, claims *Claims) {
+	c.Set(string(UserContextKey), claims)
+	ctx := context.WithValue(c.Request.Context(), UserContextKey, claims)
+	c.Request = c.Request.WithContext(ctx)
+}
+
+// principalClaims returns the claims of a configured principal
+func principalClaims(principal config.AuthPrincipal) *Claims {
+	claims := &Claims{
+		UserID:   principal.UserID,
+		Roles:    principal.Roles,
+		Scope:    strings.Join(principal.Scopes, " "),
+		TenantID: principal.Tenant,
+	}
+	claims.Subject = principal.UserID
+	return claims
+}
+
+// jwtAuthenticator accepts the bearer token, or the token cookie with cookie auth
+type jwtAuthenticator struct {
+	cfg config.JWTConfig
+}
+
+func (a jwtAuthenticator) Scheme() string { return config.AuthSchemeJWT }
+
+func (a jwtAuthenticator) Challenge() string { return `Bearer realm="` + authRealm + `"` }
+
+func (a jwtAuthenticator) Authenticate(c *gin.Context) (*Claims, error) {
+	token, err := extractToken(c, a.cfg)
+	if errors.Is(err, ErrMissingToken) {
+		return nil, ErrNoCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	return validateToken(token, a.cfg)
+}
+
+// apiKeyAuthenticator accepts a configured key in the X-Api-Key header
+type apiKeyAuthenticator struct {
+	keys []config.APIKeyCredential
+}
+
+func (a apiKeyAuthenticator) Scheme() string { return config.AuthSchemeAPIKey }
+
+func (a apiKeyAuthenticator) Challenge() string {
+	return `ApiKey realm="` + authRealm + `", header="` + APIKeyHeader + `"`
+}
+
+func (a apiKeyAuthenticator) Authenticate(c *gin.Context) (*Claims, error) {
+	key := c.GetHeader(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	// Every key is compared, in constant time, so timing doesn't reveal which matched
+	var match *config.APIKeyCredential
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(a.keys[i].Key)) == 1 {
+			match = &a.keys[i]
+		}
+	}
+	if match == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return principalClaims(match.AuthPrincipal), nil
+}
+
+// clientCertAuthenticator accepts a client certificate verified during the TLS
+// handshake whose subject common name is mapped to a principal
+type clientCertAuthenticator struct {
+	mappings []config.ClientCertMapping
+}
+
+func (a clientCertAuthenticator) Scheme() string { return config.AuthSchemeMTLS }
+
+func (a clientCertAuthenticator) Challenge() string {
+	return `Certificate realm="` + authRealm + `"`
+}
+
+func (a clientCertAuthenticator) Authenticate(c *gin.Context) (*Claims, error) {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	subject := state.VerifiedChains[0][0].Subject.CommonName
+	for _, mapping := range a.mappings {
+		if mapping.Subject != subject {
+			continue
+		}
+		principal := mapping.AuthPrincipal
+		if principal.UserID == "" {
+			principal.UserID = subject
+		}
+		return principalClaims(principal), nil
+	}
+	return nil, ErrUnknownClientCert
+}
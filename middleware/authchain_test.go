@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// authChainConfig accepts tokens signed with the test secret and one API key
+func authChainConfig() *config.Config {
+	return &config.Config{
+		JWT: config.JWTConfig{SecretKey: "test-secret"},
+		Auth: config.AuthConfig{
+			APIKeys: []config.APIKeyCredential{{Key: "batch-key", AuthPrincipal: config.AuthPrincipal{
+				UserID: "billing-batch", Roles: []string{"service"}, Scopes: []string{"invoices:read"}, Tenant: "acme",
+			}}},
+			ClientCerts: []config.ClientCertMapping{{Subject: "reporting.internal"}},
+		},
+	}
+}
+
+// authChainRouter answers with the authenticated principal and scheme
+func authChainRouter(handlers ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/invoices", append(handlers, func(c *gin.Context) {
+		claims, ok := GetUserFromContext(c)
+		if !ok {
+			c.String(http.StatusOK, "anonymous")
+			return
+		}
+		c.String(http.StatusOK, claims.AuthScheme+" "+claims.UserID)
+	})...)
+	return router
+}
+
+func TestAuthChainJWTOrAPIKey(t *testing.T) {
+	cfg := authChainConfig()
+	router := authChainRouter(AuthChain(Authenticators(cfg, config.AuthSchemeJWT, config.AuthSchemeAPIKey)...))
+	token := signTestToken(t, jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))})
+	expired := signTestToken(t, jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour))})
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+		wantBody   string
+		wantCode   ErrorCode
+	}{
+		{"token alone", map[string]string{"Authorization": "Bearer " + token}, http.StatusOK, "jwt 1", ""},
+		{"api key alone", map[string]string{APIKeyHeader: "batch-key"}, http.StatusOK, "api_key billing-batch", ""},
+		{"expired token falls back to api key", map[string]string{"Authorization": "Bearer " + expired, APIKeyHeader: "batch-key"}, http.StatusOK, "api_key billing-batch", ""},
+		{"no credentials", nil, http.StatusUnauthorized, "", CodeAuthRequired},
+		{"unknown api key", map[string]string{APIKeyHeader: "guess"}, http.StatusUnauthorized, "", CodeInvalidCredentials},
+		{"expired token", map[string]string{"Authorization": "Bearer " + expired}, http.StatusUnauthorized, "", CodeAuthTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/invoices", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				assert.Contains(t, w.Body.String(), string(tt.wantCode))
+				assert.Equal(t, []string{
+					`Bearer realm="api-gateway"`,
+					`ApiKey realm="api-gateway", header="X-Api-Key"`,
+				}, w.Header().Values("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAuthChainPrincipalRolesScopesAndTenant(t *testing.T) {
+	cfg := authChainConfig()
+	router := authChainRouter(
+		AuthChain(Authenticators(cfg, config.AuthSchemeAPIKey)...),
+		RequireRoles("service"),
+		RequireScopes("invoices:read"),
+		RequireTenant(""),
+	)
+
+	req := httptest.NewRequest("GET", "/invoices", nil)
+	req.Header.Set(APIKeyHeader, "batch-key")
+	req.Header.Set(TenantHeader, "globex")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// The tenant comes from the credential, not the caller
+	assert.Equal(t, "acme", req.Header.Get(TenantHeader))
+}
+
+func TestAuthChainClientCertificate(t *testing.T) {
+	cfg := authChainConfig()
+	router := authChainRouter(AuthChain(Authenticators(cfg, config.AuthSchemeMTLS)...))
+
+	serve := func(commonName string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/invoices", nil)
+		if commonName != "" {
+			leaf := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("reporting.internal")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "mtls reporting.internal", w.Body.String())
+
+	w = serve("intruder.internal")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), string(CodeInvalidCredentials))
+
+	w = serve("")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Certificate realm="api-gateway"`, w.Header().Get("WWW-Authenticate"))
+}
+
+func TestOptionalAuthChain(t *testing.T) {
+	cfg := authChainConfig()
+	router := authChainRouter(OptionalAuthChain(Authenticators(cfg, config.AuthSchemeJWT, config.AuthSchemeAPIKey)...))
+
+	for key, want := range map[string]string{"batch-key": "api_key billing-batch", "guess": "anonymous", "": "anonymous"} {
+		req := httptest.NewRequest("GET", "/invoices", nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, want, w.Body.String(), key)
+	}
+}
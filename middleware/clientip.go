@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trustedProxiesKey is the gin context key of the router's trusted proxy ranges
+const trustedProxiesKey = "trusted_proxies"
+
+// TrustProxies configures how the router resolves client IPs: X-Forwarded-For is only
+// honored from the trusted proxies, and no other header is consulted. Without it Gin
+// trusts every peer, letting clients spoof their IP. Requests carry the ranges so that
+// ClientIP resolves them the same way.
+func TrustProxies(router *gin.Engine, trustedProxies []string) error {
+	ranges, err := ParseIPRanges(trustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	router.ForwardedByClientIP = true
+	router.RemoteIPHeaders = []string{"X-Forwarded-For"}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	router.Use(func(c *gin.Context) {
+		c.Set(trustedProxiesKey, ranges)
+		c.Next()
+	})
+	return nil
+}
+
+// ClientIP returns the client IP of a request as ResolveClientIP resolves it through
+// the router's trusted proxies (see TrustProxies); without them it is the peer.
+// Logs and audit events use it to name the original client. It may have been supplied
+// by that client, so access decisions use accessIP instead.
+func ClientIP(c *gin.Context) string {
+	ranges, _ := c.Value(trustedProxiesKey).(IPRanges)
+	if ip := ResolveClientIP(c.Request.RemoteAddr, ForwardedFor(c.Request.Header), ranges); ip != nil {
+		return ip.String()
+	}
+	return c.Request.RemoteAddr
+}
+
+// accessIP returns the client IP that rate limits, login lockouts, connection caps and
+// idempotency keys are enforced on: the nearest address of the request's chain that
+// isn't one of the router's trusted proxies (see nearestUntrustedIP). Unlike ClientIP's,
+// a client cannot choose it by sending X-Forwarded-For.
+func accessIP(c *gin.Context) string {
+	ranges, _ := c.Value(trustedProxiesKey).(IPRanges)
+	if ip := nearestUntrustedIP(c.Request.RemoteAddr, ForwardedFor(c.Request.Header), ranges); ip != nil {
+		return ip.String()
+	}
+	return c.Request.RemoteAddr
+}
+
+// IPRanges is a list of IP address ranges
+type IPRanges []*net.IPNet
+
+// ParseIPRanges parses a list of CIDR ranges or individual IP addresses
+func ParseIPRanges(entries []string) (IPRanges, error) {
+	ranges := make(IPRanges, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			ranges = append(ranges, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+// Contains reports whether the IP falls within any of the ranges
+func (r IPRanges) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range r {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveClientIP returns the real client IP for a request. X-Forwarded-For is only
+// honored when the immediate peer is a trusted proxy; the client is then the leftmost
+// address in the chain that isn't a trusted proxy. Malformed hops are skipped.
+func ResolveClientIP(remoteAddr, forwardedFor string, trusted IPRanges) net.IP {
+	peer := ParseRemoteIP(remoteAddr)
+	if forwardedFor == "" || !trusted.Contains(peer) {
+		return peer
+	}
+
+	var first net.IP
+	for _, hop := range strings.Split(forwardedFor, ",") {
+		ip := net.ParseIP(strings.TrimSpace(hop))
+		if ip == nil {
+			continue
+		}
+		if !trusted.Contains(ip) {
+			return ip
+		}
+		if first == nil {
+			first = ip
+		}
+	}
+	// Every hop is a trusted proxy: the first of them is the furthest known client
+	if first != nil {
+		return first
+	}
+	return peer
+}
+
+// nearestUntrustedIP returns the rightmost address of the request's chain that isn't a
+// trusted proxy. Hops further left were supplied by that address, so access decisions
+// use this one rather than ResolveClientIP's.
+func nearestUntrustedIP(remoteAddr, forwardedFor string, trusted IPRanges) net.IP {
+	peer := ParseRemoteIP(remoteAddr)
+	if forwardedFor == "" || !trusted.Contains(peer) {
+		return peer
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			// A malformed hop cannot be trusted; stop at the last valid address
+			break
+		}
+		client = ip
+		if !trusted.Contains(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// ParseRemoteIP extracts the IP from a host:port remote address
+func ParseRemoteIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(remoteAddr))
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// ForwardedFor returns the full X-Forwarded-For chain, joining repeated headers
+func ForwardedFor(header http.Header) string {
+	return strings.Join(header.Values("X-Forwarded-For"), ", ")
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestClientIPTrustedProxyChain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	trusted := []string{"10.0.0.0/8"}
+	ranges, _ := ParseIPRanges(trusted)
+
+	router := gin.New()
+	assert.NoError(t, TrustProxies(router, trusted))
+	router.GET("/", func(c *gin.Context) {
+		ip := ClientIP(c)
+		c.String(http.StatusOK, ip)
+		c.Header("X-Seen-Forwarded-For", strings.Join(c.Request.Header.Values("X-Forwarded-For"), "|"))
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{"untrusted peer ignores header", "203.0.113.9:5000", map[string][]string{"X-Forwarded-For": {"1.2.3.4"}}, "203.0.113.9"},
+		{"leftmost untrusted hop behind proxies", "10.0.0.2:443", map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.7, 10.0.0.3"}}, "1.2.3.4"},
+		{"trusted and malformed hops are skipped", "10.0.0.2:443", map[string][]string{"X-Forwarded-For": {"10.0.0.9, unknown, 198.51.100.7, 10.0.0.3"}}, "198.51.100.7"},
+		{"repeated headers form one chain", "10.0.0.2:443", map[string][]string{"X-Forwarded-For": {"1.2.3.4", "198.51.100.7"}}, "1.2.3.4"},
+		{"only trusted hops", "10.0.0.2:443", map[string][]string{"X-Forwarded-For": {"10.0.0.9, 10.0.0.3"}}, "10.0.0.9"},
+		{"X-Real-IP is not consulted", "10.0.0.2:443", map[string][]string{"X-Real-IP": {"1.2.3.4"}}, "10.0.0.2"},
+		{"trusted peer without header", "10.0.0.2:443", nil, "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.headers {
+				for _, value := range values {
+					req.Header.Add(name, value)
+				}
+			}
+			want := ResolveClientIP(req.RemoteAddr, ForwardedFor(req.Header), ranges)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Body.String())
+			assert.Equal(t, want.String(), w.Body.String(), "agrees with ResolveClientIP")
+			assert.Equal(t, strings.Join(tt.headers["X-Forwarded-For"], "|"), w.Header().Get("X-Seen-Forwarded-For"), "request left unchanged")
+		})
+	}
+}
+
+func TestTrustProxiesRejectsInvalidEntries(t *testing.T) {
+	assert.Error(t, TrustProxies(gin.New(), []string{"not-an-ip"}))
+}
+
+func TestLoggerUsesResolvedClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.InfoLevel)
+	router := gin.New()
+	assert.NoError(t, TrustProxies(router, []string{"10.0.0.0/8"}))
+	router.Use(Logger(zap.New(core), &config.Config{}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:443"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.3")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, 1, logs.Len())
+	assert.Equal(t, "198.51.100.7", logs.All()[0].ContextMap()["ip"])
+}
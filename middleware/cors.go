@@ -1,30 +1,203 @@
 package middleware
 
 import (
+	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/api-gateway/config"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 // CORS returns a CORS middleware configured based on application config
 func CORS(cfg *config.Config) gin.HandlerFunc {
+	return corsHandler(cfg.CORS)
+}
+
+// corsHandler returns a CORS middleware applying one policy
+func corsHandler(rules config.CORSConfig) gin.HandlerFunc {
+	handler := cors.New(corsConfig(rules))
+	if rules.MaxAge != 0 {
+		return handler
+	}
+
+	// gin-contrib/cors omits Access-Control-Max-Age when it is zero, which lets browsers
+	// cache preflights for their default time. Send an explicit 0 to force a preflight
+	// before every request.
+	return func(c *gin.Context) {
+		if isPreflight(c.Request) {
+			c.Header("Access-Control-Max-Age", "0")
+		}
+		handler(c)
+	}
+}
+
+// isPreflight reports whether the request is a CORS preflight request
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions &&
+		req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// CORSPolicy is a CORS middleware whose configuration can be replaced at runtime.
+// Route groups can be attached to named policies (cors.policies); other requests get
+// the global policy.
+type CORSPolicy struct {
+	handlers atomic.Pointer[corsHandlers]
+	// groups are the attached route groups, longest prefix first. They are only
+	// changed while routes are set up.
+	groups []corsGroup
+}
+
+// corsHandlers are the middleware built from one CORS configuration
+type corsHandlers struct {
+	global gin.HandlerFunc
+	named  map[string]gin.HandlerFunc
+}
+
+// corsGroup attaches a named policy to the paths under a route group
+type corsGroup struct {
+	prefix string
+	policy string
+}
+
+// NewCORSPolicy creates a reloadable CORS middleware
+func NewCORSPolicy(cfg *config.Config) *CORSPolicy {
+	policy := &CORSPolicy{}
+	policy.handlers.Store(newCORSHandlers(cfg.CORS))
+	return policy
+}
+
+// newCORSHandlers builds the global and named policy middleware
+func newCORSHandlers(rules config.CORSConfig) *corsHandlers {
+	handlers := &corsHandlers{
+		global: corsHandler(rules),
+		named:  make(map[string]gin.HandlerFunc, len(rules.Policies)),
+	}
+	for name := range rules.Policies {
+		policy, _ := rules.Policy(name)
+		handlers.named[name] = corsHandler(policy)
+	}
+	return handlers
+}
+
+// Update swaps in CORS handlers built from the new configuration. An invalid
+// configuration is rejected and the current one kept.
+func (p *CORSPolicy) Update(cfg *config.Config) error {
+	if err := validateCORS(cfg.CORS); err != nil {
+		return err
+	}
+	for name := range cfg.CORS.Policies {
+		policy, _ := cfg.CORS.Policy(name)
+		if err := validateCORS(policy); err != nil {
+			return fmt.Errorf("cors policy %s: %w", name, err)
+		}
+	}
+	p.handlers.Store(newCORSHandlers(cfg.CORS))
+	return nil
+}
+
+// validateCORS checks a policy's origin patterns and its gin-contrib/cors config
+func validateCORS(rules config.CORSConfig) error {
+	if rules.OriginMatch == config.OriginMatchWildcard || rules.OriginMatch == config.OriginMatchRegex {
+		if _, err := rules.OriginPatterns(); err != nil {
+			return err
+		}
+	}
+	return corsConfig(rules).Validate()
+}
+
+// Attach applies the named policy to requests under the route group, preflights
+// included. Requests fall back to the global policy while no policy of that name is
+// configured. A nil CORSPolicy ignores attachments.
+func (p *CORSPolicy) Attach(group *gin.RouterGroup, name string) {
+	if p == nil {
+		return
+	}
+	p.groups = append(p.groups, corsGroup{prefix: strings.TrimSuffix(group.BasePath(), "/"), policy: name})
+	sort.SliceStable(p.groups, func(i, j int) bool {
+		return len(p.groups[i].prefix) > len(p.groups[j].prefix)
+	})
+}
+
+// Middleware returns a Gin middleware applying the current CORS configuration. The
+// policy is chosen by path rather than by matched route, since preflights for most
+// paths match no route.
+func (p *CORSPolicy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p.handlerFor(c.Request.URL.Path)(c)
+	}
+}
+
+// handlerFor returns the middleware of the policy attached to the path
+func (p *CORSPolicy) handlerFor(path string) gin.HandlerFunc {
+	handlers := p.handlers.Load()
+	for _, group := range p.groups {
+		if !hasPathPrefix(path, group.prefix) {
+			continue
+		}
+		if handler, ok := handlers.named[group.policy]; ok {
+			return handler
+		}
+		break
+	}
+	return handlers.global
+}
+
+// hasPathPrefix reports whether path is prefix or lies under it
+func hasPathPrefix(path, prefix string) bool {
+	rest, ok := strings.CutPrefix(path, prefix)
+	return ok && (rest == "" || rest[0] == '/')
+}
+
+// corsConfig converts a CORS policy into a gin-contrib/cors config
+func corsConfig(rules config.CORSConfig) cors.Config {
 	corsConfig := cors.Config{
-		AllowOrigins:     cfg.CORS.AllowOrigins,
-		AllowMethods:     cfg.CORS.AllowMethods,
-		AllowHeaders:     cfg.CORS.AllowHeaders,
-		ExposeHeaders:    cfg.CORS.ExposeHeaders,
-		AllowCredentials: cfg.CORS.AllowCredentials,
-		MaxAge:           time.Duration(cfg.CORS.MaxAge) * time.Second,
+		AllowOrigins:     rules.AllowOrigins,
+		AllowMethods:     rules.AllowMethods,
+		AllowHeaders:     rules.AllowHeaders,
+		ExposeHeaders:    rules.ExposeHeaders,
+		AllowCredentials: rules.AllowCredentials,
+		MaxAge:           time.Duration(rules.MaxAge) * time.Second,
+	}
+
+	// Wildcard and regex origins are matched by pattern; the matching origin is
+	// reflected rather than a static value
+	switch rules.OriginMatch {
+	case config.OriginMatchWildcard, config.OriginMatchRegex:
+		patterns, _ := rules.OriginPatterns() // Checked when the config is validated
+		allowAll := contains(rules.AllowOrigins, "*")
+		corsConfig.AllowOrigins = nil
+		corsConfig.AllowOriginFunc = func(origin string) bool {
+			if allowAll {
+				return true
+			}
+			for _, pattern := range patterns {
+				if pattern.MatchString(origin) {
+					return true
+				}
+			}
+			return false
+		}
+		return corsConfig
 	}
 
 	// If allow origins contains "*", we need to handle it specially
-	if contains(cfg.CORS.AllowOrigins, "*") {
-		corsConfig.AllowAllOrigins = true
+	if contains(rules.AllowOrigins, "*") {
 		corsConfig.AllowOrigins = nil
+		if rules.AllowCredentials {
+			// Browsers reject credentialed responses allowing "*", so reflect the
+			// request's origin instead (with Vary: Origin)
+			corsConfig.AllowOriginFunc = func(string) bool { return true }
+		} else {
+			corsConfig.AllowAllOrigins = true
+		}
 	}
 
-	return cors.New(corsConfig)
+	return corsConfig
 }
 
 // contains checks if a string slice contains a specific string
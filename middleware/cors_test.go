@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func corsPreflight(t *testing.T, maxAge int) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORS(&config.Config{CORS: config.CORSConfig{
+		AllowOrigins: []string{"https://app.example.com"},
+		AllowMethods: []string{"GET", "POST"},
+		AllowHeaders: []string{"Content-Type"},
+		MaxAge:       maxAge,
+	}}))
+	router.POST("/resource", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest(http.MethodOptions, "/resource", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSMaxAge(t *testing.T) {
+	w := corsPreflight(t, 600)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCORSMaxAgeZeroForcesPreflight(t *testing.T) {
+	w := corsPreflight(t, 0)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"0"}, w.Header().Values("Access-Control-Max-Age"))
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSMaxAgeZeroOnlyOnPreflight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORS(&config.Config{CORS: config.CORSConfig{
+		AllowOrigins: []string{"https://app.example.com"},
+		AllowMethods: []string{"GET"},
+	}}))
+	router.GET("/resource", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest(http.MethodGet, "/resource", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCORSWildcardWithCredentialsReflectsOrigin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORS(&config.Config{CORS: config.CORSConfig{
+		AllowOrigins:     []string{"*"},
+		AllowMethods:     []string{"GET"},
+		AllowCredentials: true,
+	}}))
+	router.GET("/resource", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest(http.MethodGet, "/resource", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, w.Header().Values("Vary"), "Origin")
+}
+
+func TestCORSPolicyUpdateAndAttach(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{CORS: config.CORSConfig{
+		AllowOrigins: []string{"https://app.example.com"},
+		AllowMethods: []string{"GET"},
+	}}
+	policy := NewCORSPolicy(cfg)
+
+	router := gin.New()
+	router.Use(policy.Middleware())
+	assets := router.Group("/assets")
+	policy.Attach(assets, "assets")
+	assets.GET("/app.js", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/api", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	allowOrigin := func(path string) string {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	// Until an assets policy is configured the group uses the global one
+	assert.Equal(t, "https://app.example.com", allowOrigin("/assets/app.js"))
+
+	err := policy.Update(&config.Config{CORS: config.CORSConfig{
+		AllowOrigins: []string{"https://app.example.com"},
+		AllowMethods: []string{"GET"},
+		Policies:     map[string]config.CORSConfig{"assets": {AllowOrigins: []string{"*"}}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, "*", allowOrigin("/assets/app.js"))
+	assert.Equal(t, "https://app.example.com", allowOrigin("/api"))
+
+	// An invalid named policy is rejected and the current configuration kept
+	err = policy.Update(&config.Config{CORS: config.CORSConfig{
+		AllowOrigins: []string{"https://app.example.com"},
+		Policies:     map[string]config.CORSConfig{"assets": {AllowOrigins: []string{"app.example.com"}}},
+	}})
+	assert.Error(t, err)
+	assert.Equal(t, "*", allowOrigin("/assets/app.js"))
+}
+
+func TestCORSOriginPatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		match   string
+		origins []string
+	}{
+		{"wildcard", config.OriginMatchWildcard, []string{"https://*.preview.ourapp.com"}},
+		{"regex", config.OriginMatchRegex, []string{`https://[a-z0-9-]+\.preview\.ourapp\.com`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(CORS(&config.Config{CORS: config.CORSConfig{
+				AllowOrigins:     tt.origins,
+				OriginMatch:      tt.match,
+				AllowMethods:     []string{"GET"},
+				AllowCredentials: true,
+			}}))
+			router.GET("/resource", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			request := func(origin string) *httptest.ResponseRecorder {
+				req, _ := http.NewRequest(http.MethodGet, "/resource", nil)
+				req.Header.Set("Origin", origin)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+
+			w := request("https://pr-42.preview.ourapp.com")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "https://pr-42.preview.ourapp.com", w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+
+			for _, origin := range []string{"https://preview.ourapp.com", "https://pr-42.preview.ourapp.com.evil.com", "http://pr-42.preview.ourapp.com"} {
+				w := request(origin)
+				assert.Equal(t, http.StatusForbidden, w.Code, origin)
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+			}
+		})
+	}
+}
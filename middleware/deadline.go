@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http/httpguts"
+)
+
+// RequestDeadline returns a middleware that bounds the total time spent on a request.
+// The deadline is set on the request context, so every later middleware and the proxy
+// share one budget instead of each applying its own timeout. A request whose budget
+// runs out before a response is written gets a 503.
+func RequestDeadline(budget time.Duration) gin.HandlerFunc {
+	if budget <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		// Cancelling the context would tear down an upgraded connection, whose lifetime
+		// is not a request budget
+		if IsUpgradeRequest(c.Request) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), budget)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if !c.Writer.Written() && BudgetExceeded(c.Request.Context()) {
+			AbortBudgetExceeded(c)
+		}
+	}
+}
+
+// IsUpgradeRequest reports whether the request asks to switch protocols (WebSocket or
+// any other Upgrade), i.e. Connection lists "upgrade" and Upgrade names a protocol
+func IsUpgradeRequest(req *http.Request) bool {
+	return req.Header.Get("Upgrade") != "" && httpguts.HeaderValuesContainsToken(req.Header["Connection"], "Upgrade")
+}
+
+// BudgetExceeded reports whether the request's deadline has passed
+func BudgetExceeded(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// AbortBudgetExceeded aborts the request with a 503 because its time budget ran out
+func AbortBudgetExceeded(c *gin.Context) {
+	AbortWithError(c, CodeRequestBudgetExceeded, "Request time budget exceeded")
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowIO simulates a middleware doing I/O that honors the request context
+func slowIO(delay time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		select {
+		case <-time.After(delay):
+			c.Next()
+		case <-c.Request.Context().Done():
+			if BudgetExceeded(c.Request.Context()) {
+				AbortBudgetExceeded(c)
+				return
+			}
+			c.Abort()
+		}
+	}
+}
+
+func TestRequestDeadlineBoundsTotalTime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Each stage is individually under a second, but together they exceed the budget
+	// wherever the delay occurs
+	stages := map[string][]gin.HandlerFunc{
+		"first":  {slowIO(time.Second), slowIO(0)},
+		"second": {slowIO(30 * time.Millisecond), slowIO(time.Second)},
+		"spread": {slowIO(60 * time.Millisecond), slowIO(60 * time.Millisecond)},
+	}
+
+	for name, handlers := range stages {
+		t.Run(name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(RequestDeadline(100 * time.Millisecond))
+			router.Use(handlers...)
+			router.GET("/resource", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req, _ := http.NewRequest("GET", "/resource", nil)
+			w := httptest.NewRecorder()
+			start := time.Now()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			assert.Contains(t, w.Body.String(), "Request time budget exceeded")
+			assert.Less(t, time.Since(start), 500*time.Millisecond)
+		})
+	}
+}
+
+func TestRequestDeadlineWithinBudget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestDeadline(time.Second))
+	router.GET("/resource", func(c *gin.Context) {
+		_, hasDeadline := c.Request.Context().Deadline()
+		assert.True(t, hasDeadline)
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/resource", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRequestDeadlineDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestDeadline(0))
+	router.GET("/resource", func(c *gin.Context) {
+		_, hasDeadline := c.Request.Context().Deadline()
+		assert.False(t, hasDeadline)
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/resource", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
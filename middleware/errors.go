@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorCode is a stable, machine-readable identifier of a gateway error that clients
+// can branch on. Codes are never renamed once released; messages may change.
+type ErrorCode string
+
+// Error catalog. The HTTP status of each code is listed in errorStatus.
+const (
+	CodeBadRequest            ErrorCode = "BAD_REQUEST"
+	CodeValidationFailed      ErrorCode = "VALIDATION_FAILED"
+	CodeBodyTooLarge          ErrorCode = "BODY_TOO_LARGE"
+	CodeHeadersTooLarge       ErrorCode = "HEADERS_TOO_LARGE"
+	CodeInternal              ErrorCode = "INTERNAL_ERROR"
+	CodeAuthTokenMissing      ErrorCode = "AUTH_TOKEN_MISSING"
+	CodeAuthTokenInvalid      ErrorCode = "AUTH_TOKEN_INVALID"
+	CodeAuthTokenExpired      ErrorCode = "AUTH_TOKEN_EXPIRED"
+	CodeAuthRequired          ErrorCode = "AUTH_REQUIRED"
+	CodeInsufficientRole      ErrorCode = "INSUFFICIENT_ROLE"
+	CodeInsufficientScope     ErrorCode = "INSUFFICIENT_SCOPE"
+	CodeInvalidCredentials    ErrorCode = "INVALID_CREDENTIALS"
+	CodeLoginLockedOut        ErrorCode = "LOGIN_LOCKED_OUT"
+	CodeAuthUnavailable       ErrorCode = "AUTH_UNAVAILABLE"
+	CodeRateLimited           ErrorCode = "RATE_LIMITED"
+	CodeQuotaExceeded         ErrorCode = "QUOTA_EXCEEDED"
+	CodeIdempotencyInFlight   ErrorCode = "IDEMPOTENCY_IN_FLIGHT"
+	CodeIdempotencyKeyReused  ErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	CodeServiceNotFound       ErrorCode = "SERVICE_NOT_FOUND"
+	CodeTenantUnresolved      ErrorCode = "TENANT_UNRESOLVED"
+	CodeNoHealthyUpstream     ErrorCode = "NO_HEALTHY_UPSTREAM"
+	CodeConcurrencyLimited    ErrorCode = "CONCURRENCY_LIMITED"
+	CodeUpstreamUnreachable   ErrorCode = "UPSTREAM_UNREACHABLE"
+	CodeUpstreamTimeout       ErrorCode = "UPSTREAM_TIMEOUT"
+	CodeRequestBudgetExceeded ErrorCode = "REQUEST_BUDGET_EXCEEDED"
+	CodeMaintenance           ErrorCode = "MAINTENANCE"
+	CodeStarting              ErrorCode = "STARTING"
+	CodeNotFound              ErrorCode = "NOT_FOUND"
+	CodeMethodNotAllowed      ErrorCode = "METHOD_NOT_ALLOWED"
+	CodeNotImplemented        ErrorCode = "NOT_IMPLEMENTED"
+)
+
+// errorStatus maps each error code to its HTTP status
+var errorStatus = map[ErrorCode]int{
+	CodeBadRequest:            http.StatusBadRequest,
+	CodeValidationFailed:      http.StatusUnprocessableEntity,
+	CodeBodyTooLarge:          http.StatusRequestEntityTooLarge,
+	CodeHeadersTooLarge:       http.StatusRequestHeaderFieldsTooLarge,
+	CodeInternal:              http.StatusInternalServerError,
+	CodeAuthTokenMissing:      http.StatusUnauthorized,
+	CodeAuthTokenInvalid:      http.StatusUnauthorized,
+	CodeAuthTokenExpired:      http.StatusUnauthorized,
+	CodeAuthRequired:          http.StatusUnauthorized,
+	CodeInsufficientRole:      http.StatusForbidden,
+	CodeInsufficientScope:     http.StatusForbidden,
+	CodeInvalidCredentials:    http.StatusUnauthorized,
+	CodeLoginLockedOut:        http.StatusTooManyRequests,
+	CodeAuthUnavailable:       http.StatusServiceUnavailable,
+	CodeRateLimited:           http.StatusTooManyRequests,
+	CodeQuotaExceeded:         http.StatusTooManyRequests,
+	CodeIdempotencyInFlight:   http.StatusConflict,
+	CodeIdempotencyKeyReused:  http.StatusUnprocessableEntity,
+	CodeServiceNotFound:       http.StatusInternalServerError,
+	CodeTenantUnresolved:      http.StatusBadRequest,
+	CodeNoHealthyUpstream:     http.StatusServiceUnavailable,
+	CodeConcurrencyLimited:    http.StatusServiceUnavailable,
+	CodeUpstreamUnreachable:   http.StatusBadGateway,
+	CodeUpstreamTimeout:       http.StatusGatewayTimeout,
+	CodeRequestBudgetExceeded: http.StatusServiceUnavailable,
+	CodeMaintenance:           http.StatusServiceUnavailable,
+	CodeStarting:              http.StatusServiceUnavailable,
+	CodeNotFound:              http.StatusNotFound,
+	CodeMethodNotAllowed:      http.StatusMethodNotAllowed,
+	CodeNotImplemented:        http.StatusNotImplemented,
+}
+
+// Status returns the HTTP status of the error code, 500 for unknown codes
+func (code ErrorCode) Status() int {
+	if status, ok := errorStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// APIError is the body of errors produced by the gateway itself, as opposed to errors
+// passed through from backends. It is rendered as JSON, XML or plain text depending on
+// the request's Accept header.
+type APIError struct {
+	XMLName   xml.Name  `json:"-" xml:"error"`
+	Error     string    `json:"error" xml:"status"`                              // Status text, e.g. "Bad Gateway"
+	Code      ErrorCode `json:"code" xml:"code"`                                 // Stable machine-readable code
+	Message   string    `json:"message" xml:"message"`                           // Human-readable detail
+	RequestID string    `json:"request_id,omitempty" xml:"request_id,omitempty"` // Set by the RequestID middleware
+	// Details lists the offending fields of a request body that failed validation
+	Details []FieldError `json:"details,omitempty" xml:"details>detail,omitempty"`
+}
+
+// FieldError describes one problem with a field of the request body
+type FieldError struct {
+	Field   string `json:"field" xml:"field"` // JSON pointer to the value, empty for the whole body
+	Message string `json:"message" xml:"message"`
+}
+
+// NewAPIError returns the APIError for code, echoing the request's ID
+func NewAPIError(r *http.Request, code ErrorCode, message string) APIError {
+	return APIError{
+		Error:     http.StatusText(code.Status()),
+		Code:      code,
+		Message:   message,
+		RequestID: r.Header.Get(RequestIDHeader),
+	}
+}
+
+// AbortWithError aborts the request with the error for code
+func AbortWithError(c *gin.Context, code ErrorCode, message string) {
+	AbortWithAPIError(c, NewAPIError(c.Request, code, message))
+}
+
+// AbortWithAPIError aborts the request with apiErr, for errors carrying details
+func AbortWithAPIError(c *gin.Context, apiErr APIError) {
+	c.Abort()
+	writeAPIError(c.Writer, c.Request, apiErr)
+}
+
+// WriteError writes the error for code, for handlers that only have an
+// http.ResponseWriter
+func WriteError(w http.ResponseWriter, r *http.Request, code ErrorCode, message string) {
+	writeAPIError(w, r, NewAPIError(r, code, message))
+}
+
+// Error response formats, chosen by the request's Accept header
+const (
+	errorFormatJSON = "json"
+	errorFormatXML  = "xml"
+	errorFormatText = "text"
+)
+
+// errorMediaTypes maps the media types clients may accept to the format served for
+// them. Wildcards and anything unlisted get JSON.
+var errorMediaTypes = map[string]string{
+	"application/json": errorFormatJSON,
+	"application/xml":  errorFormatXML,
+	"text/xml":         errorFormatXML,
+	"text/plain":       errorFormatText,
+	"text/*":           errorFormatText,
+}
+
+// writeAPIError renders apiErr in the format the client accepts, defaulting to JSON.
+// Marshaling keeps the body well-formed whatever the message.
+func writeAPIError(w http.ResponseWriter, r *http.Request, apiErr APIError) {
+	var body []byte
+	var contentType string
+	switch negotiateErrorFormat(r.Header.Values("Accept")) {
+	case errorFormatXML:
+		body, _ = xml.Marshal(apiErr)
+		body = append([]byte(xml.Header), body...)
+		contentType = "application/xml; charset=utf-8"
+	case errorFormatText:
+		body = []byte(apiErr.text())
+		contentType = "text/plain; charset=utf-8"
+	default:
+		body, _ = json.Marshal(apiErr)
+		contentType = "application/json; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(apiErr.Code.Status())
+	w.Write(body)
+}
+
+// text renders the error as plain text, one field per line
+func (e APIError) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d %s\n", e.Code.Status(), e.Error)
+	fmt.Fprintf(&b, "code: %s\n", e.Code)
+	fmt.Fprintf(&b, "message: %s\n", e.Message)
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, "request_id: %s\n", e.RequestID)
+	}
+	for _, detail := range e.Details {
+		fmt.Fprintf(&b, "detail: %s: %s\n", detail.Field, detail.Message)
+	}
+	return b.String()
+}
+
+// negotiateErrorFormat picks the error format with the highest quality in the Accept
+// header values, preferring JSON, then XML, then text on ties. JSON is served when
+// nothing is acceptable, as an error response beats a 406.
+func negotiateErrorFormat(accept []string) string {
+	best, bestQ := errorFormatJSON, 0.0
+	rank := map[string]int{errorFormatJSON: 0, errorFormatXML: 1, errorFormatText: 2}
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			format, ok := errorMediaTypes[mediaType]
+			if !ok {
+				if mediaType != "*/*" && mediaType != "application/*" {
+					continue
+				}
+				format = errorFormatJSON
+			}
+			q := 1.0
+			if raw, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(raw, 64); err != nil {
+					continue
+				}
+			}
+			if q > bestQ || (q == bestQ && q > 0 && rank[format] < rank[best]) {
+				best, bestQ = format, q
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeAPIError decodes an error response body
+func decodeAPIError(t *testing.T, w *httptest.ResponseRecorder) APIError {
+	var body APIError
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body
+}
+
+func TestErrorCatalogStatuses(t *testing.T) {
+	for code, status := range errorStatus {
+		assert.NotEmpty(t, http.StatusText(status), code)
+		assert.Equal(t, status, code.Status())
+	}
+	assert.Equal(t, http.StatusInternalServerError, ErrorCode("UNKNOWN").Status())
+}
+
+func TestErrorPathsReturnCodeAndRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		JWT: config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour},
+		RateLimit: config.RateLimitConfig{
+			Enabled: true, RequestsPerMin: 1, BurstSize: 1, CleanupInterval: time.Minute,
+		},
+	}
+	rl, err := NewRateLimiter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Close()
+
+	router := gin.New()
+	assert.NoError(t, TrustProxies(router, nil))
+	router.Use(RequestID(cfg))
+	router.GET("/protected", AuthMiddleware(cfg), RequireRoles("admin"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/limited", rl.Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	userToken, _ := GenerateToken("1", "user@example.com", []string{"user"}, cfg)
+	expired := signTestToken(t, jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))})
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		wantStatus    int
+		wantCode      ErrorCode
+	}{
+		{"missing token", "/protected", "", http.StatusUnauthorized, CodeAuthTokenMissing},
+		{"malformed header", "/protected", "Token abc", http.StatusUnauthorized, CodeAuthTokenInvalid},
+		{"invalid token", "/protected", "Bearer not-a-jwt", http.StatusUnauthorized, CodeAuthTokenInvalid},
+		{"expired token", "/protected", "Bearer " + expired, http.StatusUnauthorized, CodeAuthTokenExpired},
+		{"missing role", "/protected", "Bearer " + userToken, http.StatusForbidden, CodeInsufficientRole},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set(RequestIDHeader, "req-"+tt.name)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			body := decodeAPIError(t, w)
+			assert.Equal(t, tt.wantCode, body.Code)
+			assert.Equal(t, http.StatusText(tt.wantStatus), body.Error)
+			assert.Equal(t, "req-"+tt.name, body.RequestID)
+		})
+	}
+
+	t.Run("rate limited", func(t *testing.T) {
+		var w *httptest.ResponseRecorder
+		for i := 0; i < 2; i++ {
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/limited", nil))
+		}
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		body := decodeAPIError(t, w)
+		assert.Equal(t, CodeRateLimited, body.Code)
+		assert.NotEmpty(t, body.RequestID)
+		assert.Equal(t, w.Header().Get(RequestIDHeader), body.RequestID)
+	})
+}
+
+func TestWriteErrorWithoutRequestID(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteError(w, httptest.NewRequest("GET", "/", nil), CodeUpstreamUnreachable, `dial "backend": refused`)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"Bad Gateway","code":"UPSTREAM_UNREACHABLE","message":"dial \"backend\": refused"}`, w.Body.String())
+}
+
+func TestErrorContentNegotiation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		JWT: config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour},
+		RateLimit: config.RateLimitConfig{
+			Enabled: true, RequestsPerMin: 1, BurstSize: 1, CleanupInterval: time.Minute,
+		},
+	}
+	rl, err := NewRateLimiter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Close()
+
+	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.Use(MethodFilter(cfg))
+	router.GET("/protected", AuthMiddleware(cfg), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/limited", rl.Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/proxied", func(c *gin.Context) {
+		WriteError(c.Writer, c.Request, CodeUpstreamUnreachable, "connection refused")
+	})
+	router.NoRoute(func(c *gin.Context) { AbortWithError(c, CodeNotFound, "The requested endpoint does not exist") })
+	router.NoMethod(func(c *gin.Context) { AbortWithError(c, CodeMethodNotAllowed, "Method not allowed") })
+	// Use up the rate limit so every later request is limited
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/limited", nil))
+
+	paths := []struct {
+		method, path string
+		wantCode     ErrorCode
+	}{
+		{"GET", "/protected", CodeAuthTokenMissing},
+		{"GET", "/limited", CodeRateLimited},
+		{"GET", "/proxied", CodeUpstreamUnreachable},
+		{"GET", "/missing", CodeNotFound},
+		{"DELETE", "/protected", CodeMethodNotAllowed},
+		{"TRACE", "/protected", CodeMethodNotAllowed},
+	}
+	accepts := []struct {
+		accept, wantType string
+	}{
+		{"", "application/json; charset=utf-8"},
+		{"*/*", "application/json; charset=utf-8"},
+		{"text/html", "application/json; charset=utf-8"},
+		{"application/json", "application/json; charset=utf-8"},
+		{"application/xml", "application/xml; charset=utf-8"},
+		{"text/xml;q=0.9, application/json;q=0.5", "application/xml; charset=utf-8"},
+		{"text/plain", "text/plain; charset=utf-8"},
+		{"application/json;q=0, text/*", "text/plain; charset=utf-8"},
+	}
+
+	for _, p := range paths {
+		for _, a := range accepts {
+			t.Run(p.method+" "+p.path+" "+a.accept, func(t *testing.T) {
+				req := httptest.NewRequest(p.method, p.path, nil)
+				req.Header.Set(RequestIDHeader, "req-1")
+				if a.accept != "" {
+					req.Header.Set("Accept", a.accept)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, p.wantCode.Status(), w.Code)
+				assert.Equal(t, a.wantType, w.Header().Get("Content-Type"))
+				assert.Contains(t, w.Header().Values("Vary"), "Accept")
+
+				var body APIError
+				switch a.wantType {
+				case "application/xml; charset=utf-8":
+					assert.True(t, strings.HasPrefix(w.Body.String(), xml.Header))
+					assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &body))
+				case "text/plain; charset=utf-8":
+					assert.Contains(t, w.Body.String(), "code: "+string(p.wantCode)+"\n")
+					assert.Contains(t, w.Body.String(), "request_id: req-1\n")
+					return
+				default:
+					assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				}
+				assert.Equal(t, p.wantCode, body.Code)
+				assert.Equal(t, http.StatusText(w.Code), body.Error)
+				assert.Equal(t, "req-1", body.RequestID)
+			})
+		}
+	}
+}
+
+func TestErrorDetailsRendering(t *testing.T) {
+	apiErr := NewAPIError(httptest.NewRequest("POST", "/", nil), CodeValidationFailed, "Invalid body")
+	apiErr.Details = []FieldError{{Field: "/name", Message: "missing property"}}
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	writeAPIError(w, req, apiErr)
+	assert.Equal(t, xml.Header+`<error><status>Unprocessable Entity</status><code>VALIDATION_FAILED</code>`+
+		`<message>Invalid body</message><details><detail><field>/name</field><message>missing property</message></detail></details></error>`,
+		w.Body.String())
+
+	req.Header.Set("Accept", "text/plain")
+	w = httptest.NewRecorder()
+	writeAPIError(w, req, apiErr)
+	assert.Equal(t, "422 Unprocessable Entity\ncode: VALIDATION_FAILED\nmessage: Invalid body\ndetail: /name: missing property\n", w.Body.String())
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServerMaxHeaderBytes returns the http.Server MaxHeaderBytes for a header limit of
+// maxBytes (0 for Go's default). The server reads up to twice the limit so that
+// HeaderSizeLimit can answer oversized requests with a JSON error; only requests
+// beyond that get the plain-text 431 of net/http.
+func ServerMaxHeaderBytes(maxBytes int) int {
+	if maxBytes <= 0 {
+		maxBytes = http.DefaultMaxHeaderBytes
+	}
+	return 2 * maxBytes
+}
+
+// HeaderSizeLimit returns a middleware rejecting requests whose request line and
+// headers exceed maxBytes (0 for Go's default) with a 431
+func HeaderSizeLimit(maxBytes int) gin.HandlerFunc {
+	if maxBytes <= 0 {
+		maxBytes = http.DefaultMaxHeaderBytes
+	}
+
+	return func(c *gin.Context) {
+		if size := headerSize(c.Request); size > maxBytes {
+			AbortWithError(c, CodeHeadersTooLarge, fmt.Sprintf("Request headers are %d bytes, above the limit of %d", size, maxBytes))
+			return
+		}
+		c.Next()
+	}
+}
+
+// headerSize returns the size of the request line and headers as sent over HTTP/1.1
+func headerSize(r *http.Request) int {
+	// "GET /path HTTP/1.1\r\n" and "Host: example.com\r\n", which is not in r.Header
+	size := len(r.Method) + len(r.RequestURI) + len(r.Proto) + 4
+	size += len("Host: ") + len(r.Host) + 2
+	for name, values := range r.Header {
+		for _, value := range values {
+			size += len(name) + len(": ") + len(value) + 2
+		}
+	}
+	return size
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderSizeLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(HeaderSizeLimit(4096))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.MaxHeaderBytes = ServerMaxHeaderBytes(4096)
+	server.Start()
+	defer server.Close()
+
+	send := func(cookie string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+"/", nil)
+		req.Header.Set("Cookie", cookie)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := send("session=" + strings.Repeat("a", 1000))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Too large for the limit, but read by the server: the JSON error
+	resp = send("session=" + strings.Repeat("a", 6000))
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, resp.StatusCode)
+	var body APIError
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, CodeHeadersTooLarge, body.Code)
+}
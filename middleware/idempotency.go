@@ -0,0 +1,310 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// IdempotencyKeyHeader carries the client's key of a request that must not be
+// processed twice
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader marks responses replayed for a repeated Idempotency-Key
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// Idempotency defaults
+const (
+	idempotencyKeyPrefix          = "idempotency:"
+	maxIdempotencyKeyLength       = 255
+	defaultIdempotencyWaitTimeout = 10 * time.Second
+	defaultIdempotencyLockTimeout = time.Minute
+	defaultIdempotencyMaxBodySize = 1 << 20
+	idempotencyPollInterval       = 50 * time.Millisecond
+)
+
+// idempotencyVolatileHeaders are response headers that belong to one request and are
+// not replayed
+var idempotencyVolatileHeaders = []string{"Content-Length", "Date", RequestIDHeader}
+
+// Idempotency deduplicates requests carrying an Idempotency-Key header. The first
+// request for a key, route and user is processed and its response stored; later ones
+// get the stored response replayed. While the first is still processing, others are
+// rejected with 409 or wait for its response. A key reused with a different request
+// body is rejected with 422. Responses the client should retry (429 and 5xx) are not
+// stored, and a store failure lets the request through.
+type Idempotency struct {
+	cfg     config.IdempotencyConfig
+	store   ReplayStore
+	methods map[string]bool
+	logger  *zap.Logger
+	now     func() time.Time // replaced in tests
+}
+
+// idempotencyRecord is what the store holds for a key: a lock while the first request
+// is processed, then its response
+type idempotencyRecord struct {
+	Locked   int64       `json:"locked,omitempty"`    // Unix nanoseconds the first request started; 0 once done
+	BodyHash string      `json:"body_hash,omitempty"` // SHA-256 of the first request's body
+	Status   int         `json:"status,omitempty"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     []byte      `json:"body,omitempty"`
+}
+
+// NewIdempotency creates the deduplication of requests remembering keys in store
+func NewIdempotency(cfg config.IdempotencyConfig, store ReplayStore, logger *zap.Logger) *Idempotency {
+	if cfg.WaitTimeout <= 0 {
+		cfg.WaitTimeout = defaultIdempotencyWaitTimeout
+	}
+	if cfg.LockTimeout <= 0 {
+		cfg.LockTimeout = defaultIdempotencyLockTimeout
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = defaultIdempotencyMaxBodySize
+	}
+	methods := make(map[string]bool)
+	for _, method := range cfg.Methods {
+		methods[strings.ToUpper(method)] = true
+	}
+	if len(methods) == 0 {
+		methods[http.MethodPost] = true
+	}
+	return &Idempotency{cfg: cfg, store: store, methods: methods, logger: logger, now: time.Now}
+}
+
+// NewIdempotencyStore creates the configured replay store, remembering keys for the
+// idempotency TTL (the replay window when unset). The Redis store uses redisClient.
+func NewIdempotencyStore(cfg *config.Config, redisClient *redis.Client) (ReplayStore, error) {
+	window := cfg.Idempotency.TTL
+	if window <= 0 {
+		window = cfg.Replay.Window
+	}
+	return NewReplayStore(config.ReplayConfig{Window: window, Store: cfg.Replay.Store}, redisClient)
+}
+
+// IdempotencyStore creates the store of idempotency keys, sharing the rate limiter's
+// Redis client
+func (rl *RateLimiter) IdempotencyStore(cfg *config.Config) (ReplayStore, error) {
+	return NewIdempotencyStore(cfg, rl.redisClient)
+}
+
+// Middleware returns the middleware deduplicating requests. It belongs after the
+// authentication middleware, so keys are scoped to the user; unauthenticated requests
+// are scoped to the client IP.
+func (i *Idempotency) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if !i.cfg.Enabled || key == "" || !i.methods[c.Request.Method] {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			AbortWithError(c, CodeBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		bodyHash, err := hashRequestBody(c)
+		if err != nil {
+			AbortWithError(c, CodeBadRequest, "Failed to read request body")
+			return
+		}
+		storeKey := i.storeKey(c, key)
+		ctx := c.Request.Context()
+		deadline := i.now().Add(i.cfg.WaitTimeout)
+		for {
+			record, err := i.acquire(ctx, storeKey, bodyHash)
+			if err != nil {
+				i.logger.Warn("Idempotency store unavailable, processing request", zap.Error(err))
+				c.Next()
+				return
+			}
+			if record == nil {
+				i.process(c, storeKey, bodyHash)
+				return
+			}
+			if record.BodyHash != bodyHash {
+				AbortWithError(c, CodeIdempotencyKeyReused, "Idempotency-Key was already used with a different request body")
+				return
+			}
+			if record.Locked == 0 {
+				record.replay(c)
+				return
+			}
+			if i.cfg.InFlight != "wait" || !i.now().Before(deadline) {
+				AbortWithError(c, CodeIdempotencyInFlight, "A request with this Idempotency-Key is still being processed")
+				return
+			}
+
+			timer := time.NewTimer(idempotencyPollInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				c.Abort()
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// hashRequestBody returns the SHA-256 of the request body, restoring it for the
+// handlers that follow
+func hashRequestBody(c *gin.Context) (string, error) {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		sum := sha256.Sum256(nil)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// storeKey namespaces a client's key by user and route, hashed to bound its length
+func (i *Idempotency) storeKey(c *gin.Context, key string) string {
+	owner := "ip:" + accessIP(c)
+	if claims, ok := GetUserFromContext(c); ok {
+		owner = "user:" + claims.UserID
+	}
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	sum := sha256.Sum256([]byte(owner + "\n" + c.Request.Method + " " + route + "\n" + key))
+	return idempotencyKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// acquire locks key for this request, returning nil when it did. Otherwise it returns
+// the record of the request holding the key. A lock older than the lock timeout is
+// taken over, as its request is assumed lost; the takeover is a compare-and-swap, so
+// only one of the requests finding the stale lock gets it.
+func (i *Idempotency) acquire(ctx context.Context, key, bodyHash string) (*idempotencyRecord, error) {
+	now := i.now()
+	lock, err := json.Marshal(idempotencyRecord{Locked: now.UnixNano(), BodyHash: bodyHash})
+	if err != nil {
+		return nil, err
+	}
+	if added, err := i.store.Add(ctx, key, lock); err != nil || added {
+		return nil, err
+	}
+
+	value, ok, err := i.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Released or expired meanwhile; try again on the next poll
+		return &idempotencyRecord{Locked: now.UnixNano(), BodyHash: bodyHash}, nil
+	}
+	var record idempotencyRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return nil, err
+	}
+	if record.Locked != 0 && now.Sub(time.Unix(0, record.Locked)) > i.cfg.LockTimeout {
+		swapped, err := i.store.Swap(ctx, key, value, lock)
+		if err != nil || swapped {
+			return nil, err
+		}
+		// Another request took the lock over first; wait for it like for any other
+		return &idempotencyRecord{Locked: now.UnixNano(), BodyHash: bodyHash}, nil
+	}
+	return &record, nil
+}
+
+// process runs the rest of the chain holding the lock on key, then stores the response,
+// or releases the key when the response must not be replayed
+func (i *Idempotency) process(c *gin.Context, key, bodyHash string) {
+	// The outcome is recorded even when the client went away meanwhile
+	ctx := context.WithoutCancel(c.Request.Context())
+	writer := &idempotencyWriter{ResponseWriter: c.Writer, limit: i.cfg.MaxBodySize}
+	c.Writer = writer
+
+	completed := false
+	defer func() {
+		c.Writer = writer.ResponseWriter
+		if completed {
+			return
+		}
+		// A panic must not hold the key until the lock times out
+		if err := i.store.Delete(ctx, key); err != nil {
+			i.logger.Warn("Failed to release idempotency key", zap.Error(err))
+		}
+	}()
+	c.Next()
+
+	status := writer.Status()
+	if status == http.StatusTooManyRequests || status >= 500 || writer.overflow {
+		return
+	}
+	header := writer.Header().Clone()
+	for _, name := range idempotencyVolatileHeaders {
+		header.Del(name)
+	}
+	value, err := json.Marshal(idempotencyRecord{BodyHash: bodyHash, Status: status, Header: header, Body: writer.body.Bytes()})
+	if err == nil {
+		err = i.store.Set(ctx, key, value)
+	}
+	if err != nil {
+		i.logger.Warn("Failed to store idempotent response", zap.Error(err))
+		return
+	}
+	completed = true
+}
+
+// replay writes the stored response, overriding headers already set for this request
+func (r *idempotencyRecord) replay(c *gin.Context) {
+	header := c.Writer.Header()
+	for name, values := range r.Header {
+		header[name] = values
+	}
+	header.Set(IdempotentReplayedHeader, "true")
+	c.Writer.WriteHeader(r.Status)
+	c.Writer.Write(r.Body)
+	c.Abort()
+}
+
+// idempotencyWriter keeps a copy of the response body up to limit bytes
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func (w *idempotencyWriter) keep(data []byte) {
+	if w.overflow {
+		return
+	}
+	if int64(w.body.Len()+len(data)) > w.limit {
+		w.overflow = true
+		w.body = bytes.Buffer{}
+		return
+	}
+	w.body.Write(data)
+}
+
+// Write implements http.ResponseWriter
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.keep(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
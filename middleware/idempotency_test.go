@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// setupIdempotency returns a router deduplicating POST /tasks, whose handler blocks
+// until release is closed when it is not nil, and the number of handled requests
+func setupIdempotency(t *testing.T, cfg config.IdempotencyConfig, release chan struct{}) (*gin.Engine, *atomic.Int32) {
+	gin.SetMode(gin.TestMode)
+	store, err := NewReplayStore(config.ReplayConfig{Window: time.Minute}, nil)
+	assert.NoError(t, err)
+
+	var calls atomic.Int32
+	router := gin.New()
+	router.POST("/tasks", NewIdempotency(cfg, store, zap.NewNop()).Middleware(), func(c *gin.Context) {
+		n := calls.Add(1)
+		if release != nil {
+			<-release
+		}
+		if c.GetHeader("X-Fail") != "" {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "backend down"})
+			return
+		}
+		c.Header("Location", fmt.Sprintf("/tasks/%d", n))
+		c.JSON(http.StatusCreated, gin.H{"id": n})
+	})
+	return router, &calls
+}
+
+// postTask sends POST /tasks with an Idempotency-Key, when not empty
+func postTask(router *gin.Engine, key string, headers ...string) *httptest.ResponseRecorder {
+	return postTaskBody(router, key, "", headers...)
+}
+
+// postTaskBody sends POST /tasks with body and an Idempotency-Key, when not empty
+func postTaskBody(router *gin.Engine, key, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/tasks", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	router, calls := setupIdempotency(t, config.IdempotencyConfig{Enabled: true}, nil)
+
+	first := postTask(router, "key-1")
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+
+	// A duplicate gets the stored response without reaching the handler
+	duplicate := postTask(router, "key-1")
+	assert.Equal(t, http.StatusCreated, duplicate.Code)
+	assert.Equal(t, `{"id":1}`, duplicate.Body.String())
+	assert.Equal(t, "/tasks/1", duplicate.Header().Get("Location"))
+	assert.Equal(t, "true", duplicate.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Other keys and requests without a key are processed
+	assert.Equal(t, `{"id":2}`, postTask(router, "key-2").Body.String())
+	assert.Equal(t, `{"id":3}`, postTask(router, "").Body.String())
+	assert.Equal(t, `{"id":4}`, postTask(router, "").Body.String())
+
+	// Server errors are not stored, so the request can be retried
+	assert.Equal(t, http.StatusBadGateway, postTask(router, "key-3", "X-Fail", "1").Code)
+	assert.Equal(t, http.StatusCreated, postTask(router, "key-3").Code)
+	assert.Equal(t, int32(6), calls.Load())
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	for _, mode := range []string{"reject", "wait"} {
+		t.Run(mode, func(t *testing.T) {
+			release := make(chan struct{})
+			router, calls := setupIdempotency(t, config.IdempotencyConfig{Enabled: true, InFlight: mode}, release)
+
+			var wg sync.WaitGroup
+			var first *httptest.ResponseRecorder
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				first = postTask(router, "key-1")
+			}()
+			assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+			if mode == "reject" {
+				w := postTask(router, "key-1")
+				assert.Equal(t, http.StatusConflict, w.Code)
+				assert.Contains(t, w.Body.String(), string(CodeIdempotencyInFlight))
+				close(release)
+				wg.Wait()
+			} else {
+				time.AfterFunc(100*time.Millisecond, func() { close(release) })
+				w := postTask(router, "key-1")
+				wg.Wait()
+				assert.Equal(t, http.StatusCreated, w.Code)
+				assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+			}
+			assert.Equal(t, http.StatusCreated, first.Code)
+			assert.Equal(t, int32(1), calls.Load())
+		})
+	}
+}
+
+func TestIdempotencyKeyReusedWithDifferentBody(t *testing.T) {
+	router, calls := setupIdempotency(t, config.IdempotencyConfig{Enabled: true}, nil)
+
+	assert.Equal(t, http.StatusCreated, postTaskBody(router, "key-1", `{"name":"a"}`).Code)
+	duplicate := postTaskBody(router, "key-1", `{"name":"a"}`)
+	assert.Equal(t, http.StatusCreated, duplicate.Code)
+	assert.Equal(t, "true", duplicate.Header().Get(IdempotentReplayedHeader))
+
+	w := postTaskBody(router, "key-1", `{"name":"b"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), string(CodeIdempotencyKeyReused))
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestIdempotencyStaleLockTakenOverOnce(t *testing.T) {
+	store, err := NewReplayStore(config.ReplayConfig{Window: time.Minute}, nil)
+	assert.NoError(t, err)
+	idempotency := NewIdempotency(config.IdempotencyConfig{Enabled: true, LockTimeout: time.Second}, store, zap.NewNop())
+	ctx := context.Background()
+
+	stale, _ := json.Marshal(idempotencyRecord{Locked: time.Now().Add(-time.Minute).UnixNano(), BodyHash: "hash"})
+	assert.NoError(t, store.Set(ctx, "key", stale))
+
+	// Of the requests finding the stale lock, only one takes it over
+	var acquired atomic.Int32
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			record, err := idempotency.acquire(ctx, "key", "hash")
+			assert.NoError(t, err)
+			if record == nil {
+				acquired.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), acquired.Load())
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+)
+
+// IPFilterMiddleware creates a middleware that restricts access by client IP.
+// Denied addresses and, when an allow list is set, addresses outside it get 403.
+// The client IP is resolved from X-Forwarded-For only for trusted proxy peers, and is
+// the nearest untrusted hop, so spoofed headers and hops are ignored.
+func IPFilterMiddleware(rules config.IPFilterRules, trustedProxies []string) gin.HandlerFunc {
+	allow, allowErr := ParseIPRanges(rules.Allow)
+	deny, denyErr := ParseIPRanges(rules.Deny)
+	trusted, trustedErr := ParseIPRanges(trustedProxies)
+	invalid := allowErr != nil || denyErr != nil || trustedErr != nil
+
+	return func(c *gin.Context) {
+		// Fail closed on an invalid rule set rather than letting traffic through
+		if invalid {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal Server Error",
+				"message": "Invalid IP filter configuration",
+			})
+			c.Abort()
+			return
+		}
+
+		clientIP := nearestUntrustedIP(c.Request.RemoteAddr, ForwardedFor(c.Request.Header), trusted)
+
+		if deny.Contains(clientIP) || (len(allow) > 0 && !allow.Contains(clientIP)) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": "Access denied from this IP address",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupIPFilterRouter(rules config.IPFilterRules, trustedProxies []string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(IPFilterMiddleware(rules, trustedProxies))
+	router.GET("/admin", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return router
+}
+
+func requestFrom(router *gin.Engine, remoteAddr, forwardedFor string) int {
+	req, _ := http.NewRequest("GET", "/admin", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestIPFilterAllowList(t *testing.T) {
+	router := setupIPFilterRouter(config.IPFilterRules{
+		Allow: []string{"10.0.0.0/8", "192.168.1.50"},
+	}, nil)
+
+	assert.Equal(t, http.StatusOK, requestFrom(router, "10.1.2.3:5000", ""))
+	assert.Equal(t, http.StatusOK, requestFrom(router, "192.168.1.50:5000", ""))
+	assert.Equal(t, http.StatusForbidden, requestFrom(router, "192.168.1.51:5000", ""))
+	assert.Equal(t, http.StatusForbidden, requestFrom(router, "203.0.113.7:5000", ""))
+}
+
+func TestIPFilterDenyList(t *testing.T) {
+	router := setupIPFilterRouter(config.IPFilterRules{
+		Allow: []string{"10.0.0.0/8"},
+		Deny:  []string{"10.0.5.0/24", "2001:db8::/32"},
+	}, nil)
+
+	assert.Equal(t, http.StatusOK, requestFrom(router, "10.0.4.1:5000", ""))
+	assert.Equal(t, http.StatusForbidden, requestFrom(router, "10.0.5.1:5000", ""))
+	assert.Equal(t, http.StatusForbidden, requestFrom(router, "[2001:db8::1]:5000", ""))
+}
+
+func TestIPFilterForwardedFor(t *testing.T) {
+	router := setupIPFilterRouter(config.IPFilterRules{
+		Allow: []string{"198.51.100.0/24"},
+	}, []string{"172.16.0.0/12"})
+
+	// Trusted proxy forwarding an office client
+	assert.Equal(t, http.StatusOK, requestFrom(router, "172.16.0.10:443", "198.51.100.20"))
+	// Trusted proxy chain: the rightmost untrusted hop is the client
+	assert.Equal(t, http.StatusForbidden, requestFrom(router, "172.16.0.10:443", "198.51.100.20, 203.0.113.9, 172.16.0.11"))
+	// Untrusted source spoofing an office address is evaluated by its real IP
+	assert.Equal(t, http.StatusForbidden, requestFrom(router, "203.0.113.9:5000", "198.51.100.20"))
+}
+
+func TestIPFilterInvalidRulesFailClosed(t *testing.T) {
+	router := setupIPFilterRouter(config.IPFilterRules{Deny: []string{"not-an-ip"}}, nil)
+	assert.Equal(t, http.StatusInternalServerError, requestFrom(router, "10.0.0.1:5000", ""))
+}
@@ -1,14 +1,113 @@
 package middleware
 
 import (
+	"math/rand"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/api-gateway/config"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
+// RedactedValue replaces sensitive values in logs so the log schema stays stable
+const RedactedValue = "[REDACTED]"
+
+// Backend timing of proxied requests, set by the proxy for the access log
+const (
+	BackendTTFBContextKey          = "backend_ttfb"
+	BackendLatencyContextKey       = "backend_latency"
+	BackendBytesSentContextKey     = "backend_bytes_sent"
+	BackendBytesReceivedContextKey = "backend_bytes_received"
+)
+
+// Proxied requests, set by the proxy for the access log: the service, and whether a
+// 5xx came from the backend rather than the gateway along with the start of its body
+const (
+	ServiceContextKey           = "service"
+	UpstreamErrorContextKey     = "upstream_error"
+	UpstreamErrorBodyContextKey = "upstream_error_body"
+)
+
+// SlowRequestThresholdContextKey overrides the slow request threshold of a request,
+// set for routes and services with their own
+const SlowRequestThresholdContextKey = "slow_request_threshold"
+
+// defaultLogFields are the optional fields logged when none are configured
+var defaultLogFields = []string{"query", "ip", "user_agent", "user_id", "user_email"}
+
+// alwaysRedactedHeaders are masked in logs regardless of configuration
+var alwaysRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// accessLogOptions is the resolved access log configuration
+type accessLogOptions struct {
+	fields        map[string]bool
+	redactFields  map[string]bool
+	redactHeaders map[string]bool
+	sampleRate    float64
+	slowThreshold time.Duration
+}
+
+// newAccessLogOptions resolves the logging configuration
+func newAccessLogOptions(cfg config.LoggingConfig) accessLogOptions {
+	fields := cfg.Fields
+	if len(fields) == 0 {
+		fields = defaultLogFields
+	}
+
+	opts := accessLogOptions{
+		fields:        toSet(fields, strings.ToLower),
+		redactFields:  toSet(cfg.RedactFields, strings.ToLower),
+		redactHeaders: toSet(append(alwaysRedactedHeaders, cfg.RedactHeaders...), http.CanonicalHeaderKey),
+		sampleRate:    cfg.SuccessSampleRate,
+		slowThreshold: cfg.SlowRequestThreshold,
+	}
+	if opts.sampleRate <= 0 || opts.sampleRate > 1 {
+		opts.sampleRate = 1
+	}
+	return opts
+}
+
+// AccessLogger logs every request with zap, flags requests slower than the latency
+// threshold with a separate warning, and counts them for Prometheus
+type AccessLogger struct {
+	logger       *zap.Logger
+	opts         accessLogOptions
+	slowRequests *prometheus.CounterVec
+}
+
+// NewAccessLogger creates the access logging middleware
+func NewAccessLogger(logger *zap.Logger, cfg *config.Config) *AccessLogger {
+	return &AccessLogger{
+		logger: logger,
+		opts:   newAccessLogOptions(cfg.Logging),
+		slowRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_slow_requests_total",
+			Help: "Requests slower than their latency threshold, by route and backend service.",
+		}, []string{"route", "service"}),
+	}
+}
+
 // Logger returns a Gin middleware for structured logging using zap
-func Logger(logger *zap.Logger) gin.HandlerFunc {
+func Logger(logger *zap.Logger, cfg *config.Config) gin.HandlerFunc {
+	return NewAccessLogger(logger, cfg).Middleware()
+}
+
+// SlowRequestThreshold returns a middleware overriding the slow request threshold for
+// the requests it handles, e.g. those of one route
+func SlowRequestThreshold(threshold time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(SlowRequestThresholdContextKey, threshold)
+		c.Next()
+	}
+}
+
+// Middleware returns the access logging middleware
+func (a *AccessLogger) Middleware() gin.HandlerFunc {
+	logger, opts := a.logger, a.opts
+
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
@@ -20,39 +119,105 @@ func Logger(logger *zap.Logger) gin.HandlerFunc {
 		// Calculate latency
 		latency := time.Since(start)
 
+		statusCode := c.Writer.Status()
+
+		// Flag slow requests whatever their status, before sampling can drop them
+		threshold := opts.slowThreshold
+		if override, ok := c.Get(SlowRequestThresholdContextKey); ok {
+			threshold = override.(time.Duration)
+		}
+		if threshold > 0 && latency > threshold {
+			service := c.GetString(ServiceContextKey)
+			a.slowRequests.WithLabelValues(c.FullPath(), service).Inc()
+			logger.Warn("Slow request",
+				zap.String("route", c.FullPath()),
+				zap.String(ServiceContextKey, service),
+				zap.String("method", c.Request.Method),
+				zap.String("path", path),
+				zap.Int("status", statusCode),
+				zap.Duration("latency", latency),
+				zap.Duration("threshold", threshold),
+				zap.String("request_id", c.GetString("request_id")),
+			)
+		}
+
+		// Sample successful requests to reduce volume; errors are always logged
+		if statusCode < 400 && opts.sampleRate < 1 && rand.Float64() >= opts.sampleRate {
+			return
+		}
+
 		// Get request ID if available
 		requestID := c.GetString("request_id")
 
 		// Build log fields
 		fields := []zap.Field{
-			zap.Int("status", c.Writer.Status()),
+			zap.Int("status", statusCode),
 			zap.String("method", c.Request.Method),
 			zap.String("path", path),
-			zap.String("query", query),
-			zap.String("ip", c.ClientIP()),
 			zap.Duration("latency", latency),
-			zap.String("user_agent", c.Request.UserAgent()),
+			zap.Int("response_size", max(c.Writer.Size(), 0)),
+		}
+
+		// Split the latency between the backend and the gateway for proxied requests
+		if ttfb, ok := c.Get(BackendTTFBContextKey); ok {
+			fields = append(fields,
+				zap.Duration(BackendTTFBContextKey, ttfb.(time.Duration)),
+				zap.Int64(BackendBytesSentContextKey, c.GetInt64(BackendBytesSentContextKey)),
+				zap.Int64(BackendBytesReceivedContextKey, c.GetInt64(BackendBytesReceivedContextKey)),
+			)
+			if backendLatency, ok := c.Get(BackendLatencyContextKey); ok {
+				fields = append(fields,
+					zap.Duration(BackendLatencyContextKey, backendLatency.(time.Duration)),
+					zap.Duration("gateway_latency", latency-backendLatency.(time.Duration)),
+				)
+			}
+		}
+
+		if service := c.GetString(ServiceContextKey); service != "" {
+			fields = append(fields, zap.String(ServiceContextKey, service))
+		}
+		if statusCode >= 500 {
+			fields = append(fields, zap.Bool(UpstreamErrorContextKey, c.GetBool(UpstreamErrorContextKey)))
+			if body := c.GetString(UpstreamErrorBodyContextKey); body != "" {
+				fields = append(fields, zap.String(UpstreamErrorBodyContextKey, body))
+			}
 		}
 
+		fields = opts.appendString(fields, "query", query)
+		fields = opts.appendString(fields, "ip", ClientIP(c))
+		fields = opts.appendString(fields, "user_agent", c.Request.UserAgent())
+
 		if requestID != "" {
 			fields = append(fields, zap.String("request_id", requestID))
 		}
 
-		// Add user info if authenticated
-		if claims, ok := GetUserFromContext(c); ok {
+		// Correlate with the distributed trace when propagation is enabled
+		if traceID := c.GetString(TraceIDContextKey); traceID != "" {
 			fields = append(fields,
-				zap.String("user_id", claims.UserID),
-				zap.String("user_email", claims.Email),
+				zap.String(TraceIDContextKey, traceID),
+				zap.String(SpanIDContextKey, c.GetString(SpanIDContextKey)),
 			)
 		}
 
+		// Add user info if authenticated
+		if claims, ok := GetUserFromContext(c); ok {
+			fields = opts.appendString(fields, "user_id", claims.UserID)
+			fields = opts.appendString(fields, "user_email", claims.Email)
+		}
+
+		if opts.fields["request_headers"] {
+			fields = append(fields, zap.Any("request_headers", opts.headerValues(c.Request.Header)))
+		}
+		if opts.fields["response_headers"] {
+			fields = append(fields, zap.Any("response_headers", opts.headerValues(c.Writer.Header())))
+		}
+
 		// Add error if exists
 		if len(c.Errors) > 0 {
 			fields = append(fields, zap.String("error", c.Errors.String()))
 		}
 
 		// Log based on status code
-		statusCode := c.Writer.Status()
 		switch {
 		case statusCode >= 500:
 			logger.Error("Server error", fields...)
@@ -65,3 +230,46 @@ func Logger(logger *zap.Logger) gin.HandlerFunc {
 		}
 	}
 }
+
+// appendString adds an optional field if it is enabled, masking it if redacted
+func (o accessLogOptions) appendString(fields []zap.Field, name, value string) []zap.Field {
+	if !o.fields[name] {
+		return fields
+	}
+	if o.redactFields[name] && value != "" {
+		value = RedactedValue
+	}
+	return append(fields, zap.String(name, value))
+}
+
+// headerValues flattens headers for logging, masking sensitive ones
+func (o accessLogOptions) headerValues(header http.Header) map[string]string {
+	values := make(map[string]string, len(header))
+	for name, vals := range header {
+		if o.redactHeaders[http.CanonicalHeaderKey(name)] {
+			values[name] = RedactedValue
+			continue
+		}
+		values[name] = strings.Join(vals, ", ")
+	}
+	return values
+}
+
+// toSet builds a lookup set from a list, normalizing each entry
+func toSet(items []string, normalize func(string) string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[normalize(item)] = true
+	}
+	return set
+}
+
+// Describe implements prometheus.Collector
+func (a *AccessLogger) Describe(ch chan<- *prometheus.Desc) {
+	a.slowRequests.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (a *AccessLogger) Collect(ch chan<- prometheus.Metric) {
+	a.slowRequests.Collect(ch)
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func setupLoggedRouter(logging config.LoggingConfig, status int) (*gin.Engine, *observer.ObservedLogs) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.InfoLevel)
+
+	router := gin.New()
+	router.Use(Logger(zap.New(core), &config.Config{Logging: logging}))
+	router.GET("/test", func(c *gin.Context) {
+		c.Header("Set-Cookie", "session=abc123")
+		c.Header("X-Backend", "users")
+		c.Status(status)
+	})
+	return router, logs
+}
+
+func TestLoggerRedactsHeaders(t *testing.T) {
+	router, logs := setupLoggedRouter(config.LoggingConfig{
+		Fields:        []string{"ip", "request_headers", "response_headers"},
+		RedactFields:  []string{"ip"},
+		RedactHeaders: []string{"x-api-key"},
+	}, http.StatusOK)
+
+	req, _ := http.NewRequest("GET", "/test?token=secret", nil)
+	req.RemoteAddr = "203.0.113.7:4000"
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Cookie", "session=abc123")
+	req.Header.Set("X-Api-Key", "key")
+	req.Header.Set("Accept", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+
+	// Redacted fields keep their key so the log schema stays stable
+	assert.Equal(t, RedactedValue, fields["ip"])
+	assert.NotContains(t, fields, "query")
+	assert.NotContains(t, fields, "user_agent")
+
+	reqHeaders := fields["request_headers"].(map[string]string)
+	assert.Equal(t, RedactedValue, reqHeaders["Authorization"])
+	assert.Equal(t, RedactedValue, reqHeaders["Cookie"])
+	assert.Equal(t, RedactedValue, reqHeaders["X-Api-Key"])
+	assert.Equal(t, "application/json", reqHeaders["Accept"])
+
+	respHeaders := fields["response_headers"].(map[string]string)
+	assert.Equal(t, RedactedValue, respHeaders["Set-Cookie"])
+	assert.Equal(t, "users", respHeaders["X-Backend"])
+}
+
+func TestLoggerDefaultFields(t *testing.T) {
+	router, logs := setupLoggedRouter(config.LoggingConfig{}, http.StatusOK)
+
+	req, _ := http.NewRequest("GET", "/test?page=2", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "page=2", fields["query"])
+	assert.Contains(t, fields, "ip")
+	assert.NotContains(t, fields, "request_headers")
+}
+
+func TestLoggerSamplesSuccessfulRequests(t *testing.T) {
+	const requests = 2000
+	router, logs := setupLoggedRouter(config.LoggingConfig{SuccessSampleRate: 0.25}, http.StatusOK)
+
+	for i := 0; i < requests; i++ {
+		req, _ := http.NewRequest("GET", "/test", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.InDelta(t, requests*0.25, logs.Len(), requests*0.05)
+}
+
+func TestLoggerAlwaysLogsErrors(t *testing.T) {
+	const requests = 100
+	router, logs := setupLoggedRouter(config.LoggingConfig{SuccessSampleRate: 0.01}, http.StatusBadGateway)
+
+	for i := 0; i < requests; i++ {
+		req, _ := http.NewRequest("GET", "/test", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, requests, logs.Len())
+}
+
+func TestLoggerFlagsSlowRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.InfoLevel)
+	accessLogger := NewAccessLogger(zap.New(core), &config.Config{Logging: config.LoggingConfig{
+		SlowRequestThreshold: 20 * time.Millisecond,
+		SuccessSampleRate:    0.000001,
+	}})
+
+	router := gin.New()
+	router.Use(accessLogger.Middleware())
+	slow := func(c *gin.Context) {
+		time.Sleep(30 * time.Millisecond)
+		c.Status(http.StatusOK)
+	}
+	router.GET("/slow", func(c *gin.Context) { c.Set(ServiceContextKey, "users") }, slow)
+	router.GET("/fast", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/tolerant", SlowRequestThreshold(time.Second), slow)
+
+	for _, path := range []string{"/slow", "/fast", "/tolerant"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// Only the request over its threshold is flagged, even though sampling drops
+	// its access log entry
+	entries := logs.FilterMessage("Slow request").All()
+	if assert.Len(t, entries, 1) {
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "/slow", fields["route"])
+		assert.Equal(t, "users", fields["service"])
+		assert.Equal(t, 20*time.Millisecond, fields["threshold"])
+		assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(accessLogger.slowRequests.WithLabelValues("/slow", "users")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(accessLogger.slowRequests.WithLabelValues("/tolerant", "")))
+}
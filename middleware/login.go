@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// loginKeyPrefix prefixes login attempt and failure counters stored in Redis
+const loginKeyPrefix = "login:"
+
+// LoginGuard protects the login endpoint against brute force: it applies a stricter
+// per-IP rate limit than the gateway-wide one and locks out a client IP or username
+// after repeated failures. Counters live in Redis while it is reachable, otherwise in
+// memory.
+type LoginGuard struct {
+	cfg       config.LoginConfig
+	redis     sharedRedis
+	mu        sync.Mutex
+	counters  map[string]*loginCounter
+	lastSweep time.Time
+}
+
+// loginCounter is a fixed-window counter
+type loginCounter struct {
+	count   int
+	expires time.Time
+}
+
+// NewLoginGuard creates a login guard keeping its counters in redisClient, or in
+// memory when redisClient is nil or fails
+func NewLoginGuard(cfg *config.Config, redisClient *redis.Client) *LoginGuard {
+	return newLoginGuard(cfg, sharedRedis{client: redisClient})
+}
+
+// LoginGuard returns a login guard sharing the rate limiter's store: its counters move
+// between Redis and memory with the limiter's
+func (rl *RateLimiter) LoginGuard(cfg *config.Config) *LoginGuard {
+	return newLoginGuard(cfg, sharedRedis{client: rl.redisClient, limiter: rl})
+}
+
+func newLoginGuard(cfg *config.Config, store sharedRedis) *LoginGuard {
+	return &LoginGuard{
+		cfg:      cfg.Login,
+		redis:    store,
+		counters: make(map[string]*loginCounter),
+	}
+}
+
+// Middleware returns a middleware limiting login attempts per client IP
+func (g *LoginGuard) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, reset, err := g.incr(c.Request.Context(), "attempts:"+accessIP(c), time.Minute)
+		if err != nil {
+			// Log error but don't fail the request
+			c.Next()
+			return
+		}
+
+		if count > g.cfg.RequestsPerMin {
+			c.Header("Retry-After", strconv.Itoa(max(1, int(math.Ceil(time.Until(reset).Seconds())))))
+			AbortWithError(c, CodeRateLimited, "Too many login attempts. Please try again later.")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ReserveAttempt counts a login attempt as a failure of the client IP and the username
+// before its credentials are verified, so that concurrent attempts can't all get past
+// the lockout before one of them is counted. When either had already failed MaxFailures
+// times the attempt is released again, and ReserveAttempt reports how long the client
+// is locked out. A reserved attempt that succeeds is released by RecordSuccess; one that
+// couldn't be verified, by ReleaseAttempt.
+func (g *LoginGuard) ReserveAttempt(c *gin.Context, username string) (time.Duration, bool) {
+	ctx := c.Request.Context()
+	var reserved []string
+	var lockedFor time.Duration
+	locked := false
+	for _, key := range g.failureKeys(c, username) {
+		count, reset, err := g.incr(ctx, key, g.cfg.LockoutDuration)
+		if err != nil {
+			continue
+		}
+		reserved = append(reserved, key)
+		if count > g.cfg.MaxFailures {
+			locked = true
+			lockedFor = max(lockedFor, time.Until(reset))
+		}
+	}
+	if locked {
+		for _, key := range reserved {
+			g.decr(ctx, key, g.cfg.LockoutDuration)
+		}
+	}
+	return lockedFor, locked
+}
+
+// ReleaseAttempt uncounts a reserved attempt whose credentials couldn't be verified
+func (g *LoginGuard) ReleaseAttempt(c *gin.Context, username string) {
+	for _, key := range g.failureKeys(c, username) {
+		g.decr(c.Request.Context(), key, g.cfg.LockoutDuration)
+	}
+}
+
+// RecordSuccess uncounts the client IP's reserved attempt and clears the username's
+// failures. The client IP's earlier failures are kept, so logging in to one account
+// doesn't reset guessing against others.
+func (g *LoginGuard) RecordSuccess(c *gin.Context, username string) {
+	ctx := c.Request.Context()
+	g.decr(ctx, "failures:ip:"+accessIP(c), g.cfg.LockoutDuration)
+
+	key := "failures:user:" + strings.ToLower(username)
+	if g.redis.active() {
+		if err := g.redis.client.Del(ctx, loginKeyPrefix+key).Err(); err != nil {
+			g.redis.failed()
+		}
+	}
+
+	// Failures counted in memory while Redis was unreachable are cleared too
+	g.mu.Lock()
+	delete(g.counters, key)
+	g.mu.Unlock()
+}
+
+// failureKeys returns the failure counters of a login attempt
+func (g *LoginGuard) failureKeys(c *gin.Context, username string) []string {
+	return []string{
+		"failures:ip:" + accessIP(c),
+		"failures:user:" + strings.ToLower(username),
+	}
+}
+
+// incr increments a counter whose window starts with its first increment, returning
+// the new count and when the window ends. A Redis failure counts in memory instead.
+func (g *LoginGuard) incr(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	now := time.Now()
+	if g.redis.active() {
+		count, reset, err := g.incrRedis(ctx, loginKeyPrefix+key, window, now)
+		if err == nil || ctx.Err() != nil {
+			return count, reset, err
+		}
+		g.redis.failed()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sweep(now)
+
+	counter, ok := g.counters[key]
+	if !ok || !now.Before(counter.expires) {
+		counter = &loginCounter{expires: now.Add(window)}
+		g.counters[key] = counter
+	}
+	counter.count++
+	return counter.count, counter.expires, nil
+}
+
+// incrRedis increments a counter in Redis. The counter is created with its expiry in
+// the same transaction, so it can't be left without one.
+func (g *LoginGuard) incrRedis(ctx context.Context, key string, window time.Duration, now time.Time) (int, time.Time, error) {
+	var count *redis.IntCmd
+	var ttl *redis.DurationCmd
+	_, err := g.redis.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetNX(ctx, key, 0, window)
+		count = pipe.Incr(ctx, key)
+		ttl = pipe.PTTL(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return int(count.Val()), now.Add(ttl.Val()), nil
+}
+
+// decr undoes an increment of a counter. A Redis failure decrements the in-memory
+// counter instead.
+func (g *LoginGuard) decr(ctx context.Context, key string, window time.Duration) {
+	if g.redis.active() {
+		err := g.decrRedis(ctx, loginKeyPrefix+key, window)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		g.redis.failed()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if counter, ok := g.counters[key]; ok && counter.count > 0 && time.Now().Before(counter.expires) {
+		counter.count--
+	}
+}
+
+// decrRedis decrements a counter in Redis. A counter that expired meanwhile is
+// recreated at zero with an expiry rather than left at -1 without one.
+func (g *LoginGuard) decrRedis(ctx context.Context, key string, window time.Duration) error {
+	_, err := g.redis.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetNX(ctx, key, 1, window)
+		pipe.Decr(ctx, key)
+		return nil
+	})
+	return err
+}
+
+// sweep drops expired in-memory counters at most once a minute; the caller must hold g.mu
+func (g *LoginGuard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < time.Minute {
+		return
+	}
+	g.lastSweep = now
+
+	for key, counter := range g.counters {
+		if !now.Before(counter.expires) {
+			delete(g.counters, key)
+		}
+	}
+}
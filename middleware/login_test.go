@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginGuardFollowsRateLimiterStore(t *testing.T) {
+	addr := freeAddr(t)
+	server := startFakeRedis(t, addr)
+	cfg := redisConfig(t, addr)
+	cfg.Login.RequestsPerMin = 2
+	rl := newTestRateLimiter(t, cfg)
+	guard := rl.LoginGuard(cfg)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/login", guard.Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	login := func() int {
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.RemoteAddr = "203.0.113.9:5000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, login())
+	assert.Equal(t, 1, server.count("login:attempts:203.0.113.9"))
+	// The counter is created with its expiry
+	ttl := server.ttl("login:attempts:203.0.113.9")
+	assert.True(t, ttl > 0 && ttl <= time.Minute, ttl)
+
+	// An outage moves the attempts to memory instead of letting them through unchecked
+	server.stop()
+	assert.Equal(t, http.StatusOK, login())
+	assert.Equal(t, "local", rl.Store())
+	assert.Equal(t, http.StatusOK, login())
+	assert.Equal(t, http.StatusTooManyRequests, login())
+
+	// Counting returns to Redis with the rate limiter
+	server = startFakeRedis(t, addr)
+	assert.Eventually(t, func() bool { return rl.Store() == "redis" }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusOK, login())
+	assert.Equal(t, 1, server.count("login:attempts:203.0.113.9"))
+}
+
+func TestLoginGuardReservesAttemptsInRedis(t *testing.T) {
+	addr := freeAddr(t)
+	server := startFakeRedis(t, addr)
+	cfg := redisConfig(t, addr)
+	cfg.Login.MaxFailures = 1
+	cfg.Login.LockoutDuration = time.Minute
+	rl := newTestRateLimiter(t, cfg)
+	guard := rl.LoginGuard(cfg)
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/login", nil)
+	c.Request.RemoteAddr = "203.0.113.9:5000"
+
+	// The attempt is counted before it is verified, with the lockout as its expiry
+	_, locked := guard.ReserveAttempt(c, "Alice")
+	assert.False(t, locked)
+	assert.Equal(t, 1, server.count("login:failures:ip:203.0.113.9"))
+	assert.Equal(t, 1, server.count("login:failures:user:alice"))
+	ttl := server.ttl("login:failures:user:alice")
+	assert.True(t, ttl > 0 && ttl <= time.Minute, ttl)
+
+	// Past the limit the attempt is refused and not counted
+	retryAfter, locked := guard.ReserveAttempt(c, "alice")
+	assert.True(t, locked)
+	assert.True(t, retryAfter > 0 && retryAfter <= time.Minute, retryAfter)
+	assert.Equal(t, 1, server.count("login:failures:ip:203.0.113.9"))
+
+	// An attempt that couldn't be verified is uncounted
+	c.Request.RemoteAddr = "203.0.113.10:5000"
+	guard.ReserveAttempt(c, "bob")
+	guard.ReleaseAttempt(c, "bob")
+	assert.Equal(t, 0, server.count("login:failures:user:bob"))
+	ttl = server.ttl("login:failures:user:bob")
+	assert.True(t, ttl > 0 && ttl <= time.Minute, "a counter keeps its expiry: %v", ttl)
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+)
+
+// Maintenance defaults
+const (
+	defaultMaintenanceMessage    = "The service is undergoing maintenance. Please try again later."
+	defaultMaintenanceRetryAfter = 5 * time.Minute
+)
+
+// MaintenanceState is the current maintenance mode
+type MaintenanceState struct {
+	Enabled    bool
+	Message    string
+	RetryAfter time.Duration
+	Since      time.Time // When maintenance was last enabled
+}
+
+// Maintenance puts the gateway into maintenance mode, answering 503 with Retry-After
+// to everything but the exempt paths (health checks, login and the admin API by
+// default). It is switched by configuration reloads and the admin API; whichever
+// changed last wins.
+type Maintenance struct {
+	state       atomic.Pointer[MaintenanceState]
+	exemptPaths atomic.Pointer[[]string]
+
+	mu sync.Mutex
+	// applied is the configuration last applied, so reloads that leave the maintenance
+	// settings alone don't undo a switch made through the admin API
+	applied config.MaintenanceConfig
+}
+
+// NewMaintenance creates the maintenance mode switch from configuration
+func NewMaintenance(cfg config.MaintenanceConfig) *Maintenance {
+	m := &Maintenance{}
+	m.apply(cfg)
+	return m
+}
+
+// Update applies the maintenance settings of a reloaded configuration if they changed
+func (m *Maintenance) Update(cfg config.MaintenanceConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if reflect.DeepEqual(cfg, m.applied) {
+		return
+	}
+	m.applyLocked(cfg)
+}
+
+// apply applies configured maintenance settings
+func (m *Maintenance) apply(cfg config.MaintenanceConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.applyLocked(cfg)
+}
+
+func (m *Maintenance) applyLocked(cfg config.MaintenanceConfig) {
+	m.applied = cfg
+	exemptPaths := cfg.ExemptPaths
+	m.exemptPaths.Store(&exemptPaths)
+	m.Set(cfg.Enabled, cfg.Message, cfg.RetryAfter)
+}
+
+// Set switches maintenance mode. An empty message and a zero Retry-After use the
+// defaults.
+func (m *Maintenance) Set(enabled bool, message string, retryAfter time.Duration) {
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultMaintenanceRetryAfter
+	}
+
+	state := &MaintenanceState{Enabled: enabled, Message: message, RetryAfter: retryAfter}
+	if current := m.state.Load(); enabled && current != nil && current.Enabled {
+		state.Since = current.Since
+	} else if enabled {
+		state.Since = time.Now().UTC()
+	}
+	m.state.Store(state)
+}
+
+// State returns the current maintenance mode
+func (m *Maintenance) State() MaintenanceState {
+	return *m.state.Load()
+}
+
+// Middleware returns a Gin middleware rejecting requests with 503 during maintenance
+func (m *Maintenance) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := m.state.Load()
+		if !state.Enabled || isExemptPath(c.Request.URL.Path, *m.exemptPaths.Load()) {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", strconv.Itoa(int(state.RetryAfter.Seconds())))
+		AbortWithError(c, CodeMaintenance, state.Message)
+	}
+}
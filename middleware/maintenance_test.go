@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	maintenance := NewMaintenance(config.MaintenanceConfig{
+		Enabled:     true,
+		Message:     "Back soon",
+		RetryAfter:  time.Minute,
+		ExemptPaths: []string{"/health"},
+	})
+
+	router := gin.New()
+	router.Use(maintenance.Middleware())
+	router.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/orders", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	body := decodeAPIError(t, w)
+	assert.Equal(t, CodeMaintenance, body.Code)
+	assert.Equal(t, "Back soon", body.Message)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMaintenanceUpdate(t *testing.T) {
+	cfg := config.MaintenanceConfig{Message: "Back soon"}
+	maintenance := NewMaintenance(cfg)
+	assert.False(t, maintenance.State().Enabled)
+
+	// A reload leaving the maintenance settings alone keeps the admin API's switch
+	maintenance.Set(true, "", 0)
+	maintenance.Update(cfg)
+	state := maintenance.State()
+	assert.True(t, state.Enabled)
+	assert.Equal(t, defaultMaintenanceMessage, state.Message)
+	assert.Equal(t, defaultMaintenanceRetryAfter, state.RetryAfter)
+	assert.False(t, state.Since.IsZero())
+
+	// Changed settings are applied
+	maintenance.Update(config.MaintenanceConfig{Enabled: false, Message: "Deploying"})
+	assert.False(t, maintenance.State().Enabled)
+	assert.Equal(t, "Deploying", maintenance.State().Message)
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAllowedMethods are accepted when no allowlist is configured
+var DefaultAllowedMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// standardMethods are the methods defined by the HTTP specifications
+var standardMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodConnect: true,
+	http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// MethodFilter returns a middleware that rejects request methods outside the configured
+// allowlist before routing: standard methods that aren't allowed get 405 with an Allow
+// header, unrecognized methods get 501. Disallowed methods always get 405, even when
+// the allowlist names them. Methods are matched case-sensitively as HTTP requires.
+func MethodFilter(cfg *config.Config) gin.HandlerFunc {
+	methods := cfg.Server.AllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultAllowedMethods
+	}
+
+	disallowed := make(map[string]bool, len(cfg.Server.DisallowedMethods))
+	for _, method := range cfg.Server.DisallowedMethods {
+		disallowed[method] = true
+	}
+	allowed := make(map[string]bool, len(methods))
+	allowList := make([]string, 0, len(methods))
+	for _, method := range methods {
+		if !disallowed[method] {
+			allowed[method] = true
+			allowList = append(allowList, method)
+		}
+	}
+	allowHeader := strings.Join(allowList, ", ")
+
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if allowed[method] {
+			c.Next()
+			return
+		}
+
+		if standardMethods[method] || disallowed[method] {
+			c.Header("Allow", allowHeader)
+			AbortWithError(c, CodeMethodNotAllowed, fmt.Sprintf("Method %s is not allowed", method))
+		} else {
+			AbortWithError(c, CodeNotImplemented, "Request method is not supported")
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MethodFilter(&config.Config{}))
+	router.Any("/resource", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		method     string
+		wantStatus int
+	}{
+		{"GET", http.StatusOK},
+		{"OPTIONS", http.StatusOK},
+		{"TRACE", http.StatusMethodNotAllowed},
+		{"CONNECT", http.StatusMethodNotAllowed},
+		{"FOO", http.StatusNotImplemented},
+		{"get", http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "/resource", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusMethodNotAllowed {
+				assert.Equal(t, "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS", w.Header().Get("Allow"))
+			}
+		})
+	}
+}
+
+func TestMethodFilterRejectsUnroutedPaths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MethodFilter(&config.Config{Server: config.ServerConfig{AllowedMethods: []string{"GET"}}}))
+	router.NoRoute(func(c *gin.Context) { c.Status(http.StatusNotFound) })
+
+	req, _ := http.NewRequest("TRACE", "/anything", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET", w.Header().Get("Allow"))
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/api-gateway/config"
+)
+
+// NormalizePath wraps the router so requests are matched and proxied on a normalized
+// path, or redirected to it. It runs outside gin, as middleware only runs after the
+// route has been chosen. Paths are normalized in their escaped form, so encoded
+// characters such as %2F reach the backend as the client sent them.
+func NormalizePath(cfg config.PathNormalizationConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		escaped := r.URL.EscapedPath()
+		normalized := normalizePath(escaped, cfg)
+		if normalized == escaped {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cfg.Action == "redirect" {
+			// A leading // would make the location protocol-relative, redirecting off-site
+			location := "/" + strings.TrimLeft(normalized, "/")
+			if r.URL.RawQuery != "" {
+				location += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, location, cfg.RedirectStatus)
+			return
+		}
+
+		path, err := url.PathUnescape(normalized)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = path
+		r2.URL.RawPath = normalized
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// normalizePath applies the slash policies to an escaped path
+func normalizePath(path string, cfg config.PathNormalizationConfig) string {
+	if !strings.HasPrefix(path, "/") {
+		return path
+	}
+	if cfg.CollapseSlashes && strings.Contains(path, "//") {
+		var b strings.Builder
+		b.Grow(len(path))
+		for i := 0; i < len(path); i++ {
+			if path[i] == '/' && i > 0 && path[i-1] == '/' {
+				continue
+			}
+			b.WriteByte(path[i])
+		}
+		path = b.String()
+	}
+
+	switch cfg.TrailingSlash {
+	case "strip":
+		if trimmed := strings.TrimRight(path, "/"); trimmed != "" {
+			path = trimmed
+		} else {
+			path = "/"
+		}
+	case "add":
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+	}
+	return path
+}
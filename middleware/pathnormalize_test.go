@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupNormalizedRouter(cfg config.PathNormalizationConfig) http.Handler {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// Backends see the escaped path the proxy forwards
+	echo := func(c *gin.Context) { c.String(http.StatusOK, c.Request.URL.EscapedPath()) }
+	router.GET("/api/v1/projects/tasks", echo)
+	router.GET("/files/*name", echo)
+	return NormalizePath(cfg, router)
+}
+
+func TestNormalizePathRewrite(t *testing.T) {
+	handler := setupNormalizedRouter(config.PathNormalizationConfig{
+		CollapseSlashes: true,
+		TrailingSlash:   "strip",
+		Action:          "rewrite",
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		wantPath string
+	}{
+		{"clean path", "/api/v1/projects/tasks", "/api/v1/projects/tasks"},
+		{"double slashes", "//api/v1//projects///tasks", "/api/v1/projects/tasks"},
+		{"trailing slash", "/api/v1/projects/tasks/", "/api/v1/projects/tasks"},
+		{"encoded slash preserved", "/files//a%2Fb%20c/", "/files/a%2Fb%20c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantPath, w.Body.String())
+		})
+	}
+}
+
+func TestNormalizePathRedirect(t *testing.T) {
+	handler := setupNormalizedRouter(config.PathNormalizationConfig{
+		CollapseSlashes: true,
+		TrailingSlash:   "strip",
+		Action:          "redirect",
+		RedirectStatus:  http.StatusPermanentRedirect,
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1//projects/tasks/?page=2", nil))
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+	assert.Equal(t, "/api/v1/projects/tasks?page=2", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/files/a%2Fb/", nil))
+	assert.Equal(t, "/files/a%2Fb", w.Header().Get("Location"))
+
+	// Normalized paths are served without a redirect
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/projects/tasks", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestNormalizePathRedirectStaysOnSite(t *testing.T) {
+	handler := setupNormalizedRouter(config.PathNormalizationConfig{
+		TrailingSlash:  "strip",
+		Action:         "redirect",
+		RedirectStatus: http.StatusMovedPermanently,
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "//evil.example/", nil))
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/evil.example", w.Header().Get("Location"))
+}
+
+func TestNormalizePathAddTrailingSlash(t *testing.T) {
+	cfg := config.PathNormalizationConfig{TrailingSlash: "add"}
+	assert.Equal(t, "/docs/", normalizePath("/docs", cfg))
+	assert.Equal(t, "/docs/", normalizePath("/docs/", cfg))
+	assert.Equal(t, "/", normalizePath("/", cfg))
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// quotaKeyPrefix prefixes quota usage counters stored in Redis
+const quotaKeyPrefix = "quota:"
+
+// Quota windows
+const (
+	QuotaWindowDay   = "day"
+	QuotaWindowMonth = "month"
+)
+
+// Quota enforces usage quotas per user over calendar days or months (UTC), sized by
+// the plan tier in the user's token. It is independent of the per-minute rate limit:
+// a request must pass both. Usage lives in Redis while it is reachable, otherwise in
+// memory. Requests without an authenticated user are not subject to quotas.
+type Quota struct {
+	cfg       config.QuotaConfig
+	redis     sharedRedis
+	mu        sync.Mutex
+	counters  map[string]*quotaCounter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// quotaCounter is the usage of one user in one period
+type quotaCounter struct {
+	count   int64
+	expires time.Time
+}
+
+// NewQuota creates the quota enforcer keeping usage in redisClient, or in memory when
+// redisClient is nil or fails
+func NewQuota(cfg config.QuotaConfig, redisClient *redis.Client) *Quota {
+	return newQuota(cfg, sharedRedis{client: redisClient})
+}
+
+// Quota returns the quota enforcer sharing the rate limiter's store: usage moves
+// between Redis and memory with the limiter's counters
+func (rl *RateLimiter) Quota(cfg *config.Config) *Quota {
+	return newQuota(cfg.Quota, sharedRedis{client: rl.redisClient, limiter: rl})
+}
+
+func newQuota(cfg config.QuotaConfig, store sharedRedis) *Quota {
+	return &Quota{
+		cfg:      cfg,
+		redis:    store,
+		counters: make(map[string]*quotaCounter),
+		now:      time.Now,
+	}
+}
+
+// Middleware returns a middleware counting requests against the user's quota. It
+// belongs after the authentication middleware. Quota headers are set on every
+// counted response. While Redis is unreachable usage is counted in memory, per
+// instance, rather than not at all.
+func (q *Quota) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetUserFromContext(c)
+		if !q.cfg.Enabled || !ok {
+			c.Next()
+			return
+		}
+
+		tier := claims.Tier
+		if _, known := q.cfg.Tiers[tier]; !known {
+			tier = q.cfg.DefaultTier
+		}
+		limit := q.cfg.Tiers[tier]
+		if limit <= 0 {
+			// Unlimited tier
+			c.Next()
+			return
+		}
+
+		used, reset, err := q.incr(c.Request.Context(), claims.UserID)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		remaining := limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Header("X-Quota-Limit", strconv.FormatInt(limit, 10))
+		c.Header("X-Quota-Remaining", strconv.FormatInt(remaining, 10))
+		c.Header("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if used > limit {
+			c.Header("Retry-After", strconv.Itoa(int(reset.Sub(q.now()).Seconds())+1))
+			AbortWithError(c, CodeQuotaExceeded, fmt.Sprintf("The %s quota of the %s tier is exhausted", q.window(), tier))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// window returns the configured window, a month by default
+func (q *Quota) window() string {
+	if q.cfg.Window == QuotaWindowDay {
+		return QuotaWindowDay
+	}
+	return QuotaWindowMonth
+}
+
+// period returns the label of the current period and when it ends
+func (q *Quota) period() (string, time.Time) {
+	now := q.now().UTC()
+	if q.window() == QuotaWindowDay {
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+	}
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01"), start.AddDate(0, 1, 0)
+}
+
+// incr counts a request of the user in the current period, returning the usage and
+// when the period ends. A Redis failure counts in memory instead.
+func (q *Quota) incr(ctx context.Context, userID string) (int64, time.Time, error) {
+	label, reset := q.period()
+	key := q.window() + ":" + label + ":" + userID
+
+	if q.redis.active() {
+		pipe := q.redis.client.Pipeline()
+		count := pipe.Incr(ctx, quotaKeyPrefix+key)
+		// Keep the counter a day past the period so clocks that disagree slightly don't
+		// restart a period's count
+		pipe.ExpireAt(ctx, quotaKeyPrefix+key, reset.Add(24*time.Hour))
+		_, err := pipe.Exec(ctx)
+		if err == nil || ctx.Err() != nil {
+			return count.Val(), reset, err
+		}
+		q.redis.failed()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sweep(q.now())
+
+	counter, ok := q.counters[key]
+	if !ok {
+		counter = &quotaCounter{expires: reset}
+		q.counters[key] = counter
+	}
+	counter.count++
+	return counter.count, reset, nil
+}
+
+// sweep drops the counters of past periods at most once a minute; the caller must hold q.mu
+func (q *Quota) sweep(now time.Time) {
+	if now.Sub(q.lastSweep) < time.Minute {
+		return
+	}
+	q.lastSweep = now
+
+	for key, counter := range q.counters {
+		if !now.Before(counter.expires) {
+			delete(q.counters, key)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+var testQuotaConfig = config.QuotaConfig{
+	Enabled:     true,
+	Window:      QuotaWindowMonth,
+	Tiers:       map[string]int64{"free": 3, "pro": 5, "enterprise": 0},
+	DefaultTier: "free",
+}
+
+// setupQuotaRouter serves /api behind authentication and the quota, and returns a
+// function sending a request as a user of a tier
+func setupQuotaRouter(t *testing.T, quota *Quota) func(userID, tier string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	jwtConfig := config.JWTConfig{SecretKey: "test-secret"}
+	cfg := &config.Config{JWT: jwtConfig}
+
+	router := gin.New()
+	router.GET("/api", AuthMiddleware(cfg), quota.Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	return func(userID, tier string) *httptest.ResponseRecorder {
+		claims := &Claims{UserID: userID, Tier: tier, RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}}
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtConfig.SecretKey))
+		req := httptest.NewRequest("GET", "/api", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+}
+
+// fixedClock returns a clock stopped at the given time
+func fixedClock(now time.Time) func() time.Time {
+	return func() time.Time { return now }
+}
+
+func TestQuotaExhaustsMonthlyQuota(t *testing.T) {
+	quota := NewQuota(testQuotaConfig, nil)
+	quota.now = fixedClock(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	send := setupQuotaRouter(t, quota)
+	reset := strconv.FormatInt(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC).Unix(), 10)
+
+	for i := 1; i <= 5; i++ {
+		w := send("42", "pro")
+		assert.Equal(t, http.StatusOK, w.Code, "request %d", i)
+		assert.Equal(t, "5", w.Header().Get("X-Quota-Limit"))
+		assert.Equal(t, strconv.Itoa(5-i), w.Header().Get("X-Quota-Remaining"))
+		assert.Equal(t, reset, w.Header().Get("X-Quota-Reset"))
+	}
+
+	w := send("42", "pro")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-Quota-Remaining"))
+	assert.Equal(t, reset, w.Header().Get("X-Quota-Reset"))
+	assert.Equal(t, strconv.Itoa(15*24*3600+12*3600+1), w.Header().Get("Retry-After"))
+	assert.Equal(t, CodeQuotaExceeded, decodeAPIError(t, w).Code)
+
+	// Other users have their own quota
+	assert.Equal(t, http.StatusOK, send("43", "pro").Code)
+
+	// The quota starts over with the next month
+	quota.now = fixedClock(time.Date(2026, 11, 1, 0, 0, 1, 0, time.UTC))
+	w = send("42", "pro")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "4", w.Header().Get("X-Quota-Remaining"))
+}
+
+func TestQuotaTiers(t *testing.T) {
+	quota := NewQuota(testQuotaConfig, nil)
+	send := setupQuotaRouter(t, quota)
+
+	// Tokens without a known tier get the default tier
+	for _, tier := range []string{"", "platinum"} {
+		w := send("user-"+tier, tier)
+		assert.Equal(t, "3", w.Header().Get("X-Quota-Limit"), tier)
+	}
+
+	// Unlimited tiers are not counted
+	for i := 0; i < 10; i++ {
+		w := send("big-customer", "enterprise")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-Quota-Limit"))
+	}
+}
+
+func TestQuotaDailyWindowInRedis(t *testing.T) {
+	addr := freeAddr(t)
+	server := startFakeRedis(t, addr)
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+
+	// Counters expire by Redis's clock, so the quota's clock is late today
+	cfg := testQuotaConfig
+	cfg.Window = QuotaWindowDay
+	quota := NewQuota(cfg, client)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	quota.now = fixedClock(today.Add(23 * time.Hour))
+	send := setupQuotaRouter(t, quota)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, send("42", "free").Code)
+	}
+	w := send("42", "free")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, fmt.Sprint(today.AddDate(0, 0, 1).Unix()), w.Header().Get("X-Quota-Reset"))
+	key := "quota:day:" + today.Format("2006-01-02") + ":42"
+	assert.Equal(t, 4, server.count(key))
+	// The counter is kept a day past the period
+	assert.WithinDuration(t, today.AddDate(0, 0, 2), time.Now().Add(server.ttl(key)), time.Second)
+}
+
+func TestQuotaFollowsRateLimiterStore(t *testing.T) {
+	addr := freeAddr(t)
+	server := startFakeRedis(t, addr)
+	cfg := redisConfig(t, addr)
+	cfg.Quota = testQuotaConfig
+	rl := newTestRateLimiter(t, cfg)
+	quota := rl.Quota(cfg)
+	now := time.Now().UTC()
+	quota.now = fixedClock(now)
+	key := "quota:month:" + now.Format("2006-01") + ":42"
+	send := setupQuotaRouter(t, quota)
+
+	assert.Equal(t, http.StatusOK, send("42", "free").Code)
+	assert.Equal(t, 1, server.count(key))
+
+	// An outage counts usage in memory rather than letting every request through
+	server.stop()
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, send("42", "free").Code)
+	}
+	assert.Equal(t, "local", rl.Store())
+	assert.Equal(t, http.StatusTooManyRequests, send("42", "free").Code)
+}
@@ -2,9 +2,17 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
-	"net/http"
+	"math"
+	"math/rand"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,18 +22,41 @@ import (
 
 // RateLimiter manages rate limiting
 type RateLimiter struct {
-	config      *config.Config
-	redisClient *redis.Client
-	localLimits map[string]*clientLimit
-	mu          sync.RWMutex
-	useRedis    bool
+	config       *config.Config
+	redisClient  *redis.Client
+	localLimits  map[string]*clientLimit
+	mu           sync.RWMutex
+	useRedis     atomic.Bool // false while Redis is unreachable
+	reconnecting atomic.Bool
+	stop         chan struct{}
+	closeOnce    sync.Once
+	limits       atomic.Pointer[config.RateLimitConfig]
+	exemptIPs    atomic.Pointer[IPRanges] // Parsed from limits.ExemptCIDRs
+	metrics      *rateLimitMetrics
+	now          func() time.Time // replaced in tests
+	random       func() float64   // Retry-After jitter in [0, 1); replaced in tests
 }
 
-// clientLimit tracks requests for a client using token bucket algorithm
+// clientLimit is a client's token bucket. Tokens are fractional so that refills
+// between requests aren't rounded away.
 type clientLimit struct {
-	tokens       int
-	lastRefill   time.Time
-	mu           sync.Mutex
+	tokens  float64
+	updated time.Time // When tokens was last brought up to date
+	mu      sync.Mutex
+}
+
+// Prefixes of rate limit counters stored in Redis. Burst counters use their own prefix
+// so bucket listings only see the per-minute counters.
+const (
+	rateLimitKeyPrefix      = "ratelimit:"
+	rateLimitBurstKeyPrefix = "ratelimit-burst:"
+)
+
+// BucketInfo describes the current state of a client's rate limit bucket
+type BucketInfo struct {
+	Client    string    `json:"client"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
 }
 
 // NewRateLimiter creates a new rate limiter
@@ -33,11 +64,16 @@ func NewRateLimiter(cfg *config.Config) (*RateLimiter, error) {
 	rl := &RateLimiter{
 		config:      cfg,
 		localLimits: make(map[string]*clientLimit),
+		stop:        make(chan struct{}),
+		now:         time.Now,
+		random:      rand.Float64,
 	}
+	rl.metrics = newRateLimitMetrics(rl)
+	rl.UpdateConfig(cfg.RateLimit)
 
 	// Try to connect to Redis for distributed rate limiting
 	if cfg.Redis.Host != "" {
-		redisClient := redis.NewClient(&redis.Options{
+		rl.redisClient = redis.NewClient(&redis.Options{
 			Addr:     fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
 			Password: cfg.Redis.Password,
 			DB:       cfg.Redis.DB,
@@ -46,23 +82,106 @@ func NewRateLimiter(cfg *config.Config) (*RateLimiter, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		if err := redisClient.Ping(ctx).Err(); err == nil {
-			rl.redisClient = redisClient
-			rl.useRedis = true
+		if err := rl.ping(ctx); err == nil {
+			rl.useRedis.Store(true)
+		} else {
+			// Limit in memory until Redis becomes reachable
+			rl.metrics.redisFallbacks.Inc()
+			rl.startReconnect()
 		}
-		// If Redis is unavailable, fall back to in-memory rate limiting
 	}
 
-	// Start cleanup goroutine for local limits
-	if !rl.useRedis {
-		go rl.cleanupRoutine()
-	}
+	// Local limits back requests whenever Redis is unavailable
+	go rl.cleanupRoutine()
 
 	return rl, nil
 }
 
-// Close closes the rate limiter resources
+// demote switches to in-memory limiting after a Redis failure and starts retrying Redis
+func (rl *RateLimiter) demote() {
+	if rl.useRedis.CompareAndSwap(true, false) {
+		rl.metrics.redisFallbacks.Inc()
+		rl.startReconnect()
+	}
+}
+
+// sharedRedis is a Redis client used by counters besides the rate limiter's own. With a
+// limiter it is only used while the limiter reaches Redis, and a failure switches the
+// limiter, and every counter sharing it, to memory until Redis answers again.
+type sharedRedis struct {
+	client  *redis.Client
+	limiter *RateLimiter // nil when the client is always tried
+}
+
+// active reports whether counters should go to Redis
+func (s sharedRedis) active() bool {
+	return s.client != nil && (s.limiter == nil || s.limiter.useRedis.Load())
+}
+
+// failed records a Redis failure; the caller falls back to its in-memory counters
+func (s sharedRedis) failed() {
+	if s.limiter != nil {
+		s.limiter.demote()
+	}
+}
+
+// startReconnect pings Redis in the background until it answers, then switches back to
+// distributed limiting. At most one reconnect loop runs at a time.
+func (rl *RateLimiter) startReconnect() {
+	if !rl.reconnecting.CompareAndSwap(false, true) {
+		return
+	}
+
+	interval := rl.config.Redis.ReconnectInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	go func() {
+		defer rl.reconnecting.Store(false)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rl.stop:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := rl.ping(ctx)
+			cancel()
+			if err == nil {
+				rl.useRedis.Store(true)
+				return
+			}
+		}
+	}()
+}
+
+// ping checks that Redis answers, recording the latency
+func (rl *RateLimiter) ping(ctx context.Context) error {
+	defer rl.metrics.observeRedis("ping", time.Now())
+	return rl.redisClient.Ping(ctx).Err()
+}
+
+// UpdateConfig swaps in new rate limit settings; requests in flight keep the settings they started with
+func (rl *RateLimiter) UpdateConfig(limits config.RateLimitConfig) {
+	// Configuration validation rejects invalid ranges, so this only drops them if it was skipped
+	exemptIPs, _ := ParseIPRanges(limits.ExemptCIDRs)
+	rl.exemptIPs.Store(&exemptIPs)
+	rl.limits.Store(&limits)
+}
+
+// settings returns the current rate limit settings
+func (rl *RateLimiter) settings() *config.RateLimitConfig {
+	return rl.limits.Load()
+}
+
+// Close stops background work and closes the rate limiter resources
 func (rl *RateLimiter) Close() error {
+	rl.closeOnce.Do(func() { close(rl.stop) })
 	if rl.redisClient != nil {
 		return rl.redisClient.Close()
 	}
@@ -72,7 +191,8 @@ func (rl *RateLimiter) Close() error {
 // Middleware returns a Gin middleware for rate limiting
 func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !rl.config.RateLimit.Enabled {
+		limits := rl.settings()
+		if !limits.Enabled || rl.exempt(c, limits) {
 			c.Next()
 			return
 		}
@@ -82,23 +202,27 @@ func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 
 		allowed, remaining, resetTime, err := rl.allow(c.Request.Context(), clientID)
 		if err != nil {
+			// The request's time budget ran out while waiting on the store
+			if BudgetExceeded(c.Request.Context()) {
+				AbortBudgetExceeded(c)
+				return
+			}
 			// Log error but don't fail the request
 			c.Next()
 			return
 		}
 
-		// Set rate limit headers
-		c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", rl.config.RateLimit.RequestsPerMin))
+		// Set rate limit headers: the sustained limit, and the requests allowed at once
+		c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", limits.RequestsPerMin))
+		if burst, _ := localBucket(limits); int(burst) < limits.RequestsPerMin {
+			c.Header("X-RateLimit-Burst", fmt.Sprintf("%d", int(burst)))
+		}
 		c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
 		c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", resetTime.Unix()))
 
 		if !allowed {
-			c.Header("Retry-After", fmt.Sprintf("%d", int(time.Until(resetTime).Seconds())))
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":   "Too Many Requests",
-				"message": "Rate limit exceeded. Please try again later.",
-			})
-			c.Abort()
+			c.Header("Retry-After", strconv.Itoa(rl.retryAfter(resetTime, limits.RetryAfterJitter)))
+			AbortWithError(c, CodeRateLimited, "Rate limit exceeded. Please try again later.")
 			return
 		}
 
@@ -106,21 +230,89 @@ func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 	}
 }
 
-// allow checks if a request should be allowed based on rate limits
+// retryAfter returns the seconds a throttled client should wait: until reset, rounded
+// up, plus a random share of jitter so clients don't retry in lockstep
+func (rl *RateLimiter) retryAfter(reset time.Time, jitter time.Duration) int {
+	wait := reset.Sub(rl.now()) + time.Duration(rl.random()*float64(jitter))
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
+
+// exempt reports whether the request bypasses rate limiting: by its path, the client's
+// IP, a role of its token or its API key. Rate limiting runs before authentication, so
+// the token is verified here when roles are exempt.
+func (rl *RateLimiter) exempt(c *gin.Context, limits *config.RateLimitConfig) bool {
+	if isExemptPath(c.Request.URL.Path, limits.ExemptPaths) {
+		return true
+	}
+	if exemptIPs := *rl.exemptIPs.Load(); len(exemptIPs) > 0 && exemptIPs.Contains(net.ParseIP(accessIP(c))) {
+		return true
+	}
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		for _, exempt := range limits.ExemptAPIKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(exempt)) == 1 {
+				return true
+			}
+		}
+	}
+	if len(limits.ExemptRoles) > 0 {
+		claims, ok := GetUserFromContext(c)
+		if !ok {
+			if token, err := extractToken(c, rl.config.JWT); err == nil {
+				claims, _ = validateToken(token, rl.config.JWT)
+			}
+		}
+		if claims != nil {
+			for _, role := range claims.Roles {
+				if slices.Contains(limits.ExemptRoles, role) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isExemptPath reports whether path falls under one of the exempt prefixes. A prefix
+// matches the path itself or anything below it, never a longer segment: /health covers
+// /health/ready but not /healthz. A trailing * or /* spells out the same match.
+func isExemptPath(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(strings.TrimSuffix(prefix, "*"), "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// allow checks if a request should be allowed based on rate limits. A Redis failure
+// switches the limiter to local limits rather than letting the request through unchecked.
 func (rl *RateLimiter) allow(ctx context.Context, clientID string) (bool, int, time.Time, error) {
-	if rl.useRedis {
-		return rl.allowRedis(ctx, clientID)
+	if rl.useRedis.Load() {
+		allowed, remaining, reset, err := rl.allowRedis(ctx, clientID)
+		if err == nil {
+			rl.metrics.recordDecision(allowed, clientID, storeRedis)
+		}
+		if err == nil || ctx.Err() != nil {
+			return allowed, remaining, reset, err
+		}
+		rl.demote()
 	}
-	return rl.allowLocal(clientID)
+	allowed, remaining, reset, err := rl.allowLocal(clientID)
+	rl.metrics.recordDecision(allowed, clientID, storeLocal)
+	return allowed, remaining, reset, err
 }
 
-// allowRedis implements distributed rate limiting using Redis
+// allowRedis implements distributed rate limiting using Redis: a per-minute counter
+// enforces RequestsPerMin, and a counter over the time the sustained rate takes to
+// earn BurstSize requests caps bursts. Both windows are fixed.
 func (rl *RateLimiter) allowRedis(ctx context.Context, clientID string) (bool, int, time.Time, error) {
-	key := fmt.Sprintf("ratelimit:%s", clientID)
+	limits := rl.settings()
+	key := rateLimitKeyPrefix + clientID
 	window := time.Minute
-	limit := int64(rl.config.RateLimit.RequestsPerMin)
+	limit := int64(limits.RequestsPerMin)
 
-	now := time.Now()
+	now := rl.now()
 	windowStart := now.Truncate(window)
 
 	pipe := rl.redisClient.Pipeline()
@@ -131,32 +323,64 @@ func (rl *RateLimiter) allowRedis(ctx context.Context, clientID string) (bool, i
 	// Set expiry on first request
 	pipe.ExpireAt(ctx, key, windowStart.Add(window))
 
+	// Bursts are only limited separately when smaller than a minute's worth
+	burst, burstWindow := int64(limits.BurstSize), redisBurstWindow(limits)
+	var burstIncr *redis.IntCmd
+	var burstStart time.Time
+	if burstWindow > 0 {
+		burstKey := rateLimitBurstKeyPrefix + clientID
+		burstStart = now.Truncate(burstWindow)
+		burstIncr = pipe.Incr(ctx, burstKey)
+		pipe.ExpireAt(ctx, burstKey, burstStart.Add(burstWindow))
+	}
+
+	start := time.Now()
 	_, err := pipe.Exec(ctx)
+	rl.metrics.observeRedis("allow", start)
 	if err != nil {
 		return false, 0, time.Time{}, err
 	}
 
 	count := incr.Val()
 	remaining := int(limit - count)
+	resetTime := windowStart.Add(window)
+	allowed := count <= limit
+	if burstIncr != nil {
+		burstCount := burstIncr.Val()
+		remaining = min(remaining, int(burst-burstCount))
+		if allowed && burstCount > burst {
+			allowed = false
+			resetTime = burstStart.Add(burstWindow)
+		}
+	}
 	if remaining < 0 {
 		remaining = 0
 	}
 
-	resetTime := windowStart.Add(window)
-	allowed := count <= limit
-
 	return allowed, remaining, resetTime, nil
 }
 
-// allowLocal implements local in-memory rate limiting using token bucket
+// redisBurstWindow returns the window of the Redis burst counter: the time the
+// sustained rate takes to earn BurstSize requests, or 0 when bursts aren't limited
+// separately
+func redisBurstWindow(limits *config.RateLimitConfig) time.Duration {
+	if limits.BurstSize <= 0 || limits.BurstSize >= limits.RequestsPerMin {
+		return 0
+	}
+	return max(time.Minute*time.Duration(limits.BurstSize)/time.Duration(limits.RequestsPerMin), time.Second)
+}
+
+// allowLocal implements local in-memory rate limiting with a token bucket holding up to
+// BurstSize tokens, refilled continuously at RequestsPerMin. The reset time is when the
+// bucket is full again or, for a rejected request, when the next token arrives.
 func (rl *RateLimiter) allowLocal(clientID string) (bool, int, time.Time, error) {
+	now := rl.now()
+	capacity, _ := localBucket(rl.settings())
+
 	rl.mu.Lock()
 	limit, exists := rl.localLimits[clientID]
 	if !exists {
-		limit = &clientLimit{
-			tokens:     rl.config.RateLimit.RequestsPerMin,
-			lastRefill: time.Now(),
-		}
+		limit = &clientLimit{tokens: capacity, updated: now}
 		rl.localLimits[clientID] = limit
 	}
 	rl.mu.Unlock()
@@ -164,39 +388,200 @@ func (rl *RateLimiter) allowLocal(clientID string) (bool, int, time.Time, error)
 	limit.mu.Lock()
 	defer limit.mu.Unlock()
 
-	now := time.Now()
-	elapsed := now.Sub(limit.lastRefill)
+	limit.tokens, limit.updated = rl.refill(limit, now), now
 
-	// Refill tokens based on elapsed time
-	if elapsed >= time.Minute {
-		limit.tokens = rl.config.RateLimit.RequestsPerMin
-		limit.lastRefill = now
-	} else {
-		tokensToAdd := int(elapsed.Minutes() * float64(rl.config.RateLimit.RequestsPerMin))
-		limit.tokens += tokensToAdd
-		if limit.tokens > rl.config.RateLimit.RequestsPerMin {
-			limit.tokens = rl.config.RateLimit.RequestsPerMin
+	allowed := limit.tokens >= 1
+	if allowed {
+		limit.tokens--
+	}
+	target := capacity
+	if !allowed {
+		target = 1
+	}
+	return allowed, int(limit.tokens), rl.refilledAt(limit.tokens, target, now), nil
+}
+
+// localBucket returns the capacity and refill rate, in tokens per second, of local
+// buckets. Without a burst size the bucket holds a minute's worth of requests.
+func localBucket(limits *config.RateLimitConfig) (float64, float64) {
+	capacity := limits.BurstSize
+	if capacity <= 0 {
+		capacity = limits.RequestsPerMin
+	}
+	return float64(capacity), float64(limits.RequestsPerMin) / 60
+}
+
+// refill returns the bucket's tokens as of now without updating it; the caller must
+// hold limit.mu
+func (rl *RateLimiter) refill(limit *clientLimit, now time.Time) float64 {
+	capacity, rate := localBucket(rl.settings())
+	elapsed := now.Sub(limit.updated).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	// Buckets never hold more than the current capacity, which may have been lowered by a reload
+	return math.Min(limit.tokens+elapsed*rate, capacity)
+}
+
+// refilledAt returns when a bucket holding tokens at now reaches target tokens
+func (rl *RateLimiter) refilledAt(tokens, target float64, now time.Time) time.Time {
+	_, rate := localBucket(rl.settings())
+	if tokens >= target || rate <= 0 {
+		return now
+	}
+	return now.Add(time.Duration((target - tokens) / rate * float64(time.Second)))
+}
+
+// PingRedis checks that the configured Redis answers
+func (rl *RateLimiter) PingRedis(ctx context.Context) error {
+	if rl.redisClient == nil {
+		return fmt.Errorf("redis is not configured")
+	}
+	return rl.redisClient.Ping(ctx).Err()
+}
+
+// Store returns the backing store in use: "redis" or "local"
+func (rl *RateLimiter) Store() string {
+	if rl.useRedis.Load() {
+		return "redis"
+	}
+	return "local"
+}
+
+// Buckets lists active rate limit buckets a page at a time. The cursor is opaque:
+// pass "" to start and the returned cursor to continue; "" is returned after the last page.
+func (rl *RateLimiter) Buckets(ctx context.Context, cursor string, limit int) ([]BucketInfo, string, error) {
+	if rl.useRedis.Load() {
+		return rl.bucketsRedis(ctx, cursor, limit)
+	}
+	buckets, next := rl.bucketsLocal(cursor, limit)
+	return buckets, next, nil
+}
+
+// bucketsLocal lists in-memory buckets in client order, starting after the cursor
+func (rl *RateLimiter) bucketsLocal(cursor string, limit int) ([]BucketInfo, string) {
+	clients := rl.localClientsAfter(cursor)
+	next := ""
+	if len(clients) > limit {
+		clients = clients[:limit]
+		next = clients[limit-1]
+	}
+
+	now := rl.now()
+	capacity, _ := localBucket(rl.settings())
+	buckets := make([]BucketInfo, 0, len(clients))
+	for _, client := range clients {
+		rl.mu.RLock()
+		bucket, ok := rl.localLimits[client]
+		rl.mu.RUnlock()
+		if !ok {
+			continue
 		}
-		if tokensToAdd > 0 {
-			limit.lastRefill = now
+
+		// Report the refilled state without consuming or mutating the bucket
+		bucket.mu.Lock()
+		tokens := rl.refill(bucket, now)
+		bucket.mu.Unlock()
+
+		buckets = append(buckets, BucketInfo{
+			Client:    client,
+			Remaining: int(tokens),
+			Reset:     rl.refilledAt(tokens, capacity, now),
+		})
+	}
+	return buckets, next
+}
+
+// localClientsAfter returns the sorted client keys greater than cursor
+func (rl *RateLimiter) localClientsAfter(cursor string) []string {
+	rl.mu.RLock()
+	clients := make([]string, 0, len(rl.localLimits))
+	for client := range rl.localLimits {
+		if client > cursor {
+			clients = append(clients, client)
 		}
 	}
+	rl.mu.RUnlock()
 
-	// Check if request can be allowed
-	allowed := limit.tokens > 0
-	if allowed {
-		limit.tokens--
+	sort.Strings(clients)
+	return clients
+}
+
+// bucketsRedis scans Redis for rate limit counters. SCAN may return slightly more or
+// fewer keys than requested, so the page is trimmed to the limit.
+func (rl *RateLimiter) bucketsRedis(ctx context.Context, cursor string, limit int) ([]BucketInfo, string, error) {
+	var scanCursor uint64
+	if cursor != "" {
+		parsed, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+		scanCursor = parsed
 	}
 
-	remaining := limit.tokens
-	if remaining < 0 {
-		remaining = 0
+	keys, next, err := rl.redisClient.Scan(ctx, scanCursor, rateLimitKeyPrefix+"*", int64(limit)).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(keys) > limit {
+		keys = keys[:limit]
 	}
 
-	// Calculate reset time
-	resetTime := limit.lastRefill.Add(time.Minute)
+	pipe := rl.redisClient.Pipeline()
+	counts := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		counts[i] = pipe.Get(ctx, key)
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, "", err
+	}
 
-	return allowed, remaining, resetTime, nil
+	now := time.Now()
+	buckets := make([]BucketInfo, 0, len(keys))
+	for i, key := range keys {
+		count, err := counts[i].Int()
+		if err != nil {
+			// Expired between SCAN and GET
+			continue
+		}
+		remaining := rl.settings().RequestsPerMin - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		buckets = append(buckets, BucketInfo{
+			Client:    strings.TrimPrefix(key, rateLimitKeyPrefix),
+			Remaining: remaining,
+			Reset:     now.Add(ttls[i].Val()),
+		})
+	}
+
+	nextCursor := ""
+	if next != 0 {
+		nextCursor = strconv.FormatUint(next, 10)
+	}
+	return buckets, nextCursor, nil
+}
+
+// Reset forgets a client's bucket, e.g. "user:42" or "ip:10.0.0.1", so its next request
+// starts with a full allowance. Local buckets are dropped in either mode, as the
+// limiter falls back to them while Redis is unreachable. It reports whether the client
+// had a bucket.
+func (rl *RateLimiter) Reset(ctx context.Context, clientID string) (bool, error) {
+	rl.mu.Lock()
+	_, found := rl.localLimits[clientID]
+	delete(rl.localLimits, clientID)
+	rl.mu.Unlock()
+
+	if rl.useRedis.Load() {
+		deleted, err := rl.redisClient.Del(ctx, rateLimitKeyPrefix+clientID, rateLimitBurstKeyPrefix+clientID).Result()
+		if err != nil {
+			return found, err
+		}
+		found = found || deleted > 0
+	}
+	return found, nil
 }
 
 // getClientID returns a unique identifier for the client
@@ -206,13 +591,9 @@ func (rl *RateLimiter) getClientID(c *gin.Context) string {
 		return fmt.Sprintf("user:%s", claims.UserID)
 	}
 
-	// Fall back to IP address
-	// Check X-Forwarded-For header for proxy scenarios
-	if xff := c.GetHeader("X-Forwarded-For"); xff != "" {
-		return fmt.Sprintf("ip:%s", xff)
-	}
-
-	return fmt.Sprintf("ip:%s", c.ClientIP())
+	// Fall back to IP address: the nearest hop that isn't a trusted proxy, so clients
+	// can't evade limits by sending arbitrary X-Forwarded-For values.
+	return fmt.Sprintf("ip:%s", accessIP(c))
 }
 
 // cleanupRoutine periodically cleans up old entries from local limits
@@ -220,8 +601,13 @@ func (rl *RateLimiter) cleanupRoutine() {
 	ticker := time.NewTicker(rl.config.RateLimit.CleanupInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		rl.cleanup()
+	for {
+		select {
+		case <-rl.stop:
+			return
+		case <-ticker.C:
+			rl.cleanup()
+		}
 	}
 }
 
@@ -230,11 +616,11 @@ func (rl *RateLimiter) cleanup() {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	now := time.Now()
+	now := rl.now()
 	for clientID, limit := range rl.localLimits {
 		limit.mu.Lock()
 		// Remove entries that haven't been accessed in 10 minutes
-		if now.Sub(limit.lastRefill) > 10*time.Minute {
+		if now.Sub(limit.updated) > 10*time.Minute {
 			delete(rl.localLimits, clientID)
 		}
 		limit.mu.Unlock()
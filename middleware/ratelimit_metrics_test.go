@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterMetrics(t *testing.T) {
+	rl := newTestRateLimiter(t, &config.Config{
+		RateLimit: config.RateLimitConfig{RequestsPerMin: 1, BurstSize: 1},
+	})
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, registry.Register(rl))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	assert.NoError(t, TrustProxies(router, nil))
+	router.Use(rl.Middleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "203.0.113.9:5000"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	decisions := rl.metrics.decisions
+	assert.Equal(t, 1.0, testutil.ToFloat64(decisions.WithLabelValues(decisionAllowed, "ip", storeLocal)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(decisions.WithLabelValues(decisionRejected, "ip", storeLocal)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(rl.metrics.localBuckets))
+	// No Redis configured, so the limiter is not in fallback
+	assert.Equal(t, 0.0, testutil.ToFloat64(rl.metrics.redisFallback))
+
+	count, err := testutil.GatherAndCount(registry, "gateway_rate_limit_decisions_total")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
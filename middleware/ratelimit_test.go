@@ -0,0 +1,524 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRateLimiter creates an in-memory rate limiter for tests
+func newTestRateLimiter(t *testing.T, cfg *config.Config) *RateLimiter {
+	cfg.RateLimit.Enabled = true
+	if cfg.RateLimit.RequestsPerMin == 0 {
+		cfg.RateLimit.RequestsPerMin = 100
+	}
+	if cfg.RateLimit.BurstSize == 0 {
+		cfg.RateLimit.BurstSize = 20
+	}
+	cfg.RateLimit.CleanupInterval = time.Minute
+
+	rl, err := NewRateLimiter(cfg)
+	if err != nil {
+		t.Fatalf("failed to create rate limiter: %v", err)
+	}
+	t.Cleanup(func() { rl.Close() })
+	return rl
+}
+
+func clientIDFor(rl *RateLimiter, remoteAddr string, forwardedFor ...string) string {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	TrustProxies(router, rl.config.TrustedProxies)
+	router.GET("/", func(c *gin.Context) { c.String(http.StatusOK, rl.getClientID(c)) })
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = remoteAddr
+	for _, xff := range forwardedFor {
+		req.Header.Add("X-Forwarded-For", xff)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestRateLimiterClientIDTrustedProxies(t *testing.T) {
+	rl := newTestRateLimiter(t, &config.Config{TrustedProxies: []string{"10.0.0.0/8"}})
+
+	// Untrusted peer: a spoofed header is ignored
+	assert.Equal(t, "ip:203.0.113.9", clientIDFor(rl, "203.0.113.9:5000", "1.2.3.4"))
+	// Trusted peer: the nearest untrusted hop is the client, as hops further left are
+	// whatever it sent
+	assert.Equal(t, "ip:198.51.100.7", clientIDFor(rl, "10.0.0.2:443", "1.2.3.4, 198.51.100.7, 10.0.0.3"))
+	// Repeated headers are treated as one chain
+	assert.Equal(t, "ip:198.51.100.7", clientIDFor(rl, "10.0.0.2:443", "1.2.3.4", "198.51.100.7"))
+	// No header: the peer itself
+	assert.Equal(t, "ip:10.0.0.2", clientIDFor(rl, "10.0.0.2:443"))
+}
+
+func TestRateLimiterSpoofedForwardedForCannotEvadeLimit(t *testing.T) {
+	rl := newTestRateLimiter(t, &config.Config{
+		RateLimit: config.RateLimitConfig{RequestsPerMin: 2, BurstSize: 2},
+	})
+
+	router := gin.New()
+	assert.NoError(t, TrustProxies(router, nil))
+	router.Use(rl.Middleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	codes := make([]int, 0, 3)
+	for _, spoofed := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "203.0.113.9:5000"
+		req.Header.Set("X-Forwarded-For", spoofed)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+}
+
+func TestRateLimiterSpoofedHopBehindTrustedProxy(t *testing.T) {
+	rl := newTestRateLimiter(t, &config.Config{
+		TrustedProxies: []string{"10.0.0.0/8"},
+		RateLimit:      config.RateLimitConfig{RequestsPerMin: 2, BurstSize: 2, ExemptCIDRs: []string{"192.168.0.0/16"}},
+	})
+
+	router := gin.New()
+	assert.NoError(t, TrustProxies(router, rl.config.TrustedProxies))
+	router.Use(rl.Middleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// The proxy appends the client's address to whatever chain the client sent
+	codes := make([]int, 0, 3)
+	for _, spoofed := range []string{"1.1.1.1", "192.168.1.1", "2.2.2.2"} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.2:443"
+		req.Header.Set("X-Forwarded-For", spoofed+", 203.0.113.9")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes,
+		"spoofed hops neither change the bucket nor match an exempt range")
+	assert.Equal(t, "ip:203.0.113.9", clientIDFor(rl, "10.0.0.2:443", "1.1.1.1, 203.0.113.9"))
+}
+
+func TestRateLimiterHotReload(t *testing.T) {
+	writeConfig := func(path string, requestsPerMin int) {
+		content := fmt.Sprintf("rate_limit:\n  enabled: true\n  requests_per_min: %d\n  burst_size: %d\n  cleanup_interval: 1m\n", requestsPerMin, requestsPerMin)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(path, 2)
+
+	cfg, err := config.LoadConfigFile(path)
+	assert.NoError(t, err)
+	rl := newTestRateLimiter(t, cfg)
+
+	reloaded := make(chan struct{}, 1)
+	config.WatchConfig(func(newCfg *config.Config, err error) {
+		if err == nil {
+			rl.UpdateConfig(newCfg.RateLimit)
+			select {
+			case reloaded <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	router := gin.New()
+	router.Use(rl.Middleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	allowed := func(remoteAddr string, requests int) int {
+		count := 0
+		for i := 0; i < requests; i++ {
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.RemoteAddr = remoteAddr
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code == http.StatusOK {
+				count++
+			}
+		}
+		return count
+	}
+
+	assert.Equal(t, 2, allowed("203.0.113.1:5000", 5))
+
+	writeConfig(path, 4)
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config change was not picked up")
+	}
+
+	assert.Equal(t, 4, allowed("203.0.113.2:5000", 6))
+}
+
+func TestRateLimiterExemptPaths(t *testing.T) {
+	rl := newTestRateLimiter(t, &config.Config{
+		RateLimit: config.RateLimitConfig{RequestsPerMin: 1, BurstSize: 1, ExemptPaths: []string{"/health", "/metrics/"}},
+	})
+
+	router := gin.New()
+	router.Use(rl.Middleware())
+	for _, path := range []string{"/health", "/health/ready", "/health/live", "/metrics", "/healthz", "/api"} {
+		router.GET(path, func(c *gin.Context) { c.Status(http.StatusOK) })
+	}
+
+	get := func(path string) int {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = "203.0.113.9:5000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Use up the client's only token
+	assert.Equal(t, http.StatusOK, get("/api"))
+	assert.Equal(t, http.StatusTooManyRequests, get("/api"))
+
+	for i := 0; i < 20; i++ {
+		for _, path := range []string{"/health", "/health/ready", "/health/live", "/metrics"} {
+			assert.Equal(t, http.StatusOK, get(path), path)
+		}
+	}
+
+	// Prefixes match whole segments only
+	assert.Equal(t, http.StatusTooManyRequests, get("/healthz"))
+}
+
+func TestRateLimiterExemptions(t *testing.T) {
+	rl := newTestRateLimiter(t, &config.Config{
+		JWT: config.JWTConfig{SecretKey: "test-secret"},
+		RateLimit: config.RateLimitConfig{
+			RequestsPerMin: 1,
+			BurstSize:      1,
+			ExemptPaths:    []string{"/health*", "/metrics"},
+			ExemptCIDRs:    []string{"10.0.0.0/8"},
+			ExemptRoles:    []string{"internal"},
+			ExemptAPIKeys:  []string{"monitoring-key"},
+		},
+	})
+
+	router := gin.New()
+	router.Use(rl.Middleware())
+	for _, path := range []string{"/health", "/health/ready", "/healthz", "/metrics", "/api"} {
+		router.GET(path, func(c *gin.Context) { c.Status(http.StatusOK) })
+	}
+
+	get := func(path, remoteAddr string, headers ...string) int {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Health checks are never throttled, whatever the client
+	for i := 0; i < 50; i++ {
+		addr := fmt.Sprintf("203.0.113.%d:5000", i%5)
+		assert.Equal(t, http.StatusOK, get("/health", addr))
+		assert.Equal(t, http.StatusOK, get("/health/ready", addr))
+		assert.Equal(t, http.StatusOK, get("/metrics", addr))
+	}
+	// The wildcard stops at segment boundaries
+	assert.Equal(t, http.StatusOK, get("/healthz", "203.0.113.9:5000"))
+	assert.Equal(t, http.StatusTooManyRequests, get("/healthz", "203.0.113.9:5000"))
+
+	// An exempt range bypasses the limit, other clients don't
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, http.StatusOK, get("/api", "10.1.2.3:1234"))
+	}
+	assert.Equal(t, http.StatusOK, get("/api", "192.168.1.1:1234"))
+	assert.Equal(t, http.StatusTooManyRequests, get("/api", "192.168.1.1:1234"))
+
+	// So do exempt roles and API keys, but not other roles or keys
+	token := func(roles ...string) string {
+		claims := &Claims{UserID: "1", Roles: roles, RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}}
+		signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+		return "Bearer " + signed
+	}
+	assert.Equal(t, http.StatusOK, get("/api", "192.168.1.1:1234", "Authorization", token("internal")))
+	assert.Equal(t, http.StatusTooManyRequests, get("/api", "192.168.1.1:1234", "Authorization", token("user")))
+	assert.Equal(t, http.StatusOK, get("/api", "192.168.1.1:1234", "X-Api-Key", "monitoring-key"))
+	assert.Equal(t, http.StatusTooManyRequests, get("/api", "192.168.1.1:1234", "X-Api-Key", "other-key"))
+}
+
+// redisConfig points the rate limiter at addr, retrying quickly while it is down
+func redisConfig(t *testing.T, addr string) *config.Config {
+	host, port, _ := net.SplitHostPort(addr)
+	portNumber, _ := strconv.Atoi(port)
+	return &config.Config{
+		Redis:     config.RedisConfig{Host: host, Port: portNumber, ReconnectInterval: 20 * time.Millisecond},
+		RateLimit: config.RateLimitConfig{RequestsPerMin: 2, BurstSize: 2},
+	}
+}
+
+func TestRateLimiterPromotesToRedis(t *testing.T) {
+	addr := freeAddr(t)
+	rl := newTestRateLimiter(t, redisConfig(t, addr))
+	assert.Equal(t, "local", rl.Store())
+
+	server := startFakeRedis(t, addr)
+	assert.Eventually(t, func() bool { return rl.Store() == "redis" }, 5*time.Second, 10*time.Millisecond)
+
+	allowed, _, _, err := rl.allow(context.Background(), "ip:203.0.113.9")
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, 1, server.count("ratelimit:ip:203.0.113.9"))
+}
+
+func TestRateLimiterDemotesWhenRedisFails(t *testing.T) {
+	addr := freeAddr(t)
+	server := startFakeRedis(t, addr)
+	rl := newTestRateLimiter(t, redisConfig(t, addr))
+	assert.Equal(t, "redis", rl.Store())
+
+	allow := func() bool {
+		allowed, _, _, err := rl.allow(context.Background(), "ip:203.0.113.9")
+		assert.NoError(t, err)
+		return allowed
+	}
+	assert.True(t, allow())
+	assert.Equal(t, 1, server.count("ratelimit:ip:203.0.113.9"))
+
+	// The outage switches to local limits instead of letting requests through unchecked
+	server.stop()
+	assert.True(t, allow())
+	assert.Equal(t, "local", rl.Store())
+	assert.True(t, allow())
+	assert.False(t, allow())
+
+	// Distributed limiting resumes once Redis is back
+	startFakeRedis(t, addr)
+	assert.Eventually(t, func() bool { return rl.Store() == "redis" }, 5*time.Second, 10*time.Millisecond)
+}
+
+// fakeClock is a manually advanced clock for the local limiter
+type fakeClock struct{ now time.Time }
+
+func (f *fakeClock) Now() time.Time          { return f.now }
+func (f *fakeClock) Advance(d time.Duration) { f.now = f.now.Add(d) }
+
+func TestLocalTokenBucketSteadyRate(t *testing.T) {
+	rl := newTestRateLimiter(t, &config.Config{
+		RateLimit: config.RateLimitConfig{RequestsPerMin: 60, BurstSize: 2},
+	})
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	rl.now = clock.Now
+
+	// 57 requests a minute against a limit of 60, for ten minutes. Intervals that
+	// don't add up to whole tokens must not lose the fraction.
+	for i := 0; i < 570; i++ {
+		allowed, _, _, _ := rl.allowLocal("ip:203.0.113.9")
+		if !assert.True(t, allowed, "request %d rejected below the limit", i) {
+			return
+		}
+		clock.Advance(1052 * time.Millisecond)
+	}
+}
+
+func TestLocalTokenBucketRefillsProportionally(t *testing.T) {
+	rl := newTestRateLimiter(t, &config.Config{
+		RateLimit: config.RateLimitConfig{RequestsPerMin: 60, BurstSize: 3},
+	})
+	start := time.Unix(1_700_000_000, 0)
+	clock := &fakeClock{now: start}
+	rl.now = clock.Now
+	const client = "ip:203.0.113.9"
+
+	for i := 2; i >= 0; i-- {
+		allowed, remaining, reset, _ := rl.allowLocal(client)
+		assert.True(t, allowed)
+		assert.Equal(t, i, remaining)
+		// The bucket is full again once the used tokens have been refilled
+		assert.Equal(t, start.Add(time.Duration(3-i)*time.Second), reset)
+	}
+
+	// Empty: a rejected request is told when the next token arrives
+	clock.Advance(400 * time.Millisecond)
+	allowed, remaining, reset, _ := rl.allowLocal(client)
+	assert.False(t, allowed)
+	assert.Equal(t, 0, remaining)
+	assert.Equal(t, start.Add(time.Second), reset)
+
+	// Partial refills add up rather than being discarded
+	clock.Advance(600 * time.Millisecond)
+	allowed, _, _, _ = rl.allowLocal(client)
+	assert.True(t, allowed)
+
+	// Idle clients refill up to the capacity, not beyond
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		allowed, _, _, _ = rl.allowLocal(client)
+		assert.True(t, allowed)
+	}
+	allowed, _, _, _ = rl.allowLocal(client)
+	assert.False(t, allowed)
+}
+
+func TestRateLimiterBurstSize(t *testing.T) {
+	newLimiter := func(cfg *config.Config, now time.Time) *RateLimiter {
+		cfg.RateLimit.RequestsPerMin, cfg.RateLimit.BurstSize = 60, 5
+		rl := newTestRateLimiter(t, cfg)
+		clock := &fakeClock{now: now}
+		rl.now = clock.Now
+		return rl
+	}
+	burst := func(t *testing.T, rl *RateLimiter) {
+		for i := 0; i < 5; i++ {
+			allowed, remaining, _, err := rl.allow(context.Background(), "ip:203.0.113.9")
+			assert.NoError(t, err)
+			assert.True(t, allowed, "request %d of the burst rejected", i+1)
+			assert.Equal(t, 4-i, remaining)
+		}
+		// The sustained limit has room left, but the burst is spent
+		allowed, _, _, err := rl.allow(context.Background(), "ip:203.0.113.9")
+		assert.NoError(t, err)
+		assert.False(t, allowed)
+	}
+
+	t.Run("local", func(t *testing.T) {
+		burst(t, newLimiter(&config.Config{}, time.Unix(1_700_000_040, 0)))
+	})
+	t.Run("redis", func(t *testing.T) {
+		// Counters expire at the end of their window by Redis's clock, so the limiter's
+		// clock must be the real one
+		addr := freeAddr(t)
+		server := startFakeRedis(t, addr)
+		now := time.Now()
+		rl := newLimiter(redisConfig(t, addr), now)
+		assert.Equal(t, "redis", rl.Store())
+		burst(t, rl)
+
+		// Each counter lives until the end of its window: a minute, and the five seconds
+		// the sustained rate takes to earn the burst
+		assert.WithinDuration(t, now.Truncate(time.Minute).Add(time.Minute), time.Now().Add(server.ttl("ratelimit:ip:203.0.113.9")), time.Second)
+		assert.WithinDuration(t, now.Truncate(5*time.Second).Add(5*time.Second), time.Now().Add(server.ttl("ratelimit-burst:ip:203.0.113.9")), time.Second)
+
+		// Once a window has passed, its counter is gone
+		rl.now = func() time.Time { return now.Add(-time.Minute) }
+		_, _, _, err := rl.allow(context.Background(), "ip:198.51.100.1")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, server.count("ratelimit:ip:198.51.100.1"))
+		assert.Equal(t, 0, server.count("ratelimit-burst:ip:198.51.100.1"))
+	})
+}
+
+func TestRateLimiterBurstHeader(t *testing.T) {
+	rl := newTestRateLimiter(t, &config.Config{
+		RateLimit: config.RateLimitConfig{RequestsPerMin: 60, BurstSize: 5},
+	})
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(rl.Middleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "60", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "5", w.Header().Get("X-RateLimit-Burst"))
+	assert.Equal(t, "4", w.Header().Get("X-RateLimit-Remaining"))
+}
+
+func TestRateLimiterReset(t *testing.T) {
+	throttleAndReset := func(t *testing.T, rl *RateLimiter) {
+		allow := func() bool {
+			allowed, _, _, err := rl.allow(context.Background(), "ip:203.0.113.9")
+			assert.NoError(t, err)
+			return allowed
+		}
+		assert.True(t, allow())
+		assert.True(t, allow())
+		assert.False(t, allow())
+
+		found, err := rl.Reset(context.Background(), "ip:203.0.113.9")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.True(t, allow())
+
+		found, err = rl.Reset(context.Background(), "ip:198.51.100.1")
+		assert.NoError(t, err)
+		assert.False(t, found)
+	}
+
+	t.Run("local", func(t *testing.T) {
+		throttleAndReset(t, newTestRateLimiter(t, &config.Config{
+			RateLimit: config.RateLimitConfig{RequestsPerMin: 2, BurstSize: 2},
+		}))
+	})
+	t.Run("redis", func(t *testing.T) {
+		addr := freeAddr(t)
+		startFakeRedis(t, addr)
+		rl := newTestRateLimiter(t, redisConfig(t, addr))
+		assert.Equal(t, "redis", rl.Store())
+		throttleAndReset(t, rl)
+	})
+}
+
+func TestRateLimiterRetryAfterJitter(t *testing.T) {
+	rl := newTestRateLimiter(t, &config.Config{
+		RateLimit: config.RateLimitConfig{RequestsPerMin: 60, BurstSize: 1, RetryAfterJitter: 10 * time.Second},
+	})
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	rl.now = clock.Now
+	draws := []float64{0, 0.5, 0.999}
+	rl.random = func() float64 {
+		draw := draws[0]
+		draws = draws[1:]
+		return draw
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(rl.Middleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w
+	}
+	assert.Equal(t, http.StatusOK, request().Code)
+
+	// The bucket refills in a second; the jitter adds up to ten more
+	for _, want := range []string{"1", "6", "11"} {
+		w := request()
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, want, w.Header().Get("Retry-After"))
+		assert.Equal(t, strconv.FormatInt(clock.now.Add(time.Second).Unix(), 10), w.Header().Get("X-RateLimit-Reset"))
+		assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+		assert.Contains(t, w.Body.String(), `"code":"RATE_LIMITED"`)
+	}
+
+	// Real draws stay within the bound
+	rl.random = rand.Float64
+	for i := 0; i < 20; i++ {
+		retryAfter, err := strconv.Atoi(request().Header().Get("Retry-After"))
+		assert.NoError(t, err)
+		assert.True(t, retryAfter >= 1 && retryAfter <= 11, "Retry-After %d out of bounds", retryAfter)
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Recovery recovers panics in later middleware and handlers, logging them with their
+// stack and answering with the standard JSON error. It replaces gin.Recovery, and
+// counts panics by route for Prometheus.
+type Recovery struct {
+	logger *zap.Logger
+	panics *prometheus.CounterVec
+}
+
+// NewRecovery creates the panic recovery middleware
+func NewRecovery(logger *zap.Logger) *Recovery {
+	return &Recovery{
+		logger: logger,
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_panics_total",
+			Help: "Panics recovered while serving requests, by route.",
+		}, []string{"route"}),
+	}
+}
+
+// Middleware returns a middleware recovering panics. A panic before the response
+// started gets a 500 INTERNAL_ERROR; once the response has started or the connection
+// was hijacked, the connection is aborted instead so clients can't mistake a truncated
+// response for a complete one. http.ErrAbortHandler and broken client connections are
+// passed on or dropped without a stack, as they are not gateway faults.
+func (r *Recovery) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			fields := []zap.Field{
+				zap.String("request_id", c.GetString("request_id")),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+			}
+			if err, ok := recovered.(error); ok && brokenConnection(err) {
+				r.logger.Warn("Client connection broken", append(fields, zap.Error(err))...)
+				c.Abort()
+				return
+			}
+
+			r.panics.WithLabelValues(c.FullPath()).Inc()
+			r.logger.Error("Panic recovered",
+				append(fields, zap.String("panic", fmt.Sprint(recovered)), zap.Stack("stack"))...,
+			)
+
+			if c.Writer.Written() {
+				panic(http.ErrAbortHandler)
+			}
+			AbortWithError(c, CodeInternal, "Internal server error")
+		}()
+
+		c.Next()
+	}
+}
+
+// brokenConnection reports whether err comes from writing to a client that went away
+func brokenConnection(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// Describe implements prometheus.Collector
+func (r *Recovery) Describe(ch chan<- *prometheus.Desc) {
+	r.panics.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (r *Recovery) Collect(ch chan<- prometheus.Metric) {
+	r.panics.Collect(ch)
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newRecoveryRouter(recovery *Recovery) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(recovery.Middleware(), RequestID(&config.Config{}))
+	router.GET("/panic", func(c *gin.Context) {
+		panic("something broke")
+	})
+	router.GET("/stream", func(c *gin.Context) {
+		c.Writer.WriteString("partial")
+		c.Writer.Flush()
+		panic("broke mid-stream")
+	})
+	return router
+}
+
+func TestRecoveryWritesJSONError(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	recovery := NewRecovery(zap.New(core))
+	router := newRecoveryRouter(recovery)
+
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	var body APIError
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, CodeInternal, body.Code)
+	assert.Equal(t, "req-42", body.RequestID)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(recovery.panics.WithLabelValues("/panic")))
+	entries := logs.FilterMessage("Panic recovered").All()
+	if assert.Len(t, entries, 1) {
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "something broke", fields["panic"])
+		assert.Equal(t, "req-42", fields["request_id"])
+		assert.Contains(t, fields["stack"], "recovery_test")
+	}
+}
+
+func TestRecoveryAbortsStartedResponse(t *testing.T) {
+	recovery := NewRecovery(zap.NewNop())
+	server := httptest.NewServer(newRecoveryRouter(recovery))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The response was already under way, so the connection is cut rather than ended
+	// as if it were complete
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = io.ReadAll(resp.Body)
+	assert.Error(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(recovery.panics.WithLabelValues("/stream")))
+}
@@ -0,0 +1,341 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a minimal RESP server implementing the commands the rate limiter and
+// replay store use, including WATCH and MULTI/EXEC transactions. Keys expire as in
+// Redis, by the real clock.
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	values   map[string]fakeValue
+	versions map[string]int // Bumped on every write, for WATCH
+	conns    map[net.Conn]bool
+	wg       sync.WaitGroup
+}
+
+// fakeSession is the transaction state of one connection
+type fakeSession struct {
+	multi   bool
+	queued  [][]string
+	watched map[string]int
+}
+
+// fakeValue is a string key with an optional expiry
+type fakeValue struct {
+	value   string
+	expires time.Time // zero when the key doesn't expire
+}
+
+// startFakeRedis serves on addr until the test ends or stop is called
+func startFakeRedis(t *testing.T, addr string) *fakeRedis {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("fake redis: %v", err)
+	}
+	r := &fakeRedis{
+		listener: listener,
+		values:   make(map[string]fakeValue),
+		versions: make(map[string]int),
+		conns:    make(map[net.Conn]bool),
+	}
+	r.wg.Add(1)
+	go r.serve()
+	t.Cleanup(r.stop)
+	return r
+}
+
+// freeAddr returns a local address nothing is listening on
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+// stop closes the listener and every open connection, like a Redis outage
+func (r *fakeRedis) stop() {
+	r.listener.Close()
+	r.mu.Lock()
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+// count returns a counter's value
+func (r *fakeRedis) count(key string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, _ := r.lookup(key)
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+// ttl returns the time left before a key expires, or 0 when it doesn't expire
+func (r *fakeRedis) ttl(key string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.lookup(key); !ok || r.values[key].expires.IsZero() {
+		return 0
+	}
+	return time.Until(r.values[key].expires)
+}
+
+func (r *fakeRedis) serve() {
+	defer r.wg.Done()
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.conns[conn] = true
+		r.mu.Unlock()
+		r.wg.Add(1)
+		go r.handle(conn)
+	}
+}
+
+func (r *fakeRedis) handle(conn net.Conn) {
+	defer r.wg.Done()
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	session := &fakeSession{}
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, r.transact(session, args)); err != nil {
+			return
+		}
+	}
+}
+
+// transact runs a command within the connection's transaction state
+func (r *fakeRedis) transact(session *fakeSession, args []string) string {
+	switch command := strings.ToUpper(args[0]); {
+	case command == "WATCH":
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if session.watched == nil {
+			session.watched = make(map[string]int)
+		}
+		for _, key := range args[1:] {
+			session.watched[key] = r.versions[key]
+		}
+		return "+OK\r\n"
+	case command == "UNWATCH":
+		session.watched = nil
+		return "+OK\r\n"
+	case command == "MULTI":
+		session.multi = true
+		return "+OK\r\n"
+	case command == "DISCARD":
+		*session = fakeSession{}
+		return "+OK\r\n"
+	case command == "EXEC":
+		queued, watched := session.queued, session.watched
+		*session = fakeSession{}
+		r.mu.Lock()
+		for key, version := range watched {
+			if r.versions[key] != version {
+				r.mu.Unlock()
+				return "*-1\r\n"
+			}
+		}
+		r.mu.Unlock()
+		reply := fmt.Sprintf("*%d\r\n", len(queued))
+		for _, queuedArgs := range queued {
+			reply += r.execute(queuedArgs)
+		}
+		return reply
+	case session.multi:
+		session.queued = append(session.queued, args)
+		return "+QUEUED\r\n"
+	}
+	return r.execute(args)
+}
+
+// execute runs a command and returns its RESP reply
+func (r *fakeRedis) execute(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "INCR", "DECR":
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delta := 1
+		if strings.ToUpper(args[0]) == "DECR" {
+			delta = -1
+		}
+		// The counter keeps its expiry, as in Redis
+		value, ok := r.lookup(args[1])
+		entry := r.values[args[1]]
+		if !ok {
+			entry = fakeValue{}
+		}
+		n, _ := strconv.Atoi(value)
+		entry.value = strconv.Itoa(n + delta)
+		r.values[args[1]] = entry
+		r.versions[args[1]]++
+		return fmt.Sprintf(":%d\r\n", n+delta)
+	case "PTTL":
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, ok := r.lookup(args[1]); !ok {
+			return ":-2\r\n"
+		}
+		expires := r.values[args[1]].expires
+		if expires.IsZero() {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", time.Until(expires).Milliseconds())
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT":
+		return r.expire(strings.ToUpper(args[0]), args[1], args[2])
+	case "SET":
+		return r.set(args[1], args[2], args[3:])
+	case "GET":
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		value, ok := r.lookup(args[1])
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "DEL":
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		deleted := 0
+		for _, key := range args[1:] {
+			r.versions[key]++
+			if _, ok := r.lookup(key); ok {
+				deleted++
+			}
+			delete(r.values, key)
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+// set implements SET with the NX, EX and PX options
+func (r *fakeRedis) set(key, value string, options []string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := fakeValue{value: value}
+	onlyIfAbsent := false
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case "NX":
+			onlyIfAbsent = true
+		case "EX", "PX":
+			n, _ := strconv.Atoi(options[i+1])
+			unit := time.Second
+			if strings.ToUpper(options[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			entry.expires = time.Now().Add(time.Duration(n) * unit)
+			i++
+		}
+	}
+
+	if _, exists := r.lookup(key); exists && onlyIfAbsent {
+		return "$-1\r\n"
+	}
+	r.values[key] = entry
+	r.versions[key]++
+	return "+OK\r\n"
+}
+
+// expire implements EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT. As in Redis, an expiry
+// that has already passed deletes the key.
+func (r *fakeRedis) expire(command, key, arg string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return "-ERR value is not an integer or out of range\r\n"
+	}
+	if _, ok := r.lookup(key); !ok {
+		return ":0\r\n"
+	}
+	var expires time.Time
+	switch command {
+	case "EXPIRE":
+		expires = time.Now().Add(time.Duration(n) * time.Second)
+	case "PEXPIRE":
+		expires = time.Now().Add(time.Duration(n) * time.Millisecond)
+	case "EXPIREAT":
+		expires = time.Unix(n, 0)
+	case "PEXPIREAT":
+		expires = time.UnixMilli(n)
+	}
+
+	r.versions[key]++
+	if !time.Now().Before(expires) {
+		delete(r.values, key)
+		return ":1\r\n"
+	}
+	entry := r.values[key]
+	entry.expires = expires
+	r.values[key] = entry
+	return ":1\r\n"
+}
+
+// lookup returns an unexpired value; the caller must hold r.mu
+func (r *fakeRedis) lookup(key string) (string, bool) {
+	entry, ok := r.values[key]
+	if !ok || (!entry.expires.IsZero() && !time.Now().Before(entry.expires)) {
+		return "", false
+	}
+	return entry.value, true
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid command header %q", header)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk string header %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// replayKeyPrefix prefixes replay protection keys stored in Redis
+const replayKeyPrefix = "replay:"
+
+// errNotSwapped ends a Redis swap whose key no longer holds the expected value
+var errNotSwapped = errors.New("replay key changed")
+
+// defaultReplayWindow applies when no replay window is configured
+const defaultReplayWindow = 24 * time.Hour
+
+// ReplayStore remembers keys for the replay window, for features that must recognize a
+// request they have seen before (nonces, idempotency keys, deduplication). Features
+// namespace their keys, e.g. "idempotency:<key>".
+type ReplayStore interface {
+	// Add records key with value unless it is already recorded, reporting whether it was added
+	Add(ctx context.Context, key string, value []byte) (bool, error)
+	// Get returns the value recorded for key
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set records or replaces the value for key, restarting its window
+	Set(ctx context.Context, key string, value []byte) error
+	// Swap replaces the value for key, restarting its window, only if it still is old,
+	// reporting whether it did. The check and the write are atomic.
+	Swap(ctx context.Context, key string, old, value []byte) (bool, error)
+	// Delete forgets key
+	Delete(ctx context.Context, key string) error
+}
+
+// NewReplayStore creates the configured replay store. The Redis store uses redisClient,
+// which must not be nil.
+func NewReplayStore(cfg config.ReplayConfig, redisClient *redis.Client) (ReplayStore, error) {
+	window := cfg.Window
+	if window <= 0 {
+		window = defaultReplayWindow
+	}
+
+	switch cfg.Store {
+	case "", "memory":
+		return newMemoryReplayStore(window), nil
+	case "redis":
+		if redisClient == nil {
+			return nil, fmt.Errorf("replay store redis requires a redis client")
+		}
+		return &redisReplayStore{client: redisClient, window: window}, nil
+	default:
+		return nil, fmt.Errorf("unknown replay store %q", cfg.Store)
+	}
+}
+
+// ReplayStore creates the configured replay store, sharing the rate limiter's Redis client
+func (rl *RateLimiter) ReplayStore(cfg *config.Config) (ReplayStore, error) {
+	return NewReplayStore(cfg.Replay, rl.redisClient)
+}
+
+// redisReplayStore keeps replay keys in Redis, shared across gateway instances
+type redisReplayStore struct {
+	client *redis.Client
+	window time.Duration
+}
+
+func (s *redisReplayStore) Add(ctx context.Context, key string, value []byte) (bool, error) {
+	return s.client.SetNX(ctx, replayKeyPrefix+key, value, s.window).Result()
+}
+
+func (s *redisReplayStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, replayKeyPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *redisReplayStore) Set(ctx context.Context, key string, value []byte) error {
+	return s.client.Set(ctx, replayKeyPrefix+key, value, s.window).Err()
+}
+
+// Swap watches the key so that the write is only made if nobody changed it meanwhile
+func (s *redisReplayStore) Swap(ctx context.Context, key string, old, value []byte) (bool, error) {
+	key = replayKeyPrefix + key
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil || (err == nil && !bytes.Equal(current, old)) {
+			return errNotSwapped
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, value, s.window)
+			return nil
+		})
+		return err
+	}, key)
+	if err == errNotSwapped || err == redis.TxFailedErr {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *redisReplayStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, replayKeyPrefix+key).Err()
+}
+
+// memoryReplayStore keeps replay keys in memory, for a single gateway instance
+type memoryReplayStore struct {
+	window    time.Duration
+	mu        sync.Mutex
+	entries   map[string]replayEntry
+	lastSweep time.Time
+}
+
+// replayEntry is a remembered key's value and when it is forgotten
+type replayEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryReplayStore(window time.Duration) *memoryReplayStore {
+	return &memoryReplayStore{window: window, entries: make(map[string]replayEntry)}
+}
+
+func (s *memoryReplayStore) Add(ctx context.Context, key string, value []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expires) {
+		return false, nil
+	}
+	s.entries[key] = replayEntry{value: value, expires: now.Add(s.window)}
+	return true, nil
+}
+
+func (s *memoryReplayStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || !time.Now().Before(entry.expires) {
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (s *memoryReplayStore) Set(ctx context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+
+	s.entries[key] = replayEntry{value: value, expires: now.Add(s.window)}
+	return nil
+}
+
+func (s *memoryReplayStore) Swap(ctx context.Context, key string, old, value []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expires) || !bytes.Equal(entry.value, old) {
+		return false, nil
+	}
+	s.entries[key] = replayEntry{value: value, expires: now.Add(s.window)}
+	return true, nil
+}
+
+func (s *memoryReplayStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep drops expired entries at most once a minute; the caller must hold s.mu
+func (s *memoryReplayStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
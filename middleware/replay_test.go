@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayStores(t *testing.T) {
+	const window = 150 * time.Millisecond
+
+	stores := map[string]func(t *testing.T) ReplayStore{
+		"memory": func(t *testing.T) ReplayStore {
+			store, err := NewReplayStore(config.ReplayConfig{Window: window, Store: "memory"}, nil)
+			assert.NoError(t, err)
+			return store
+		},
+		"redis": func(t *testing.T) ReplayStore {
+			addr := freeAddr(t)
+			startFakeRedis(t, addr)
+			client := redis.NewClient(&redis.Options{Addr: addr})
+			t.Cleanup(func() { client.Close() })
+
+			store, err := NewReplayStore(config.ReplayConfig{Window: window, Store: "redis"}, client)
+			assert.NoError(t, err)
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			added, err := store.Add(ctx, "nonce:abc", []byte("first"))
+			assert.NoError(t, err)
+			assert.True(t, added)
+
+			// A replayed key is recognized and keeps its original value
+			added, err = store.Add(ctx, "nonce:abc", []byte("second"))
+			assert.NoError(t, err)
+			assert.False(t, added)
+			value, ok, err := store.Get(ctx, "nonce:abc")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, "first", string(value))
+
+			assert.NoError(t, store.Set(ctx, "nonce:abc", []byte("replaced")))
+			value, _, _ = store.Get(ctx, "nonce:abc")
+			assert.Equal(t, "replaced", string(value))
+
+			// Swap only replaces the value it was given
+			swapped, err := store.Swap(ctx, "nonce:abc", []byte("stale"), []byte("lost"))
+			assert.NoError(t, err)
+			assert.False(t, swapped)
+			swapped, err = store.Swap(ctx, "nonce:abc", []byte("replaced"), []byte("swapped"))
+			assert.NoError(t, err)
+			assert.True(t, swapped)
+			value, _, _ = store.Get(ctx, "nonce:abc")
+			assert.Equal(t, "swapped", string(value))
+			swapped, err = store.Swap(ctx, "nonce:missing", nil, []byte("value"))
+			assert.NoError(t, err)
+			assert.False(t, swapped)
+
+			assert.NoError(t, store.Delete(ctx, "nonce:abc"))
+			_, ok, err = store.Get(ctx, "nonce:abc")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			// Keys are forgotten once the window passes
+			added, _ = store.Add(ctx, "idempotency:xyz", []byte("response"))
+			assert.True(t, added)
+			time.Sleep(window + 50*time.Millisecond)
+			_, ok, err = store.Get(ctx, "idempotency:xyz")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			added, err = store.Add(ctx, "idempotency:xyz", []byte("response"))
+			assert.NoError(t, err)
+			assert.True(t, added)
+		})
+	}
+}
+
+func TestNewReplayStoreRequiresRedisClient(t *testing.T) {
+	_, err := NewReplayStore(config.ReplayConfig{Store: "redis"}, nil)
+	assert.Error(t, err)
+}
@@ -2,7 +2,15 @@ package middleware
 
 import (
 	"crypto/rand"
+	"encoding/binary"
 	"fmt"
+	"io"
+	mathrand "math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/api-gateway/config"
 	"github.com/gin-gonic/gin"
 )
 
@@ -11,29 +19,188 @@ const (
 	RequestIDHeader = "X-Request-ID"
 )
 
-// generateUUID generates a simple UUID v4
-func generateUUID() string {
-	b := make([]byte, 16)
-	rand.Read(b)
+// Request ID formats
+const (
+	requestIDUUIDv4 = "uuidv4"
+	requestIDUUIDv7 = "uuidv7"
+	requestIDULID   = "ulid"
+)
+
+// ulidAlphabet is Crockford's base32, used by ULIDs
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// fallbackCounter makes IDs generated without the system RNG unique within the process;
+// it is mixed with fallbackSeed so the IDs don't show it
+var (
+	fallbackCounter atomic.Uint64
+	fallbackSeed    = mathrand.Uint64()
+)
+
+// readRandom fills b from r, falling back to the clock, a process-wide counter and a
+// pseudo-random generator when r fails, so IDs stay unique instead of turning into
+// zeros. The fallback is not unpredictable, but it is only used while the system RNG
+// is broken.
+func readRandom(r io.Reader, b []byte) {
+	if _, err := io.ReadFull(r, b); err == nil {
+		return
+	}
+	var fallback [24]byte
+	binary.BigEndian.PutUint64(fallback[0:8], mathrand.Uint64()^uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint64(fallback[8:16], fallbackCounter.Add(1)^fallbackSeed)
+	binary.BigEndian.PutUint64(fallback[16:24], mathrand.Uint64())
+	for i := range b {
+		b[i] = fallback[i%len(fallback)]
+	}
+}
+
+// requestIDGenerator generates request IDs in one of the supported formats. Time-ordered
+// IDs carry a sequence number within their millisecond, so the IDs of one gateway
+// never collide and sort in the order they were generated.
+type requestIDGenerator struct {
+	format string
+	random io.Reader        // replaced in tests
+	now    func() time.Time // replaced in tests
+
+	mu         sync.Mutex
+	lastMillis int64
+	sequence   uint32
+}
+
+// newRequestIDGenerator returns a generator for format, UUIDv4 when empty
+func newRequestIDGenerator(format string) *requestIDGenerator {
+	if format == "" {
+		format = requestIDUUIDv4
+	}
+	return &requestIDGenerator{format: format, random: rand.Reader, now: time.Now}
+}
+
+// generate returns a new request ID
+func (g *requestIDGenerator) generate() string {
+	switch g.format {
+	case requestIDUUIDv7:
+		return g.uuidV7()
+	case requestIDULID:
+		return g.ulid()
+	}
+	return g.uuidV4()
+}
+
+// uuidV4 returns a random UUID
+func (g *requestIDGenerator) uuidV4() string {
+	var b [16]byte
+	readRandom(g.random, b[:])
 	b[6] = (b[6] & 0x0f) | 0x40 // Version 4
 	b[8] = (b[8] & 0x3f) | 0x80 // Variant is 10
+	return formatUUID(b)
+}
+
+// uuidV7 returns a UUID of the Unix millisecond, a 12-bit sequence and 62 random bits
+func (g *requestIDGenerator) uuidV7() string {
+	millis, sequence := g.tick(1<<12 - 1)
+
+	var b [16]byte
+	putMillis(b[:], millis)
+	binary.BigEndian.PutUint16(b[6:8], uint16(sequence))
+	readRandom(g.random, b[8:])
+	b[6] = (b[6] & 0x0f) | 0x70 // Version 7
+	b[8] = (b[8] & 0x3f) | 0x80 // Variant is 10
+	return formatUUID(b)
+}
+
+// ulid returns a ULID of the Unix millisecond, a 16-bit sequence and 64 random bits
+func (g *requestIDGenerator) ulid() string {
+	millis, sequence := g.tick(1<<16 - 1)
+
+	var b [16]byte
+	putMillis(b[:], millis)
+	binary.BigEndian.PutUint16(b[6:8], uint16(sequence))
+	readRandom(g.random, b[8:])
+	return encodeULID(b)
+}
+
+// tick returns the millisecond and sequence number of the next time-ordered ID. The
+// sequence restarts every millisecond; once it passes maxSequence, or when the clock
+// goes backwards, IDs borrow the following millisecond so they keep increasing.
+func (g *requestIDGenerator) tick(maxSequence uint32) (int64, uint32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	millis := g.now().UnixMilli()
+	switch {
+	case millis > g.lastMillis:
+		g.lastMillis, g.sequence = millis, 0
+	case g.sequence < maxSequence:
+		g.sequence++
+	default:
+		g.lastMillis, g.sequence = g.lastMillis+1, 0
+	}
+	return g.lastMillis, g.sequence
+}
+
+// putMillis writes a Unix millisecond timestamp into the first 48 bits of b
+func putMillis(b []byte, millis int64) {
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(millis))
+	copy(b[0:6], ts[2:8])
+}
+
+// formatUUID returns the canonical text form of a UUID
+func formatUUID(b [16]byte) string {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
 
-// RequestID returns a middleware that generates/forwards request IDs
-func RequestID() gin.HandlerFunc {
+// encodeULID returns the 26-character Crockford base32 form of a ULID
+func encodeULID(b [16]byte) string {
+	hi, lo := binary.BigEndian.Uint64(b[0:8]), binary.BigEndian.Uint64(b[8:16])
+	var out [26]byte
+	// 128 bits in 26 characters of 5 bits: the first character holds the top 3 bits
+	for i := 25; i >= 0; i-- {
+		out[i] = ulidAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// RequestID returns a middleware that generates/forwards request IDs and, when trace
+// propagation is enabled, continues or starts the distributed trace
+func RequestID(cfg *config.Config) gin.HandlerFunc {
+	formats := cfg.Tracing.Propagation
+	traceHeader := cfg.Tracing.ResponseHeader
+	generator := newRequestIDGenerator(cfg.RequestID.Format)
+
 	return func(c *gin.Context) {
 		// Check if request ID already exists in header
 		requestID := c.GetHeader(RequestIDHeader)
 
+		if len(formats) > 0 {
+			tc := newTraceContext(c.Request.Header, formats)
+			c.Set(TraceIDContextKey, tc.traceID)
+			c.Set(SpanIDContextKey, tc.spanID)
+
+			// Proxied requests carry the gateway span as their parent
+			tc.inject(c.Request.Header, formats)
+
+			// Let clients quote the trace in bug reports
+			if traceHeader != "" {
+				c.Header(traceHeader, tc.traceID)
+			}
+
+			// Derive the request ID from the trace for correlation, unless a format is set
+			if requestID == "" && cfg.RequestID.Format == "" {
+				requestID = tc.requestID()
+			}
+		}
+
 		// Generate new request ID if not present
 		if requestID == "" {
-			requestID = generateUUID()
+			requestID = generator.generate()
 		}
 
-		// Set request ID in context and response header
+		// Set request ID in context, response header and forwarded request
 		c.Set("request_id", requestID)
 		c.Header(RequestIDHeader, requestID)
+		c.Request.Header.Set(RequestIDHeader, requestID)
 
 		c.Next()
 	}
@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var traceParentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-0[01]$`)
+
+// setupTracedRouter returns a router whose handler echoes what a proxied backend would receive
+func setupTracedRouter(formats ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(&config.Config{Tracing: config.TracingConfig{Propagation: formats}}))
+	router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"traceparent": c.Request.Header.Get(TraceParentHeader),
+			"b3_trace_id": c.Request.Header.Get(B3TraceIDHeader),
+			"b3_parent":   c.Request.Header.Get(B3ParentSpanIDHeader),
+			"trace_id":    c.GetString(TraceIDContextKey),
+			"span_id":     c.GetString(SpanIDContextKey),
+			"request_id":  c.Request.Header.Get(RequestIDHeader),
+		})
+	})
+	return router
+}
+
+func tracedRequest(router *gin.Engine, header http.Header) (*httptest.ResponseRecorder, map[string]string) {
+	req, _ := http.NewRequest("GET", "/test", nil)
+	for name, values := range header {
+		req.Header.Set(name, values[0])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w, body
+}
+
+func TestRequestIDPassesThroughTraceParent(t *testing.T) {
+	router := setupTracedRouter("w3c")
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	w, body := tracedRequest(router, http.Header{"Traceparent": {incoming}})
+
+	// Same trace, new gateway span
+	matches := traceParentPattern.FindStringSubmatch(body["traceparent"])
+	assert.Len(t, matches, 3)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", matches[1])
+	assert.NotEqual(t, "00f067aa0ba902b7", matches[2])
+	assert.Equal(t, matches[2], body["span_id"])
+	assert.True(t, strings.HasSuffix(body["traceparent"], "-01"))
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", body["trace_id"])
+	assert.Equal(t, "4bf92f35-77b3-4da6-a3ce-929d0e0e4736", w.Header().Get(RequestIDHeader))
+	assert.Equal(t, w.Header().Get(RequestIDHeader), body["request_id"])
+}
+
+func TestRequestIDGeneratesTraceParent(t *testing.T) {
+	router := setupTracedRouter("w3c")
+
+	// A malformed header is treated as absent
+	_, body := tracedRequest(router, http.Header{"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"}})
+
+	matches := traceParentPattern.FindStringSubmatch(body["traceparent"])
+	assert.Len(t, matches, 3)
+	assert.NotEqual(t, "00000000000000000000000000000000", matches[1])
+	assert.Equal(t, matches[1], body["trace_id"])
+	assert.Empty(t, body["b3_trace_id"])
+}
+
+func TestRequestIDB3Propagation(t *testing.T) {
+	router := setupTracedRouter("w3c", "b3")
+
+	_, body := tracedRequest(router, http.Header{"B3": {"80f198ee56343ba8-e457b5a2e4d86bd1-1"}})
+
+	assert.Equal(t, "000000000000000080f198ee56343ba8", body["trace_id"])
+	assert.Equal(t, body["trace_id"], body["b3_trace_id"])
+	assert.Equal(t, "e457b5a2e4d86bd1", body["b3_parent"])
+	assert.Contains(t, body["traceparent"], body["trace_id"])
+}
+
+func TestRequestIDKeepsClientRequestID(t *testing.T) {
+	router := setupTracedRouter("w3c")
+
+	w, _ := tracedRequest(router, http.Header{RequestIDHeader: {"client-id"}})
+	assert.Equal(t, "client-id", w.Header().Get(RequestIDHeader))
+
+	// Without propagation the request ID is a random UUID and no trace headers are added
+	w, body := tracedRequest(setupTracedRouter(), nil)
+	assert.Len(t, w.Header().Get(RequestIDHeader), 36)
+	assert.Empty(t, body["traceparent"])
+}
+
+func TestRequestIDTraceResponseHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(propagation []string) *gin.Engine {
+		router := gin.New()
+		router.Use(RequestID(&config.Config{Tracing: config.TracingConfig{
+			Propagation:    propagation,
+			ResponseHeader: "X-Trace-ID",
+		}}))
+		router.GET("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+		return router
+	}
+
+	w, _ := tracedRequest(newRouter([]string{"w3c"}), http.Header{
+		"Traceparent":   {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		RequestIDHeader: {"client-id"},
+	})
+	assert.Equal(t, "client-id", w.Header().Get(RequestIDHeader))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Header().Get("X-Trace-ID"))
+
+	// Without tracing there is no trace ID to expose
+	w, _ = tracedRequest(newRouter(nil), nil)
+	assert.NotEmpty(t, w.Header().Get(RequestIDHeader))
+	assert.Empty(t, w.Header().Get("X-Trace-ID"))
+}
+
+// failingReader simulates a broken system RNG
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("entropy unavailable") }
+
+var requestIDPatterns = map[string]*regexp.Regexp{
+	"uuidv4": regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+	"uuidv7": regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+	"ulid":   regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+}
+
+func TestRequestIDFormatsAreUnique(t *testing.T) {
+	for format, pattern := range requestIDPatterns {
+		for _, rng := range []string{"system", "failing"} {
+			t.Run(format+" "+rng, func(t *testing.T) {
+				generator := newRequestIDGenerator(format)
+				if rng == "failing" {
+					generator.random = failingReader{}
+				}
+
+				const n = 100000
+				seen := make(map[string]bool, n)
+				previous := ""
+				for i := 0; i < n; i++ {
+					id := generator.generate()
+					if !pattern.MatchString(id) {
+						t.Fatalf("%q is not a valid %s", id, format)
+					}
+					if seen[id] {
+						t.Fatalf("duplicate ID %q after %d IDs", id, i)
+					}
+					seen[id] = true
+					assert.NotContains(t, id, "00000000-0000")
+					// Time-ordered formats sort in generation order
+					if format != "uuidv4" && id <= previous {
+						t.Fatalf("%q does not sort after %q", id, previous)
+					}
+					previous = id
+				}
+			})
+		}
+	}
+}
+
+func TestRequestIDTimeOrderedEncoding(t *testing.T) {
+	generator := newRequestIDGenerator("ulid")
+	generator.now = func() time.Time { return time.UnixMilli(1469918176385) }
+	generator.random = bytes.NewReader(make([]byte, 64))
+
+	// The timestamp of the ULID specification's example
+	assert.Equal(t, "01ARYZ6S41"+"0000000000000000", generator.generate())
+	assert.Equal(t, "01ARYZ6S41"+"000G000000000000", generator.generate())
+
+	generator.format = "uuidv7"
+	id := generator.generate()
+	assert.Equal(t, "01563df3-6481-7002-8000-000000000000", id)
+}
+
+func TestRequestIDConfiguredFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(&config.Config{
+		Tracing:   config.TracingConfig{Propagation: []string{"w3c"}},
+		RequestID: config.RequestIDConfig{Format: "ulid"},
+	}))
+	router.GET("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	assert.Regexp(t, requestIDPatterns["ulid"], w.Header().Get(RequestIDHeader))
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// defaultSchemaMaxBodySize bounds the body buffered for schema validation by default
+const defaultSchemaMaxBodySize = 1 << 20
+
+// schemas caches compiled JSON Schemas by file path and content, so routes sharing a
+// schema compile it once and an edited file is compiled anew when routes are rebuilt
+var schemas sync.Map
+
+// compileSchema returns the compiled JSON Schema at path
+func compileSchema(path string) (*jsonschema.Schema, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	key := path + "\n" + hex.EncodeToString(sum[:])
+	if schema, ok := schemas.Load(key); ok {
+		return schema.(*jsonschema.Schema), nil
+	}
+
+	// The content read is compiled, so it matches the key it is cached under
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(path, bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	schema, err := compiler.Compile(path)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := schemas.LoadOrStore(key, schema)
+	return actual.(*jsonschema.Schema), nil
+}
+
+// validateBody buffers the request body and checks it against schema, restoring it for
+// the handlers that follow. It aborts the request and returns false when the body is
+// too large, not JSON or doesn't match.
+func validateBody(c *gin.Context, schema *jsonschema.Schema, maxBodySize int64) bool {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodySize+1))
+	if err != nil {
+		AbortWithError(c, CodeBadRequest, "Failed to read request body")
+		return false
+	}
+	if int64(len(body)) > maxBodySize {
+		AbortWithError(c, CodeBodyTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBodySize))
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+
+	// Numbers are kept as json.Number so large integers validate exactly
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		AbortWithError(c, CodeBadRequest, "Request body must be valid JSON")
+		return false
+	}
+
+	err = schema.Validate(value)
+	if err == nil {
+		return true
+	}
+	apiErr := NewAPIError(c.Request, CodeValidationFailed, "Request body does not match the schema")
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		apiErr.Details = fieldErrors(validationErr)
+	}
+	AbortWithAPIError(c, apiErr)
+	return false
+}
+
+// fieldErrors flattens a validation error into its leaf causes, which name the
+// offending values, ordered by location
+func fieldErrors(err *jsonschema.ValidationError) []FieldError {
+	var details []FieldError
+	var walk func(err *jsonschema.ValidationError)
+	walk = func(err *jsonschema.ValidationError) {
+		if len(err.Causes) == 0 {
+			details = append(details, FieldError{Field: err.InstanceLocation, Message: err.Message})
+			return
+		}
+		for _, cause := range err.Causes {
+			walk(cause)
+		}
+	}
+	walk(err)
+	sort.SliceStable(details, func(i, j int) bool { return details[i].Field < details[j].Field })
+	return details
+}
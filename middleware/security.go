@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+)
+
+// SecurityHeaders returns a middleware that adds security headers to every response
+// and strips backend headers that leak implementation details. Headers are applied
+// just before the response is written, so proxied backend headers are covered and a
+// policy the backend (or an earlier handler) already set is left alone.
+func SecurityHeaders(cfg config.SecurityHeadersConfig) gin.HandlerFunc {
+	if !cfg.Enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	headers := map[string]string{}
+	if cfg.ContentTypeOptions {
+		headers["X-Content-Type-Options"] = "nosniff"
+	}
+	if cfg.FrameOptions != "" {
+		headers["X-Frame-Options"] = cfg.FrameOptions
+	}
+	if cfg.ReferrerPolicy != "" {
+		headers["Referrer-Policy"] = cfg.ReferrerPolicy
+	}
+	if cfg.ContentSecurityPolicy != "" {
+		headers["Content-Security-Policy"] = cfg.ContentSecurityPolicy
+	}
+
+	hsts := ""
+	if cfg.HSTS.Enabled {
+		hsts = fmt.Sprintf("max-age=%d", int64(cfg.HSTS.MaxAge.Seconds()))
+		if cfg.HSTS.IncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if cfg.HSTS.Preload {
+			hsts += "; preload"
+		}
+	}
+
+	return func(c *gin.Context) {
+		tls := c.Request.TLS != nil
+		c.Writer = &securityHeadersWriter{
+			ResponseWriter: c.Writer,
+			apply: func(header http.Header) {
+				for _, name := range cfg.StripHeaders {
+					header.Del(name)
+				}
+				for name, value := range headers {
+					if header.Get(name) == "" {
+						header.Set(name, value)
+					}
+				}
+				// HSTS is ignored by browsers over plain HTTP and must not be sent there
+				if tls && hsts != "" && header.Get("Strict-Transport-Security") == "" {
+					header.Set("Strict-Transport-Security", hsts)
+				}
+			},
+		}
+		c.Next()
+	}
+}
+
+// securityHeadersWriter applies the security headers once, before the header is written
+type securityHeadersWriter struct {
+	gin.ResponseWriter
+	apply func(http.Header)
+	once  sync.Once
+}
+
+func (w *securityHeadersWriter) applyHeaders() {
+	w.once.Do(func() { w.apply(w.ResponseWriter.Header()) })
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *securityHeadersWriter) WriteHeader(code int) {
+	w.applyHeaders()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// WriteHeaderNow implements gin.ResponseWriter
+func (w *securityHeadersWriter) WriteHeaderNow() {
+	w.applyHeaders()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Write implements http.ResponseWriter
+func (w *securityHeadersWriter) Write(data []byte) (int, error) {
+	w.applyHeaders()
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *securityHeadersWriter) WriteString(s string) (int, error) {
+	w.applyHeaders()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Flush implements http.Flusher
+func (w *securityHeadersWriter) Flush() {
+	w.applyHeaders()
+	w.ResponseWriter.Flush()
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSecurityHeadersConfig() config.SecurityHeadersConfig {
+	return config.SecurityHeadersConfig{
+		Enabled:               true,
+		HSTS:                  config.HSTSConfig{Enabled: true, MaxAge: 365 * 24 * time.Hour, IncludeSubdomains: true},
+		ContentTypeOptions:    true,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+		ContentSecurityPolicy: "default-src 'none'",
+		StripHeaders:          []string{"Server", "X-Powered-By"},
+	}
+}
+
+func setupSecurityHeadersRouter(cfg config.SecurityHeadersConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(SecurityHeaders(cfg))
+	router.GET("/resource", func(c *gin.Context) {
+		// Simulate headers copied from a backend response
+		c.Header("Server", "nginx/1.25.3")
+		c.Header("X-Powered-By", "Express")
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	router.GET("/framed", func(c *gin.Context) {
+		c.Header("X-Frame-Options", "SAMEORIGIN")
+		c.Status(http.StatusNoContent)
+	})
+	return router
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	router := setupSecurityHeadersRouter(testSecurityHeadersConfig())
+
+	req, _ := http.NewRequest("GET", "/resource", nil)
+	req.TLS = &tls.ConnectionState{}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "default-src 'none'", w.Header().Get("Content-Security-Policy"))
+	assert.Empty(t, w.Header().Get("Server"))
+	assert.Empty(t, w.Header().Get("X-Powered-By"))
+}
+
+func TestSecurityHeadersNoHSTSWithoutTLS(t *testing.T) {
+	router := setupSecurityHeadersRouter(testSecurityHeadersConfig())
+
+	req, _ := http.NewRequest("GET", "/resource", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+}
+
+func TestSecurityHeadersDisabledCSP(t *testing.T) {
+	cfg := testSecurityHeadersConfig()
+	cfg.ContentSecurityPolicy = ""
+	router := setupSecurityHeadersRouter(cfg)
+
+	req, _ := http.NewRequest("GET", "/resource", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	_, present := w.Header()["Content-Security-Policy"]
+	assert.False(t, present)
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+}
+
+func TestSecurityHeadersKeepBackendValues(t *testing.T) {
+	router := setupSecurityHeadersRouter(testSecurityHeadersConfig())
+
+	req, _ := http.NewRequest("GET", "/framed", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"SAMEORIGIN"}, w.Header().Values("X-Frame-Options"))
+}
+
+func TestSecurityHeadersDisabled(t *testing.T) {
+	cfg := testSecurityHeadersConfig()
+	cfg.Enabled = false
+	router := setupSecurityHeadersRouter(cfg)
+
+	req, _ := http.NewRequest("GET", "/resource", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Empty(t, w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "Express", w.Header().Get("X-Powered-By"))
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/api-gateway/config"
+	"go.uber.org/zap"
+)
+
+// Startup gate defaults
+const (
+	defaultStartupMaxWait    = 60 * time.Second
+	defaultStartupBackoff    = 500 * time.Millisecond
+	defaultStartupMaxBackoff = 5 * time.Second
+	startupCheckTimeout      = 2 * time.Second
+)
+
+// startupExemptPaths are the liveness probes answered while the gateway starts
+var startupExemptPaths = []string{"/health", "/health/live"}
+
+// startupCheck is a dependency the gateway waits for at startup
+type startupCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// StartupGate holds back traffic at startup until the gateway's startup-critical
+// dependencies are reachable, answering 503 to everything but the liveness probes.
+// When disabled it is open from the start.
+type StartupGate struct {
+	cfg    config.StartupConfig
+	logger *zap.Logger
+	open   atomic.Bool
+
+	mu     sync.Mutex
+	checks []startupCheck
+}
+
+// NewStartupGate creates the startup gate from configuration
+func NewStartupGate(cfg config.StartupConfig, logger *zap.Logger) *StartupGate {
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = defaultStartupMaxWait
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultStartupBackoff
+	}
+	if cfg.MaxBackoff < cfg.Backoff {
+		cfg.MaxBackoff = max(defaultStartupMaxBackoff, cfg.Backoff)
+	}
+
+	g := &StartupGate{cfg: cfg, logger: logger}
+	g.open.Store(!cfg.Enabled)
+	return g
+}
+
+// AddCheck registers a dependency that must be reachable before traffic is let through
+func (g *StartupGate) AddCheck(name string, check func(ctx context.Context) error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.checks = append(g.checks, startupCheck{name: name, check: check})
+}
+
+// Open reports whether the gateway is serving traffic
+func (g *StartupGate) Open() bool {
+	return g.open.Load()
+}
+
+// Wait checks the dependencies with exponential backoff until all are reachable, then
+// opens the gate. After the configured maximum wait, or when ctx is done, the gate
+// opens regardless and the dependencies still down are logged.
+func (g *StartupGate) Wait(ctx context.Context) {
+	if g.open.Load() {
+		return
+	}
+	g.mu.Lock()
+	checks := g.checks
+	g.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, g.cfg.MaxWait)
+	defer cancel()
+
+	start := time.Now()
+	backoff := g.cfg.Backoff
+	for {
+		down := g.unreachable(ctx, checks)
+		if len(down) == 0 {
+			g.logger.Info("Startup dependencies reachable, accepting traffic",
+				zap.Duration("waited", time.Since(start)),
+			)
+			g.open.Store(true)
+			return
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			g.logger.Warn("Startup dependencies still unreachable, accepting traffic anyway",
+				zap.Strings("dependencies", down),
+				zap.Duration("waited", time.Since(start)),
+			)
+			g.open.Store(true)
+			return
+		case <-timer.C:
+		}
+		g.logger.Info("Waiting for startup dependencies", zap.Strings("dependencies", down))
+		backoff = min(backoff*2, g.cfg.MaxBackoff)
+	}
+}
+
+// unreachable runs every check concurrently and returns the names of those failing
+func (g *StartupGate) unreachable(ctx context.Context, checks []startupCheck) []string {
+	ctx, cancel := context.WithTimeout(ctx, startupCheckTimeout)
+	defer cancel()
+
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check startupCheck) {
+			defer wg.Done()
+			results[i] = check.check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	var down []string
+	for i, err := range results {
+		if err != nil {
+			down = append(down, checks[i].name)
+		}
+	}
+	return down
+}
+
+// Handler wraps the gateway's handler, answering 503 with Retry-After until the gate
+// opens. It runs outside gin so no middleware, such as rate limiting, sees the
+// requests held back, and belongs inside NormalizePath so exempt paths are matched
+// on the normalized path.
+func (g *StartupGate) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.open.Load() || isStartupExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", "1")
+		WriteError(w, r, CodeStarting, "The gateway is starting. Please try again shortly.")
+	})
+}
+
+// isStartupExempt reports whether path is a liveness probe, ignoring a trailing slash
+func isStartupExempt(path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	for _, exempt := range startupExemptPaths {
+		if path == exempt {
+			return true
+		}
+	}
+	return false
+}
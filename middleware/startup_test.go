@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestStartupGateWaitsForDependencies(t *testing.T) {
+	gate := NewStartupGate(config.StartupConfig{
+		Enabled:    true,
+		MaxWait:    5 * time.Second,
+		Backoff:    10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+	}, zap.NewNop())
+
+	var available atomic.Bool
+	var attempts atomic.Int32
+	gate.AddCheck("mock", func(ctx context.Context) error {
+		attempts.Add(1)
+		if !available.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	// Wrapped as the gateway wraps it, inside path normalization
+	handler := NormalizePath(config.PathNormalizationConfig{CollapseSlashes: true}, gate.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	done := make(chan struct{})
+	go func() {
+		gate.Wait(context.Background())
+		close(done)
+	}()
+
+	// Held back while the dependency is down; liveness is still answered
+	assert.Eventually(t, func() bool { return attempts.Load() >= 3 }, time.Second, 5*time.Millisecond)
+	assert.False(t, gate.Open())
+	w := serve("/api/v1/users")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"code":"STARTING"`)
+	assert.Equal(t, http.StatusServiceUnavailable, serve("/health/ready").Code)
+	assert.Equal(t, http.StatusOK, serve("/health/live").Code)
+	assert.Equal(t, http.StatusOK, serve("//health//live").Code)
+
+	available.Store(true)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("gate did not open once the dependency was reachable")
+	}
+	assert.True(t, gate.Open())
+	assert.Equal(t, http.StatusOK, serve("/api/v1/users").Code)
+	assert.Equal(t, http.StatusOK, serve("/health/ready").Code)
+}
+
+func TestStartupGateOpensAfterMaxWait(t *testing.T) {
+	gate := NewStartupGate(config.StartupConfig{
+		Enabled: true,
+		MaxWait: 50 * time.Millisecond,
+		Backoff: 10 * time.Millisecond,
+	}, zap.NewNop())
+	gate.AddCheck("mock", func(ctx context.Context) error { return errors.New("down") })
+
+	start := time.Now()
+	gate.Wait(context.Background())
+	assert.True(t, gate.Open())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestStartupGateDisabled(t *testing.T) {
+	gate := NewStartupGate(config.StartupConfig{}, zap.NewNop())
+	gate.AddCheck("mock", func(ctx context.Context) error { return errors.New("down") })
+	assert.True(t, gate.Open())
+	gate.Wait(context.Background())
+	assert.True(t, gate.Open())
+}
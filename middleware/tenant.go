@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// TenantHeader is the header carrying the tenant to backends, and from principals
+	// that may act for any tenant
+	TenantHeader = "X-Tenant-ID"
+	// TenantContextKey stores the resolved tenant in the Gin context
+	TenantContextKey = "tenant_id"
+	// AnyTenant as a principal's tenant lets it choose the tenant with the tenant header,
+	// e.g. for internal services acting on behalf of every tenant
+	AnyTenant = "*"
+)
+
+// ResolveTenant returns the caller's tenant: the tenant of the authenticated principal,
+// from the token's tenant_id claim or the credential's configured tenant. Only
+// principals of AnyTenant choose one, with the tenant header; anonymous callers never
+// do. Returns "" if unresolved.
+func ResolveTenant(c *gin.Context, header string) string {
+	if tenant := c.GetString(TenantContextKey); tenant != "" {
+		return tenant
+	}
+	if header == "" {
+		header = TenantHeader
+	}
+
+	claims, ok := GetUserFromContext(c)
+	if !ok {
+		return ""
+	}
+	if claims.TenantID != AnyTenant {
+		return claims.TenantID
+	}
+	if tenant := strings.TrimSpace(c.GetHeader(header)); tenant != AnyTenant {
+		return tenant
+	}
+	return ""
+}
+
+// RequireTenant returns a middleware for tenant-scoped routes: it resolves the tenant,
+// rejects requests without one with 400, and forwards it as the tenant header,
+// replacing any client-supplied value
+func RequireTenant(header string) gin.HandlerFunc {
+	if header == "" {
+		header = TenantHeader
+	}
+
+	return func(c *gin.Context) {
+		tenant := ResolveTenant(c, header)
+		if tenant == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Tenant could not be resolved for this request",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set(TenantContextKey, tenant)
+		c.Request.Header.Set(header, tenant)
+		c.Next()
+	}
+}
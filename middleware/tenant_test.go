@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if tenant := c.GetHeader("X-Test-Tenant"); tenant != "" {
+			c.Set(string(UserContextKey), &Claims{UserID: "user-1", TenantID: tenant})
+		}
+	})
+	router.Use(RequireTenant(""))
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(TenantContextKey)+" "+c.Request.Header.Get(TenantHeader))
+	})
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(map[string]string{"X-Test-Tenant": "acme", TenantHeader: "globex"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "acme acme", w.Body.String())
+
+	// Only principals of any tenant choose one
+	w = serve(map[string]string{"X-Test-Tenant": AnyTenant, TenantHeader: "globex"})
+	assert.Equal(t, "globex globex", w.Body.String())
+	w = serve(map[string]string{"X-Test-Tenant": AnyTenant, TenantHeader: AnyTenant})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Anonymous callers can't pick a tenant, or its upstream
+	w = serve(map[string]string{TenantHeader: "globex"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
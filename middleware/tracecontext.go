@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TraceParentHeader is the W3C Trace Context header
+	TraceParentHeader = "traceparent"
+	// B3Header is the single-header B3 format
+	B3Header = "b3"
+	// B3TraceIDHeader, B3SpanIDHeader, B3ParentSpanIDHeader and B3SampledHeader are the multi-header B3 format
+	B3TraceIDHeader      = "X-B3-TraceId"
+	B3SpanIDHeader       = "X-B3-SpanId"
+	B3ParentSpanIDHeader = "X-B3-ParentSpanId"
+	B3SampledHeader      = "X-B3-Sampled"
+
+	// TraceIDContextKey and SpanIDContextKey store the trace identifiers in the Gin context
+	TraceIDContextKey = "trace_id"
+	SpanIDContextKey  = "span_id"
+)
+
+// traceContext identifies the gateway's span within a distributed trace
+type traceContext struct {
+	traceID      string // 32 lowercase hex characters
+	spanID       string // 16 lowercase hex characters, the gateway's own span
+	parentSpanID string // span of the caller, empty when the gateway starts the trace
+	sampled      bool
+}
+
+// extractTraceContext reads an incoming trace context in the enabled formats, in order
+func extractTraceContext(header http.Header, formats []string) (traceContext, bool) {
+	for _, format := range formats {
+		switch format {
+		case "w3c":
+			if tc, ok := parseTraceParent(header.Get(TraceParentHeader)); ok {
+				return tc, true
+			}
+		case "b3":
+			if tc, ok := parseB3(header); ok {
+				return tc, true
+			}
+		}
+	}
+	return traceContext{}, false
+}
+
+// newTraceContext starts a trace, continuing the caller's trace when present
+func newTraceContext(header http.Header, formats []string) traceContext {
+	parent, ok := extractTraceContext(header, formats)
+	if !ok {
+		return traceContext{traceID: randomHex(16), spanID: randomHex(8), sampled: true}
+	}
+	return traceContext{
+		traceID:      parent.traceID,
+		spanID:       randomHex(8),
+		parentSpanID: parent.spanID,
+		sampled:      parent.sampled,
+	}
+}
+
+// inject writes the trace context into the headers in the enabled formats,
+// replacing whatever the caller sent
+func (tc traceContext) inject(header http.Header, formats []string) {
+	for _, format := range formats {
+		switch format {
+		case "w3c":
+			flags := "00"
+			if tc.sampled {
+				flags = "01"
+			}
+			header.Set(TraceParentHeader, fmt.Sprintf("00-%s-%s-%s", tc.traceID, tc.spanID, flags))
+		case "b3":
+			sampled := "0"
+			if tc.sampled {
+				sampled = "1"
+			}
+			header.Del(B3Header)
+			header.Set(B3TraceIDHeader, tc.traceID)
+			header.Set(B3SpanIDHeader, tc.spanID)
+			header.Set(B3SampledHeader, sampled)
+			header.Del(B3ParentSpanIDHeader)
+			if tc.parentSpanID != "" {
+				header.Set(B3ParentSpanIDHeader, tc.parentSpanID)
+			}
+		}
+	}
+}
+
+// requestID formats the trace ID as a UUID so request IDs correlate with traces
+func (tc traceContext) requestID() string {
+	id := tc.traceID
+	return fmt.Sprintf("%s-%s-%s-%s-%s", id[0:8], id[8:12], id[12:16], id[16:20], id[20:32])
+}
+
+// parseTraceParent parses a W3C traceparent header: version-traceid-spanid-flags
+func parseTraceParent(value string) (traceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return traceContext{}, false
+	}
+	// Version 00 has exactly four fields; future versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return traceContext{}, false
+	}
+
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) || !isHex(flags) || len(flags) != 2 {
+		return traceContext{}, false
+	}
+
+	flagBits, _ := hex.DecodeString(flags)
+	return traceContext{traceID: traceID, spanID: spanID, sampled: flagBits[0]&0x01 == 1}, true
+}
+
+// parseB3 parses B3 trace headers in the single-header or multi-header form
+func parseB3(header http.Header) (traceContext, bool) {
+	traceID, spanID, sampled := header.Get(B3TraceIDHeader), header.Get(B3SpanIDHeader), header.Get(B3SampledHeader)
+
+	if single := header.Get(B3Header); single != "" {
+		// traceid-spanid[-sampled[-parentspanid]]
+		parts := strings.Split(strings.TrimSpace(single), "-")
+		if len(parts) < 2 {
+			return traceContext{}, false
+		}
+		traceID, spanID, sampled = parts[0], parts[1], ""
+		if len(parts) > 2 {
+			sampled = parts[2]
+		}
+	}
+
+	traceID = strings.ToLower(traceID)
+	spanID = strings.ToLower(spanID)
+
+	// 64-bit B3 trace IDs are left-padded to 128 bits
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) {
+		return traceContext{}, false
+	}
+
+	return traceContext{traceID: traceID, spanID: spanID, sampled: sampled != "0"}, true
+}
+
+// isHexID reports whether id is a non-zero lowercase hex string of the given length
+func isHexID(id string, length int) bool {
+	return len(id) == length && isHex(id) && strings.Trim(id, "0") != ""
+}
+
+// isHex reports whether s contains only lowercase hex characters
+func isHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// randomHex returns n random bytes hex-encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	readRandom(rand.Reader, b)
+	return hex.EncodeToString(b)
+}
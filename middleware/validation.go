@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ValidateRequest returns a middleware rejecting requests that miss a required header
+// or send a body of a content type the route doesn't accept, with a 400 naming the
+// problem, and bodies not matching the route's JSON Schema with a 422 listing the
+// offending fields. Bodies are only checked on POST, PUT and PATCH requests.
+func ValidateRequest(cfg config.RequestValidationConfig) gin.HandlerFunc {
+	maxBodySize := cfg.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultSchemaMaxBodySize
+	}
+	var schema *jsonschema.Schema
+	var schemaErr error
+	if cfg.Schema != "" {
+		// Configuration validation compiled the schema already, so this only fails if
+		// the file changed since
+		schema, schemaErr = compileSchema(cfg.Schema)
+	}
+
+	return func(c *gin.Context) {
+		for _, name := range cfg.RequiredHeaders {
+			if strings.TrimSpace(c.GetHeader(name)) == "" {
+				AbortWithError(c, CodeBadRequest, fmt.Sprintf("Missing required header %s", name))
+				return
+			}
+		}
+
+		if len(cfg.ContentTypes) > 0 && hasWriteBody(c.Request) {
+			mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+			if err != nil || !matchesMediaType(mediaType, cfg.ContentTypes) {
+				AbortWithError(c, CodeBadRequest, fmt.Sprintf("Content-Type must be one of %s", strings.Join(cfg.ContentTypes, ", ")))
+				return
+			}
+		}
+
+		if cfg.Schema != "" && hasWriteBody(c.Request) {
+			if schemaErr != nil {
+				AbortWithError(c, CodeInternal, "Request schema unavailable")
+				return
+			}
+			if !validateBody(c, schema, maxBodySize) {
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// hasWriteBody reports whether the request is a POST, PUT or PATCH that carries a body
+func hasWriteBody(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		// ContentLength is -1 for bodies of unknown length, e.g. chunked
+		return r.ContentLength != 0
+	}
+	return false
+}
+
+// matchesMediaType reports whether mediaType is one of the accepted types, which may
+// use a type/* wildcard
+func matchesMediaType(mediaType string, accepted []string) bool {
+	for _, candidate := range accepted {
+		candidate, _, _ = mime.ParseMediaType(candidate)
+		if prefix, ok := strings.CutSuffix(candidate, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == candidate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ValidateRequest(config.RequestValidationConfig{
+		RequiredHeaders: []string{"X-Client-Version"},
+		ContentTypes:    []string{"application/json", "image/*"},
+	}))
+	router.Any("/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name        string
+		method      string
+		body        string
+		contentType string
+		version     string
+		wantStatus  int
+		wantMessage string
+	}{
+		{"json post", "POST", `{"item":1}`, "application/json; charset=utf-8", "2", http.StatusOK, ""},
+		{"wildcard type", "PUT", "png", "image/png", "2", http.StatusOK, ""},
+		{"missing content type", "POST", `{"item":1}`, "", "2", http.StatusBadRequest, "Content-Type must be one of application/json, image/*"},
+		{"wrong content type", "PATCH", "item=1", "application/x-www-form-urlencoded", "2", http.StatusBadRequest, "Content-Type must be one of application/json, image/*"},
+		{"bodiless post", "POST", "", "", "2", http.StatusOK, ""},
+		{"get ignores content type", "GET", "", "text/plain", "2", http.StatusOK, ""},
+		{"missing header", "GET", "", "", "", http.StatusBadRequest, "Missing required header X-Client-Version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/orders", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.version != "" {
+				req.Header.Set("X-Client-Version", tt.version)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantMessage != "" {
+				var body APIError
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(t, CodeBadRequest, body.Code)
+				assert.Equal(t, tt.wantMessage, body.Message)
+			}
+		})
+	}
+}
+
+func TestValidateRequestSchema(t *testing.T) {
+	schemaFile := filepath.Join(t.TempDir(), "order.json")
+	assert.NoError(t, os.WriteFile(schemaFile, []byte(`{
+		"type": "object",
+		"required": ["item"],
+		"properties": {
+			"item": {"type": "string"},
+			"quantity": {"type": "integer", "minimum": 1}
+		}
+	}`), 0o600))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ValidateRequest(config.RequestValidationConfig{Schema: schemaFile, MaxBodySize: 64}))
+	// The handler sees the body the middleware consumed
+	router.POST("/orders", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/orders", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"item":"book","quantity":2}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"item":"book","quantity":2}`, w.Body.String())
+
+	w = post(`{"quantity":0}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var body APIError
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, CodeValidationFailed, body.Code)
+	if assert.Len(t, body.Details, 2) {
+		assert.Equal(t, "", body.Details[0].Field)
+		assert.Contains(t, body.Details[0].Message, "item")
+		assert.Equal(t, "/quantity", body.Details[1].Field)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"item":`).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(`{"item":"`+strings.Repeat("x", 64)+`"}`).Code)
+}
+
+func TestValidateRequestSchemaEdited(t *testing.T) {
+	schemaFile := filepath.Join(t.TempDir(), "order.json")
+	assert.NoError(t, os.WriteFile(schemaFile, []byte(`{"type": "object", "required": ["item"]}`), 0o600))
+
+	gin.SetMode(gin.TestMode)
+	post := func(handler gin.HandlerFunc) int {
+		router := gin.New()
+		router.POST("/orders", handler, func(c *gin.Context) { c.Status(http.StatusOK) })
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/orders", strings.NewReader(`{"item":"book"}`)))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, post(ValidateRequest(config.RequestValidationConfig{Schema: schemaFile})))
+
+	// A middleware built after the file changed validates against the new schema
+	assert.NoError(t, os.WriteFile(schemaFile, []byte(`{"type": "object", "required": ["item", "quantity"]}`), 0o600))
+	assert.Equal(t, http.StatusUnprocessableEntity, post(ValidateRequest(config.RequestValidationConfig{Schema: schemaFile})))
+}
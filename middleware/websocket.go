@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+)
+
+// connectionLimiter counts open upgraded connections globally and per client
+type connectionLimiter struct {
+	max       int64
+	perClient int
+	total     atomic.Int64
+	mu        sync.Mutex
+	clients   map[string]int
+}
+
+// acquire reserves a connection for the client, returning the refusal status (429 for
+// the per-client cap, 503 for the global cap) or 0 if the connection is allowed
+func (l *connectionLimiter) acquire(client string) int {
+	if l.max > 0 {
+		if l.total.Add(1) > l.max {
+			l.total.Add(-1)
+			return http.StatusServiceUnavailable
+		}
+	} else {
+		l.total.Add(1)
+	}
+
+	if l.perClient > 0 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.clients[client] >= l.perClient {
+			l.total.Add(-1)
+			return http.StatusTooManyRequests
+		}
+		l.clients[client]++
+	}
+	return 0
+}
+
+// release frees a connection reserved by acquire
+func (l *connectionLimiter) release(client string) {
+	l.total.Add(-1)
+
+	if l.perClient > 0 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.clients[client] <= 1 {
+			delete(l.clients, client)
+		} else {
+			l.clients[client]--
+		}
+	}
+}
+
+// WebSocketLimit returns a middleware capping concurrent WebSocket and other upgraded
+// connections per client IP and across the gateway. A connection counts until the
+// handler returns, which for a proxied upgrade is when the tunnel closes.
+func WebSocketLimit(cfg *config.Config) gin.HandlerFunc {
+	limits := cfg.WebSocket
+	if limits.MaxConnections <= 0 && limits.MaxConnectionsPerClient <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	limiter := &connectionLimiter{
+		max:       int64(limits.MaxConnections),
+		perClient: limits.MaxConnectionsPerClient,
+		clients:   make(map[string]int),
+	}
+
+	return func(c *gin.Context) {
+		if !IsUpgradeRequest(c.Request) {
+			c.Next()
+			return
+		}
+
+		client := accessIP(c)
+		switch limiter.acquire(client) {
+		case http.StatusTooManyRequests:
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":   "Too Many Requests",
+				"message": "Too many open WebSocket connections from this client",
+			})
+			return
+		case http.StatusServiceUnavailable:
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "Service Unavailable",
+				"message": "WebSocket connection limit reached",
+			})
+			return
+		}
+		defer limiter.release(client)
+
+		c.Next()
+	}
+}
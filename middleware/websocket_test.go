@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/api-gateway/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// heldConnections serves upgrade requests that stay open until released, standing in
+// for proxied WebSocket tunnels
+type heldConnections struct {
+	router  *gin.Engine
+	opened  chan struct{}
+	release chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newHeldConnections(cfg *config.Config) *heldConnections {
+	gin.SetMode(gin.TestMode)
+	h := &heldConnections{
+		router:  gin.New(),
+		opened:  make(chan struct{}, 100),
+		release: make(chan struct{}),
+	}
+	h.router.Use(WebSocketLimit(cfg))
+	h.router.GET("/ws", func(c *gin.Context) {
+		if !IsUpgradeRequest(c.Request) {
+			c.Status(http.StatusOK)
+			return
+		}
+		h.opened <- struct{}{}
+		<-h.release
+	})
+	return h
+}
+
+// send issues a request and returns its status; WebSocket requests that are accepted
+// block until released, so they are started with open instead
+func (h *heldConnections) send(remoteAddr string, websocket bool) int {
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.RemoteAddr = remoteAddr
+	if websocket {
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+	}
+	w := httptest.NewRecorder()
+	h.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+// open starts a WebSocket connection and waits until it is established
+func (h *heldConnections) open(remoteAddr string) {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.send(remoteAddr, true)
+	}()
+	<-h.opened
+}
+
+// closeAll releases every open connection and waits for them to finish
+func (h *heldConnections) closeAll() {
+	close(h.release)
+	h.wg.Wait()
+}
+
+func TestWebSocketLimitPerClient(t *testing.T) {
+	h := newHeldConnections(&config.Config{WebSocket: config.WebSocketConfig{MaxConnectionsPerClient: 2}})
+
+	h.open("203.0.113.1:5000")
+	h.open("203.0.113.1:5001")
+	assert.Equal(t, http.StatusTooManyRequests, h.send("203.0.113.1:5002", true))
+
+	// Other clients and plain requests are unaffected
+	h.open("203.0.113.2:5000")
+	assert.Equal(t, http.StatusOK, h.send("203.0.113.1:5003", false))
+
+	// Closed connections free their slots
+	h.closeAll()
+	h.release = make(chan struct{})
+	h.open("203.0.113.1:5004")
+	h.open("203.0.113.1:5005")
+	h.closeAll()
+}
+
+func TestWebSocketLimitGlobal(t *testing.T) {
+	h := newHeldConnections(&config.Config{WebSocket: config.WebSocketConfig{MaxConnections: 3, MaxConnectionsPerClient: 2}})
+
+	h.open("203.0.113.1:5000")
+	h.open("203.0.113.2:5000")
+	h.open("203.0.113.3:5000")
+	assert.Equal(t, http.StatusServiceUnavailable, h.send("203.0.113.4:5000", true))
+
+	h.closeAll()
+	h.release = make(chan struct{})
+	h.open("203.0.113.4:5000")
+	h.closeAll()
+}
+
+func TestWebSocketLimitDisabled(t *testing.T) {
+	h := newHeldConnections(&config.Config{})
+	for i := 0; i < 20; i++ {
+		h.open("203.0.113.1:5000")
+	}
+	h.closeAll()
+}
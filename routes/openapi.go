@@ -0,0 +1,307 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// Names of the security schemes in the generated document
+const (
+	bearerAuthScheme = "bearerAuth"
+	apiKeyAuthScheme = "apiKeyAuth"
+)
+
+// routeAccess describes the authentication a route requires: "required", "optional"
+// or "none", plus the roles and scopes checked after authentication
+type routeAccess struct {
+	auth     string
+	roles    []string
+	scopes   []string
+	anyScope bool     // One of the scopes suffices rather than all
+	schemes  []string // Auth schemes accepted when not just JWT
+}
+
+// accessPolicy records the authentication of each route as it is registered with the
+// middleware enforcing it, so the OpenAPI document can describe it; gin does not
+// expose a route's middleware chain
+type accessPolicy struct {
+	routes map[string]routeAccess // keyed by "METHOD path"
+}
+
+func newAccessPolicy() *accessPolicy {
+	return &accessPolicy{routes: make(map[string]routeAccess)}
+}
+
+// group attaches the middleware enforcing access to group, and returns the group
+// recording access for every route registered through it
+func (a *accessPolicy) group(group *gin.RouterGroup, access routeAccess, handlers ...gin.HandlerFunc) *accessGroup {
+	group.Use(handlers...)
+	return &accessGroup{RouterGroup: group, policy: a, access: access}
+}
+
+// route records the authentication of a single route; method "ANY" covers all methods
+func (a *accessPolicy) route(method, path string, access routeAccess) {
+	a.routes[strings.ToUpper(method)+" "+path] = access
+}
+
+// lookup returns the access of a route; routes registered without any are public.
+// HEAD routes share the access of their GET route.
+func (a *accessPolicy) lookup(method, path string) routeAccess {
+	if access, ok := a.routes[method+" "+path]; ok {
+		return access
+	}
+	if access, ok := a.routes["GET "+path]; ok && method == http.MethodHead {
+		return access
+	}
+	if access, ok := a.routes["ANY "+path]; ok {
+		return access
+	}
+	return routeAccess{auth: "none"}
+}
+
+// accessGroup is a route group whose middleware enforces access, recording it for each
+// route registered on the group
+type accessGroup struct {
+	*gin.RouterGroup
+	policy *accessPolicy
+	access routeAccess
+}
+
+// record records the group's access for a route, at its path as gin joins it
+func (g *accessGroup) record(method, relativePath string) {
+	absolute := path.Join(g.BasePath(), relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(absolute, "/") {
+		absolute += "/"
+	}
+	g.policy.route(method, absolute, g.access)
+}
+
+func (g *accessGroup) Handle(method, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	g.record(method, relativePath)
+	return g.RouterGroup.Handle(method, relativePath, handlers...)
+}
+
+func (g *accessGroup) Any(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	g.record("ANY", relativePath)
+	return g.RouterGroup.Any(relativePath, handlers...)
+}
+
+func (g *accessGroup) GET(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodGet, relativePath, handlers...)
+}
+
+func (g *accessGroup) HEAD(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodHead, relativePath, handlers...)
+}
+
+func (g *accessGroup) POST(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodPost, relativePath, handlers...)
+}
+
+func (g *accessGroup) PUT(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodPut, relativePath, handlers...)
+}
+
+func (g *accessGroup) PATCH(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodPatch, relativePath, handlers...)
+}
+
+func (g *accessGroup) DELETE(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodDelete, relativePath, handlers...)
+}
+
+func (g *accessGroup) OPTIONS(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodOptions, relativePath, handlers...)
+}
+
+// routeTableAccess returns the access declared for a route table entry
+func routeTableAccess(route config.RouteConfig) routeAccess {
+	switch route.Auth {
+	case "", "required":
+		return routeAccess{auth: "required", roles: route.Roles, scopes: route.Scopes, anyScope: route.ScopeMode == "any", schemes: route.AuthSchemes}
+	case "optional":
+		return routeAccess{auth: route.Auth, schemes: route.AuthSchemes}
+	default:
+		return routeAccess{auth: route.Auth}
+	}
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+	Roles       []string                   `json:"x-required-roles,omitempty"`
+	Scopes      []string                   `json:"x-required-scopes,omitempty"`
+	ScopeMode   string                     `json:"x-scope-mode,omitempty"` // "any" when one scope suffices
+	AuthSchemes []string                   `json:"x-auth-schemes,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string            `json:"name"`
+	In          string            `json:"in"`
+	Required    bool              `json:"required"`
+	Description string            `json:"description,omitempty"`
+	Schema      map[string]string `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string `json:"description"`
+}
+
+type openAPIComponents struct {
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// buildOpenAPIDocument describes the registered routes as an OpenAPI 3 document.
+// Methods OpenAPI cannot express (CONNECT) are left out.
+func buildOpenAPIDocument(routes gin.RoutesInfo, access *accessPolicy, cfg config.OpenAPIConfig) *openAPIDocument {
+	doc := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: cfg.Title, Version: cfg.Version},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+		Components: openAPIComponents{SecuritySchemes: map[string]openAPISecurityScheme{
+			bearerAuthScheme: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			apiKeyAuthScheme: {Type: "apiKey", In: "header", Name: middleware.APIKeyHeader},
+		}},
+	}
+
+	for _, route := range routes {
+		if route.Method == http.MethodConnect {
+			continue
+		}
+
+		path, parameters := openAPIPath(route.Path)
+		operation := &openAPIOperation{
+			OperationID: strings.ToLower(route.Method) + route.Path,
+			Parameters:  parameters,
+			Responses:   map[string]openAPIResponse{"default": {Description: "Response"}},
+		}
+
+		routeAccess := access.lookup(route.Method, route.Path)
+		switch routeAccess.auth {
+		case "required":
+			operation.Security = securityRequirements(routeAccess.schemes)
+			operation.Roles = routeAccess.roles
+			// OpenAPI 3.0 only lists scopes for OAuth schemes, so they are extensions too
+			operation.Scopes = routeAccess.scopes
+			if routeAccess.anyScope {
+				operation.ScopeMode = "any"
+			}
+		case "optional":
+			operation.Security = append([]map[string][]string{{}}, securityRequirements(routeAccess.schemes)...)
+		}
+		if routeAccess.auth != "none" {
+			// OpenAPI 3.0 can't describe client certificates, so the schemes are listed too
+			operation.AuthSchemes = routeAccess.schemes
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = operation
+	}
+	return doc
+}
+
+// securityRequirements returns the alternative security requirements of the auth
+// schemes, JWT when none are declared. Client certificates have no OpenAPI 3.0 scheme.
+func securityRequirements(schemes []string) []map[string][]string {
+	if len(schemes) == 0 {
+		return []map[string][]string{{bearerAuthScheme: {}}}
+	}
+	var requirements []map[string][]string
+	for _, scheme := range schemes {
+		switch scheme {
+		case config.AuthSchemeJWT:
+			requirements = append(requirements, map[string][]string{bearerAuthScheme: {}})
+		case config.AuthSchemeAPIKey:
+			requirements = append(requirements, map[string][]string{apiKeyAuthScheme: {}})
+		}
+	}
+	return requirements
+}
+
+// openAPIPath converts a gin path to OpenAPI templating and lists its parameters.
+// A catch-all "*path" becomes a single "{path}" parameter holding the remaining path.
+func openAPIPath(path string) (string, []openAPIParameter) {
+	segments := strings.Split(path, "/")
+	var parameters []openAPIParameter
+	for i, segment := range segments {
+		if segment == "" || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+
+		parameter := openAPIParameter{
+			Name:     segment[1:],
+			In:       "path",
+			Required: true,
+			Schema:   map[string]string{"type": "string"},
+		}
+		if segment[0] == '*' {
+			parameter.Description = "Remaining path, may contain slashes"
+		}
+		parameters = append(parameters, parameter)
+		segments[i] = "{" + segment[1:] + "}"
+	}
+
+	return strings.Join(segments, "/"), parameters
+}
+
+// registerAPIDocs serves the OpenAPI document at /openapi.json and a Swagger UI at
+// /docs. The document is built once, after every other route has been registered.
+func registerAPIDocs(router *gin.Engine, cfg config.OpenAPIConfig, access *accessPolicy) {
+	var spec []byte
+	getAndHead(router, "/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+	})
+	getAndHead(router, "/docs", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+	})
+
+	spec, _ = json.Marshal(buildOpenAPIDocument(router.Routes(), access, cfg))
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at the generated document
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>API Gateway</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
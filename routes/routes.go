@@ -1,23 +1,114 @@
 package routes
 
 import (
+	"context"
+	"net/http"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/api-gateway/config"
 	"github.com/api-gateway/handlers"
 	"github.com/api-gateway/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
-// SetupRoutes configures all routes for the API Gateway
-func SetupRoutes(router *gin.Engine, cfg *config.Config, logger *zap.Logger) {
-	// Health check endpoints (no authentication required)
+// Components are the gateway components created by the caller, which applies
+// configuration reloads to them and closes them. Any of them may be nil.
+type Components struct {
+	// RateLimiter backs the login guard, readiness and admin inspection endpoints
+	RateLimiter *middleware.RateLimiter
+	// CORSPolicy gets route groups attached to their named CORS policies
+	CORSPolicy *middleware.CORSPolicy
+	// Maintenance is switched through the admin API
+	Maintenance *middleware.Maintenance
+	// Config reports the loaded configuration through the admin API; when nil, the
+	// configuration passed to SetupRoutes is reported
+	Config *handlers.ConfigHandler
+	// Startup gets the dependencies the gateway waits for at startup
+	Startup *middleware.StartupGate
+}
+
+// SetupRoutes configures all routes for the API Gateway and returns the proxy handler
+// so the caller can apply configuration changes and close it
+func SetupRoutes(router *gin.Engine, cfg *config.Config, logger *zap.Logger, components Components) *handlers.ProxyHandler {
+	rateLimiter, corsPolicy := components.RateLimiter, components.CORSPolicy
+
+	// Usage quotas of authenticated users, sharing the rate limiter's store
+	var quota gin.HandlerFunc
+	if cfg.Quota.Enabled {
+		if rateLimiter != nil {
+			quota = rateLimiter.Quota(cfg).Middleware()
+		} else {
+			quota = middleware.NewQuota(cfg.Quota, nil).Middleware()
+		}
+	}
+
+	// Deduplication of requests by Idempotency-Key, sharing the rate limiter's store
+	var idempotency gin.HandlerFunc
+	if cfg.Idempotency.Enabled {
+		var store middleware.ReplayStore
+		var err error
+		if rateLimiter != nil {
+			store, err = rateLimiter.IdempotencyStore(cfg)
+		} else {
+			store, err = middleware.NewIdempotencyStore(cfg, nil)
+		}
+		if err != nil {
+			logger.Error("Idempotency disabled: invalid store", zap.Error(err))
+		} else {
+			idempotency = middleware.NewIdempotency(cfg.Idempotency, store, logger).Middleware()
+		}
+	}
+
+	// Authentication per route, described by the OpenAPI document
+	access := newAccessPolicy()
+
+	// Health check endpoints (no authentication required, but for the detailed report)
 	health := handlers.NewHealthHandler(logger)
-	router.GET("/health", health.Health)
-	router.GET("/health/ready", health.Ready)
-	router.GET("/health/live", health.Live)
+	getAndHead(router, "/health", health.Health)
+	getAndHead(router, "/health/ready", health.Ready)
+	getAndHead(router, "/health/live", health.Live)
+	getAndHead(access.group(router.Group("/health"), adminAccess, adminMiddleware(cfg)...), "/detailed", health.Detailed)
+
+	// Prometheus metrics (configure under metrics), for the allowed scrapers only
+	if cfg.Metrics.Prometheus {
+		scrapers := middleware.IPFilterMiddleware(config.IPFilterRules{Allow: cfg.Metrics.Allow}, cfg.IPFilter.TrustedProxies)
+		getAndHead(router, cfg.Metrics.Path, scrapers, gin.WrapH(promhttp.Handler()))
+	}
 
 	// Create proxy handler
 	proxy := handlers.NewProxyHandler(cfg, logger)
+	health.SetUpstreamReporter(proxy)
+	health.SetMetricsReporter(proxy)
+	if rateLimiter != nil {
+		health.SetRateLimitReporter(rateLimiter)
+	}
+
+	// Dependencies checked by the readiness probe (configure under readiness)
+	health.ConfigureReadiness(cfg.Readiness)
+	if rateLimiter != nil && cfg.Redis.Host != "" {
+		health.AddReadinessCheck("redis", cfg.Readiness.Redis, rateLimiter.PingRedis)
+	}
+	for _, name := range cfg.Readiness.Services {
+		name := name
+		health.AddReadinessCheck("service:"+name, true, func(ctx context.Context) error {
+			return proxy.CheckService(ctx, name)
+		})
+	}
+
+	// Dependencies waited for before accepting traffic (configure under readiness.startup)
+	if startup := components.Startup; startup != nil {
+		if rateLimiter != nil && cfg.Readiness.Startup.Redis {
+			startup.AddCheck("redis", rateLimiter.PingRedis)
+		}
+		for _, name := range cfg.Readiness.Startup.Services {
+			name := name
+			startup.AddCheck("service:"+name, func(ctx context.Context) error {
+				return proxy.CheckService(ctx, name)
+			})
+		}
+	}
 
 	// ============================================
 	// External Services (no authentication)
@@ -32,41 +123,307 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config, logger *zap.Logger) {
 	// Docker Registry V2 API
 	router.Any("/v2/*path", proxy.ProxyToExternalService("docker_registry"))
 
+	// gRPC passthrough: calls arrive as POST /<package.Service>/<Method>
+	for name, svc := range cfg.Services {
+		for _, grpcService := range svc.GRPCServices {
+			router.POST("/"+grpcService+"/:method", proxy.ProxyGRPC(name))
+		}
+	}
+
 	// ============================================
 	// API Routes
 	// ============================================
 
 	// API version 1 routes
 	v1 := router.Group("/api/v1")
+	corsPolicy.Attach(v1, "api")
 	{
 		// Public routes (no authentication)
-		public := v1.Group("/public")
+		public := access.group(v1.Group("/public"), routeAccess{auth: "none"})
+		corsPolicy.Attach(public.RouterGroup, "public")
 		{
-			public.GET("/status", health.Status)
+			getAndHead(public, "/status", health.Status)
+
+			// Password login (configure under login)
+			if cfg.Login.Enabled {
+				registerLogin(public, cfg, logger, rateLimiter)
+			}
 		}
 
 		// Protected routes (authentication required)
 		// Add your authenticated routes here
-		protected := v1.Group("")
-		protected.Use(middleware.AuthMiddleware(cfg))
+		protected := access.group(v1.Group(""), routeAccess{auth: "required"}, middleware.AuthMiddleware(cfg))
+		if quota != nil {
+			protected.Use(quota)
+		}
+		if idempotency != nil {
+			protected.Use(idempotency)
+		}
 		{
 			// Example: proxy to a backend service (configure in config.yaml under services)
 			_ = proxy // proxy handler available for use
+
+			// Composite endpoints aggregating several backends (configure under composites)
+			for _, composite := range cfg.Composites {
+				getAndHead(protected, composite.Path, proxy.Aggregate(composite))
+			}
+
+			// Services registered at runtime through the admin API
+			protected.Any("/services/:service/*path", proxy.ProxyToRegisteredService())
 		}
 
 		// Admin routes (require admin role)
-		admin := v1.Group("/admin")
-		admin.Use(middleware.AuthMiddleware(cfg))
-		admin.Use(middleware.RequireRoles("admin"))
+		adminGroup := v1.Group("/admin")
+		corsPolicy.Attach(adminGroup, "admin")
+		admin := access.group(adminGroup, adminAccess, adminMiddleware(cfg)...)
 		{
-			admin.GET("/system/status", health.SystemStatus)
+			getAndHead(admin, "/system/status", health.SystemStatus)
+
+			// Runtime service registration
+			getAndHead(admin, "/services", proxy.ListServices)
+			admin.POST("/services", proxy.CreateService)
+			admin.PUT("/services/:name", proxy.UpdateService)
+			admin.DELETE("/services/:name", proxy.DeleteService)
+
+			if rateLimiter != nil {
+				rateLimits := handlers.NewRateLimitHandler(rateLimiter, cfg, logger)
+				getAndHead(admin, "/ratelimit", rateLimits.ListBuckets)
+				admin.DELETE("/ratelimit/:clientID", rateLimits.ResetClient)
+			}
+
+			// Response cache purge: ?key= for one entry, ?prefix= for a range, or all
+			admin.DELETE("/cache", proxy.FlushCache)
+
+			configView := components.Config
+			if configView == nil {
+				configView = handlers.NewConfigHandler(cfg)
+			}
+			getAndHead(admin, "/config", configView.Get)
+
+			if components.Maintenance != nil {
+				maintenance := handlers.NewMaintenanceHandler(components.Maintenance, logger)
+				getAndHead(admin, "/maintenance", maintenance.Get)
+				admin.POST("/maintenance", maintenance.Set)
+			}
 		}
 	}
 
 	// ============================================
-	// Frontend Catch-all (WebUI proxy)
+	// Declarative routes (configure under routes)
+	// ============================================
+	registerRouteTable(router, cfg, proxy, access, quota, idempotency)
+
+	// API documentation (configure under openapi)
+	if cfg.OpenAPI.Enabled {
+		registerAPIDocs(router, cfg.OpenAPI, access)
+	}
+
+	// Known paths requested with an unregistered method get a JSON 405 with an Allow
+	// header. Global middleware still runs first, so CORS preflight short-circuits.
+	router.HandleMethodNotAllowed = true
+	router.NoMethod(handlers.MethodNotAllowed)
+
+	// ============================================
+	// Unmatched paths: fallback service, API 404 or frontend catch-all (WebUI proxy)
 	// ============================================
-	// Proxies all unmatched routes to the frontend dev server (e.g., Vite)
-	// Supports WebSocket upgrades for HMR (Hot Module Replacement)
-	router.NoRoute(proxy.ProxyWithWebSocket("frontend"))
+	registerNoRoute(router, cfg, proxy, quota)
+
+	logRouteSummary(router, logger)
+
+	return proxy
+}
+
+// adminAccess is the access adminMiddleware enforces
+var adminAccess = routeAccess{auth: "required", roles: []string{"admin"}}
+
+// adminMiddleware returns the middleware guarding admin endpoints: the admin IP
+// filter when configured, authentication and the admin role. Admitted requests are
+// recorded in the audit log.
+func adminMiddleware(cfg *config.Config) []gin.HandlerFunc {
+	var chain []gin.HandlerFunc
+	if cfg.IPFilter.Admin.Enabled() {
+		chain = append(chain, middleware.IPFilterMiddleware(cfg.IPFilter.Admin, cfg.IPFilter.TrustedProxies))
+	}
+	return append(chain, middleware.AuthMiddleware(cfg), middleware.RequireRoles("admin"), middleware.AuditAdmin())
+}
+
+// registerLogin registers the login endpoint behind its brute-force guard. The guard
+// shares the rate limiter's store when there is one.
+func registerLogin(group gin.IRoutes, cfg *config.Config, logger *zap.Logger, rateLimiter *middleware.RateLimiter) {
+	verifier, err := handlers.NewCredentialVerifier(cfg)
+	if err != nil {
+		logger.Error("Login disabled: invalid credential verifier", zap.Error(err))
+		return
+	}
+
+	guard := middleware.NewLoginGuard(cfg, nil)
+	if rateLimiter != nil {
+		guard = rateLimiter.LoginGuard(cfg)
+	}
+
+	auth := handlers.NewAuthHandler(cfg, verifier, guard, logger)
+	group.POST("/auth/login", guard.Middleware(), auth.Login)
+}
+
+// registerRouteTable registers the routes declared in configuration. The table is
+// validated when the configuration is loaded. Authenticated routes count against
+// the user's quota when quota is not nil, and every route deduplicates requests by
+// Idempotency-Key when idempotency is not nil.
+func registerRouteTable(router *gin.Engine, cfg *config.Config, proxy *handlers.ProxyHandler, access *accessPolicy, quota, idempotency gin.HandlerFunc) {
+	// GET routes answer HEAD too, unless the table declares the HEAD route itself
+	declared := make(map[string]bool, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		declared[strings.ToUpper(route.Method)+" "+route.Path] = true
+	}
+
+	for _, route := range cfg.Routes {
+		routeAccess := routeTableAccess(route)
+		access.route(route.Method, route.Path, routeAccess)
+
+		chain := authChain(cfg, route.Auth, route.Roles, route.AuthSchemes)
+		if len(route.Scopes) > 0 {
+			if route.ScopeMode == "any" {
+				chain = append(chain, middleware.RequireAnyScope(route.Scopes...))
+			} else {
+				chain = append(chain, middleware.RequireScopes(route.Scopes...))
+			}
+		}
+		if route.SlowRequestThreshold > 0 {
+			chain = append([]gin.HandlerFunc{middleware.SlowRequestThreshold(route.SlowRequestThreshold)}, chain...)
+		}
+		// Malformed requests are rejected before they count against quotas
+		if route.Validation.Enabled() {
+			chain = append(chain, middleware.ValidateRequest(route.Validation))
+		}
+		if quota != nil && route.Auth != "none" {
+			chain = append(chain, quota)
+		}
+		if idempotency != nil {
+			chain = append(chain, idempotency)
+		}
+
+		if route.ResponseFilter.Enabled() {
+			chain = append(chain, handlers.ResponseFilter(route.ResponseFilter))
+		}
+
+		switch {
+		case route.TargetPath != "":
+			chain = append(chain, proxy.ProxyToServiceWithPath(route.Service, route.TargetPath))
+		case len(route.Rewrites) > 0:
+			chain = append(chain, proxy.ProxyToServiceWithRewrite(route.Service, route.Rewrites...))
+		default:
+			chain = append(chain, proxy.ProxyToService(route.Service))
+		}
+
+		method := strings.ToUpper(route.Method)
+		switch {
+		case method == "ANY":
+			router.Any(route.Path, chain...)
+		case method == http.MethodGet && !declared["HEAD "+route.Path]:
+			getAndHead(router, route.Path, chain...)
+		default:
+			router.Handle(method, route.Path, chain...)
+		}
+	}
+}
+
+// getAndHead registers handlers for GET and HEAD requests to path, so every GET route
+// answers HEAD. HEAD requests run the same chain: proxied ones reach the backend as
+// HEAD, and the server drops any body the handlers write.
+func getAndHead(routes gin.IRoutes, path string, handlers ...gin.HandlerFunc) {
+	routes.GET(path, handlers...)
+	routes.HEAD(path, handlers...)
+}
+
+// authChain returns the middleware authenticating requests for an auth mode: required
+// (the default, optionally with roles), optional or none. Routes accepting schemes
+// besides JWT try each in turn; JWT alone keeps the token middleware.
+func authChain(cfg *config.Config, mode string, roles []string, schemes []string) []gin.HandlerFunc {
+	jwtOnly := len(schemes) == 0 || (len(schemes) == 1 && schemes[0] == config.AuthSchemeJWT)
+	switch mode {
+	case "", "required":
+		chain := []gin.HandlerFunc{middleware.AuthMiddleware(cfg)}
+		if !jwtOnly {
+			chain[0] = middleware.AuthChain(middleware.Authenticators(cfg, schemes...)...)
+		}
+		if len(roles) > 0 {
+			chain = append(chain, middleware.RequireRoles(roles...))
+		}
+		return chain
+	case "optional":
+		if !jwtOnly {
+			return []gin.HandlerFunc{middleware.OptionalAuthChain(middleware.Authenticators(cfg, schemes...)...)}
+		}
+		return []gin.HandlerFunc{middleware.OptionalAuthMiddleware(cfg)}
+	}
+	return nil
+}
+
+// Destinations of requests matching no route
+const (
+	noRouteDefault  = "default"
+	noRouteNotFound = "not_found"
+	noRouteFrontend = "frontend"
+)
+
+// registerNoRoute handles requests matching no route. Paths under the default route's
+// prefix are proxied to its service when enabled, behind its authentication and
+// quota; other /api/ paths get a JSON 404 rather than reaching the frontend; everything
+// else is proxied to the frontend dev server (e.g., Vite), including WebSocket upgrades
+// for HMR (Hot Module Replacement), optionally with a per-request CSP nonce for the
+// web UI shell.
+func registerNoRoute(router *gin.Engine, cfg *config.Config, proxy *handlers.ProxyHandler, quota gin.HandlerFunc) {
+	fallback := cfg.DefaultRoute
+	destination := func(c *gin.Context) string {
+		path := c.Request.URL.Path
+		switch {
+		case fallback.Enabled && strings.HasPrefix(path, fallback.PathPrefix):
+			return noRouteDefault
+		case strings.HasPrefix(path, "/api/"):
+			return noRouteNotFound
+		}
+		return noRouteFrontend
+	}
+	// only runs h for requests headed to dest; gin moves on to the next handler otherwise
+	only := func(dest string, h gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			if destination(c) == dest {
+				h(c)
+			}
+		}
+	}
+
+	var chain []gin.HandlerFunc
+	if fallback.Enabled {
+		fallbackChain := authChain(cfg, fallback.Auth, nil, nil)
+		if quota != nil && fallback.Auth != "none" {
+			fallbackChain = append(fallbackChain, quota)
+		}
+		fallbackChain = append(fallbackChain, proxy.ProxyToService(fallback.Service))
+		for _, h := range fallbackChain {
+			chain = append(chain, only(noRouteDefault, h))
+		}
+	}
+	chain = append(chain, only(noRouteNotFound, handlers.NotFound))
+	if cfg.CSP.Enabled {
+		chain = append(chain, only(noRouteFrontend, middleware.CSPNonce(cfg)))
+	}
+	chain = append(chain, only(noRouteFrontend, proxy.ProxyWithWebSocket("frontend")))
+	router.NoRoute(chain...)
+}
+
+// logRouteSummary logs a single summary of the registered routes instead of one
+// line per route, keeping startup logs readable with large route tables
+func logRouteSummary(router *gin.Engine, logger *zap.Logger) {
+	routes := router.Routes()
+	byMethod := make(map[string]int)
+	for _, route := range routes {
+		byMethod[route.Method]++
+	}
+
+	fields := []zap.Field{zap.Int("routes", len(routes))}
+	for method, count := range byMethod {
+		fields = append(fields, zap.Int(strings.ToLower(method), count))
+	}
+	logger.Info("Routes registered", fields...)
 }
@@ -0,0 +1,597 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/api-gateway/config"
+	"github.com/api-gateway/handlers"
+	"github.com/api-gateway/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newGatewayRouter sets up the routes of cfg on a router behind the global middleware
+func newGatewayRouter(t *testing.T, cfg *config.Config, components Components, global ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(global...)
+	proxy := SetupRoutes(router, cfg, zap.NewNop(), components)
+	t.Cleanup(proxy.Close)
+	return router
+}
+
+// startGateway serves the routes of cfg over HTTP, as proxying to backends requires
+func startGateway(t *testing.T, cfg *config.Config, components Components, global ...gin.HandlerFunc) *httptest.Server {
+	gateway := httptest.NewServer(newGatewayRouter(t, cfg, components, global...))
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+// setRequestHeaders sets token as the request's bearer credentials when set, and the
+// given header name and value pairs
+func setRequestHeaders(req *http.Request, token string, headers ...string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+}
+
+// serveRequest serves a request with the token and headers of setRequestHeaders on the router
+func serveRequest(router http.Handler, method, path, token string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	setRequestHeaders(req, token, headers...)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// gatewayResponse is a response received through the gateway
+type gatewayResponse struct {
+	Code   int
+	Header http.Header
+	Body   string
+}
+
+// sendRequest sends a request with the token and headers of setRequestHeaders through the
+// gateway and reads the response
+func sendRequest(t *testing.T, gateway *httptest.Server, method, path, token, body string, headers ...string) gatewayResponse {
+	req, _ := http.NewRequest(method, gateway.URL+path, strings.NewReader(body))
+	setRequestHeaders(req, token, headers...)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return gatewayResponse{Code: resp.StatusCode, Header: resp.Header, Body: string(respBody)}
+}
+
+// largeRouteConfig builds a configuration with n services and n composite routes
+func largeRouteConfig(n int) *config.Config {
+	cfg := &config.Config{
+		JWT:              config.JWTConfig{SecretKey: "test-secret"},
+		Services:         make(map[string]config.ServiceEndpoint, n),
+		ExternalServices: map[string]config.ExternalServiceEndpoint{},
+	}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("service-%d", i)
+		cfg.Services[name] = config.ServiceEndpoint{BaseURL: fmt.Sprintf("http://%s:8080", name)}
+		cfg.Composites = append(cfg.Composites, config.CompositeRoute{
+			Path: fmt.Sprintf("/composite/%d/:id", i),
+			Requests: []config.CompositeRequest{
+				{Key: "item", Service: name, Path: "/items/:id"},
+			},
+		})
+	}
+	return cfg
+}
+
+func TestSetupRoutesLargeRouteTable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const n = 5000
+	cfg := largeRouteConfig(n)
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	router := gin.New()
+
+	start := time.Now()
+	SetupRoutes(router, cfg, zap.New(core), Components{})
+	elapsed := time.Since(start)
+
+	assert.Less(t, elapsed, 5*time.Second)
+	assert.GreaterOrEqual(t, len(router.Routes()), n)
+
+	// Startup logs a handful of summary lines rather than one per route or service
+	assert.Less(t, logs.Len(), 10)
+	summary := logs.FilterMessage("Routes registered").All()
+	if assert.Len(t, summary, 1) {
+		assert.EqualValues(t, len(router.Routes()), summary[0].ContextMap()["routes"])
+	}
+	proxies := logs.FilterMessage("Initialized service proxies").All()
+	if assert.Len(t, proxies, 1) {
+		assert.EqualValues(t, n, proxies[0].ContextMap()["services"])
+	}
+}
+
+func BenchmarkSetupRoutes(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	cfg := largeRouteConfig(2000)
+	logger := zap.NewNop()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		SetupRoutes(gin.New(), cfg, logger, Components{})
+	}
+}
+
+func TestRouteTableEnforcesRoles(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		JWT:      config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour},
+		Services: map[string]config.ServiceEndpoint{"reports": {BaseURL: backend.URL}},
+		Routes: []config.RouteConfig{
+			{Method: "GET", Path: "/reports/:id", Service: "reports", TargetPath: "/v2/reports/:id", Roles: []string{"admin"}},
+			{Method: "ANY", Path: "/public/*path", Service: "reports", Auth: "none"},
+			// Beside the built-in /api/v1 routes, which validation keeps clear of
+			{Method: "GET", Path: "/api/v1/reports/:id", Service: "reports", Auth: "none"},
+		},
+	}
+
+	gateway := startGateway(t, cfg, Components{})
+
+	adminToken, _ := middleware.GenerateToken("1", "admin@example.com", []string{"admin"}, cfg)
+	userToken, _ := middleware.GenerateToken("2", "user@example.com", []string{"user"}, cfg)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"admin allowed", "GET", "/reports/7", adminToken, http.StatusOK, "GET /v2/reports/7"},
+		{"missing role", "GET", "/reports/7", userToken, http.StatusForbidden, ""},
+		{"unauthenticated", "GET", "/reports/7", "", http.StatusUnauthorized, ""},
+		{"public any method", "DELETE", "/public/cache", "", http.StatusOK, "DELETE /cache"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := sendRequest(t, gateway, tt.method, tt.path, tt.token, "")
+			assert.Equal(t, tt.wantStatus, resp.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, resp.Body)
+			}
+		})
+	}
+}
+
+func TestRouteTableAuthSchemes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The gateway keeps the key to itself and forwards who it authenticated
+		w.Write([]byte(r.Header.Get(middleware.APIKeyHeader) + "|" + r.Header.Get(handlers.UserIDHeader) + "|" + r.Header.Get(handlers.AuthSchemeHeader)))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		JWT:     config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour},
+		OpenAPI: config.OpenAPIConfig{Enabled: true},
+		Auth: config.AuthConfig{APIKeys: []config.APIKeyCredential{
+			{Key: "batch-key", AuthPrincipal: config.AuthPrincipal{UserID: "billing-batch"}},
+		}},
+		Services: map[string]config.ServiceEndpoint{"invoices": {BaseURL: backend.URL}},
+		Routes: []config.RouteConfig{
+			{Method: "GET", Path: "/invoices", Service: "invoices", AuthSchemes: []string{"jwt", "api_key"}},
+			{Method: "POST", Path: "/invoices", Service: "invoices"},
+		},
+	}
+
+	router := newGatewayRouter(t, cfg, Components{})
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	// Either scheme authenticates on the route declaring both
+	token, _ := middleware.GenerateToken("1", "user@example.com", nil, cfg)
+	resp := sendRequest(t, gateway, "GET", "/invoices", token, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "|1|jwt", resp.Body)
+	resp = sendRequest(t, gateway, "GET", "/invoices", "", "", middleware.APIKeyHeader, "batch-key")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "|billing-batch|api_key", resp.Body)
+
+	resp = sendRequest(t, gateway, "GET", "/invoices", "", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Len(t, resp.Header.Values("WWW-Authenticate"), 2)
+
+	// Routes not declaring schemes take tokens only
+	resp = sendRequest(t, gateway, "POST", "/invoices", "", "", middleware.APIKeyHeader, "batch-key")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	w := serveRequest(router, "GET", "/openapi.json", "")
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Security    []map[string][]string `json:"security"`
+			AuthSchemes []string              `json:"x-auth-schemes"`
+		}
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	list := doc.Paths["/invoices"]["get"]
+	assert.Equal(t, []map[string][]string{{"bearerAuth": {}}, {"apiKeyAuth": {}}}, list.Security)
+	assert.Equal(t, []string{"jwt", "api_key"}, list.AuthSchemes)
+	assert.Empty(t, doc.Paths["/invoices"]["post"].AuthSchemes)
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	cfg := &config.Config{
+		JWT:      config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour},
+		OpenAPI:  config.OpenAPIConfig{Enabled: true, Title: "Test Gateway", Version: "1.2.3"},
+		Services: map[string]config.ServiceEndpoint{"reports": {BaseURL: "http://reports:8080"}},
+		Routes: []config.RouteConfig{
+			{Method: "GET", Path: "/reports/:id", Service: "reports", Roles: []string{"auditor"}},
+			{Method: "POST", Path: "/feedback", Service: "reports", Auth: "optional"},
+			{Method: "DELETE", Path: "/reports/:id", Service: "reports", Scopes: []string{"reports:delete", "reports:admin"}, ScopeMode: "any"},
+		},
+	}
+
+	router := newGatewayRouter(t, cfg, Components{})
+
+	// Scoped routes of the table are enforced
+	token, _ := middleware.GenerateToken("1", "user@example.com", nil, cfg)
+	w := serveRequest(router, "DELETE", "/reports/1", token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "INSUFFICIENT_SCOPE")
+
+	w = serveRequest(router, "GET", "/openapi.json", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Info       struct{ Title string }
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			SecuritySchemes map[string]map[string]string `json:"securitySchemes"`
+		}
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Equal(t, "Test Gateway", doc.Info.Title)
+	assert.Equal(t, "bearer", doc.Components.SecuritySchemes["bearerAuth"]["scheme"])
+
+	operation := func(path, method string) map[string]interface{} {
+		raw, ok := doc.Paths[path][method]
+		if !assert.True(t, ok, "%s %s missing from spec", method, path) {
+			return nil
+		}
+		var op map[string]interface{}
+		assert.NoError(t, json.Unmarshal(raw, &op))
+		return op
+	}
+
+	reports := operation("/reports/{id}", "get")
+	assert.Equal(t, []interface{}{map[string]interface{}{"bearerAuth": []interface{}{}}}, reports["security"])
+	assert.Equal(t, []interface{}{"auditor"}, reports["x-required-roles"])
+	assert.Equal(t, "id", reports["parameters"].([]interface{})[0].(map[string]interface{})["name"])
+
+	deleteReport := operation("/reports/{id}", "delete")
+	assert.Equal(t, []interface{}{"reports:delete", "reports:admin"}, deleteReport["x-required-scopes"])
+	assert.Equal(t, "any", deleteReport["x-scope-mode"])
+
+	feedback := operation("/feedback", "post")
+	assert.Len(t, feedback["security"], 2)
+
+	admin := operation("/api/v1/admin/services/{name}", "delete")
+	assert.Equal(t, []interface{}{"admin"}, admin["x-required-roles"])
+
+	health := operation("/health", "get")
+	assert.NotContains(t, health, "security")
+	// Access is recorded with the middleware of each group
+	assert.Equal(t, []interface{}{"admin"}, operation("/health/detailed", "get")["x-required-roles"])
+	assert.NotContains(t, operation("/api/v1/public/status", "get"), "security")
+	assert.Contains(t, operation("/api/v1/services/{service}/{path}", "post"), "security")
+
+	w = serveRequest(router, "GET", "/docs", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "/openapi.json")
+}
+
+func TestOpenAPIDisabled(t *testing.T) {
+	router := newGatewayRouter(t, &config.Config{JWT: config.JWTConfig{SecretKey: "test-secret"}}, Components{})
+	for _, route := range router.Routes() {
+		assert.NotEqual(t, "/openapi.json", route.Path)
+	}
+}
+
+func TestMethodNotAllowedAndPreflight(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{SecretKey: "test-secret"},
+		CORS: config.CORSConfig{
+			AllowOrigins: []string{"https://app.example.com"},
+			AllowMethods: []string{"GET", "POST", "DELETE"},
+			AllowHeaders: []string{"Authorization", "Content-Type"},
+		},
+	}
+
+	corsPolicy := middleware.NewCORSPolicy(cfg)
+	router := newGatewayRouter(t, cfg, Components{CORSPolicy: corsPolicy}, corsPolicy.Middleware())
+
+	// /health only accepts GET
+	w := serveRequest(router, "DELETE", "/health", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Contains(t, w.Header().Get("Allow"), "GET")
+	var body map[string]string
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body)) {
+		assert.Equal(t, "Method Not Allowed", body["error"])
+		assert.Equal(t, "METHOD_NOT_ALLOWED", body["code"])
+	}
+
+	// A preflight for the same path is answered by CORS before the method check
+	w = serveRequest(router, "OPTIONS", "/health", "", "Origin", "https://app.example.com", "Access-Control-Request-Method", "GET")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSPolicyPerGroup(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{SecretKey: "test-secret"},
+		CORS: config.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{"GET", "POST"},
+			Policies: map[string]config.CORSConfig{
+				"admin": {AllowOrigins: []string{"https://console.example.com"}, AllowCredentials: true},
+			},
+		},
+	}
+
+	corsPolicy := middleware.NewCORSPolicy(cfg)
+	router := newGatewayRouter(t, cfg, Components{CORSPolicy: corsPolicy}, corsPolicy.Middleware())
+	preflight := func(path, origin string) *httptest.ResponseRecorder {
+		return serveRequest(router, "OPTIONS", path, "", "Origin", origin, "Access-Control-Request-Method", "GET")
+	}
+
+	// The public group has no policy of its own and uses the global one
+	w := preflight("/api/v1/public/status", "https://app.example.com")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = preflight("/api/v1/admin/services", "https://console.example.com")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://console.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET,POST", w.Header().Get("Access-Control-Allow-Methods"), "methods default to the global policy")
+
+	w = preflight("/api/v1/admin/services", "https://app.example.com")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Paths merely sharing the prefix are not part of the group
+	w = preflight("/api/v1/administrators", "https://app.example.com")
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestDetailedHealthRequiresAdmin(t *testing.T) {
+	cfg := &config.Config{JWT: config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour}}
+	router := newGatewayRouter(t, cfg, Components{})
+
+	adminToken, _ := middleware.GenerateToken("1", "admin@example.com", []string{"admin"}, cfg)
+	userToken, _ := middleware.GenerateToken("2", "user@example.com", []string{"user"}, cfg)
+
+	for token, want := range map[string]int{"": http.StatusUnauthorized, userToken: http.StatusForbidden, adminToken: http.StatusOK} {
+		assert.Equal(t, want, serveRequest(router, "GET", "/health/detailed", token).Code)
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		JWT:      config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour},
+		Services: map[string]config.ServiceEndpoint{"orders": {BaseURL: backend.URL}},
+		Routes:   []config.RouteConfig{{Method: "GET", Path: "/orders", Service: "orders", Auth: "none"}},
+		Maintenance: config.MaintenanceConfig{
+			ExemptPaths: []string{"/health", "/api/v1/admin"},
+		},
+	}
+
+	maintenance := middleware.NewMaintenance(cfg.Maintenance)
+	gateway := startGateway(t, cfg, Components{Maintenance: maintenance}, maintenance.Middleware())
+	adminToken, _ := middleware.GenerateToken("1", "admin@example.com", []string{"admin"}, cfg)
+
+	assert.Equal(t, http.StatusOK, sendRequest(t, gateway, "GET", "/orders", "", "").Code)
+
+	resp := sendRequest(t, gateway, "POST", "/api/v1/admin/maintenance", adminToken, `{"enabled": true, "message": "Deploying", "retry_after": 120}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = sendRequest(t, gateway, "GET", "/orders", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "120", resp.Header.Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, sendRequest(t, gateway, "GET", "/health", "", "").Code)
+	assert.Equal(t, http.StatusOK, sendRequest(t, gateway, "GET", "/api/v1/admin/maintenance", adminToken, "").Code)
+
+	sendRequest(t, gateway, "POST", "/api/v1/admin/maintenance", adminToken, `{"enabled": false}`)
+	assert.Equal(t, http.StatusOK, sendRequest(t, gateway, "GET", "/orders", "", "").Code)
+}
+
+func TestAdminConfigRedactsSecrets(t *testing.T) {
+	cfg := &config.Config{
+		JWT:   config.JWTConfig{SecretKey: "test-secret", PreviousSecrets: []string{"old-secret"}, TokenDuration: time.Hour},
+		Redis: config.RedisConfig{Host: "redis", Password: "redis-password"},
+	}
+
+	router := newGatewayRouter(t, cfg, Components{})
+
+	adminToken, _ := middleware.GenerateToken("1", "admin@example.com", []string{"admin"}, cfg)
+	userToken, _ := middleware.GenerateToken("2", "user@example.com", []string{"user"}, cfg)
+	assert.Equal(t, http.StatusUnauthorized, serveRequest(router, "GET", "/api/v1/admin/config", "").Code)
+	assert.Equal(t, http.StatusForbidden, serveRequest(router, "GET", "/api/v1/admin/config", userToken).Code)
+
+	w := serveRequest(router, "GET", "/api/v1/admin/config", adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "test-secret")
+	assert.NotContains(t, w.Body.String(), "old-secret")
+	assert.NotContains(t, w.Body.String(), "redis-password")
+
+	var body struct {
+		Config struct {
+			JWT   map[string]interface{} `json:"jwt"`
+			Redis map[string]interface{} `json:"redis"`
+		} `json:"config"`
+		RestartRequired []string `json:"restart_required"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, config.RedactedValue, body.Config.JWT["secret_key"])
+	assert.Equal(t, []interface{}{config.RedactedValue}, body.Config.JWT["previous_secrets"])
+	assert.Equal(t, "1h0m0s", body.Config.JWT["token_duration"])
+	assert.Equal(t, config.RedactedValue, body.Config.Redis["password"])
+	assert.Equal(t, "redis", body.Config.Redis["host"])
+	assert.Empty(t, body.RestartRequired)
+}
+
+func TestRouteTableValidation(t *testing.T) {
+	var proxied atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Services: map[string]config.ServiceEndpoint{"orders": {BaseURL: backend.URL}},
+		Routes: []config.RouteConfig{{
+			Method: "POST", Path: "/orders", Service: "orders", Auth: "none",
+			Validation: config.RequestValidationConfig{ContentTypes: []string{"application/json"}},
+		}},
+	}
+
+	gateway := startGateway(t, cfg, Components{})
+	post := func(contentType string) int {
+		return sendRequest(t, gateway, "POST", "/orders", "", `{"item":1}`, "Content-Type", contentType).Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post("text/plain"))
+	assert.Equal(t, int32(0), proxied.Load(), "rejected requests must not reach the backend")
+	assert.Equal(t, http.StatusCreated, post("application/json"))
+	assert.Equal(t, int32(1), proxied.Load())
+}
+
+func TestDefaultRoute(t *testing.T) {
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("legacy " + r.Method + " " + r.URL.Path))
+	}))
+	defer legacy.Close()
+
+	jwt := config.JWTConfig{SecretKey: "test-secret", TokenDuration: time.Hour}
+	cfg := &config.Config{
+		JWT:          jwt,
+		Services:     map[string]config.ServiceEndpoint{"legacy": {BaseURL: legacy.URL}},
+		DefaultRoute: config.DefaultRouteConfig{Enabled: true, Service: "legacy", PathPrefix: "/api/v1/"},
+	}
+	gateway := startGateway(t, cfg, Components{})
+	token, _ := middleware.GenerateToken("1", "user@example.com", []string{"user"}, cfg)
+
+	// Unmatched API paths fall through to the legacy backend with method and path intact
+	resp := sendRequest(t, gateway, "DELETE", "/api/v1/projects/7", token, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "legacy DELETE /api/v1/projects/7", resp.Body)
+
+	// Behind the default route's authentication
+	assert.Equal(t, http.StatusUnauthorized, sendRequest(t, gateway, "GET", "/api/v1/projects/7", "", "").Code)
+
+	// Registered routes still win, and paths outside the prefix don't fall through
+	assert.Equal(t, http.StatusOK, sendRequest(t, gateway, "GET", "/api/v1/public/status", "", "").Code)
+	resp = sendRequest(t, gateway, "GET", "/api/v2/projects", token, "")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.NotContains(t, resp.Body, "legacy")
+
+	// Without a default route, unmatched API paths get the plain 404
+	gateway = startGateway(t, &config.Config{JWT: jwt, Services: cfg.Services}, Components{})
+	resp = sendRequest(t, gateway, "GET", "/api/v1/projects/7", token, "")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Contains(t, resp.Body, "The requested endpoint does not exist")
+}
+
+func TestHeadOnGetRoutesAndDisallowedMethods(t *testing.T) {
+	var backendMethod atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendMethod.Store(r.Method)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "11")
+		if r.Method != http.MethodHead {
+			w.Write([]byte("report body"))
+		}
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			AllowedMethods:    []string{"GET", "HEAD", "POST", "TRACE"},
+			DisallowedMethods: []string{"TRACE", "CONNECT"},
+		},
+		Services: map[string]config.ServiceEndpoint{"reports": {BaseURL: backend.URL}},
+		Routes: []config.RouteConfig{
+			{Method: "GET", Path: "/reports", Service: "reports", Auth: "none"},
+		},
+	}
+	gateway := startGateway(t, cfg, Components{}, middleware.MethodFilter(cfg))
+
+	// HEAD on a proxied GET route reaches the backend as HEAD, without a body
+	resp := sendRequest(t, gateway, "HEAD", "/reports", "", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "HEAD", backendMethod.Load())
+	assert.Equal(t, "11", resp.Header.Get("Content-Length"))
+	assert.Empty(t, resp.Body)
+
+	resp = sendRequest(t, gateway, "GET", "/reports", "", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "GET", backendMethod.Load())
+	assert.Equal(t, "report body", resp.Body)
+
+	// Built-in GET routes answer HEAD too
+	resp = sendRequest(t, gateway, "HEAD", "/health", "", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Body)
+
+	// TRACE is rejected globally, even though the allowlist names it
+	resp = sendRequest(t, gateway, "TRACE", "/reports", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+	assert.Equal(t, "GET, HEAD, POST", resp.Header.Get("Allow"))
+	assert.Contains(t, resp.Body, `"code":"METHOD_NOT_ALLOWED"`)
+	assert.Equal(t, "GET", backendMethod.Load())
+}
+
+func TestMetricsRestrictedToAllowedScrapers(t *testing.T) {
+	cfg := &config.Config{
+		JWT:     config.JWTConfig{SecretKey: "test-secret"},
+		Metrics: config.MetricsConfig{Prometheus: true, Path: "/metrics", Allow: []string{"127.0.0.1", "::1"}},
+	}
+	router := newGatewayRouter(t, cfg, Components{})
+	scrape := func(remoteAddr string) int {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, scrape("127.0.0.1:9090"))
+	assert.Equal(t, http.StatusForbidden, scrape("203.0.113.7:9090"))
+}